@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+func diffCommand() *cli.Command {
+	var (
+		paths         cli.StringSlice
+		estimate      bool
+		ctxSize       = 0
+		offloadLayers = -1
+		noMMap        bool
+		inJson        bool
+	)
+	return &cli.Command{
+		Name:      "diff",
+		Usage:     "Compare the metadata, tensors and estimates of two local GGUF files.",
+		UsageText: "diff --path a.gguf --path b.gguf [--estimate [--ctx-size 4096] [--gpu-layers 10] [--no-mmap]] [--json]",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Destination: &paths,
+				Value:       &paths,
+				Name:        "path",
+				Aliases:     []string{"model", "m"},
+				Usage:       "Path where the GGUF file to compare, must be specified twice, e.g. --path a.gguf --path b.gguf.",
+				Required:    true,
+			},
+			&cli.BoolFlag{
+				Destination: &estimate,
+				Value:       estimate,
+				Name:        "estimate",
+				Usage:       "Compare the llama.cpp run estimates side by side.",
+			},
+			&cli.IntFlag{
+				Destination: &ctxSize,
+				Value:       ctxSize,
+				Name:        "ctx-size",
+				Aliases:     []string{"c"},
+				Usage: "Specify the size of prompt context for \"--estimate\", " +
+					"default is equal to the model's maximum context size.",
+			},
+			&cli.IntFlag{
+				Destination: &offloadLayers,
+				Value:       offloadLayers,
+				Name:        "gpu-layers",
+				Aliases:     []string{"ngl", "n-gpu-layers"},
+				Usage: "Specify how many layers of the model to offload for \"--estimate\", " +
+					"default is full offloaded.",
+			},
+			&cli.BoolFlag{
+				Destination: &noMMap,
+				Value:       noMMap,
+				Name:        "no-mmap",
+				Usage:       "Specify disabling Memory-Mapped using for \"--estimate\".",
+			},
+			&cli.BoolFlag{
+				Destination: &inJson,
+				Value:       inJson,
+				Name:        "json",
+				Usage:       "Output as JSON.",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			ps := paths.Value()
+			if len(ps) != 2 {
+				return errors.New("--path must be specified twice")
+			}
+			gfs := make([]*GGUFFile, len(ps))
+			for i := range ps {
+				gf, err := ParseGGUFFile(ps[i], SkipLargeMetadata())
+				if err != nil {
+					return fmt.Errorf("failed to parse GGUF file %s: %w", ps[i], err)
+				}
+				gfs[i] = gf
+			}
+
+			var dopts []GGUFDiffOption
+			if estimate {
+				var eopts []GGUFRunEstimateOption
+				if ctxSize > 0 {
+					eopts = append(eopts, WithLLaMACppContextSize(int32(ctxSize)))
+				}
+				if offloadLayers >= 0 {
+					eopts = append(eopts, WithLLaMACppOffloadLayers(uint64(offloadLayers)))
+				}
+				dopts = append(dopts, WithDiffLLaMACppRunEstimate(!noMMap, 0, 0, eopts...))
+			}
+			d := DiffGGUFFiles(gfs[0], gfs[1], dopts...)
+
+			if inJson {
+				enc := json.NewEncoder(os.Stdout)
+				if inPrettyJson {
+					enc.SetIndent("", "  ")
+				}
+				return enc.Encode(d)
+			}
+			printDiffTable(d)
+			return nil
+		},
+	}
+}
+
+func printDiffTable(d GGUFFileDiff) {
+	if len(d.Metadata) != 0 {
+		bd := make([][]any, len(d.Metadata))
+		for i, m := range d.Metadata {
+			bd[i] = []any{
+				string(m.Kind),
+				m.Key,
+				diffMetadataValue(m.A),
+				diffMetadataValue(m.B),
+			}
+		}
+		tprint("METADATA", [][]any{{"Kind", "Key", "A", "B"}}, bd)
+	}
+
+	if len(d.Tensors) != 0 {
+		bd := make([][]any, len(d.Tensors))
+		for i, ti := range d.Tensors {
+			bd[i] = append(append([]any{string(ti.Kind), ti.Name}, diffTensor(ti.A)...), diffTensor(ti.B)...)
+		}
+		tprint("TENSORS", [][]any{
+			{"Kind", "Name", "A", "A", "B", "B"},
+			{"Kind", "Name", "Type", "Dimensions", "Type", "Dimensions"},
+		}, bd)
+	}
+
+	tprint("MODEL", [][]any{{"", "A", "B", "Delta"}}, [][]any{
+		{"Size", d.ModelSize[0], d.ModelSize[1], diffDelta(d.ModelSizeDelta, GGUFBytesScalar(abs(d.ModelSizeDelta)))},
+		{"Parameters", d.ModelParameters[0], d.ModelParameters[1], diffDelta(d.ModelParametersDelta, GGUFParametersScalar(abs(d.ModelParametersDelta)))},
+		{"BPW", d.ModelBitsPerWeight[0], d.ModelBitsPerWeight[1], diffDelta(d.ModelBitsPerWeightDelta, sprintf("%.2f", abs(d.ModelBitsPerWeightDelta)))},
+	})
+
+	if d.Estimate == nil {
+		return
+	}
+	es := *d.Estimate
+	bd := [][]any{
+		{"Context Size", es[0].ContextSize, es[1].ContextSize},
+		{"Offload Layers", es[0].Items[0].OffloadLayers, es[1].Items[0].OffloadLayers},
+		{"Full Offloaded", es[0].Items[0].FullOffloaded, es[1].Items[0].FullOffloaded},
+		{"RAM UMA", es[0].Items[0].RAM.UMA, es[1].Items[0].RAM.UMA},
+		{"RAM NonUMA", es[0].Items[0].RAM.NonUMA, es[1].Items[0].RAM.NonUMA},
+	}
+	for i := 0; i < max(len(es[0].Items[0].VRAMs), len(es[1].Items[0].VRAMs)); i++ {
+		uma, nonUMA := []any{sprintf("VRAM %d UMA", i)}, []any{sprintf("VRAM %d NonUMA", i)}
+		for j := range es {
+			if vs := es[j].Items[0].VRAMs; i < len(vs) {
+				uma, nonUMA = append(uma, vs[i].UMA), append(nonUMA, vs[i].NonUMA)
+			} else {
+				uma, nonUMA = append(uma, "N/A"), append(nonUMA, "N/A")
+			}
+		}
+		bd = append(bd, uma, nonUMA)
+	}
+	tprint("ESTIMATE", [][]any{{"", "A", "B"}}, bd)
+}
+
+func diffMetadataValue(kv *GGUFMetadataKV) string {
+	if kv == nil {
+		return "N/A"
+	}
+	if kv.ValueType != GGUFMetadataValueTypeArray {
+		return sprintf("%s: %v", kv.ValueType, kv.Value)
+	}
+	av := kv.ValueArray()
+	return sprintf("%s: [%s; %d]", kv.ValueType, av.Type, av.Len)
+}
+
+func diffTensor(ti *GGUFTensorInfo) []any {
+	if ti == nil {
+		return []any{"N/A", "N/A"}
+	}
+	ds := make([]string, len(ti.Dimensions))
+	for j := range ti.Dimensions {
+		ds[j] = sprintf(ti.Dimensions[j])
+	}
+	return []any{ti.Type.String(), "[" + strings.Join(ds, ", ") + "]"}
+}
+
+func diffDelta[T int64 | float64](d T, s any) string {
+	switch {
+	case d > 0:
+		return "+" + sprintf(s)
+	case d < 0:
+		return "-" + sprintf(s)
+	}
+	return "0"
+}
+
+func abs[T int64 | float64](v T) T {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+func editCommand() *cli.Command {
+	var (
+		path    string
+		sets    cli.StringSlice
+		deletes cli.StringSlice
+		renames cli.StringSlice
+	)
+	return &cli.Command{
+		Name:      "edit",
+		Usage:     "Edit the metadata of a local GGUF file in place.",
+		UsageText: "edit --path model.gguf [--set key=type:value]... [--delete key]... [--rename old=new]...",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Destination: &path,
+				Value:       path,
+				Name:        "path",
+				Aliases:     []string{"model", "m"},
+				Usage:       "Path where the GGUF file to edit.",
+				Required:    true,
+			},
+			&cli.StringSliceFlag{
+				Destination: &sets,
+				Value:       &sets,
+				Name:        "set",
+				Usage: "Set the metadata in the form of \"key=type:value\", " +
+					"type selects from [uint8, int8, uint16, int16, uint32, int32, float32, bool, string, uint64, int64, float64], " +
+					"e.g. --set general.name=string:Qwen2 --set general.alignment=uint32:32.",
+			},
+			&cli.StringSliceFlag{
+				Destination: &deletes,
+				Value:       &deletes,
+				Name:        "delete",
+				Usage:       "Delete the metadata with the given key, e.g. --delete general.license.",
+			},
+			&cli.StringSliceFlag{
+				Destination: &renames,
+				Value:       &renames,
+				Name:        "rename",
+				Usage:       "Rename the metadata in the form of \"old=new\", e.g. --rename general.name=general.basename.",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			gf, err := ParseGGUFFile(path, UseRawStrings())
+			if err != nil {
+				return fmt.Errorf("failed to parse GGUF file: %w", err)
+			}
+
+			kvs := gf.Header.MetadataKV
+			for _, k := range deletes.Value() {
+				if !kvs.Delete(k) {
+					return fmt.Errorf("failed to delete metadata: key %s not found", k)
+				}
+			}
+			for _, s := range renames.Value() {
+				ok, nk, found := strings.Cut(s, "=")
+				if !found {
+					return fmt.Errorf("failed to rename metadata: invalid %q", s)
+				}
+				if err = kvs.Rename(ok, nk); err != nil {
+					return fmt.Errorf("failed to rename metadata: %w", err)
+				}
+			}
+			for _, s := range sets.Value() {
+				k, vt, v, err := parseMetadataKV(s)
+				if err != nil {
+					return fmt.Errorf("failed to set metadata: %w", err)
+				}
+				if err = kvs.Set(k, vt, v); err != nil {
+					return fmt.Errorf("failed to set metadata: %w", err)
+				}
+			}
+
+			shifted, err := RewriteGGUFFileMetadata(path, kvs)
+			if err != nil {
+				return fmt.Errorf("failed to rewrite GGUF file: %w", err)
+			}
+			fmt.Printf("Edited %s, tensor data %s.\n", path, tenary(shifted, "shifted", "untouched"))
+			return nil
+		},
+	}
+}
+
+// parseMetadataKV parses the given string in the form of "key=type:value".
+func parseMetadataKV(s string) (key string, vt GGUFMetadataValueType, value any, err error) {
+	key, tv, found := strings.Cut(s, "=")
+	if !found || key == "" {
+		return "", 0, nil, fmt.Errorf("invalid %q, want key=type:value", s)
+	}
+	t, v, found := strings.Cut(tv, ":")
+	if !found {
+		return "", 0, nil, fmt.Errorf("invalid %q, want key=type:value", s)
+	}
+
+	switch strings.ToLower(t) {
+	case "uint8":
+		vt = GGUFMetadataValueTypeUint8
+		var x uint64
+		x, err = strconv.ParseUint(v, 10, 8)
+		value = uint8(x)
+	case "int8":
+		vt = GGUFMetadataValueTypeInt8
+		var x int64
+		x, err = strconv.ParseInt(v, 10, 8)
+		value = int8(x)
+	case "uint16":
+		vt = GGUFMetadataValueTypeUint16
+		var x uint64
+		x, err = strconv.ParseUint(v, 10, 16)
+		value = uint16(x)
+	case "int16":
+		vt = GGUFMetadataValueTypeInt16
+		var x int64
+		x, err = strconv.ParseInt(v, 10, 16)
+		value = int16(x)
+	case "uint32":
+		vt = GGUFMetadataValueTypeUint32
+		var x uint64
+		x, err = strconv.ParseUint(v, 10, 32)
+		value = uint32(x)
+	case "int32":
+		vt = GGUFMetadataValueTypeInt32
+		var x int64
+		x, err = strconv.ParseInt(v, 10, 32)
+		value = int32(x)
+	case "float32":
+		vt = GGUFMetadataValueTypeFloat32
+		var x float64
+		x, err = strconv.ParseFloat(v, 32)
+		value = float32(x)
+	case "bool":
+		vt = GGUFMetadataValueTypeBool
+		value, err = strconv.ParseBool(v)
+	case "string":
+		vt = GGUFMetadataValueTypeString
+		value = v
+	case "uint64":
+		vt = GGUFMetadataValueTypeUint64
+		value, err = strconv.ParseUint(v, 10, 64)
+	case "int64":
+		vt = GGUFMetadataValueTypeInt64
+		value, err = strconv.ParseInt(v, 10, 64)
+	case "float64":
+		vt = GGUFMetadataValueTypeFloat64
+		value, err = strconv.ParseFloat(v, 64)
+	default:
+		return "", 0, nil, errors.New("unsupported type " + t)
+	}
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("invalid %s value %q: %w", t, v, err)
+	}
+	return key, vt, value, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+func fitCommand() *cli.Command {
+	var (
+		src             ggufSource
+		ram             string
+		vram            string
+		target          = "ctx"
+		minCtxSize      = 4096
+		maxCtxSize      int
+		cacheTypes      = "f16"
+		maxParallelSize = 1
+		deviceMetrics   cli.StringSlice
+		flashAttention  bool
+		noMMap          bool
+		inJson          bool
+	)
+	return &cli.Command{
+		Name:  "fit",
+		Usage: "Search the maximum context size and offload layers of running the GGUF file in llama.cpp within the memory budgets.",
+		UsageText: "fit [--path model.gguf | --url https://... | --hf-repo repo --hf-file model.gguf] --ram 64GiB [--vram 24GiB[,24GiB ...]] " +
+			"[--target ctx|throughput] [--min-ctx-size 4096] [--max-ctx-size 131072] [--cache-types f16,q8_0] " +
+			"[--max-parallel-size 1] [--device-metric 10TFLOPS;400GBps ...] [--flash-attention] [--no-mmap] [--json]\n\n" +
+			"The \"ctx\" target maximizes the context size, then the offload layers, " +
+			"the \"throughput\" target maximizes the estimated tokens per second with \"--device-metric\", " +
+			"otherwise the offload layers, then the parallel size and the context size.",
+		Flags: append(src.Flags(),
+			&cli.StringFlag{
+				Destination: &ram,
+				Name:        "ram",
+				Required:    true,
+				Usage:       "Available RAM, e.g. 64GiB.",
+			},
+			&cli.StringFlag{
+				Destination: &vram,
+				Name:        "vram",
+				Usage: "Available VRAM of each device, separated by commas, e.g. 24GiB,24GiB, " +
+					"no layers are offloaded if not specified.",
+			},
+			&cli.StringFlag{
+				Destination: &target,
+				Value:       target,
+				Name:        "target",
+				Usage:       "Target to maximize, select from [ctx, throughput].",
+			},
+			&cli.IntFlag{
+				Destination: &minCtxSize,
+				Value:       minCtxSize,
+				Name:        "min-ctx-size",
+				Usage: "Minimum context size to search, " +
+					"which is the context size each parallel sequence requires with \"--target throughput\".",
+			},
+			&cli.IntFlag{
+				Destination: &maxCtxSize,
+				Value:       maxCtxSize,
+				Name:        "max-ctx-size",
+				Usage:       "Maximum context size to search, 0 means the maximum context length of the model.",
+			},
+			&cli.StringFlag{
+				Destination: &cacheTypes,
+				Value:       cacheTypes,
+				Name:        "cache-types",
+				Usage: "Candidate types of the KV cache in the order of preference, separated by commas, " +
+					"select from [f32, f16, q8_0, q4_0, q4_1, iq4_nl, q5_0, q5_1].",
+			},
+			&cli.IntFlag{
+				Destination: &maxParallelSize,
+				Value:       maxParallelSize,
+				Name:        "max-parallel-size",
+				Usage:       "Maximum parallel size to search in the powers of 2, works with \"--target throughput\".",
+			},
+			&cli.StringSliceFlag{
+				Destination: &deviceMetrics,
+				Value:       &deviceMetrics,
+				Name:        "device-metric",
+				Usage: "Metric of each device in the form of \"FLOPS;Up Bandwidth[;Down Bandwidth]\", " +
+					"the first is the CPU and the rest are the devices of \"--vram\" in order, " +
+					"works with \"--target throughput\" to rank the candidates by the estimated tokens per second.",
+			},
+			&cli.BoolFlag{
+				Destination: &flashAttention,
+				Value:       flashAttention,
+				Name:        "flash-attention",
+				Aliases:     []string{"flash-attn", "fa"},
+				Usage:       "Enable flash attention, which is required by the quantized value cache.",
+			},
+			&cli.BoolFlag{
+				Destination: &noMMap,
+				Value:       noMMap,
+				Name:        "no-mmap",
+				Usage:       "Disable loading the model with mmap.",
+			},
+			&cli.BoolFlag{
+				Destination: &inJson,
+				Value:       inJson,
+				Name:        "json",
+				Usage:       "Output as JSON.",
+			},
+		),
+		Action: func(c *cli.Context) error {
+			budgets, err := parseFitBudgets(ram, vram)
+			if err != nil {
+				return err
+			}
+
+			fopts := []LLaMACppRunFitOption{
+				WithLLaMACppFitContextSizeRange(int32(minCtxSize), int32(maxCtxSize)),
+				WithLLaMACppFitMaxParallelSize(int32(maxParallelSize)),
+			}
+			switch target {
+			case "ctx":
+			case "throughput":
+				fopts = append(fopts, WithLLaMACppFitTarget(LLaMACppRunFitTargetThroughput))
+			default:
+				return fmt.Errorf("invalid target %q, select from [ctx, throughput]", target)
+			}
+			var ts []GGMLType
+			for _, s := range strings.Split(cacheTypes, ",") {
+				ts = append(ts, toGGMLType(strings.TrimSpace(s)))
+			}
+			fopts = append(fopts, WithLLaMACppFitCacheTypes(ts...))
+			if flashAttention {
+				fopts = append(fopts, WithLLaMACppFitEstimateOptions(WithFlashAttention()))
+			}
+			if dmss := deviceMetrics.Value(); len(dmss) > 0 {
+				dms, err := parseDeviceMetrics(dmss)
+				if err != nil {
+					return err
+				}
+				fopts = append(fopts, WithLLaMACppFitEstimateOptions(WithDeviceMetrics(dms)))
+			}
+			if noMMap {
+				fopts = append(fopts, WithoutLLaMACppFitMMap())
+			}
+
+			gf, _, err := src.Open(c.Context, false)
+			if err != nil {
+				return err
+			}
+			r, err := gf.FitLLaMACppRun(budgets, fopts...)
+			if err != nil {
+				return err
+			}
+
+			if inJson {
+				enc := json.NewEncoder(os.Stdout)
+				if inPrettyJson {
+					enc.SetIndent("", "  ")
+				}
+				return enc.Encode(r)
+			}
+
+			emi := r.Summary.Items[0]
+			hd := []any{
+				"Context Size",
+				"Offload Layers",
+				"Cache Type K / V",
+				"Parallel Size",
+				"RAM",
+			}
+			bd := []any{
+				sprintf(r.ContextSize),
+				sprintf(tenary(r.FullOffloaded, sprintf("%d (%d + 1)", r.OffloadLayers, r.OffloadLayers-1), r.OffloadLayers)),
+				sprintf("%s / %s", r.CacheKeyType, r.CacheValueType),
+				sprintf(r.ParallelSize),
+				sprintf("%s / %s", emi.RAM.NonUMA, budgets[0].Memory),
+			}
+			for i, v := range emi.VRAMs {
+				if i+1 >= len(budgets) {
+					break
+				}
+				hd = append(hd, sprintf("VRAM %d", i))
+				bd = append(bd, sprintf("%s / %s", v.NonUMA, budgets[i+1].Memory))
+			}
+			tprint("FIT", [][]any{hd}, [][]any{bd})
+
+			args := []string{
+				sprintf("--ctx-size %d", r.ContextSize),
+				sprintf("--gpu-layers %d", r.OffloadLayers),
+				sprintf("--cache-type-k %s", strings.ToLower(r.CacheKeyType.String())),
+				sprintf("--cache-type-v %s", strings.ToLower(r.CacheValueType.String())),
+				sprintf("--parallel %d", r.ParallelSize),
+			}
+			if r.Summary.FlashAttention {
+				args = append(args, "--flash-attn")
+			}
+			if len(budgets) > 2 {
+				ss := make([]string, len(budgets)-1)
+				for i := range ss {
+					ss[i] = sprintf(uint64(budgets[i+1].Memory) >> 20)
+				}
+				args = append(args, "--tensor-split "+strings.Join(ss, ","))
+			}
+			fmt.Printf("llama.cpp arguments: %s\n", strings.Join(args, " "))
+			return nil
+		},
+	}
+}
+
+// parseFitBudgets parses the RAM and the comma separated VRAMs into the device budgets.
+func parseFitBudgets(ram, vram string) ([]GGUFRunDeviceBudget, error) {
+	ss := []string{ram}
+	if vram != "" {
+		ss = append(ss, strings.Split(vram, ",")...)
+	}
+	budgets := make([]GGUFRunDeviceBudget, 0, len(ss))
+	for _, s := range ss {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, errors.New("empty memory budget")
+		}
+		m, err := ParseGGUFBytesScalar(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory budget %q: %w", s, err)
+		}
+		budgets = append(budgets, GGUFRunDeviceBudget{Memory: m})
+	}
+	return budgets, nil
+}
@@ -10,6 +10,8 @@ require (
 	github.com/gpustack/gguf-parser-go v0.6.0
 	github.com/jedib0t/go-pretty/v6 v6.6.1
 	github.com/urfave/cli/v2 v2.27.5
+	golang.org/x/sync v0.9.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -27,8 +29,8 @@ require (
 	golang.org/x/crypto v0.29.0 // indirect
 	golang.org/x/exp v0.0.0-20241108190413-2d47ceb2692f // indirect
 	golang.org/x/mod v0.22.0 // indirect
-	golang.org/x/sync v0.9.0 // indirect
 	golang.org/x/sys v0.27.0 // indirect
+	golang.org/x/text v0.20.0 // indirect
 	golang.org/x/tools v0.27.0 // indirect
 	gonum.org/v1/gonum v0.15.1 // indirect
 )
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+// Exit codes of the hash command,
+// 1 is reserved for the failure of loading the GGUF file.
+const (
+	hashExitCodeMismatched = 2
+)
+
+func hashCommand() *cli.Command {
+	var (
+		src     ggufSource
+		tensors bool
+		verify  bool
+		compare string
+		inJson  bool
+	)
+	return &cli.Command{
+		Name:  "hash",
+		Usage: "Compute the sha256 of a GGUF file and its tensors, and verify the integrity.",
+		UsageText: "hash [--path model.gguf | --url https://... | --hf-repo repo --hf-file model.gguf] " +
+			"[--tensors [--compare manifest.json]] [--verify] [--json]\n\n" +
+			"Exit with 0 if verified, 1 if failed to load the file, 2 if the hashes mismatched.",
+		Flags: append(src.Flags(),
+			&cli.BoolFlag{
+				Destination: &tensors,
+				Value:       tensors,
+				Name:        "tensors",
+				Usage:       "Compute the sha256 of the data of each tensor.",
+			},
+			&cli.StringFlag{
+				Destination: &compare,
+				Value:       compare,
+				Name:        "compare",
+				Usage: "Path where the JSON output of another \"hash --tensors --json\" to compare, " +
+					"the different tensors are reported, works with \"--tensors\".",
+			},
+			&cli.BoolFlag{
+				Destination: &verify,
+				Value:       verify,
+				Name:        "verify",
+				Usage: "Verify the sha256 of the (split) files against the LFS oid of the HuggingFace repository, " +
+					"works with \"--hf-repo/--hf-file\" pair.",
+			},
+			&cli.BoolFlag{
+				Destination: &inJson,
+				Value:       inJson,
+				Name:        "json",
+				Usage:       "Output as JSON.",
+			},
+		),
+		Action: func(c *cli.Context) error {
+			if verify && (src.hfRepo == "" || src.hfFile == "") {
+				return errors.New("--verify works with --hf-repo/--hf-file pair")
+			}
+			if compare != "" && !tensors {
+				return errors.New("--compare works with --tensors")
+			}
+
+			gf, srcs, err := src.Open(c.Context, true)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = srcs.Close() }()
+
+			type file struct {
+				Name     string `json:"name"`
+				SHA256   string `json:"sha256"`
+				Expected string `json:"expected,omitempty"`
+			}
+			o := struct {
+				Files []file `json:"files"`
+				GGUFTensorHashManifest
+				Differences []GGUFTensorHashDiff `json:"differences,omitempty"`
+			}{}
+
+			hs, err := gf.FileHashes(srcs.ReaderAts()...)
+			if err != nil {
+				return fmt.Errorf("failed to hash GGUF file: %w", err)
+			}
+			names := []string{hashSourceName(src)}
+			if len(hs) > 1 {
+				names = CompleteShardGGUFFilename(names[0])
+			}
+			o.Files = make([]file, len(hs))
+			for i := range hs {
+				o.Files[i] = file{Name: names[i], SHA256: hs[i]}
+			}
+
+			mismatched := false
+			if verify {
+				var ropts []GGUFReadOption
+				if src.hfToken != "" {
+					ropts = append(ropts, UseBearerAuth(src.hfToken))
+				}
+				hfFiles := []string{src.hfFile}
+				if len(hs) > 1 {
+					hfFiles = CompleteShardGGUFFilename(src.hfFile)
+				}
+				for i := range o.Files {
+					oid, err := GetHuggingFaceLFSOid(c.Context, src.hfRepo, hfFiles[i], ropts...)
+					if err != nil {
+						return fmt.Errorf("failed to get LFS oid: %w", err)
+					}
+					o.Files[i].Expected = oid
+					mismatched = mismatched || !strings.EqualFold(oid, o.Files[i].SHA256)
+				}
+			}
+
+			if tensors {
+				o.GGUFTensorHashManifest, err = gf.TensorHashes(srcs.ReaderAts()...)
+				if err != nil {
+					return fmt.Errorf("failed to hash tensors: %w", err)
+				}
+				if compare != "" {
+					bs, err := os.ReadFile(compare)
+					if err != nil {
+						return fmt.Errorf("failed to read manifest: %w", err)
+					}
+					var m GGUFTensorHashManifest
+					if err = json.Unmarshal(bs, &m); err != nil {
+						return fmt.Errorf("failed to parse manifest: %w", err)
+					}
+					o.Differences = m.Diff(o.GGUFTensorHashManifest)
+					mismatched = mismatched || len(o.Differences) != 0
+				}
+			}
+
+			if inJson {
+				enc := json.NewEncoder(os.Stdout)
+				if inPrettyJson {
+					enc.SetIndent("", "  ")
+				}
+				if err = enc.Encode(o); err != nil {
+					return err
+				}
+			} else {
+				bd := make([][]any, len(o.Files))
+				for i, f := range o.Files {
+					bd[i] = []any{
+						f.Name,
+						f.SHA256,
+						tenary(verify, tenary(strings.EqualFold(f.Expected, f.SHA256), "verified", "mismatched: "+f.Expected), "N/A"),
+					}
+				}
+				tprint("FILES", [][]any{{"Name", "SHA256", "Verification"}}, bd)
+
+				if tensors {
+					bd = make([][]any, len(o.Tensors))
+					for i, t := range o.Tensors {
+						bd[i] = []any{i, t.Name, t.Type.String(), GGUFBytesScalar(t.Size), t.SHA256}
+					}
+					tprint("TENSORS", [][]any{{"#", "Name", "Type", "Size", "SHA256"}}, bd)
+				}
+				if len(o.Differences) != 0 {
+					bd = make([][]any, len(o.Differences))
+					for i, d := range o.Differences {
+						bd[i] = []any{string(d.Kind), d.Name, tenary(d.A != "", d.A, "N/A"), tenary(d.B != "", d.B, "N/A")}
+					}
+					tprint("DIFFERENCES", [][]any{{"Kind", "Name", "Expected", "Actual"}}, bd)
+				}
+			}
+
+			if mismatched {
+				return cli.Exit("Hashed, mismatched.", hashExitCodeMismatched)
+			}
+			if !inJson && (verify || compare != "") {
+				fmt.Println("Hashed, verified.")
+			}
+			return nil
+		},
+	}
+}
+
+// hashSourceName returns the file name of the given ggufSource.
+func hashSourceName(src ggufSource) string {
+	switch {
+	case src.path != "":
+		return filepath.Base(src.path)
+	case src.url != "":
+		return filepath.Base(src.url)
+	}
+	return filepath.Base(src.hfFile)
+}
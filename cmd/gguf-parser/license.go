@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+// licenseExitCodeViolated is the exit code when the license violates the policy.
+const licenseExitCodeViolated = 2
+
+// loadLicensePolicy loads the LicensePolicy from the given YAML or JSON file.
+func loadLicensePolicy(path string) (LicensePolicy, error) {
+	var p LicensePolicy
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return p, fmt.Errorf("failed to read license policy: %w", err)
+	}
+	if err = yaml.Unmarshal(bs, &p); err != nil {
+		return p, fmt.Errorf("failed to parse license policy: %w", err)
+	}
+	if len(p.Allow) == 0 && len(p.Deny) == 0 {
+		return p, fmt.Errorf("license policy %q has neither allow nor deny list", path)
+	}
+	return p, nil
+}
+
+// checkLicensePolicy checks the license of the model against the policy file,
+// the license is selected from the "general.license", "general.license.name",
+// or the license texts of the Ollama model in order.
+func checkLicensePolicy(path string, m GGUFMetadata, olLicenses []string) error {
+	p, err := loadLicensePolicy(path)
+	if err != nil {
+		return err
+	}
+
+	license := m.License
+	if license == "" {
+		license = m.LicenseName
+	}
+	if license == "" && len(olLicenses) > 0 {
+		ls := make([]string, len(olLicenses))
+		for i := range olLicenses {
+			if ls[i], err = NormalizeLicense(olLicenses[i]); err != nil {
+				return cli.Exit(fmt.Sprintf("license violates the policy: %v", err), licenseExitCodeViolated)
+			}
+			if strings.ContainsAny(ls[i], " ") {
+				ls[i] = "(" + ls[i] + ")"
+			}
+		}
+		license = strings.Join(ls, " AND ")
+	}
+
+	r := p.Evaluate(license)
+	if !r.Allowed {
+		return cli.Exit(fmt.Sprintf("license %q violates the policy: %s", r.License, strings.Join(r.Violations, "; ")),
+			licenseExitCodeViolated)
+	}
+	return nil
+}
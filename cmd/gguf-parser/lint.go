@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+// Exit codes of the lint command,
+// 1 is reserved for the failure of loading the GGUF file.
+const (
+	lintExitCodeError   = 2
+	lintExitCodeWarning = 3
+)
+
+func lintCommand() *cli.Command {
+	var (
+		src    ggufSource
+		strict bool
+		inJson bool
+	)
+	return &cli.Command{
+		Name:  "lint",
+		Usage: "Validate the structure of a GGUF file.",
+		UsageText: "lint [--path model.gguf | --url https://... | --hf-repo repo --hf-file model.gguf] [--strict] [--json]\n\n" +
+			"Exit with 0 if no errors found, 1 if failed to load the file, 2 if errors found, " +
+			"3 if warnings found with \"--strict\".",
+		Flags: append(src.Flags(),
+			&cli.BoolFlag{
+				Destination: &strict,
+				Value:       strict,
+				Name:        "strict",
+				Usage:       "Treat warnings as failures.",
+			},
+			&cli.BoolFlag{
+				Destination: &inJson,
+				Value:       inJson,
+				Name:        "json",
+				Usage:       "Output as JSON.",
+			},
+		),
+		Action: func(c *cli.Context) error {
+			gf, _, err := src.Open(c.Context, false)
+			if err != nil {
+				return err
+			}
+
+			fs := gf.Validate()
+			if fs == nil {
+				fs = GGUFValidationFindings{}
+			}
+			if inJson {
+				enc := json.NewEncoder(os.Stdout)
+				if inPrettyJson {
+					enc.SetIndent("", "  ")
+				}
+				if err = enc.Encode(fs); err != nil {
+					return err
+				}
+			} else if len(fs) != 0 {
+				bd := make([][]any, len(fs))
+				for i, f := range fs {
+					bd[i] = []any{
+						string(f.Severity),
+						string(f.Code),
+						f.Split,
+						tenary(f.Subject != "", f.Subject, "N/A"),
+						f.Message,
+					}
+				}
+				tprint("FINDINGS", [][]any{{"Severity", "Code", "Split", "Subject", "Message"}}, bd)
+			}
+
+			switch {
+			case fs.HasErrors():
+				return cli.Exit(fmt.Sprintf("Linted, %d finding(s) with errors.", len(fs)), lintExitCodeError)
+			case strict && len(fs) != 0:
+				return cli.Exit(fmt.Sprintf("Linted, %d warning(s) in strict mode.", len(fs)), lintExitCodeWarning)
+			}
+			if !inJson {
+				fmt.Printf("Linted, %d finding(s).\n", len(fs))
+			}
+			return nil
+		},
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/gpustack/gguf-parser-go/util/anyx"
 	"github.com/gpustack/gguf-parser-go/util/json"
@@ -45,7 +46,7 @@ func main() {
 	app := &cli.App{
 		Name:            name,
 		Usage:           "Review/Check GGUF files and estimate the memory usage and provide optimization suggestions.",
-		UsageText:       name + " [GLOBAL OPTIONS]",
+		UsageText:       name + " [GLOBAL OPTIONS] [COMMAND [COMMAND OPTIONS]]",
 		Version:         Version,
 		Reader:          os.Stdin,
 		Writer:          os.Stdout,
@@ -54,6 +55,19 @@ func main() {
 		OnUsageError: func(c *cli.Context, _ error, _ bool) error {
 			return cli.ShowAppHelp(c)
 		},
+		Commands: []*cli.Command{
+			editCommand(),
+			tensorsCommand(),
+			lintCommand(),
+			splitCommand(),
+			mergeCommand(),
+			diffCommand(),
+			hashCommand(),
+			templateCommand(),
+			serveCommand(),
+			renameCommand(),
+			fitCommand(),
+		},
 		Flags: []cli.Flag{
 			&cli.BoolFlag{
 				Destination: &debug,
@@ -72,7 +86,8 @@ func main() {
 				},
 				Usage: "Path where the GGUF file to load for the main model, e.g. \"~/.cache" +
 					"/lm-studio/models/QuantFactory/Qwen2-7B-Instruct-GGUF" +
-					"/Qwen2-7B-Instruct.Q5_K_M.gguf\".",
+					"/Qwen2-7B-Instruct.Q5_K_M.gguf\", " +
+					"or the GGUF file inside a tar archive in the form of \"archive.tar#model.gguf\".",
 			},
 			&cli.StringFlag{
 				Destination: &draftPath,
@@ -639,6 +654,15 @@ func main() {
 				Usage: "Specify the physical maximum batch size, " +
 					"which is used to estimate the usage.",
 			},
+			&cli.IntFlag{
+				Destination: &lmcPromptLength,
+				Value:       lmcPromptLength,
+				Category:    "Estimate/LLaMACpp",
+				Name:        "prompt-length",
+				Usage: "Specify the length of the prompt, " +
+					"which is used to estimate the prompt processing throughput and the time to first token " +
+					"with \"--device-metric\", default is the logical batch size.",
+			},
 			&cli.StringFlag{
 				Destination: &lmcCacheKeyType,
 				Value:       lmcCacheKeyType,
@@ -673,6 +697,27 @@ func main() {
 					"which is used to estimate the usage. " +
 					"Disable Key-Value offloading can reduce the usage of VRAM.",
 			},
+			&cli.BoolFlag{
+				Destination: &lmcSWAFull,
+				Value:       lmcSWAFull,
+				Category:    "Estimate/LLaMACpp",
+				Name:        "swa-full", // LLaMACpp compatibility
+				Usage: "Specify using the full-size KV cache for the sliding window attention layers, " +
+					"which is used to estimate the usage. " +
+					"By default, the KV cache of the sliding window attention layers is sized by the window.",
+			},
+			&cli.StringSliceFlag{
+				Destination: &lmcOverrideTensors,
+				Category:    "Estimate/LLaMACpp",
+				Name:        "override-tensor",
+				Aliases: []string{ // LLaMACpp compatibility
+					"ot",
+				},
+				Usage: "Override the device of the tensors whose names match the regex, " +
+					"in the form of \"<regex>=<device>[,<regex>=<device>...]\", " +
+					"the device is \"CPU\", \"RPC[host:port]\" or a GPU backend name ending with the index, e.g. \"CUDA0\", " +
+					"which is used to estimate the usage, e.g. \"--override-tensor exps=CPU\" keeps the expert tensors on the CPU.",
+			},
 			&cli.StringFlag{
 				Destination: &lmcSplitMode,
 				Value:       lmcSplitMode,
@@ -726,6 +771,37 @@ func main() {
 					"which is used to estimate the usage, " +
 					"default is full offloaded.",
 			},
+			&cli.IntFlag{
+				Destination: &lmcDraftMax,
+				Value:       lmcDraftMax,
+				Category:    "Estimate/LLaMACpp",
+				Name:        "draft-max",
+				Aliases: []string{ // LLaMACpp compatibility
+					"draft",
+					"draft-n",
+				},
+				Usage: "Specify the maximum number of tokens to draft for the speculative decoding, " +
+					"which is used to estimate the throughput with the draft model and \"--device-metric\".",
+			},
+			&cli.IntFlag{
+				Destination: &lmcDraftMin,
+				Value:       lmcDraftMin,
+				Category:    "Estimate/LLaMACpp",
+				Name:        "draft-min",
+				Aliases: []string{ // LLaMACpp compatibility
+					"draft-n-min",
+				},
+				Usage: "Specify the minimum number of tokens to draft for the speculative decoding, " +
+					"which is used to estimate the throughput with the draft model and \"--device-metric\".",
+			},
+			&cli.Float64Flag{
+				Destination: &lmcDraftAcceptanceRate,
+				Value:       lmcDraftAcceptanceRate,
+				Category:    "Estimate/LLaMACpp",
+				Name:        "draft-acceptance-rate",
+				Usage: "Specify the probability that a drafted token is accepted, in the range of (0, 1], " +
+					"which is used to estimate the throughput with the draft model and \"--device-metric\".",
+			},
 			&cli.Uint64Flag{
 				Destination: &lmcOffloadLayersStep,
 				Value:       lmcOffloadLayersStep,
@@ -828,6 +904,14 @@ func main() {
 				Name:        "image-free-compute-memory-immediately", // LLaMABox compatibility
 				Usage:       "Specify to free the compute memory immediately after the generation, which burst using VRAM.",
 			},
+			&cli.StringFlag{
+				Destination: &licensePolicy,
+				Value:       licensePolicy,
+				Category:    "Check",
+				Name:        "license-policy",
+				Usage: "Path to the license policy file in YAML or JSON, e.g. \"{allow: [MIT, Apache-2.0], deny: [CC-BY-NC-*]}\", " +
+					"fails with exit code 2 if the license of the model violates the policy.",
+			},
 			&cli.BoolFlag{
 				Destination: &raw,
 				Value:       raw,
@@ -973,18 +1057,24 @@ var (
 	deviceMetrics     cli.StringSlice
 	platformFootprint = "150,250"
 	// estimate options for llama.cpp
-	lmcCtxSize            = 0
-	lmcInMaxCtxSize       bool
-	lmcLogicalBatchSize   = 2048
-	lmcPhysicalBatchSize  = 512
-	lmcCacheKeyType       = "f16"
-	lmcCacheValueType     = "f16"
-	lmcNoKVOffload        bool
-	lmcSplitMode          = "layer"
-	lmcNoMMap             bool
-	lmcVisualMaxImageSize uint
-	lmcOffloadLayersDraft = -1
-	lmcOffloadLayersStep  uint64
+	lmcCtxSize             = 0
+	lmcInMaxCtxSize        bool
+	lmcLogicalBatchSize    = 2048
+	lmcPhysicalBatchSize   = 512
+	lmcPromptLength        = 0
+	lmcCacheKeyType        = "f16"
+	lmcCacheValueType      = "f16"
+	lmcNoKVOffload         bool
+	lmcSWAFull             bool
+	lmcOverrideTensors     cli.StringSlice
+	lmcSplitMode           = "layer"
+	lmcNoMMap              bool
+	lmcVisualMaxImageSize  uint
+	lmcOffloadLayersDraft  = -1
+	lmcDraftMax            = 16
+	lmcDraftMin            = 0
+	lmcDraftAcceptanceRate = 0.7
+	lmcOffloadLayersStep   uint64
 	// estimate options for stable-diffusion.cpp
 	sdcBatchCount                   uint = 1
 	sdcHeight                       uint = 1024
@@ -995,6 +1085,8 @@ var (
 	sdcAutoencoderTiling            bool
 	sdcNoAutoencoderTiling          bool
 	sdcFreeComputeMemoryImmediately bool
+	// check options
+	licensePolicy string
 	// output options
 	raw              bool
 	rawOutput        string
@@ -1096,29 +1188,9 @@ func mainAction(c *cli.Context) error {
 		}
 	}
 	if dmss := deviceMetrics.Value(); len(dmss) > 0 {
-		dms := make([]GGUFRunDeviceMetric, len(dmss))
-		for i := range dmss {
-			ss := strings.Split(dmss[i], ";")
-			if len(ss) < 2 {
-				return errors.New("--device-metric has invalid format")
-			}
-			var err error
-			dms[i].FLOPS, err = ParseFLOPSScalar(strings.TrimSpace(ss[0]))
-			if err != nil {
-				return fmt.Errorf("--device-metric has invalid FLOPS: %w", err)
-			}
-			dms[i].UpBandwidth, err = ParseBytesPerSecondScalar(strings.TrimSpace(ss[1]))
-			if err != nil {
-				return fmt.Errorf("--device-metric has invalid Up Bandwidth: %w", err)
-			}
-			if len(ss) > 2 {
-				dms[i].DownBandwidth, err = ParseBytesPerSecondScalar(strings.TrimSpace(ss[2]))
-				if err != nil {
-					return fmt.Errorf("--device-metric has invalid Down Bandwidth: %w", err)
-				}
-			} else {
-				dms[i].DownBandwidth = dms[i].UpBandwidth
-			}
+		dms, err := parseDeviceMetrics(dmss)
+		if err != nil {
+			return err
 		}
 		eopts = append(eopts, WithDeviceMetrics(dms))
 	}
@@ -1137,15 +1209,46 @@ func mainAction(c *cli.Context) error {
 		}
 		eopts = append(eopts, WithLLaMACppPhysicalBatchSize(int32(lmcPhysicalBatchSize)))
 	}
+	if lmcPromptLength > 0 {
+		eopts = append(eopts, WithLLaMACppPromptLength(int32(lmcPromptLength)))
+	}
+	if lmcDraftMin < 0 || lmcDraftMin > lmcDraftMax {
+		return errors.New("--draft-min must be in the range of 0 to --draft-max")
+	}
+	eopts = append(eopts, WithLLaMACppDraftSize(int32(lmcDraftMin), int32(lmcDraftMax)))
+	if lmcDraftAcceptanceRate <= 0 || lmcDraftAcceptanceRate > 1 {
+		return errors.New("--draft-acceptance-rate must be in the range of (0, 1]")
+	}
+	eopts = append(eopts, WithLLaMACppDraftAcceptanceRate(lmcDraftAcceptanceRate))
 	if lmcCacheKeyType != "" {
 		eopts = append(eopts, WithLLaMACppCacheKeyType(toGGMLType(lmcCacheKeyType)))
 	}
 	if lmcCacheValueType != "" {
 		eopts = append(eopts, WithLLaMACppCacheValueType(toGGMLType(lmcCacheValueType)))
 	}
+	if lmcSWAFull {
+		eopts = append(eopts, WithLLaMACppFullSWACache())
+	}
 	if lmcNoKVOffload {
 		eopts = append(eopts, WithoutLLaMACppOffloadKVCache())
 	}
+	if ots := lmcOverrideTensors.Value(); len(ots) > 0 {
+		// Count the devices as the estimate does,
+		// the RPC servers work with "--tensor-split" only.
+		var rpcs []string
+		nd := 1
+		if tensorSplit != "" {
+			nd = len(strings.Split(tensorSplit, ","))
+			if rpcServers != "" {
+				rpcs = strings.Split(rpcServers, ",")
+			}
+		}
+		ovs, err := parseTensorOverrides(ots, rpcs, nd)
+		if err != nil {
+			return fmt.Errorf("--override-tensor %w", err)
+		}
+		eopts = append(eopts, WithLLaMACppTensorOverrides(ovs))
+	}
 	switch lmcSplitMode {
 	case "row":
 		eopts = append(eopts, WithLLaMACppSplitMode(LLaMACppSplitModeRow))
@@ -1188,6 +1291,7 @@ func mainAction(c *cli.Context) error {
 		// Common.
 		gf         *GGUFFile
 		adapterGfs []*GGUFFile
+		olLicenses []string
 		// LLaMACpp specific.
 		lmcProjectGf *GGUFFile
 		lmcDrafterGf *GGUFFile
@@ -1205,8 +1309,16 @@ func mainAction(c *cli.Context) error {
 		default:
 			return errors.New("no model specified")
 		case path != "":
+			if ap, an, ok := splitArchivePath(path); ok {
+				gf, err = ParseGGUFFileFromTar(ap, an, ropts...)
+				break
+			}
 			gf, err = ParseGGUFFile(path, ropts...)
 		case url != "":
+			if au, an, ok := splitArchivePath(url); ok {
+				gf, err = ParseGGUFFileFromTarRemote(ctx, au, an, ropts...)
+				break
+			}
 			gf, err = ParseGGUFFileRemote(ctx, url, ropts...)
 		case hfRepo != "" && hfFile != "":
 			if hfToken != "" {
@@ -1221,6 +1333,12 @@ func mainAction(c *cli.Context) error {
 		case olModel != "":
 			om := ParseOllamaModel(olModel, SetOllamaModelBaseURL(olBaseURL))
 			gf, err = ParseGGUFFileFromOllamaModel(ctx, om, ropts...)
+			if err == nil && om != nil && licensePolicy != "" {
+				// Fail closed, the license policy cannot be checked without the licenses.
+				if olLicenses, err = om.License(ctx, nil); err != nil {
+					return fmt.Errorf("failed to get license of Ollama model: %w", err)
+				}
+			}
 			if err == nil && om != nil && olUsage {
 				// Parameters override.
 				{
@@ -1427,6 +1545,12 @@ func mainAction(c *cli.Context) error {
 		sde StableDiffusionCppRunEstimate
 	)
 
+	if licensePolicy != "" {
+		if err := checkLicensePolicy(licensePolicy, m, olLicenses); err != nil {
+			return err
+		}
+	}
+
 	skipTokenizer = skipTokenizer || t.Model == ""
 	skipEstimate = skipEstimate || m.Type != "model"
 
@@ -1564,32 +1688,58 @@ func mainAction(c *cli.Context) error {
 	GGUFBytesScalarStringInMiBytes = inMib
 
 	if !skipMetadata {
+		hd := []any{
+			"Type",
+			"Name",
+			"Arch",
+			"Quantization",
+			"Little Endian",
+			"Size",
+			"Parameters",
+			"BPW",
+		}
+		bd := []any{
+			m.Type,
+			sprintf(tenary(len(m.Name) == 0, "N/A", tenary(len([]rune(m.Name)) <= 20, m.Name, string([]rune(m.Name)[:20])+"..."))),
+			m.Architecture,
+			sprintf(m.FileType),
+			sprintf(m.LittleEndian),
+			sprintf(m.Size),
+			sprintf(m.Parameters),
+			sprintf(m.BitsPerWeight),
+		}
+		// Provenance, only if present.
+		refNames := func(rs []GGUFModelReference) []string {
+			ns := make([]string, len(rs))
+			for i, r := range rs {
+				ns[i] = tenary(r.Organization != "" && !strings.Contains(r.Name, "/"), r.Organization+"/"+r.Name, r.Name).(string)
+			}
+			return ns
+		}
+		for _, p := range []struct {
+			h string
+			v []string
+		}{
+			{"Organization", []string{m.Organization}},
+			{"Finetune", []string{m.Finetune}},
+			{"Size Label", []string{m.SizeLabel}},
+			{"Quantized By", []string{m.QuantizedBy}},
+			{"Repo URL", []string{m.RepoURL}},
+			{"Base Models", refNames(m.BaseModels)},
+			{"Datasets", refNames(m.Datasets)},
+			{"Tags", m.Tags},
+			{"Languages", m.Languages},
+		} {
+			if len(p.v) == 0 || len(p.v) == 1 && p.v[0] == "" {
+				continue
+			}
+			hd = append(hd, p.h)
+			bd = append(bd, sprintList(p.v, 3))
+		}
 		tprint(
 			"Metadata",
-			[][]any{
-				{
-					"Type",
-					"Name",
-					"Arch",
-					"Quantization",
-					"Little Endian",
-					"Size",
-					"Parameters",
-					"BPW",
-				},
-			},
-			[][]any{
-				{
-					m.Type,
-					sprintf(tenary(len(m.Name) == 0, "N/A", tenary(len([]rune(m.Name)) <= 20, m.Name, string([]rune(m.Name)[:20])+"..."))),
-					m.Architecture,
-					sprintf(m.FileType),
-					sprintf(m.LittleEndian),
-					sprintf(m.Size),
-					sprintf(m.Parameters),
-					sprintf(m.BitsPerWeight),
-				},
-			})
+			[][]any{hd},
+			[][]any{bd})
 	}
 
 	if !skipArchitecture {
@@ -1662,6 +1812,20 @@ func mainAction(c *cli.Context) error {
 					sprintf(a.ExpertCount),
 					sprintf(a.VocabularyLength),
 				}
+				if a.AttentionSlidingWindow > 0 {
+					n := 0
+					for _, swa := range a.AttentionSlidingWindowLayers {
+						if swa {
+							n++
+						}
+					}
+					hd = append(hd, "Sliding Window")
+					bd = append(bd, fmt.Sprintf("%d (%d/%d layers)", a.AttentionSlidingWindow, n, a.BlockCount))
+				}
+				if a.AttentionMLA() {
+					hd = append(hd, "MLA KV LoRA Rank")
+					bd = append(bd, sprintf(a.AttentionKVLoRARank))
+				}
 			}
 		}
 		tprint(
@@ -1738,6 +1902,15 @@ func mainAction(c *cli.Context) error {
 			hds[0] = append(hds[0], "Max TPS")
 			hds[1] = append(hds[1], "Max TPS")
 		}
+		if lmes.Items[0].MaximumPromptTokensPerSecond != nil {
+			hd := fmt.Sprintf("Prompt (%d Tokens)", lmes.Items[0].PromptLength)
+			hds[0] = append(hds[0], hd, hd)
+			hds[1] = append(hds[1], "Max Throughput", "Min TTFT")
+		}
+		if lmes.Items[0].MaximumSpeculativeTokensPerSecond != nil {
+			hds[0] = append(hds[0], "Speculative", "Speculative", "Speculative")
+			hds[1] = append(hds[1], "Draft Size", "Max Throughput", "Speedup")
+		}
 		hds[0] = append(hds[0], "RAM", "RAM", "RAM")
 		hds[1] = append(hds[1], "Layers (I + T + O)", "UMA", "NonUMA")
 		for _, v := range lmes.Items[0].VRAMs {
@@ -1799,6 +1972,18 @@ func mainAction(c *cli.Context) error {
 				bds[i] = append(bds[i],
 					sprintf(*lmes.Items[i].MaximumTokensPerSecond))
 			}
+			if lmes.Items[i].MaximumPromptTokensPerSecond != nil {
+				bds[i] = append(bds[i],
+					sprintf(*lmes.Items[i].MaximumPromptTokensPerSecond),
+					sprintf(lmes.Items[i].MinimumTimeToFirstToken.Round(time.Microsecond)))
+			}
+			if lmes.Items[i].MaximumSpeculativeTokensPerSecond != nil {
+				bds[i] = append(bds[i],
+					sprintf(lmes.Items[i].SpeculativeDraftSize),
+					sprintf(*lmes.Items[i].MaximumSpeculativeTokensPerSecond),
+					sprintf("%.2fx", float64(*lmes.Items[i].MaximumSpeculativeTokensPerSecond)/
+						float64(*lmes.Items[i].MaximumTokensPerSecond)))
+			}
 			bds[i] = append(bds[i],
 				sprintf("1 + %d + %d", lmes.Items[i].RAM.HandleLayers, tenary(lmes.Items[i].RAM.HandleOutputLayer, 1, 0)),
 				sprintf(lmes.Items[i].RAM.UMA),
@@ -1879,6 +2064,35 @@ func mainAction(c *cli.Context) error {
 	return nil
 }
 
+// parseDeviceMetrics parses the "--device-metric" values into the device metrics.
+func parseDeviceMetrics(dmss []string) ([]GGUFRunDeviceMetric, error) {
+	dms := make([]GGUFRunDeviceMetric, len(dmss))
+	for i := range dmss {
+		ss := strings.Split(dmss[i], ";")
+		if len(ss) < 2 {
+			return nil, errors.New("--device-metric has invalid format")
+		}
+		var err error
+		dms[i].FLOPS, err = ParseFLOPSScalar(strings.TrimSpace(ss[0]))
+		if err != nil {
+			return nil, fmt.Errorf("--device-metric has invalid FLOPS: %w", err)
+		}
+		dms[i].UpBandwidth, err = ParseBytesPerSecondScalar(strings.TrimSpace(ss[1]))
+		if err != nil {
+			return nil, fmt.Errorf("--device-metric has invalid Up Bandwidth: %w", err)
+		}
+		if len(ss) > 2 {
+			dms[i].DownBandwidth, err = ParseBytesPerSecondScalar(strings.TrimSpace(ss[2]))
+			if err != nil {
+				return nil, fmt.Errorf("--device-metric has invalid Down Bandwidth: %w", err)
+			}
+		} else {
+			dms[i].DownBandwidth = dms[i].UpBandwidth
+		}
+	}
+	return dms, nil
+}
+
 func sprintf(f any, a ...any) string {
 	if v, ok := f.(string); ok {
 		if len(a) != 0 {
@@ -1889,6 +2103,15 @@ func sprintf(f any, a ...any) string {
 	return anyx.String(f)
 }
 
+// sprintList returns the first n items of the given list in lines,
+// and the count of the rest items if any.
+func sprintList(ss []string, n int) string {
+	if len(ss) <= n {
+		return strings.Join(ss, "\n")
+	}
+	return strings.Join(ss[:n], "\n") + fmt.Sprintf("\n(+%d more)", len(ss)-n)
+}
+
 func tprint(title string, headers, bodies [][]any) {
 	tw := table.NewWriter()
 	tw.SetOutputMirror(os.Stdout)
@@ -1924,6 +2147,51 @@ func tenary(c bool, t, f any) any {
 	return f
 }
 
+// parseTensorOverrides parses the "<regex>=<device>" pairs into the tensor overrides,
+// the devices are indexed as the estimate does,
+// 0 is the CPU, then the RPC servers and the local GPU devices.
+func parseTensorOverrides(values, rpcs []string, devices int) ([]LLaMACppTensorOverride, error) {
+	var ovs []LLaMACppTensorOverride
+	for _, v := range values {
+		for _, p := range strings.Split(v, ",") {
+			ps := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(ps) != 2 || ps[0] == "" || ps[1] == "" {
+				return nil, fmt.Errorf("has invalid pair %q", p)
+			}
+			re, err := regexp.Compile(ps[0])
+			if err != nil {
+				return nil, fmt.Errorf("has invalid regex %q: %w", ps[0], err)
+			}
+
+			d, bt := -1, ps[1]
+			switch {
+			case strings.EqualFold(bt, "CPU"):
+				d = 0
+			case strings.HasPrefix(bt, "RPC[") && strings.HasSuffix(bt, "]"):
+				srv := bt[4 : len(bt)-1]
+				for i := range rpcs {
+					if strings.TrimSpace(rpcs[i]) == srv {
+						d = 1 + i
+						break
+					}
+				}
+			default:
+				n := strings.TrimRightFunc(bt, unicode.IsDigit)
+				i := 0
+				if n != bt {
+					i, _ = strconv.Atoi(bt[len(n):])
+				}
+				d = 1 + len(rpcs) + i
+			}
+			if d < 0 || d > devices {
+				return nil, fmt.Errorf("has unknown device %q", bt)
+			}
+			ovs = append(ovs, LLaMACppTensorOverride{Regex: re, Device: d})
+		}
+	}
+	return ovs, nil
+}
+
 func toGGMLType(s string) GGMLType {
 	t := GGMLTypeF16
 	switch s {
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+// Exit codes of the rename command,
+// 1 is reserved for the failure of loading the GGUF files.
+const (
+	renameExitCodeMismatched = 2
+)
+
+func renameCommand() *cli.Command {
+	var (
+		paths  cli.StringSlice
+		dryRun bool
+		inJson bool
+	)
+	return &cli.Command{
+		Name:  "rename",
+		Usage: "Rename the local GGUF files following the GGUF naming convention, which derives the names from the contents.",
+		UsageText: "rename --path model.gguf [--path model-00001-of-00002.gguf ...] [--dry-run] [--json]\n\n" +
+			"The shards of a split GGUF file are renamed together if the given path is a shard.\n" +
+			"Exit with 0 if renamed or all names matched, 1 if failed to load the files, " +
+			"2 if any name mismatched with \"--dry-run\".",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Destination: &paths,
+				Name:        "path",
+				Aliases:     []string{"model", "m"},
+				Required:    true,
+				Usage:       "Path where the GGUF file to rename, can be specified multiple times.",
+			},
+			&cli.BoolFlag{
+				Destination: &dryRun,
+				Value:       dryRun,
+				Name:        "dry-run",
+				Usage:       "Only report the files whose names disagree with their contents, without renaming.",
+			},
+			&cli.BoolFlag{
+				Destination: &inJson,
+				Value:       inJson,
+				Name:        "json",
+				Usage:       "Output as JSON.",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			var rs []renameResult
+			for _, p := range paths.Value() {
+				r, err := renameGGUFFile(p, dryRun)
+				if err != nil {
+					return err
+				}
+				rs = append(rs, r...)
+			}
+
+			mismatched := 0
+			for i := range rs {
+				if !rs[i].Matched && !rs[i].Renamed {
+					mismatched++
+				}
+			}
+
+			if inJson {
+				enc := json.NewEncoder(os.Stdout)
+				if inPrettyJson {
+					enc.SetIndent("", "  ")
+				}
+				if err := enc.Encode(rs); err != nil {
+					return err
+				}
+			} else {
+				bd := make([][]any, len(rs))
+				for i, r := range rs {
+					bd[i] = []any{
+						r.Path,
+						r.Suggested,
+						tenary(r.Matched, "matched", tenary(r.Renamed, "renamed", "mismatched")),
+					}
+				}
+				tprint("FILES", [][]any{{"Path", "Suggested", "Status"}}, bd)
+			}
+
+			if mismatched != 0 {
+				return cli.Exit(fmt.Sprintf("Checked, %d file(s) mismatched.", mismatched), renameExitCodeMismatched)
+			}
+			return nil
+		},
+	}
+}
+
+// renameResult is the result of renaming a (split) GGUF file.
+type renameResult struct {
+	Path      string `json:"path"`
+	Suggested string `json:"suggested"`
+	Matched   bool   `json:"matched"`
+	Renamed   bool   `json:"renamed,omitempty"`
+}
+
+// renameGGUFFile renames the GGUF file and its shards at the given path to the suggested names,
+// or only compares the names if dryRun is true.
+func renameGGUFFile(path string, dryRun bool) ([]renameResult, error) {
+	gf, err := ParseGGUFFile(path, SkipLargeMetadata(), UseMMap())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GGUF file %s: %w", path, err)
+	}
+
+	olds := CompleteShardGGUFFilename(path)
+	if olds == nil {
+		olds = []string{path}
+	}
+	news := []string{gf.SuggestedFilename().String()}
+	if sns := CompleteShardGGUFFilename(news[0]); sns != nil {
+		news = sns
+	}
+	if len(olds) != len(news) {
+		return nil, fmt.Errorf("failed to rename GGUF file %s: expected %d shard(s), but got %d", path, len(news), len(olds))
+	}
+
+	rs := make([]renameResult, len(olds))
+	for i := range olds {
+		rs[i] = renameResult{
+			Path:      olds[i],
+			Suggested: filepath.Join(filepath.Dir(olds[i]), news[i]),
+			Matched:   filepath.Base(olds[i]) == news[i],
+		}
+	}
+	if dryRun {
+		return rs, nil
+	}
+
+	for i := range rs {
+		if rs[i].Matched {
+			continue
+		}
+		if _, err = os.Stat(rs[i].Suggested); err == nil {
+			return nil, fmt.Errorf("failed to rename GGUF file %s: %s already exists", rs[i].Path, rs[i].Suggested)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to rename GGUF file %s: %w", rs[i].Path, err)
+		}
+		if err = os.Rename(rs[i].Path, rs[i].Suggested); err != nil {
+			return nil, fmt.Errorf("failed to rename GGUF file %s: %w", rs[i].Path, err)
+		}
+		rs[i].Renamed = true
+	}
+	return rs, nil
+}
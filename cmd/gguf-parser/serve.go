@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+	"github.com/gpustack/gguf-parser-go/util/ptr"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+func serveCommand() *cli.Command {
+	var (
+		listen = "127.0.0.1:8080"
+		files  cli.StringSlice
+		token  string
+	)
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "Serve the tokenizers of GGUF files over HTTP, to tokenize, detokenize and count the tokens.",
+		UsageText: "serve --file [name=]model.gguf [--file [name=]https://... ...] [--listen 127.0.0.1:8080] [--token token]\n\n" +
+			"POST /tokenize   {\"model\": \"name\", \"content\": \"...\", \"add_special\": true, \"parse_special\": true}\n" +
+			"POST /detokenize {\"model\": \"name\", \"tokens\": [1, 2, 3]}\n" +
+			"POST /count      {\"model\": \"name\", \"content\": \"...\", \"add_special\": true, \"parse_special\": true}\n\n" +
+			"The \"model\" can be omitted if only one file is served.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Destination: &listen,
+				Value:       listen,
+				Name:        "listen",
+				Usage:       "Address to listen on.",
+			},
+			&cli.StringSliceFlag{
+				Destination: &files,
+				Name:        "file",
+				Required:    true,
+				Usage: "GGUF file to serve in the form of \"[name=]path\" or \"[name=]url\", " +
+					"the name defaults to the file name without the \".gguf\" extension.",
+			},
+			&cli.StringFlag{
+				Destination: &token,
+				Value:       token,
+				Name:        "token",
+				Usage:       "Bearer auth token to load the remote GGUF files, optional.",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			h, err := newServeHandler(files.Value(), token)
+			if err != nil {
+				return err
+			}
+
+			srv := &http.Server{
+				Addr:              listen,
+				Handler:           h,
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			go func() {
+				<-c.Context.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				_ = srv.Shutdown(ctx)
+			}()
+			fmt.Printf("Serving %s on %s\n", strings.Join(h.names, ", "), listen)
+			if err = srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+const (
+	// serveMaxBodyBytes is the max size of the request body.
+	serveMaxBodyBytes = 64 << 20
+	// serveLoadTimeout is the max duration of loading a GGUF file.
+	serveLoadTimeout = 10 * time.Minute
+)
+
+type (
+	// serveModel is a served GGUF file,
+	// the vocabulary is loaded on the first request and cached.
+	serveModel struct {
+		src ggufSource
+
+		loading              singleflight.Group
+		mu                   sync.Mutex
+		vocab                *GGUFVocabulary
+		maximumContextLength uint64
+	}
+
+	// serveHandler is the http.Handler of the serve command.
+	serveHandler struct {
+		mux    *http.ServeMux
+		models map[string]*serveModel
+		names  []string
+	}
+
+	serveTokenizeRequest struct {
+		Model        string `json:"model"`
+		Content      string `json:"content"`
+		AddSpecial   *bool  `json:"add_special"`
+		ParseSpecial *bool  `json:"parse_special"`
+	}
+
+	serveTokenizeResponse struct {
+		Tokens []int64 `json:"tokens"`
+	}
+
+	serveDetokenizeRequest struct {
+		Model  string  `json:"model"`
+		Tokens []int64 `json:"tokens"`
+	}
+
+	serveDetokenizeResponse struct {
+		Content string `json:"content"`
+	}
+
+	serveCountResponse struct {
+		Count                int    `json:"count"`
+		MaximumContextLength uint64 `json:"maximum_context_length"`
+		// Exceeded is true if the count exceeds the maximum context length of the model.
+		Exceeded bool `json:"exceeded"`
+	}
+
+	serveErrorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+// load returns the vocabulary and the maximum context length of the model,
+// which loads the GGUF file at the first call,
+// and retries at the next call if failed.
+//
+// The loading is shared by the concurrent calls and runs without holding the lock,
+// each call stops waiting once its context is done,
+// while the loading keeps going for the others until serveLoadTimeout.
+func (m *serveModel) load(ctx context.Context) (*GGUFVocabulary, uint64, error) {
+	if vocab, maxCtx := m.loaded(); vocab != nil {
+		return vocab, maxCtx, nil
+	}
+
+	ch := m.loading.DoChan("", func() (any, error) {
+		if vocab, _ := m.loaded(); vocab != nil {
+			return nil, nil
+		}
+
+		lctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), serveLoadTimeout)
+		defer cancel()
+
+		gf, _, err := m.src.Open(lctx, false)
+		if err != nil {
+			return nil, err
+		}
+		vocab, err := gf.Vocabulary()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load vocabulary: %w", err)
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.vocab, m.maximumContextLength = vocab, gf.Architecture().MaximumContextLength
+		return nil, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, 0, r.Err
+		}
+	}
+
+	vocab, maxCtx := m.loaded()
+	return vocab, maxCtx, nil
+}
+
+// loaded returns the cached vocabulary and maximum context length of the model,
+// the vocabulary is nil if not loaded yet.
+func (m *serveModel) loaded() (*GGUFVocabulary, uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.vocab, m.maximumContextLength
+}
+
+// newServeHandler returns a serveHandler serving the given files,
+// each file is in the form of "[name=]path" or "[name=]url".
+func newServeHandler(files []string, token string) (*serveHandler, error) {
+	h := &serveHandler{
+		mux:    http.NewServeMux(),
+		models: make(map[string]*serveModel, len(files)),
+	}
+	for _, f := range files {
+		name, loc, ok := strings.Cut(f, "=")
+		if !ok || strings.Contains(name, "/") {
+			p, _, _ := strings.Cut(f, "?")
+			name, loc = strings.TrimSuffix(filepath.Base(p), ".gguf"), f
+		}
+		if name == "" || loc == "" {
+			return nil, fmt.Errorf("invalid file %q, must be in the form of \"[name=]path\" or \"[name=]url\"", f)
+		}
+		if _, ok = h.models[name]; ok {
+			return nil, fmt.Errorf("duplicated name %q", name)
+		}
+
+		m := &serveModel{}
+		if strings.HasPrefix(loc, "http://") || strings.HasPrefix(loc, "https://") {
+			m.src.url, m.src.token = loc, token
+		} else {
+			m.src.path, m.src.mmap = loc, true
+		}
+		h.models[name] = m
+		h.names = append(h.names, name)
+	}
+	if len(h.models) == 0 {
+		return nil, errors.New("no file specified")
+	}
+	slices.Sort(h.names)
+
+	h.mux.HandleFunc("POST /tokenize", h.handleTokenize)
+	h.mux.HandleFunc("POST /detokenize", h.handleDetokenize)
+	h.mux.HandleFunc("POST /count", h.handleCount)
+	return h, nil
+}
+
+func (h *serveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *serveHandler) handleTokenize(w http.ResponseWriter, r *http.Request) {
+	var req serveTokenizeRequest
+	vocab, _, ok := h.prepare(w, r, &req, &req.Model)
+	if !ok {
+		return
+	}
+	tokens := vocab.Encode(req.Content, ptr.Deref(req.AddSpecial, true), ptr.Deref(req.ParseSpecial, true))
+	if tokens == nil {
+		tokens = []int64{}
+	}
+	writeServeJSON(w, http.StatusOK, serveTokenizeResponse{Tokens: tokens})
+}
+
+func (h *serveHandler) handleDetokenize(w http.ResponseWriter, r *http.Request) {
+	var req serveDetokenizeRequest
+	vocab, _, ok := h.prepare(w, r, &req, &req.Model)
+	if !ok {
+		return
+	}
+	content, err := vocab.Decode(req.Tokens, false, true)
+	if err != nil {
+		writeServeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeServeJSON(w, http.StatusOK, serveDetokenizeResponse{Content: content})
+}
+
+func (h *serveHandler) handleCount(w http.ResponseWriter, r *http.Request) {
+	var req serveTokenizeRequest
+	vocab, maxCtx, ok := h.prepare(w, r, &req, &req.Model)
+	if !ok {
+		return
+	}
+	n := len(vocab.Encode(req.Content, ptr.Deref(req.AddSpecial, true), ptr.Deref(req.ParseSpecial, true)))
+	writeServeJSON(w, http.StatusOK, serveCountResponse{
+		Count:                n,
+		MaximumContextLength: maxCtx,
+		Exceeded:             maxCtx > 0 && uint64(n) > maxCtx,
+	})
+}
+
+// prepare decodes the request body into the given request,
+// and loads the vocabulary of the requested model,
+// returns false if failed, and the error response has been written.
+func (h *serveHandler) prepare(w http.ResponseWriter, r *http.Request, req any, model *string) (*GGUFVocabulary, uint64, bool) {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, serveMaxBodyBytes))
+	if err := dec.Decode(req); err != nil {
+		writeServeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return nil, 0, false
+	}
+
+	name := *model
+	if name == "" {
+		if len(h.names) != 1 {
+			writeServeError(w, http.StatusBadRequest, fmt.Errorf("model is required, select from %v", h.names))
+			return nil, 0, false
+		}
+		name = h.names[0]
+	}
+	m, ok := h.models[name]
+	if !ok {
+		writeServeError(w, http.StatusNotFound, fmt.Errorf("model %q not found", name))
+		return nil, 0, false
+	}
+
+	vocab, maxCtx, err := m.load(r.Context())
+	if err != nil {
+		writeServeError(w, http.StatusInternalServerError, fmt.Errorf("failed to load model %q: %w", name, err))
+		return nil, 0, false
+	}
+	return vocab, maxCtx, true
+}
+
+func writeServeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v)
+}
+
+func writeServeError(w http.ResponseWriter, status int, err error) {
+	writeServeJSON(w, status, serveErrorResponse{Error: err.Error()})
+}
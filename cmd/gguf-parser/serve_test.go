@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+// writeServeTestFile writes a GGUF file with a SentencePiece tokenizer,
+// the context length is 8.
+func writeServeTestFile(t *testing.T, dir, name string) string {
+	t.Helper()
+
+	tokens := []string{"<unk>", "<s>", "</s>", "▁", "h", "i", "▁hi", "hi"}
+	types := []int32{2, 3, 3, 1, 1, 1, 1, 1}
+	scores := []float32{0, 0, 0, -1, -2, -2, -0.5, -1.5}
+	array := func(typ GGUFMetadataValueType, n int, f func(i int) any) GGUFMetadataKVArrayValue {
+		vs := make([]any, n)
+		for i := range vs {
+			vs[i] = f(i)
+		}
+		return GGUFMetadataKVArrayValue{Type: typ, Len: uint64(n), Array: vs}
+	}
+	gf := &GGUFFile{
+		Header: GGUFHeader{
+			Magic:   GGUFMagicGGUFLe,
+			Version: GGUFVersionV3,
+			MetadataKV: GGUFMetadataKVs{
+				{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+				{Key: "llama.context_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(8)},
+				{Key: "tokenizer.ggml.model", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+				{Key: "tokenizer.ggml.tokens", ValueType: GGUFMetadataValueTypeArray, Value: array(
+					GGUFMetadataValueTypeString, len(tokens), func(i int) any { return tokens[i] })},
+				{Key: "tokenizer.ggml.token_type", ValueType: GGUFMetadataValueTypeArray, Value: array(
+					GGUFMetadataValueTypeInt32, len(types), func(i int) any { return types[i] })},
+				{Key: "tokenizer.ggml.scores", ValueType: GGUFMetadataValueTypeArray, Value: array(
+					GGUFMetadataValueTypeFloat32, len(scores), func(i int) any { return scores[i] })},
+			},
+		},
+	}
+
+	p := filepath.Join(dir, name)
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	if _, err = NewGGUFWriter(f).Write(gf); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestServeHandler(t *testing.T) {
+	dir := t.TempDir()
+	h, err := newServeHandler([]string{
+		writeServeTestFile(t, dir, "a.gguf"),
+		"b=" + writeServeTestFile(t, dir, "other.gguf"),
+		"missing=" + filepath.Join(dir, "missing.gguf"),
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"a", "b", "missing"}; !reflect.DeepEqual(h.names, expected) {
+		t.Fatalf("expected names %v, got %v", expected, h.names)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	post := func(path, body string) (int, string) {
+		resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		bs, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(bytes.TrimSpace(bs))
+	}
+
+	testCases := []struct {
+		name           string
+		path           string
+		given          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"tokenize", "/tokenize", `{"model":"a","content":"hi hi"}`, 200, `{"tokens":[1,6,6]}`},
+		{"tokenize without special", "/tokenize", `{"model":"b","content":"hi","add_special":false}`, 200, `{"tokens":[6]}`},
+		{"tokenize control", "/tokenize", `{"model":"a","content":"</s>","add_special":false}`, 200, `{"tokens":[2]}`},
+		{"tokenize empty", "/tokenize", `{"model":"a","content":"","add_special":false}`, 200, `{"tokens":[]}`},
+		{"detokenize", "/detokenize", `{"model":"a","tokens":[1,6,6,2]}`, 200, `{"content":"<s> hi hi</s>"}`},
+		{"detokenize out of range", "/detokenize", `{"model":"a","tokens":[8]}`, 400, `{"error":"token ID 8 out of range"}`},
+		{"count", "/count", `{"model":"a","content":"hi hi hi"}`, 200, `{"count":4,"maximum_context_length":8,"exceeded":false}`},
+		{"count exceeded", "/count", `{"model":"a","content":"hi hi hi hi hi hi hi hi"}`, 200, `{"count":9,"maximum_context_length":8,"exceeded":true}`},
+		{"model required", "/count", `{"content":"hi"}`, 400, `{"error":"model is required, select from [a b missing]"}`},
+		{"model not found", "/count", `{"model":"c","content":"hi"}`, 404, `{"error":"model \"c\" not found"}`},
+		{"invalid body", "/tokenize", `{"model":`, 400, ""},
+		{"failed to load", "/tokenize", `{"model":"missing","content":"hi"}`, 500, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := post(tc.path, tc.given)
+			if status != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, status, body)
+			}
+			if tc.expectedBody != "" && body != tc.expectedBody {
+				t.Fatalf("expected body %s, got %s", tc.expectedBody, body)
+			}
+		})
+	}
+
+	// Method not allowed.
+	resp, err := http.Get(srv.URL + "/tokenize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
+
+func TestServeHandler_Concurrent(t *testing.T) {
+	h, err := newServeHandler([]string{writeServeTestFile(t, t.TempDir(), "a.gguf")}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 32)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/count", strings.NewReader(`{"content":"hi hi"}`))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			var resp serveCountResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Count != 3 {
+				errs <- rec.Body.String()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Errorf("unexpected response: %s", e)
+	}
+
+	if h.models["a"].vocab == nil {
+		t.Fatal("expected the vocabulary to be cached")
+	}
+}
+
+func TestServeHandler_SlowLoading(t *testing.T) {
+	dir := t.TempDir()
+	p := writeServeTestFile(t, dir, "a.gguf")
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		http.ServeFile(w, r, p)
+	}))
+	defer srv.Close()
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+
+	h, err := newServeHandler([]string{"slow=" + srv.URL + "/a.gguf", "fast=" + p}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := func(ctx context.Context, model string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/count", strings.NewReader(`{"model":"`+model+`","content":"hi hi"}`))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req.WithContext(ctx))
+		return rec
+	}
+
+	// The request stops waiting once its context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if rec := count(ctx, "slow"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusInternalServerError, rec.Code, rec.Body.String())
+	}
+
+	// The others are not blocked by the slow loading.
+	if rec := count(context.Background(), "fast"); rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	// The loading keeps going after the request is gone.
+	close(release)
+	if rec := count(context.Background(), "slow"); rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+}
+
+func TestNewServeHandler(t *testing.T) {
+	for _, given := range [][]string{
+		nil,
+		{"a=x.gguf", "a=y.gguf"},
+		{"=x.gguf"},
+	} {
+		if _, err := newServeHandler(given, ""); err == nil {
+			t.Errorf("expected error for %v", given)
+		}
+	}
+
+	h, err := newServeHandler([]string{"https://example.com/models/m.gguf?download=true", "r=https://example.com/x.gguf"}, "tk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := h.models["r"]; m == nil || m.src.url != "https://example.com/x.gguf" || m.src.token != "tk" {
+		t.Errorf("unexpected model r: %+v", m)
+	}
+	if _, ok := h.models["m"]; !ok {
+		t.Errorf("unexpected names %v", h.names)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/gpustack/gguf-parser-go/util/osx"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+// ggufSource locates a GGUF file for the commands,
+// which supports local path, remote url and HuggingFace repository.
+type ggufSource struct {
+	path    string
+	url     string
+	token   string
+	hfRepo  string
+	hfFile  string
+	hfToken string
+	mmap    bool
+}
+
+// Flags returns the cli.Flag list to fill the ggufSource.
+func (s *ggufSource) Flags() []cli.Flag {
+	s.mmap = true
+	return []cli.Flag{
+		&cli.StringFlag{
+			Destination: &s.path,
+			Value:       s.path,
+			Name:        "path",
+			Aliases:     []string{"model", "m"},
+			Usage:       "Path where the GGUF file to load, or \"archive.tar#model.gguf\" inside a tar archive.",
+		},
+		&cli.StringFlag{
+			Destination: &s.url,
+			Value:       s.url,
+			Name:        "url",
+			Aliases:     []string{"model-url", "mu"},
+			Usage:       "Url where the GGUF file to load.",
+		},
+		&cli.StringFlag{
+			Destination: &s.token,
+			Value:       s.token,
+			Name:        "token",
+			Usage:       "Bearer auth token to load GGUF file, optional, works with \"--url\".",
+		},
+		&cli.StringFlag{
+			Destination: &s.hfRepo,
+			Value:       s.hfRepo,
+			Name:        "hf-repo",
+			Aliases:     []string{"hfr"},
+			Usage:       "Repository of HuggingFace which the GGUF file store, works with \"--hf-file\".",
+		},
+		&cli.StringFlag{
+			Destination: &s.hfFile,
+			Value:       s.hfFile,
+			Name:        "hf-file",
+			Aliases:     []string{"hff"},
+			Usage:       "Model file below the \"--hf-repo\".",
+		},
+		&cli.StringFlag{
+			Destination: &s.hfToken,
+			Value:       s.hfToken,
+			Name:        "hf-token",
+			Aliases:     []string{"hft"},
+			Usage:       "User access token of HuggingFace, optional, works with \"--hf-repo/--hf-file\" pair.",
+		},
+		&cli.BoolFlag{
+			Destination: &s.mmap,
+			Value:       s.mmap,
+			Name:        "mmap",
+			Usage:       "Use mmap to read the local GGUF file.",
+		},
+	}
+}
+
+// Open parses the GGUF file with the given read options,
+// and opens the sources of the tensor data if withSources is true.
+func (s *ggufSource) Open(ctx context.Context, withSources bool, opts ...GGUFReadOption) (gf *GGUFFile, srcs *GGUFFileSources, err error) {
+	ropts := slices.Clone(opts)
+	if s.mmap {
+		ropts = append(ropts, UseMMap())
+	}
+
+	path, url := s.path, s.url
+	switch {
+	case url != "":
+		if s.token != "" {
+			ropts = append(ropts, UseBearerAuth(s.token))
+		}
+	case s.hfRepo != "" && s.hfFile != "":
+		url = fmt.Sprintf("%s/%s/resolve/main/%s",
+			osx.Getenv("HF_ENDPOINT", "https://huggingface.co"), s.hfRepo, s.hfFile)
+		if s.hfToken != "" {
+			ropts = append(ropts, UseBearerAuth(s.hfToken))
+		}
+	}
+
+	archive := false
+	switch {
+	default:
+		return nil, nil, errors.New("no model specified")
+	case path != "":
+		if ap, an, ok := splitArchivePath(path); ok {
+			archive = true
+			gf, err = ParseGGUFFileFromTar(ap, an, ropts...)
+			break
+		}
+		gf, err = ParseGGUFFile(path, ropts...)
+	case url != "":
+		if au, an, ok := splitArchivePath(url); ok {
+			archive = true
+			gf, err = ParseGGUFFileFromTarRemote(ctx, au, an, ropts...)
+			break
+		}
+		gf, err = ParseGGUFFileRemote(ctx, url, ropts...)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse GGUF file: %w", err)
+	}
+	if !withSources {
+		return gf, nil, nil
+	}
+	if archive {
+		return nil, nil, errors.New("reading tensor data inside an archive is not supported")
+	}
+
+	if path != "" {
+		srcs, err = OpenGGUFFileSources(path, ropts...)
+	} else {
+		srcs, err = OpenGGUFFileSourcesRemote(ctx, url, ropts...)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open GGUF file: %w", err)
+	}
+	return gf, srcs, nil
+}
+
+// splitArchivePath splits the given path or url in the form of "archive.tar#model.gguf",
+// returns the archive, the entry name and true if it is an archive path.
+//
+// The entry name can be empty to select the first GGUF file inside the archive.
+func splitArchivePath(s string) (archive, name string, ok bool) {
+	i := strings.LastIndex(s, "#")
+	if i < 0 {
+		return "", "", false
+	}
+	archive, name = s[:i], s[i+1:]
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(strings.ToLower(archive), ext) {
+			return archive, name, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+func splitCommand() *cli.Command {
+	var (
+		src        ggufSource
+		output     string
+		maxSize    string
+		maxTensors uint64
+	)
+	return &cli.Command{
+		Name:  "split",
+		Usage: "Split a GGUF file into shards as llama.cpp gguf-split does.",
+		UsageText: "split [--path model.gguf | --url https://... | --hf-repo repo --hf-file model.gguf] --output prefix " +
+			"(--split-max-size 2G | --split-max-tensors 128)",
+		Flags: append(src.Flags(),
+			&cli.StringFlag{
+				Destination: &output,
+				Value:       output,
+				Name:        "output",
+				Aliases:     []string{"o"},
+				Usage: "Path prefix of the shards, " +
+					"e.g. \"--output path/to/model\" writes \"path/to/model-00001-of-00003.gguf\" and so on.",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Destination: &maxSize,
+				Value:       maxSize,
+				Name:        "split-max-size",
+				Usage: "Maximum tensor data size of each shard, " +
+					"e.g. 500M, 2G or 2GiB, " +
+					"a shard holding only one tensor may exceed the limit.",
+			},
+			&cli.Uint64Flag{
+				Destination: &maxTensors,
+				Value:       maxTensors,
+				Name:        "split-max-tensors",
+				Usage:       "Maximum number of tensors of each shard.",
+			},
+		),
+		Action: func(c *cli.Context) error {
+			var opts []GGUFSplitOption
+			switch {
+			case (maxSize == "") == (maxTensors == 0):
+				return errors.New("either --split-max-size or --split-max-tensors must be specified")
+			case maxSize != "":
+				sz, err := ParseGGUFBytesScalar(maxSize)
+				if err != nil || sz == 0 {
+					return fmt.Errorf("invalid --split-max-size %q", maxSize)
+				}
+				opts = append(opts, WithSplitMaxSize(uint64(sz)))
+			default:
+				opts = append(opts, WithSplitMaxTensors(maxTensors))
+			}
+
+			gf, srcs, err := src.Open(c.Context, true, UseRawStrings())
+			if err != nil {
+				return err
+			}
+			defer func() { _ = srcs.Close() }()
+
+			output = strings.TrimSuffix(output, ".gguf")
+			ps, err := SplitGGUFFile(gf, srcs.ReaderAts(), output, opts...)
+			if err != nil {
+				return fmt.Errorf("failed to split GGUF file: %w", err)
+			}
+			for _, p := range ps {
+				fmt.Println(p)
+			}
+			fmt.Printf("Split into %d shards with %d tensors\n", len(ps), len(gf.TensorInfos))
+			return nil
+		},
+	}
+}
+
+func mergeCommand() *cli.Command {
+	var (
+		paths  cli.StringSlice
+		output string
+	)
+	return &cli.Command{
+		Name:      "merge",
+		Usage:     "Merge the shards of a GGUF file into one as llama.cpp gguf-split does.",
+		UsageText: "merge --path model-00001-of-00003.gguf [--path model-00002-of-00003.gguf]... --output model.gguf",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Destination: &paths,
+				Value:       &paths,
+				Name:        "path",
+				Aliases:     []string{"model", "m"},
+				Usage: "Path where the shards to merge in order, " +
+					"if only one shard is given, the others are located by the filename.",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Destination: &output,
+				Value:       output,
+				Name:        "output",
+				Aliases:     []string{"o"},
+				Usage:       "Path where the merged GGUF file to write.",
+				Required:    true,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if err := MergeGGUFFiles(paths.Value(), output); err != nil {
+				return fmt.Errorf("failed to merge GGUF files: %w", err)
+			}
+			fmt.Printf("Merged into %s\n", output)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+func templateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "template",
+		Usage: "List or render the chat templates of a GGUF file.",
+		Subcommands: []*cli.Command{
+			templateListCommand(),
+			templateRenderCommand(),
+		},
+	}
+}
+
+func templateListCommand() *cli.Command {
+	var (
+		src    ggufSource
+		inJson bool
+	)
+	return &cli.Command{
+		Name:      "list",
+		Usage:     "List the chat templates of a GGUF file.",
+		UsageText: "template list [--path model.gguf | --url https://... | --hf-repo repo --hf-file model.gguf] [--json]",
+		Flags: append(src.Flags(),
+			&cli.BoolFlag{
+				Destination: &inJson,
+				Value:       inJson,
+				Name:        "json",
+				Usage:       "Output as JSON.",
+			},
+		),
+		Action: func(c *cli.Context) error {
+			gf, _, err := src.Open(c.Context, false)
+			if err != nil {
+				return err
+			}
+			cts := gf.ChatTemplates()
+
+			if inJson {
+				enc := json.NewEncoder(os.Stdout)
+				if inPrettyJson {
+					enc.SetIndent("", "  ")
+				}
+				return enc.Encode(cts)
+			}
+
+			bd := make([][]any, len(cts))
+			for i, ct := range cts {
+				bd[i] = []any{
+					ct.Name,
+					sprintf(strings.Count(ct.Template, "\n") + 1),
+					GGUFBytesScalar(len(ct.Template)),
+					tenary(ct.BOSToken != "", ct.BOSToken, "N/A"),
+					tenary(ct.EOSToken != "", ct.EOSToken, "N/A"),
+				}
+			}
+			tprint("TEMPLATES", [][]any{{"Name", "Lines", "Size", "BOS Token", "EOS Token"}}, bd)
+			return nil
+		},
+	}
+}
+
+func templateRenderCommand() *cli.Command {
+	var (
+		src                 ggufSource
+		name                = GGUFChatTemplateDefaultName
+		messages            string
+		tools               string
+		addGenerationPrompt bool
+		vars                cli.StringSlice
+	)
+	return &cli.Command{
+		Name:  "render",
+		Usage: "Render the messages into the prompt with a chat template of a GGUF file.",
+		UsageText: "template render [--path model.gguf | --url https://... | --hf-repo repo --hf-file model.gguf] " +
+			"--messages msgs.json [--tools tools.json] [--name default] [--add-generation-prompt] [--var key=value ...]",
+		Flags: append(src.Flags(),
+			&cli.StringFlag{
+				Destination: &name,
+				Value:       name,
+				Name:        "name",
+				Usage:       "Name of the chat template to render, e.g. \"tool_use\" for \"tokenizer.chat_template.tool_use\".",
+			},
+			&cli.StringFlag{
+				Destination: &messages,
+				Value:       messages,
+				Name:        "messages",
+				Required:    true,
+				Usage:       "Path where the JSON list of messages to render, use \"-\" to read from stdin.",
+			},
+			&cli.StringFlag{
+				Destination: &tools,
+				Value:       tools,
+				Name:        "tools",
+				Usage:       "Path where the JSON list of tools to render, optional.",
+			},
+			&cli.BoolFlag{
+				Destination: &addGenerationPrompt,
+				Value:       addGenerationPrompt,
+				Name:        "add-generation-prompt",
+				Usage:       "Append the tokens that indicate the start of an assistant message.",
+			},
+			&cli.StringSliceFlag{
+				Destination: &vars,
+				Name:        "var",
+				Usage: "Extra variable to render in the form of \"key=value\", " +
+					"the value is parsed as JSON if possible, e.g. \"enable_thinking=false\".",
+			},
+		),
+		Action: func(c *cli.Context) error {
+			msgs, err := readTemplateJSON(messages)
+			if err != nil {
+				return fmt.Errorf("failed to read messages: %w", err)
+			}
+			var opts []GGUFChatTemplateOption
+			if tools != "" {
+				ts, err := readTemplateJSON(tools)
+				if err != nil {
+					return fmt.Errorf("failed to read tools: %w", err)
+				}
+				opts = append(opts, WithChatTemplateTools(ts))
+			}
+			if addGenerationPrompt {
+				opts = append(opts, WithChatTemplateAddGenerationPrompt())
+			}
+			for _, v := range vars.Value() {
+				k, s, ok := strings.Cut(v, "=")
+				if !ok || k == "" {
+					return fmt.Errorf("invalid variable %q, must be in the form of \"key=value\"", v)
+				}
+				var val any = s
+				if json.Valid([]byte(s)) {
+					val = json.RawMessage(s)
+				}
+				opts = append(opts, WithChatTemplateVariable(k, val))
+			}
+
+			gf, _, err := src.Open(c.Context, false)
+			if err != nil {
+				return err
+			}
+			ct, ok := gf.ChatTemplate(name)
+			if !ok {
+				return fmt.Errorf("chat template %q not found", name)
+			}
+			p, err := ct.Render(msgs, opts...)
+			if err != nil {
+				return err
+			}
+			fmt.Print(p)
+			return nil
+		},
+	}
+}
+
+// readTemplateJSON reads the JSON from the given path or stdin,
+// the raw message is returned to keep the key order.
+func readTemplateJSON(path string) (json.RawMessage, error) {
+	var (
+		bs  []byte
+		err error
+	)
+	if path == "-" {
+		bs, err = io.ReadAll(os.Stdin)
+	} else {
+		bs, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(bs) {
+		return nil, errors.New("invalid JSON")
+	}
+	return bs, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+func tensorsCommand() *cli.Command {
+	var (
+		src    ggufSource
+		stats  bool
+		inJson bool
+	)
+	return &cli.Command{
+		Name:      "tensors",
+		Usage:     "List the tensors of a GGUF file, optionally with the numeric statistics.",
+		UsageText: "tensors [--path model.gguf | --url https://... | --hf-repo repo --hf-file model.gguf] [--stats] [--json]",
+		Flags: append(src.Flags(),
+			&cli.BoolFlag{
+				Destination: &stats,
+				Value:       stats,
+				Name:        "stats",
+				Usage: "Stream the tensor data to compute the numeric statistics(min, max, mean, std, NaN/Inf count) " +
+					"of each tensor and each layer, " +
+					"the tensors cannot be dequantized are skipped.",
+			},
+			&cli.BoolFlag{
+				Destination: &inJson,
+				Value:       inJson,
+				Name:        "json",
+				Usage:       "Output as JSON.",
+			},
+		),
+		Action: func(c *cli.Context) error {
+			gf, srcs, err := src.Open(c.Context, stats)
+			if err != nil {
+				return err
+			}
+			if srcs != nil {
+				defer func() { _ = srcs.Close() }()
+			}
+
+			var st GGUFTensorsStatistics
+			if stats {
+				st, err = gf.TensorStatistics(srcs.ReaderAts()...)
+				if err != nil {
+					return fmt.Errorf("failed to compute tensor statistics: %w", err)
+				}
+			}
+
+			if inJson {
+				return printTensorsJSON(gf, st, stats)
+			}
+			printTensorsTable(gf, st, stats)
+			return nil
+		},
+	}
+}
+
+func printTensorsJSON(gf *GGUFFile, st GGUFTensorsStatistics, stats bool) error {
+	type tensor struct {
+		Name       string   `json:"name"`
+		Type       GGMLType `json:"type"`
+		Dimensions []uint64 `json:"dimensions"`
+		Size       uint64   `json:"size"`
+
+		Statistics *GGUFTensorStatistics `json:"statistics,omitempty"`
+	}
+	o := struct {
+		Tensors []tensor              `json:"tensors"`
+		Layers  []GGUFLayerStatistics `json:"layers,omitempty"`
+	}{
+		Tensors: make([]tensor, len(gf.TensorInfos)),
+		Layers:  st.Layers,
+	}
+	for i, ti := range gf.TensorInfos {
+		o.Tensors[i] = tensor{
+			Name:       ti.Name,
+			Type:       ti.Type,
+			Dimensions: ti.Dimensions,
+			Size:       ti.Bytes(),
+		}
+		if stats {
+			o.Tensors[i].Statistics = &st.Tensors[i]
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	if inPrettyJson {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(o)
+}
+
+func printTensorsTable(gf *GGUFFile, st GGUFTensorsStatistics, stats bool) {
+	hd := []any{"#", "Name", "Type", "Dimensions", "Size"}
+	if stats {
+		hd = append(hd, "Min", "Max", "Mean", "Std", "NaN", "Inf", "Zero", sparsityHeader())
+	}
+	bd := make([][]any, len(gf.TensorInfos))
+	for i, ti := range gf.TensorInfos {
+		ds := make([]string, len(ti.Dimensions))
+		for j := range ti.Dimensions {
+			ds[j] = sprintf(ti.Dimensions[j])
+		}
+		bd[i] = []any{
+			i,
+			ti.Name,
+			ti.Type.String(),
+			"[" + strings.Join(ds, ", ") + "]",
+			GGUFBytesScalar(ti.Bytes()),
+		}
+		if stats {
+			bd[i] = append(bd[i], statisticsRow(st.Tensors[i].GGUFNumericStatistics, st.Tensors[i].Skipped)...)
+		}
+	}
+	tprint("TENSORS", [][]any{hd}, bd)
+
+	if !stats || len(st.Layers) == 0 {
+		return
+	}
+	hd = []any{"Name", "Tensors", "Elements", "Min", "Max", "Mean", "Std", "NaN", "Inf", "Zero", sparsityHeader()}
+	bd = make([][]any, len(st.Layers))
+	for i, l := range st.Layers {
+		bd[i] = append([]any{l.Name, l.Count, l.Elements}, statisticsRow(l.GGUFNumericStatistics, false)...)
+	}
+	tprint("LAYERS", [][]any{hd}, bd)
+}
+
+func statisticsRow(s GGUFNumericStatistics, skipped bool) []any {
+	if skipped {
+		return []any{"N/A", "N/A", "N/A", "N/A", "N/A", "N/A", "N/A", "N/A"}
+	}
+	sp := make([]string, len(s.Sparsity))
+	for i := range s.Sparsity {
+		sp[i] = sprintf(s.Sparsity[i])
+	}
+	return []any{
+		sprintf("%.6g", s.Min),
+		sprintf("%.6g", s.Max),
+		sprintf("%.6g", s.Mean),
+		sprintf("%.6g", s.Std),
+		s.NaNs,
+		s.Infs,
+		s.Zeros,
+		strings.Join(sp, "/"),
+	}
+}
+
+// sparsityHeader returns the header of the sparsity histogram column,
+// which lists the magnitude buckets, e.g. "Sparsity (<1e-08/.../>=1)".
+func sparsityHeader() string {
+	bs := make([]string, 0, len(GGUFSparsityBounds)+1)
+	for _, b := range GGUFSparsityBounds {
+		bs = append(bs, sprintf("<%g", b))
+	}
+	bs = append(bs, sprintf(">=%g", GGUFSparsityBounds[len(GGUFSparsityBounds)-1]))
+	return "Sparsity (" + strings.Join(bs, "/") + ")"
+}
@@ -1,7 +1,6 @@
 package gguf_parser
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -32,6 +31,8 @@ type GGUFFile struct {
 	TensorInfos GGUFTensorInfos `json:"tensorInfos"`
 	// Padding is the padding size of the GGUF file,
 	// which is used to split Header and TensorInfos from tensor data.
+	//
+	// The padding is zero if the end of TensorInfos is already aligned.
 	Padding int64 `json:"padding"`
 	// SplitPaddings holds the padding size slice of the GGUF file splits,
 	// each item represents splitting Header and TensorInfos from tensor data.
@@ -47,6 +48,11 @@ type GGUFFile struct {
 	//
 	// The length of SplitTensorDataStartOffsets is the number of split files.
 	SplitTensorDataStartOffsets []int64 `json:"splitTensorDataStartOffsets,omitempty"`
+	// SplitTensorCounts holds the tensor count slice of the GGUF file splits,
+	// each item represents the number of tensors in the split file.
+	//
+	// The length of SplitTensorCounts is the number of split files.
+	SplitTensorCounts []uint64 `json:"splitTensorCounts,omitempty"`
 
 	/* Appendix */
 
@@ -71,6 +77,13 @@ type GGUFFile struct {
 	// which describes how many bits are used to store a weight,
 	// higher is better.
 	ModelBitsPerWeight GGUFBitsPerWeightScalar `json:"modelBitsPerWeight"`
+	// Legacy is true if the file is parsed from the legacy GGML, GGMF or GGJT format,
+	// whose metadata is synthesized from the hyperparameters and the vocabulary,
+	// and whose tensor names are converted to the GGUF ones.
+	//
+	// The tensor data of legacy file is interleaved with the tensor infos,
+	// and the Q4_0, Q4_1, Q8_0 and Q8_1 tensors before GGJT v3 are slightly larger than the GGUF ones.
+	Legacy bool `json:"legacy,omitempty"`
 }
 
 // GGUFMagic is a magic number of GGUF file,
@@ -207,6 +220,27 @@ type (
 
 var ErrGGUFFileInvalidFormat = errors.New("invalid GGUF format")
 
+// GGUFFileLimitError is returned when the value read from the file exceeds the limit,
+// see UseMaxStringLength, UseMaxArrayLength, UseMaxTensorCount and UseMaxMetadataBytes.
+//
+// GGUFFileLimitError wraps ErrGGUFFileInvalidFormat.
+type GGUFFileLimitError struct {
+	// Limit is the name of the exceeded limit.
+	Limit string
+	// Value is the value read from the file.
+	Value uint64
+	// Max is the maximum value allowed.
+	Max uint64
+}
+
+func (e *GGUFFileLimitError) Error() string {
+	return fmt.Sprintf("%v: %s %d exceeds the limit %d", ErrGGUFFileInvalidFormat, e.Limit, e.Value, e.Max)
+}
+
+func (e *GGUFFileLimitError) Unwrap() error {
+	return ErrGGUFFileInvalidFormat
+}
+
 // ParseGGUFFile parses a GGUF file from the local given path,
 // and returns the GGUFFile, or an error if any.
 func ParseGGUFFile(path string, opts ...GGUFReadOption) (*GGUFFile, error) {
@@ -215,6 +249,22 @@ func ParseGGUFFile(path string, opts ...GGUFReadOption) (*GGUFFile, error) {
 		opt(&o)
 	}
 
+	fs, err := openGGUFFile(path, o)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for i := range fs {
+			osx.Close(fs[i])
+		}
+	}()
+
+	return parseGGUFFile(fs, o)
+}
+
+// openGGUFFile opens the local GGUF file and its shards,
+// and returns the list of _GGUFFileReadSeeker, or an error if any.
+func openGGUFFile(path string, o _GGUFReadOptions) (_ []_GGUFFileReadSeeker, err error) {
 	var paths []string
 	{
 		rs := CompleteShardGGUFFilename(path)
@@ -227,6 +277,9 @@ func ParseGGUFFile(path string, opts ...GGUFReadOption) (*GGUFFile, error) {
 
 	fs := make([]_GGUFFileReadSeeker, 0, len(paths))
 	defer func() {
+		if err == nil {
+			return
+		}
 		for i := range fs {
 			osx.Close(fs[i])
 		}
@@ -260,7 +313,7 @@ func ParseGGUFFile(path string, opts ...GGUFReadOption) (*GGUFFile, error) {
 		})
 	}
 
-	return parseGGUFFile(fs, o)
+	return fs, nil
 }
 
 type _GGUFFileReadSeeker struct {
@@ -270,6 +323,19 @@ type _GGUFFileReadSeeker struct {
 }
 
 func parseGGUFFile(fs []_GGUFFileReadSeeker, o _GGUFReadOptions) (_ *GGUFFile, err error) {
+	if o.MaxStringLength == 0 {
+		o.MaxStringLength = DefaultMaxStringLength
+	}
+	if o.MaxArrayLength == 0 {
+		o.MaxArrayLength = DefaultMaxArrayLength
+	}
+	if o.MaxTensorCount == 0 {
+		o.MaxTensorCount = DefaultMaxTensorCount
+	}
+	if o.MaxMetadataBytes == 0 {
+		o.MaxMetadataBytes = DefaultMaxMetadataBytes
+	}
+
 	var gf GGUFFile
 
 	for _, f := range fs {
@@ -284,7 +350,10 @@ func parseGGUFFile(fs []_GGUFFileReadSeeker, o _GGUFReadOptions) (_ *GGUFFile, e
 		default:
 			return nil, ErrGGUFFileInvalidFormat
 		case GGUFMagicGGML, GGUFMagicGGMF, GGUFMagicGGJT:
-			return nil, fmt.Errorf("unsupported format: %s", magic)
+			if len(fs) != 1 {
+				return nil, fmt.Errorf("unsupported format: split %s", magic)
+			}
+			return parseGGUFFileLegacy(f, magic, o)
 		case GGUFMagicGGUFLe:
 		case GGUFMagicGGUFBe:
 			bo = binary.BigEndian
@@ -298,7 +367,7 @@ func parseGGUFFile(fs []_GGUFFileReadSeeker, o _GGUFReadOptions) (_ *GGUFFile, e
 		}
 		gf.Header.Version = version
 
-		rd := _GGUFReader{v: version, o: o, f: f, bo: bo}
+		rd := _GGUFReader{v: version, o: o, f: f, s: f.Size, bo: bo}
 
 		// tensor count
 		var tensorCount uint64
@@ -310,7 +379,13 @@ func parseGGUFFile(fs []_GGUFFileReadSeeker, o _GGUFReadOptions) (_ *GGUFFile, e
 		if err != nil {
 			return nil, fmt.Errorf("read tensor count: %w", err)
 		}
+		if err = rd.CheckLength("tensor count", tensorCount, o.MaxTensorCount, rd.MinTensorInfoSize()); err != nil {
+			return nil, err
+		}
 		gf.Header.TensorCount += tensorCount
+		if gf.Header.TensorCount > o.MaxTensorCount {
+			return nil, &GGUFFileLimitError{Limit: "tensor count", Value: gf.Header.TensorCount, Max: o.MaxTensorCount}
+		}
 
 		// metadata kv count
 		var metadataKVCount uint64
@@ -322,17 +397,23 @@ func parseGGUFFile(fs []_GGUFFileReadSeeker, o _GGUFReadOptions) (_ *GGUFFile, e
 		if err != nil {
 			return nil, fmt.Errorf("read metadata kv count: %w", err)
 		}
+		if err = rd.CheckLength("metadata kv count", metadataKVCount, 0, rd.MinMetadataKVSize()); err != nil {
+			return nil, err
+		}
 		gf.Header.MetadataKVCount += metadataKVCount
 
 		// metadata kv
+		kvs := make(GGUFMetadataKVs, metadataKVCount)
 		{
 			rd := _GGUFMetadataReader{_GGUFReader: rd}
-			kvs := make(GGUFMetadataKVs, metadataKVCount)
 			for i := uint64(0); i < metadataKVCount; i++ {
 				kvs[i], err = rd.Read()
 				if err != nil {
 					return nil, fmt.Errorf("read metadata kv %d: %w", i, err)
 				}
+				if err = rd.CheckMetadataBytes(); err != nil {
+					return nil, err
+				}
 			}
 			for i := range kvs {
 				if kvs[i].Key == "split.no" {
@@ -347,7 +428,7 @@ func parseGGUFFile(fs []_GGUFFileReadSeeker, o _GGUFReadOptions) (_ *GGUFFile, e
 		if gf.TensorInfos == nil {
 			tc, ok := gf.Header.MetadataKV.Get("split.tensors.count")
 			if ok {
-				gf.TensorInfos = make(GGUFTensorInfos, 0, anyx.Number[int](tc.Value))
+				gf.TensorInfos = make(GGUFTensorInfos, 0, min(anyx.Number[uint64](tc.Value), o.MaxTensorCount))
 			} else {
 				gf.TensorInfos = make(GGUFTensorInfos, 0, tensorCount)
 			}
@@ -361,7 +442,11 @@ func parseGGUFFile(fs []_GGUFFileReadSeeker, o _GGUFReadOptions) (_ *GGUFFile, e
 					return nil, fmt.Errorf("read tensor info %d: %w", i, err)
 				}
 			}
+			if err = rd.CheckMetadataBytes(); err != nil {
+				return nil, err
+			}
 			gf.TensorInfos = append(gf.TensorInfos, tis...)
+			gf.SplitTensorCounts = append(gf.SplitTensorCounts, tensorCount)
 		}
 
 		pds, err := f.Seek(0, io.SeekCurrent)
@@ -376,11 +461,20 @@ func parseGGUFFile(fs []_GGUFFileReadSeeker, o _GGUFReadOptions) (_ *GGUFFile, e
 			// This can vary to allow for different alignment schemes, but it must be a multiple of 8.
 			// Some writers may not write the alignment.
 			// If the alignment is not specified, assume it is 32.
+			//
+			// Each split file has its own alignment,
+			// e.g. llama.cpp only writes the general.* metadata into the first split file.
 			var ag uint32 = 32
-			if v, ok := gf.Header.MetadataKV.Get("general.alignment"); ok {
+			if v, ok := kvs.Get("general.alignment"); ok {
+				if v.ValueType != GGUFMetadataValueTypeUint32 {
+					return nil, fmt.Errorf("%w: invalid alignment type %v", ErrGGUFFileInvalidFormat, v.ValueType)
+				}
 				ag = v.ValueUint32()
+				if ag == 0 || ag&(ag-1) != 0 {
+					return nil, fmt.Errorf("%w: invalid alignment %d", ErrGGUFFileInvalidFormat, ag)
+				}
 			}
-			padding = int64(ag) - (pds % int64(ag))
+			padding = int64(GGMLPadding(uint64(pds), uint64(ag))) - pds
 		}
 		if len(fs) == 1 {
 			gf.Padding = padding
@@ -467,6 +561,30 @@ func (gf *GGUFFile) Layers(ignores ...string) GGUFLayerTensorInfos {
 	return gf.TensorInfos.Layers(ignores...)
 }
 
+// tensorInfoSplitIndexes returns the split file index of each GGUFTensorInfo,
+// or an error if the split files cannot be resolved.
+func (gf *GGUFFile) tensorInfoSplitIndexes() ([]int, error) {
+	idxs := make([]int, len(gf.TensorInfos))
+	if len(gf.SplitTensorDataStartOffsets) <= 1 {
+		return idxs, nil
+	}
+	if len(gf.SplitTensorCounts) != len(gf.SplitTensorDataStartOffsets) {
+		return nil, errors.New("unresolved tensor split counts")
+	}
+
+	var i int
+	for s, c := range gf.SplitTensorCounts {
+		for j := uint64(0); j < c && i < len(idxs); j++ {
+			idxs[i] = s
+			i++
+		}
+	}
+	if i != len(idxs) {
+		return nil, errors.New("mismatched tensor split counts")
+	}
+	return idxs, nil
+}
+
 func (kv GGUFMetadataKV) ValueUint8() uint8 {
 	if kv.ValueType != GGUFMetadataValueTypeUint8 {
 		panic(fmt.Errorf("invalid type: %v", kv.ValueType))
@@ -832,6 +950,109 @@ func (kvs GGUFMetadataKVs) Index(keys []string) (values map[string]GGUFMetadataK
 	return values, found
 }
 
+// Set sets the value of the GGUFMetadataKV with the given key,
+// appends a new GGUFMetadataKV if the key is not found,
+// and returns an error if the value does not match the given type.
+func (kvs *GGUFMetadataKVs) Set(key string, vt GGUFMetadataValueType, value any) error {
+	if key == "" {
+		return errors.New("empty key")
+	}
+	if err := checkGGUFMetadataValue(vt, value); err != nil {
+		return fmt.Errorf("check %s value: %w", key, err)
+	}
+
+	kv := GGUFMetadataKV{Key: key, ValueType: vt, Value: value}
+	for i := range *kvs {
+		if (*kvs)[i].Key == key {
+			(*kvs)[i] = kv
+			return nil
+		}
+	}
+	*kvs = append(*kvs, kv)
+	return nil
+}
+
+// Delete deletes the GGUFMetadataKV with the given key,
+// and returns true if found, and false otherwise.
+func (kvs *GGUFMetadataKVs) Delete(key string) bool {
+	for i := range *kvs {
+		if (*kvs)[i].Key == key {
+			*kvs = append((*kvs)[:i], (*kvs)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Rename renames the GGUFMetadataKV with the given old key to the new key,
+// and returns an error if the old key is not found or the new key already exists.
+func (kvs GGUFMetadataKVs) Rename(oldKey, newKey string) error {
+	if newKey == "" {
+		return errors.New("empty key")
+	}
+	if _, found := kvs.Get(newKey); found {
+		return fmt.Errorf("key %s already exists", newKey)
+	}
+	for i := range kvs {
+		if kvs[i].Key == oldKey {
+			kvs[i].Key = newKey
+			return nil
+		}
+	}
+	return fmt.Errorf("key %s not found", oldKey)
+}
+
+// checkGGUFMetadataValue checks whether the given value matches the given GGUFMetadataValueType.
+func checkGGUFMetadataValue(vt GGUFMetadataValueType, value any) error {
+	var ok bool
+	switch vt {
+	case GGUFMetadataValueTypeUint8:
+		_, ok = value.(uint8)
+	case GGUFMetadataValueTypeInt8:
+		_, ok = value.(int8)
+	case GGUFMetadataValueTypeUint16:
+		_, ok = value.(uint16)
+	case GGUFMetadataValueTypeInt16:
+		_, ok = value.(int16)
+	case GGUFMetadataValueTypeUint32:
+		_, ok = value.(uint32)
+	case GGUFMetadataValueTypeInt32:
+		_, ok = value.(int32)
+	case GGUFMetadataValueTypeFloat32:
+		_, ok = value.(float32)
+	case GGUFMetadataValueTypeBool:
+		_, ok = value.(bool)
+	case GGUFMetadataValueTypeString:
+		_, ok = value.(string)
+	case GGUFMetadataValueTypeArray:
+		var av GGUFMetadataKVArrayValue
+		av, ok = value.(GGUFMetadataKVArrayValue)
+		if !ok {
+			break
+		}
+		if av.Len != uint64(len(av.Array)) {
+			return fmt.Errorf("mismatched array length: want %d, got %d", av.Len, len(av.Array))
+		}
+		for i := range av.Array {
+			if err := checkGGUFMetadataValue(av.Type, av.Array[i]); err != nil {
+				return fmt.Errorf("check array item %d: %w", i, err)
+			}
+		}
+	case GGUFMetadataValueTypeUint64:
+		_, ok = value.(uint64)
+	case GGUFMetadataValueTypeInt64:
+		_, ok = value.(int64)
+	case GGUFMetadataValueTypeFloat64:
+		_, ok = value.(float64)
+	default:
+		return fmt.Errorf("invalid type: %v", vt)
+	}
+	if !ok {
+		return fmt.Errorf("invalid %s value: %T", vt, value)
+	}
+	return nil
+}
+
 // Get returns the GGUFTensorInfo with the given name,
 // and true if found, and false otherwise.
 func (ti GGUFTensorInfo) Get(name string) (info GGUFTensorInfo, found bool) {
@@ -1377,9 +1598,81 @@ type _GGUFReader struct {
 	v  GGUFVersion
 	o  _GGUFReadOptions
 	f  io.ReadSeeker
+	s  int64
 	bo binary.ByteOrder
 }
 
+// CheckLength checks the given length prefix read from the file,
+// returns an error if the length exceeds the given limit,
+// or the remaining bytes cannot hold the length of items with the given minimum item size.
+//
+// The limit is ignored if it is 0.
+func (rd _GGUFReader) CheckLength(what string, l, limit, itemSize uint64) error {
+	if limit != 0 && l > limit {
+		return &GGUFFileLimitError{Limit: what, Value: l, Max: limit}
+	}
+
+	// Skip seeking for the small length.
+	if l*itemSize <= 4096 && l <= 4096 {
+		return nil
+	}
+	pos, err := rd.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("seek %s: %w", what, err)
+	}
+	if r := uint64(max(rd.s-pos, 0)); l > r/max(itemSize, 1) {
+		return fmt.Errorf("%w: %s %d exceeds the remaining %d bytes", ErrGGUFFileInvalidFormat, what, l, r)
+	}
+	return nil
+}
+
+// CheckMetadataBytes checks the current position against the limit of metadata bytes.
+func (rd _GGUFReader) CheckMetadataBytes() error {
+	pos, err := rd.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("seek metadata end: %w", err)
+	}
+	if rd.o.MaxMetadataBytes != 0 && uint64(pos) > rd.o.MaxMetadataBytes {
+		return &GGUFFileLimitError{Limit: "metadata bytes", Value: uint64(pos), Max: rd.o.MaxMetadataBytes}
+	}
+	return nil
+}
+
+// lengthSize returns the size in bytes of a length prefix.
+func (rd _GGUFReader) lengthSize() uint64 {
+	if rd.v <= GGUFVersionV1 {
+		return 4
+	}
+	return 8
+}
+
+// MinValueSize returns the minimum size in bytes of a value with the given type.
+func (rd _GGUFReader) MinValueSize(vt GGUFMetadataValueType) uint64 {
+	switch vt {
+	case GGUFMetadataValueTypeUint16, GGUFMetadataValueTypeInt16:
+		return 2
+	case GGUFMetadataValueTypeUint32, GGUFMetadataValueTypeInt32, GGUFMetadataValueTypeFloat32:
+		return 4
+	case GGUFMetadataValueTypeUint64, GGUFMetadataValueTypeInt64, GGUFMetadataValueTypeFloat64:
+		return 8
+	case GGUFMetadataValueTypeString:
+		return rd.lengthSize()
+	case GGUFMetadataValueTypeArray:
+		return 4 + rd.lengthSize()
+	}
+	return 1
+}
+
+// MinMetadataKVSize returns the minimum size in bytes of a GGUFMetadataKV.
+func (rd _GGUFReader) MinMetadataKVSize() uint64 {
+	return rd.lengthSize() + 4 + 1
+}
+
+// MinTensorInfoSize returns the minimum size in bytes of a GGUFTensorInfo.
+func (rd _GGUFReader) MinTensorInfoSize() uint64 {
+	return rd.lengthSize() + 4 + 4 + 8
+}
+
 func (rd _GGUFReader) ReadUint8() (v uint8, err error) {
 	err = binary.Read(rd.f, rd.bo, &v)
 	if err != nil {
@@ -1450,6 +1743,16 @@ func (rd _GGUFReader) ReadBool() (v bool, err error) {
 }
 
 func (rd _GGUFReader) ReadString() (v string, err error) {
+	v, err = rd.ReadRawString()
+	if rd.o.RawStrings {
+		return v, err
+	}
+	return strings.TrimSpace(v), err
+}
+
+// ReadRawString reads the string without trimming,
+// which keeps the whitespace array items, e.g. the "\n" token of the vocabulary.
+func (rd _GGUFReader) ReadRawString() (v string, err error) {
 	var l uint64
 	if rd.v <= GGUFVersionV1 {
 		l, err = rd.ReadUint64FromUint32()
@@ -1459,14 +1762,21 @@ func (rd _GGUFReader) ReadString() (v string, err error) {
 	if err != nil {
 		return "", fmt.Errorf("read string length: %w", err)
 	}
+	if err = rd.CheckLength("string length", l, rd.o.MaxStringLength, 1); err != nil {
+		return "", err
+	}
+
+	if l == 0 {
+		return "", nil
+	}
 
 	b := bytex.GetBytes(l)
 	defer bytex.Put(b)
-	if _, err = rd.f.Read(b); err != nil {
+	if _, err = io.ReadFull(rd.f, b); err != nil {
 		return "", fmt.Errorf("read string: %w", err)
 	}
 
-	return string(bytes.TrimSpace(b)), nil
+	return string(b), nil
 }
 
 func (rd _GGUFReader) SkipReadingString() (err error) {
@@ -1479,6 +1789,9 @@ func (rd _GGUFReader) SkipReadingString() (err error) {
 	if err != nil {
 		return fmt.Errorf("read string length: %w", err)
 	}
+	if err = rd.CheckLength("string length", l, rd.o.MaxStringLength, 1); err != nil {
+		return err
+	}
 	_, err = rd.f.Seek(int64(l), io.SeekCurrent)
 	if err != nil {
 		return fmt.Errorf("seek string: %w", err)
@@ -1495,6 +1808,9 @@ func (rd _GGUFReader) ReadArray() (v GGUFMetadataKVArrayValue, err error) {
 	if err = binary.Read(rd.f, rd.bo, &v.Type); err != nil {
 		return v, fmt.Errorf("read array item type: %w", err)
 	}
+	if v.Type >= _GGUFMetadataValueTypeCount {
+		return v, fmt.Errorf("%w: invalid array item type %v", ErrGGUFFileInvalidFormat, v.Type)
+	}
 
 	if rd.v <= GGUFVersionV1 {
 		v.Len, err = rd.ReadUint64FromUint32()
@@ -1504,6 +1820,9 @@ func (rd _GGUFReader) ReadArray() (v GGUFMetadataKVArrayValue, err error) {
 	if err != nil {
 		return v, fmt.Errorf("read array length: %w", err)
 	}
+	if err = rd.CheckLength("array length", v.Len, rd.o.MaxArrayLength, rd.MinValueSize(v.Type)); err != nil {
+		return v, err
+	}
 
 	itemStart, err := rd.f.Seek(0, io.SeekCurrent)
 	if err != nil {
@@ -1513,7 +1832,11 @@ func (rd _GGUFReader) ReadArray() (v GGUFMetadataKVArrayValue, err error) {
 	if !rd.o.SkipLargeMetadata {
 		v.Array = make([]any, v.Len)
 		for i := uint64(0); i < v.Len; i++ {
-			v.Array[i], err = rd.ReadValue(v.Type)
+			if v.Type == GGUFMetadataValueTypeString {
+				v.Array[i], err = rd.ReadRawString()
+			} else {
+				v.Array[i], err = rd.ReadValue(v.Type)
+			}
 			if err != nil {
 				return v, fmt.Errorf("read array item %d: %w", i, err)
 			}
@@ -1543,6 +1866,12 @@ func (rd _GGUFReader) ReadArray() (v GGUFMetadataKVArrayValue, err error) {
 				return v, fmt.Errorf("seek array[string] %d: %w", i, err)
 			}
 		}
+	case GGUFMetadataValueTypeArray:
+		for i := uint64(0); i < v.Len; i++ {
+			if _, err = rd.ReadArray(); err != nil {
+				return v, fmt.Errorf("seek array[array] %d: %w", i, err)
+			}
+		}
 	default:
 		// Should not happen.
 		panic(fmt.Errorf("invalid type: %v", v.Type))
@@ -1586,7 +1915,7 @@ func (rd _GGUFReader) ReadFloat64() (v float64, err error) {
 
 func (rd _GGUFReader) ReadValue(vt GGUFMetadataValueType) (v any, err error) {
 	if vt >= _GGUFMetadataValueTypeCount {
-		return nil, fmt.Errorf("invalid type: %v", vt)
+		return nil, fmt.Errorf("%w: invalid type %v", ErrGGUFFileInvalidFormat, vt)
 	}
 
 	switch vt {
@@ -1630,6 +1959,30 @@ type _GGUFMetadataReader struct {
 	_GGUFReader
 }
 
+// ggufSmallArrayKeys are the keys of the arrays that are read even if SkipLargeMetadata is set.
+var ggufSmallArrayKeys = map[string]struct{}{
+	"general.tags":      {},
+	"general.languages": {},
+}
+
+// ggufSmallArrayKeySuffixes are the key suffixes of the per-layer arrays that are read even if SkipLargeMetadata is set.
+var ggufSmallArrayKeySuffixes = []string{
+	".attention.sliding_window_pattern",
+}
+
+// isGGUFSmallArrayKey returns true if the given key is the key of a small array.
+func isGGUFSmallArrayKey(key string) bool {
+	if _, ok := ggufSmallArrayKeys[key]; ok {
+		return true
+	}
+	for _, s := range ggufSmallArrayKeySuffixes {
+		if strings.HasSuffix(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
 func (rd _GGUFMetadataReader) Read() (kv GGUFMetadataKV, err error) {
 	kv.Key, err = rd.ReadString()
 	if err != nil {
@@ -1643,11 +1996,16 @@ func (rd _GGUFMetadataReader) Read() (kv GGUFMetadataKV, err error) {
 		}
 		kv.ValueType = GGUFMetadataValueType(vt)
 		if kv.ValueType >= _GGUFMetadataValueTypeCount {
-			return kv, fmt.Errorf("invalid value type: %v", kv.ValueType)
+			return kv, fmt.Errorf("%w: invalid value type %v", ErrGGUFFileInvalidFormat, kv.ValueType)
 		}
 	}
 
-	kv.Value, err = rd.ReadValue(kv.ValueType)
+	vrd := rd._GGUFReader
+	if isGGUFSmallArrayKey(kv.Key) {
+		// Always read the small arrays.
+		vrd.o.SkipLargeMetadata = false
+	}
+	kv.Value, err = vrd.ReadValue(kv.ValueType)
 	if err != nil {
 		return kv, fmt.Errorf("read %s value: %w", kv.Key, err)
 	}
@@ -1674,6 +2032,9 @@ func (rd _GGUFTensorInfoReader) Read() (ti GGUFTensorInfo, err error) {
 	if err != nil {
 		return ti, fmt.Errorf("read n dimensions: %w", err)
 	}
+	if ti.NDimensions > GGMLMaxDims {
+		return ti, fmt.Errorf("%w: n dimensions %d exceeds %d", ErrGGUFFileInvalidFormat, ti.NDimensions, GGMLMaxDims)
+	}
 
 	ti.Dimensions = make([]uint64, ti.NDimensions)
 	for i := uint32(0); i < ti.NDimensions; i++ {
@@ -1694,7 +2055,7 @@ func (rd _GGUFTensorInfoReader) Read() (ti GGUFTensorInfo, err error) {
 		}
 		ti.Type = GGMLType(v)
 		if ti.Type >= _GGMLTypeCount {
-			return ti, fmt.Errorf("invalid type: %v", ti.Type)
+			return ti, fmt.Errorf("%w: invalid type %v", ErrGGUFFileInvalidFormat, ti.Type)
 		}
 	}
 
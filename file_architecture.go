@@ -66,8 +66,37 @@ type (
 		//
 		// Defaults to `EmbeddingLength / AttentionHeadCount`.
 		AttentionValueLength uint32 `json:"attentionValueLength,omitempty"`
+		// AttentionKeyLengthMLA(n_embd_head_k_mla) is the size of a key head after decompressing the latent,
+		// which is used in the MLA(Multi-head Latent Attention), e.g. DeepSeek V3 is 192.
+		//
+		// Zero if the model does not use MLA,
+		// or the model was converted before llama.cpp supports MLA.
+		AttentionKeyLengthMLA uint32 `json:"attentionKeyLengthMLA,omitempty"`
+		// AttentionValueLengthMLA(n_embd_head_v_mla) is the size of a value head after decompressing the latent,
+		// which is used in the MLA, e.g. DeepSeek V3 is 128.
+		AttentionValueLengthMLA uint32 `json:"attentionValueLengthMLA,omitempty"`
+		// AttentionQLoRARank(n_lora_q) is the rank of the compressed query,
+		// zero means the query is not compressed, e.g. DeepSeek V2 Lite.
+		AttentionQLoRARank uint32 `json:"attentionQLoRARank,omitempty"`
+		// AttentionKVLoRARank(n_lora_kv) is the rank of the compressed latent key and value,
+		// which is what the MLA caches instead of the key and value heads.
+		AttentionKVLoRARank uint32 `json:"attentionKVLoRARank,omitempty"`
 		// AttentionCausal is true if the attention is causal.
 		AttentionCausal bool `json:"attentionCausal,omitempty"`
+		// AttentionSlidingWindow(n_swa) is the size of the sliding window attention(SWA).
+		AttentionSlidingWindow uint64 `json:"attentionSlidingWindow,omitempty"`
+		// AttentionSlidingWindowPattern(n_pattern) describes the interleaved local/global layers,
+		// every AttentionSlidingWindowPattern-th layer is a global(full attention) layer,
+		// and the others are local(sliding window attention) layers,
+		// e.g. Gemma 2 is 2, Gemma 3 is 6.
+		//
+		// Zero means all layers are local if AttentionSlidingWindowLayers is not empty.
+		AttentionSlidingWindowPattern uint32 `json:"attentionSlidingWindowPattern,omitempty"`
+		// AttentionSlidingWindowLayers indicates whether each layer uses the sliding window attention,
+		// the length is BlockCount.
+		//
+		// Empty if the model does not use the sliding window attention.
+		AttentionSlidingWindowLayers []bool `json:"attentionSlidingWindowLayers,omitempty"`
 		// RoPEDimensionCount is the number of dimensions in the RoPE(Rotary Positional Encoding).
 		RoPEDimensionCount uint64 `json:"ropeDimensionCount,omitempty"`
 		// RoPEFrequencyBase is the base frequency of the RoPE.
@@ -201,6 +230,15 @@ type (
 	}
 )
 
+// AttentionMLA returns true if the model uses the MLA(Multi-head Latent Attention),
+// which caches the compressed latent key and value instead of the key and value heads.
+//
+// Models converted before llama.cpp supports MLA carry the LoRA ranks but not the MLA head lengths,
+// llama.cpp runs them as the normal multi-head attention.
+func (ga GGUFArchitecture) AttentionMLA() bool {
+	return ga.AttentionKVLoRARank > 0 && ga.AttentionKeyLengthMLA > 0 && ga.AttentionValueLengthMLA > 0
+}
+
 // DiffusionHasConditioners returns true if the diffusion model has conditioners.
 func (ga GGUFArchitecture) DiffusionHasConditioners() bool {
 	return len(ga.DiffusionConditioners) > 0
@@ -572,6 +610,18 @@ func (gf *GGUFFile) adapterArchitecture(arch string) (ga GGUFArchitecture) {
 	return ga
 }
 
+// ggufArchitectureSlidingWindowPatterns are the sliding window attention patterns of the architectures,
+// which are not declared by "<arch>.attention.sliding_window_pattern",
+// see https://github.com/ggml-org/llama.cpp/blob/master/src/llama-model.cpp.
+//
+// The other architectures declaring "<arch>.attention.sliding_window" only are treated as full attention,
+// as llama.cpp does.
+var ggufArchitectureSlidingWindowPatterns = map[string]uint32{
+	"gemma2":  2,
+	"gemma3":  6,
+	"cohere2": 4,
+}
+
 func (gf *GGUFFile) transformerArchitecture(arch string) (ga GGUFArchitecture) {
 	var (
 		contextLengthKey     = arch + ".context_length"
@@ -584,17 +634,23 @@ func (gf *GGUFFile) transformerArchitecture(arch string) (ga GGUFArchitecture) {
 		expertCountKey                   = arch + ".expert_count"
 		expertUsedCountKey               = arch + ".expert_used_count"
 
-		attentionHeadCountKey           = arch + ".attention.head_count"
-		attentionHeadCountKVKey         = arch + ".attention.head_count_kv"
-		attentionMaxALiBIBiasKey        = arch + ".attention.max_alibi_bias"
-		attentionMaxALiBIBiasKey2       = arch + ".attention.alibi_bias_max"
-		attentionClampKQVKey            = arch + ".attention.clamp_kqv"
-		attentionClampKQVKey2           = arch + ".attention.clip_kqv"
-		attentionLayerNormEpsilonKey    = arch + ".attention.layer_norm_epsilon"
-		attentionLayerNormRMSEpsilonKey = arch + ".attention.layer_norm_rms_epsilon"
-		attentionKeyLengthKey           = arch + ".attention.key_length"
-		attentionValueLengthKey         = arch + ".attention.value_length"
-		attentionCausalKey              = arch + ".attention.causal"
+		attentionHeadCountKey            = arch + ".attention.head_count"
+		attentionHeadCountKVKey          = arch + ".attention.head_count_kv"
+		attentionMaxALiBIBiasKey         = arch + ".attention.max_alibi_bias"
+		attentionMaxALiBIBiasKey2        = arch + ".attention.alibi_bias_max"
+		attentionClampKQVKey             = arch + ".attention.clamp_kqv"
+		attentionClampKQVKey2            = arch + ".attention.clip_kqv"
+		attentionLayerNormEpsilonKey     = arch + ".attention.layer_norm_epsilon"
+		attentionLayerNormRMSEpsilonKey  = arch + ".attention.layer_norm_rms_epsilon"
+		attentionKeyLengthKey            = arch + ".attention.key_length"
+		attentionValueLengthKey          = arch + ".attention.value_length"
+		attentionKeyLengthMLAKey         = arch + ".attention.key_length_mla"
+		attentionValueLengthMLAKey       = arch + ".attention.value_length_mla"
+		attentionQLoRARankKey            = arch + ".attention.q_lora_rank"
+		attentionKVLoRARankKey           = arch + ".attention.kv_lora_rank"
+		attentionCausalKey               = arch + ".attention.causal"
+		attentionSlidingWindowKey        = arch + ".attention.sliding_window"
+		attentionSlidingWindowPatternKey = arch + ".attention.sliding_window_pattern"
 
 		ropeDimensionCountKey         = arch + ".rope.dimension_count"
 		ropeFrequencyBaseKey          = arch + ".rope.freq_base"
@@ -635,7 +691,13 @@ func (gf *GGUFFile) transformerArchitecture(arch string) (ga GGUFArchitecture) {
 		attentionLayerNormRMSEpsilonKey,
 		attentionKeyLengthKey,
 		attentionValueLengthKey,
+		attentionKeyLengthMLAKey,
+		attentionValueLengthMLAKey,
+		attentionQLoRARankKey,
+		attentionKVLoRARankKey,
 		attentionCausalKey,
+		attentionSlidingWindowKey,
+		attentionSlidingWindowPatternKey,
 		ropeDimensionCountKey,
 		ropeFrequencyBaseKey,
 		ropeScaleLinearKey,
@@ -711,11 +773,55 @@ func (gf *GGUFFile) transformerArchitecture(arch string) (ga GGUFArchitecture) {
 	} else if ga.AttentionHeadCount != 0 {
 		ga.AttentionValueLength = uint32(ga.EmbeddingLength / ga.AttentionHeadCount)
 	}
+	if v, ok := m[attentionKeyLengthMLAKey]; ok {
+		ga.AttentionKeyLengthMLA = ValueNumeric[uint32](v)
+	}
+	if v, ok := m[attentionValueLengthMLAKey]; ok {
+		ga.AttentionValueLengthMLA = ValueNumeric[uint32](v)
+	}
+	if v, ok := m[attentionQLoRARankKey]; ok {
+		ga.AttentionQLoRARank = ValueNumeric[uint32](v)
+	}
+	if v, ok := m[attentionKVLoRARankKey]; ok {
+		ga.AttentionKVLoRARank = ValueNumeric[uint32](v)
+	}
 	if v, ok := m[attentionCausalKey]; ok {
 		ga.AttentionCausal = v.ValueBool()
 	} else {
 		ga.AttentionCausal = true
 	}
+	if v, ok := m[attentionSlidingWindowKey]; ok {
+		ga.AttentionSlidingWindow = ValueNumeric[uint64](v)
+	}
+	if ga.AttentionSlidingWindow > 0 {
+		// Interleaved local/global layers,
+		// see https://github.com/ggml-org/llama.cpp/blob/master/src/llama-hparams.cpp.
+		v, ok := m[attentionSlidingWindowPatternKey]
+		switch {
+		case ok && v.ValueType == GGUFMetadataValueTypeArray:
+			// The empty or non-bool array cannot tell the local layers,
+			// treat all layers as global rather than local.
+			av := v.ValueArray()
+			ok = av.Type == GGUFMetadataValueTypeBool && av.Len != 0 && uint64(len(av.Array)) == av.Len
+			for i := 0; ok && i < len(av.Array); i++ {
+				_, ok = av.Array[i].(bool)
+			}
+			if ok {
+				ga.AttentionSlidingWindowLayers = av.ValuesBool()
+			}
+		case ok:
+			ga.AttentionSlidingWindowPattern = ValueNumeric[uint32](v)
+		default:
+			ga.AttentionSlidingWindowPattern, ok = ggufArchitectureSlidingWindowPatterns[arch]
+		}
+		if ok && ga.AttentionSlidingWindowLayers == nil {
+			n := uint64(ga.AttentionSlidingWindowPattern)
+			ga.AttentionSlidingWindowLayers = make([]bool, ga.BlockCount)
+			for i := range ga.AttentionSlidingWindowLayers {
+				ga.AttentionSlidingWindowLayers[i] = n == 0 || uint64(i)%n < n-1
+			}
+		}
+	}
 
 	if v, ok := m[ropeDimensionCountKey]; ok {
 		ga.RoPEDimensionCount = ValueNumeric[uint64](v)
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestGGUFFile_Architecture(t *testing.T) {
@@ -24,6 +25,112 @@ func TestGGUFFile_Architecture(t *testing.T) {
 	t.Log("\n", spew.Sdump(f.Architecture()), "\n")
 }
 
+func TestGGUFFile_Architecture_SlidingWindow(t *testing.T) {
+	u32 := func(k string, v uint32) GGUFMetadataKV {
+		return GGUFMetadataKV{Key: k, ValueType: GGUFMetadataValueTypeUint32, Value: v}
+	}
+	arch := func(a string, kvs ...GGUFMetadataKV) GGUFArchitecture {
+		gf := GGUFFile{Header: GGUFHeader{MetadataKV: append(GGUFMetadataKVs{
+			{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: a},
+			u32(a+".block_count", 6),
+		}, kvs...)}}
+		return gf.Architecture()
+	}
+
+	cases := []struct {
+		name           string
+		given          GGUFArchitecture
+		expectedWindow uint64
+		expectedLayers []bool
+	}{
+		{
+			name:  "no sliding window",
+			given: arch("llama"),
+		},
+		{
+			name:           "sliding window without pattern",
+			given:          arch("phi3", u32("phi3.attention.sliding_window", 2047)),
+			expectedWindow: 2047,
+		},
+		{
+			name:           "gemma2",
+			given:          arch("gemma2", u32("gemma2.attention.sliding_window", 4096)),
+			expectedWindow: 4096,
+			expectedLayers: []bool{true, false, true, false, true, false},
+		},
+		{
+			name:           "gemma3",
+			given:          arch("gemma3", u32("gemma3.attention.sliding_window", 1024)),
+			expectedWindow: 1024,
+			expectedLayers: []bool{true, true, true, true, true, false},
+		},
+		{
+			name: "numeric pattern",
+			given: arch("cohere2",
+				u32("cohere2.attention.sliding_window", 4096),
+				u32("cohere2.attention.sliding_window_pattern", 3)),
+			expectedWindow: 4096,
+			expectedLayers: []bool{true, true, false, true, true, false},
+		},
+		{
+			name: "zero pattern",
+			given: arch("llama",
+				u32("llama.attention.sliding_window", 4096),
+				u32("llama.attention.sliding_window_pattern", 0)),
+			expectedWindow: 4096,
+			expectedLayers: []bool{true, true, true, true, true, true},
+		},
+		{
+			name: "array pattern",
+			given: arch("llama",
+				u32("llama.attention.sliding_window", 128),
+				GGUFMetadataKV{
+					Key:       "llama.attention.sliding_window_pattern",
+					ValueType: GGUFMetadataValueTypeArray,
+					Value: GGUFMetadataKVArrayValue{
+						Type:  GGUFMetadataValueTypeBool,
+						Len:   6,
+						Array: []any{false, true, true, false, true, true},
+					},
+				}),
+			expectedWindow: 128,
+			expectedLayers: []bool{false, true, true, false, true, true},
+		},
+		{
+			name: "empty array pattern",
+			given: arch("gemma3",
+				u32("gemma3.attention.sliding_window", 1024),
+				GGUFMetadataKV{
+					Key:       "gemma3.attention.sliding_window_pattern",
+					ValueType: GGUFMetadataValueTypeArray,
+					Value:     GGUFMetadataKVArrayValue{Type: GGUFMetadataValueTypeBool},
+				}),
+			expectedWindow: 1024,
+		},
+		{
+			name: "non-bool array pattern",
+			given: arch("llama",
+				u32("llama.attention.sliding_window", 128),
+				GGUFMetadataKV{
+					Key:       "llama.attention.sliding_window_pattern",
+					ValueType: GGUFMetadataValueTypeArray,
+					Value: GGUFMetadataKVArrayValue{
+						Type:  GGUFMetadataValueTypeUint32,
+						Len:   6,
+						Array: []any{uint32(0), uint32(1), uint32(1), uint32(0), uint32(1), uint32(1)},
+					},
+				}),
+			expectedWindow: 128,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedWindow, tc.given.AttentionSlidingWindow)
+			assert.Equal(t, tc.expectedLayers, tc.given.AttentionSlidingWindowLayers)
+		})
+	}
+}
+
 func BenchmarkGGUFFile_Architecture(b *testing.B) {
 	mp, ok := os.LookupEnv("TEST_MODEL_PATH")
 	if !ok {
@@ -44,3 +151,42 @@ func BenchmarkGGUFFile_Architecture(b *testing.B) {
 		_ = f.Architecture()
 	}
 }
+
+func TestGGUFFile_Architecture_MLA(t *testing.T) {
+	u32 := func(k string, v uint32) GGUFMetadataKV {
+		return GGUFMetadataKV{Key: "deepseek2." + k, ValueType: GGUFMetadataValueTypeUint32, Value: v}
+	}
+	arch := func(kvs ...GGUFMetadataKV) GGUFArchitecture {
+		gf := GGUFFile{Header: GGUFHeader{MetadataKV: append(GGUFMetadataKVs{
+			{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "deepseek2"},
+			u32("block_count", 61),
+			u32("embedding_length", 7168),
+			u32("attention.head_count", 128),
+			u32("attention.q_lora_rank", 1536),
+			u32("attention.kv_lora_rank", 512),
+			u32("rope.dimension_count", 64),
+		}, kvs...)}}
+		return gf.Architecture()
+	}
+
+	// Converted before llama.cpp supports MLA.
+	a := arch(
+		u32("attention.head_count_kv", 128),
+		u32("attention.key_length", 192),
+		u32("attention.value_length", 128))
+	assert.Equal(t, uint32(1536), a.AttentionQLoRARank)
+	assert.Equal(t, uint32(512), a.AttentionKVLoRARank)
+	assert.False(t, a.AttentionMLA())
+	assert.Equal(t, uint64(192*128), a.EmbeddingKeyGQA)
+
+	// Converted with the MLA head lengths, the key and value heads are the latent.
+	a = arch(
+		u32("attention.head_count_kv", 1),
+		u32("attention.key_length", 576),
+		u32("attention.value_length", 512),
+		u32("attention.key_length_mla", 192),
+		u32("attention.value_length_mla", 128))
+	assert.Equal(t, uint32(192), a.AttentionKeyLengthMLA)
+	assert.Equal(t, uint32(128), a.AttentionValueLengthMLA)
+	assert.True(t, a.AttentionMLA())
+}
@@ -0,0 +1,132 @@
+package gguf_parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gpustack/gguf-parser-go/util/jinja"
+)
+
+// GGUFChatTemplateDefaultName is the name of the chat template stored in "tokenizer.chat_template".
+const GGUFChatTemplateDefaultName = "default"
+
+// GGUFChatTemplate represents a chat template of a GGUF file.
+type GGUFChatTemplate struct {
+	// Name is the name of the chat template,
+	// which is "default" for "tokenizer.chat_template",
+	// or the suffix of "tokenizer.chat_template.<name>", e.g. "tool_use".
+	Name string `json:"name"`
+	// Template is the Jinja2 source of the chat template.
+	Template string `json:"template"`
+	// BOSToken is the text of the beginning of sentence token,
+	// which is empty if not found.
+	BOSToken string `json:"bosToken,omitempty"`
+	// EOSToken is the text of the end of sentence token,
+	// which is empty if not found.
+	EOSToken string `json:"eosToken,omitempty"`
+}
+
+// ChatTemplates returns the chat templates of the GGUF file,
+// the default one goes first, and the named ones are sorted by name.
+//
+// The BOSToken and EOSToken are filled if the tokens are not skipped at parsing,
+// see SkipLargeMetadata.
+func (gf *GGUFFile) ChatTemplates() []GGUFChatTemplate {
+	const (
+		chatTemplateKey = "tokenizer.chat_template"
+		tokensKey       = "tokenizer.ggml.tokens"
+	)
+
+	var cts []GGUFChatTemplate
+	for _, kv := range gf.Header.MetadataKV {
+		if kv.ValueType != GGUFMetadataValueTypeString {
+			continue
+		}
+		switch {
+		case kv.Key == chatTemplateKey:
+			cts = append(cts, GGUFChatTemplate{Name: GGUFChatTemplateDefaultName, Template: kv.ValueString()})
+		case strings.HasPrefix(kv.Key, chatTemplateKey+"."):
+			cts = append(cts, GGUFChatTemplate{Name: kv.Key[len(chatTemplateKey)+1:], Template: kv.ValueString()})
+		}
+	}
+	if len(cts) == 0 {
+		return nil
+	}
+	sort.SliceStable(cts, func(i, j int) bool {
+		if cts[i].Name == GGUFChatTemplateDefaultName || cts[j].Name == GGUFChatTemplateDefaultName {
+			return cts[i].Name == GGUFChatTemplateDefaultName && cts[j].Name != GGUFChatTemplateDefaultName
+		}
+		return cts[i].Name < cts[j].Name
+	})
+
+	var bos, eos string
+	if kv, ok := gf.Header.MetadataKV.Get(tokensKey); ok && kv.ValueType == GGUFMetadataValueTypeArray {
+		if av := kv.ValueArray(); av.Type == GGUFMetadataValueTypeString && len(av.Array) != 0 {
+			tks := av.ValuesString()
+			gt := gf.Tokenizer()
+			if gt.BOSTokenID >= 0 && gt.BOSTokenID < int64(len(tks)) {
+				bos = tks[gt.BOSTokenID]
+			}
+			if gt.EOSTokenID >= 0 && gt.EOSTokenID < int64(len(tks)) {
+				eos = tks[gt.EOSTokenID]
+			}
+		}
+	}
+	for i := range cts {
+		cts[i].BOSToken, cts[i].EOSToken = bos, eos
+	}
+	return cts
+}
+
+// ChatTemplate returns the chat template of the given name,
+// and true if found, and false otherwise.
+func (gf *GGUFFile) ChatTemplate(name string) (GGUFChatTemplate, bool) {
+	for _, ct := range gf.ChatTemplates() {
+		if ct.Name == name {
+			return ct, true
+		}
+	}
+	return GGUFChatTemplate{}, false
+}
+
+// Render renders the given messages into the prompt string,
+// the messages are usually a list of {"role": ..., "content": ...} objects,
+// which are converted into the template values via JSON,
+// use json.RawMessage to keep the key order of the objects.
+//
+// The template is rendered as the Hugging Face transformers,
+// with the variables messages, tools, add_generation_prompt, bos_token and eos_token.
+func (ct GGUFChatTemplate) Render(messages any, opts ...GGUFChatTemplateOption) (string, error) {
+	var o _GGUFChatTemplateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	t, err := jinja.Parse(ct.Template)
+	if err != nil {
+		return "", fmt.Errorf("parse chat template: %w", err)
+	}
+	if o.Now != nil {
+		t = t.WithNow(o.Now)
+	}
+
+	vars := map[string]any{
+		"messages":              messages,
+		"add_generation_prompt": o.AddGenerationPrompt,
+		"bos_token":             ct.BOSToken,
+		"eos_token":             ct.EOSToken,
+	}
+	if o.Tools != nil {
+		vars["tools"] = o.Tools
+	}
+	for k, v := range o.Variables {
+		vars[k] = v
+	}
+
+	s, err := t.Render(vars)
+	if err != nil {
+		return "", fmt.Errorf("render chat template: %w", err)
+	}
+	return s, nil
+}
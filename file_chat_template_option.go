@@ -0,0 +1,52 @@
+package gguf_parser
+
+import (
+	"time"
+)
+
+type (
+	_GGUFChatTemplateOptions struct {
+		Tools               any
+		AddGenerationPrompt bool
+		Variables           map[string]any
+		Now                 func() time.Time
+	}
+
+	// GGUFChatTemplateOption is the options for rendering a chat template.
+	GGUFChatTemplateOption func(*_GGUFChatTemplateOptions)
+)
+
+// WithChatTemplateTools renders the chat template with the given tools,
+// which are usually a list of JSON schema of the functions.
+func WithChatTemplateTools(tools any) GGUFChatTemplateOption {
+	return func(o *_GGUFChatTemplateOptions) {
+		o.Tools = tools
+	}
+}
+
+// WithChatTemplateAddGenerationPrompt renders the chat template with add_generation_prompt enabled,
+// which appends the tokens that indicate the start of an assistant message.
+func WithChatTemplateAddGenerationPrompt() GGUFChatTemplateOption {
+	return func(o *_GGUFChatTemplateOptions) {
+		o.AddGenerationPrompt = true
+	}
+}
+
+// WithChatTemplateVariable renders the chat template with the given extra variable,
+// e.g. "enable_thinking".
+func WithChatTemplateVariable(name string, value any) GGUFChatTemplateOption {
+	return func(o *_GGUFChatTemplateOptions) {
+		if o.Variables == nil {
+			o.Variables = map[string]any{}
+		}
+		o.Variables[name] = value
+	}
+}
+
+// WithChatTemplateNow renders the chat template with the given time as the current time,
+// which is used by strftime_now.
+func WithChatTemplateNow(now time.Time) GGUFChatTemplateOption {
+	return func(o *_GGUFChatTemplateOptions) {
+		o.Now = func() time.Time { return now }
+	}
+}
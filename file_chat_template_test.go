@@ -0,0 +1,304 @@
+package gguf_parser
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gpustack/gguf-parser-go/util/jinja"
+)
+
+func TestGGUFFile_ChatTemplates(t *testing.T) {
+	fx := newTestLLaMAFixture(GGUFVersionV3, false)
+	fx.MetadataKV = append(fx.MetadataKV,
+		GGUFMetadataKV{Key: "tokenizer.chat_template.tool_use", ValueType: GGUFMetadataValueTypeString, Value: "{{ tools | length }}"},
+		GGUFMetadataKV{Key: "tokenizer.chat_template", ValueType: GGUFMetadataValueTypeString, Value: "{{ bos_token }}{{ messages[0].content }}{{ eos_token }}"},
+		GGUFMetadataKV{Key: "tokenizer.chat_template.rag", ValueType: GGUFMetadataValueTypeString, Value: "{{ documents }}"},
+	)
+	p := fx.WriteFiles(t, t.TempDir(), "a", 1)[0]
+
+	gf, err := ParseGGUFFile(p)
+	require.NoError(t, err)
+	cts := gf.ChatTemplates()
+	if assert.Len(t, cts, 3) {
+		assert.Equal(t, []string{"default", "rag", "tool_use"}, []string{cts[0].Name, cts[1].Name, cts[2].Name})
+		assert.Equal(t, "t1", cts[0].BOSToken)
+		assert.Equal(t, "t2", cts[0].EOSToken)
+	}
+
+	ct, ok := gf.ChatTemplate("default")
+	require.True(t, ok)
+	actual, err := ct.Render([]map[string]any{{"role": "user", "content": "hi"}})
+	require.NoError(t, err)
+	assert.Equal(t, "t1hit2", actual)
+
+	ct, ok = gf.ChatTemplate("tool_use")
+	require.True(t, ok)
+	actual, err = ct.Render(nil, WithChatTemplateTools([]any{map[string]any{"type": "function"}}))
+	require.NoError(t, err)
+	assert.Equal(t, "1", actual)
+
+	_, ok = gf.ChatTemplate("missing")
+	assert.False(t, ok)
+
+	// The tokens are skipped.
+	gf, err = ParseGGUFFile(p, SkipLargeMetadata())
+	require.NoError(t, err)
+	cts = gf.ChatTemplates()
+	if assert.Len(t, cts, 3) {
+		assert.Empty(t, cts[0].BOSToken)
+	}
+}
+
+func TestGGUFChatTemplate_Render(t *testing.T) {
+	const chatml = `{%- if tools %}
+    {{- '<|im_start|>system\n' }}
+    {%- if messages[0]['role'] == 'system' %}
+        {{- messages[0]['content'] }}
+    {%- else %}
+        {{- 'You are Qwen, created by Alibaba Cloud. You are a helpful assistant.' }}
+    {%- endif %}
+    {{- "\n\n# Tools\n\nYou may call one or more functions to assist with the user query.\n\nYou are provided with function signatures within <tools></tools> XML tags:\n<tools>" }}
+    {%- for tool in tools %}
+        {{- "\n" }}
+        {{- tool | tojson }}
+    {%- endfor %}
+    {{- "\n</tools>\n\nFor each function call, return a json object with function name and arguments within <tool_call></tool_call> XML tags:\n<tool_call>\n{\"name\": <function-name>, \"arguments\": <args-json-object>}\n</tool_call><|im_end|>\n" }}
+{%- else %}
+    {%- if messages[0]['role'] == 'system' %}
+        {{- '<|im_start|>system\n' + messages[0]['content'] + '<|im_end|>\n' }}
+    {%- else %}
+        {{- '<|im_start|>system\nYou are Qwen, created by Alibaba Cloud. You are a helpful assistant.<|im_end|>\n' }}
+    {%- endif %}
+{%- endif %}
+{%- for message in messages %}
+    {%- if (message.role == "user") or (message.role == "system" and not loop.first) or (message.role == "assistant" and not message.tool_calls) %}
+        {{- '<|im_start|>' + message.role + '\n' + message.content + '<|im_end|>' + '\n' }}
+    {%- elif message.role == "assistant" %}
+        {{- '<|im_start|>' + message.role }}
+        {%- if message.content %}
+            {{- '\n' + message.content }}
+        {%- endif %}
+        {%- for tool_call in message.tool_calls %}
+            {%- if tool_call.function is defined %}
+                {%- set tool_call = tool_call.function %}
+            {%- endif %}
+            {{- '\n<tool_call>\n{"name": "' }}
+            {{- tool_call.name }}
+            {{- '", "arguments": ' }}
+            {{- tool_call.arguments | tojson }}
+            {{- '}\n</tool_call>' }}
+        {%- endfor %}
+        {{- '<|im_end|>\n' }}
+    {%- elif message.role == "tool" %}
+        {%- if (loop.index0 == 0) or (messages[loop.index0 - 1].role != "tool") %}
+            {{- '<|im_start|>user' }}
+        {%- endif %}
+        {{- '\n<tool_response>\n' }}
+        {{- message.content }}
+        {{- '\n</tool_response>' }}
+        {%- if loop.last or (messages[loop.index0 + 1].role != "tool") %}
+            {{- '<|im_end|>\n' }}
+        {%- endif %}
+    {%- endif %}
+{%- endfor %}
+{%- if add_generation_prompt %}
+    {{- '<|im_start|>assistant\n' }}
+{%- endif %}
+`
+
+	const llama3 = `{{- bos_token }}
+{%- if not date_string is defined %}
+    {%- set date_string = strftime_now("%d %b %Y") %}
+{%- endif %}
+{%- if messages[0]['role'] == 'system' %}
+    {%- set system_message = messages[0]['content']|trim %}
+    {%- set messages = messages[1:] %}
+{%- else %}
+    {%- set system_message = "" %}
+{%- endif %}
+{{- "<|start_header_id|>system<|end_header_id|>\n\n" }}
+{{- "Cutting Knowledge Date: December 2023\n" }}
+{{- "Today Date: " + date_string + "\n\n" }}
+{{- system_message }}
+{{- "<|eot_id|>" }}
+{%- for message in messages %}
+    {{- '<|start_header_id|>' + message['role'] + '<|end_header_id|>\n\n'+ message['content'] | trim + '<|eot_id|>' }}
+{%- endfor %}
+{%- if add_generation_prompt %}
+    {{- '<|start_header_id|>assistant<|end_header_id|>\n\n' }}
+{%- endif %}
+`
+
+	const gemma = `{{ bos_token }}{% if messages[0]['role'] == 'system' %}{{ raise_exception('System role not supported') }}{% endif %}{% for message in messages %}{% if (message['role'] == 'user') != (loop.index0 % 2 == 0) %}{{ raise_exception('Conversation roles must alternate user/assistant/user/assistant/...') }}{% endif %}{% if (message['role'] == 'assistant') %}{% set role = 'model' %}{% else %}{% set role = message['role'] %}{% endif %}{{ '<start_of_turn>' + role + '
+' + message['content'] | trim + '<end_of_turn>
+' }}{% endfor %}{% if add_generation_prompt %}{{'<start_of_turn>model
+'}}{% endif %}`
+
+	const deepseek = `{% if not add_generation_prompt is defined %}{% set add_generation_prompt = false %}{% endif %}{% set ns = namespace(is_first=false, is_tool=false, is_output_first=true, system_prompt='') %}{%- for message in messages %}{%- if message['role'] == 'system' %}{% set ns.system_prompt = message['content'] %}{%- endif %}{%- endfor %}{{bos_token}}{{ns.system_prompt}}{%- for message in messages %}{%- if message['role'] == 'user' %}{%- set ns.is_tool = false -%}{{'<｜User｜>' + message['content']}}{%- endif %}{%- if message['role'] == 'assistant' and message['content'] is not none %}{% set content = message['content'] %}{% if '</think>' in content %}{% set content = content.split('</think>')[-1] %}{% endif %}{{'<｜Assistant｜>' + content + '<｜end▁of▁sentence｜>'}}{%- endif %}{%- endfor -%}{% if add_generation_prompt %}{{'<｜Assistant｜><think>\n'}}{% endif %}`
+
+	msgs := []map[string]any{
+		{"role": "system", "content": "You are a bot."},
+		{"role": "user", "content": "Hi "},
+		{"role": "assistant", "content": "<think>hmm</think>Hello!"},
+		{"role": "user", "content": "Weather in Paris?"},
+	}
+
+	testCases := []struct {
+		name     string
+		template string
+		messages any
+		opts     []GGUFChatTemplateOption
+		expected string
+	}{
+		{
+			name:     "chatml",
+			template: chatml,
+			messages: msgs,
+			opts:     []GGUFChatTemplateOption{WithChatTemplateAddGenerationPrompt()},
+			expected: "<|im_start|>system\nYou are a bot.<|im_end|>\n" +
+				"<|im_start|>user\nHi <|im_end|>\n" +
+				"<|im_start|>assistant\n<think>hmm</think>Hello!<|im_end|>\n" +
+				"<|im_start|>user\nWeather in Paris?<|im_end|>\n" +
+				"<|im_start|>assistant\n",
+		},
+		{
+			name:     "chatml with tools",
+			template: chatml,
+			messages: json.RawMessage(`[
+				{"role": "user", "content": "Weather in Paris?"},
+				{"role": "assistant", "content": "", "tool_calls": [
+					{"type": "function", "function": {"name": "get_weather", "arguments": {"city": "Paris", "days": 2}}}
+				]},
+				{"role": "tool", "content": "{\"temp\": 20.5}"},
+				{"role": "tool", "content": "sunny"}
+			]`),
+			opts: []GGUFChatTemplateOption{
+				WithChatTemplateTools(json.RawMessage(`[{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object", "required": ["city"]}}}]`)),
+			},
+			expected: "<|im_start|>system\nYou are Qwen, created by Alibaba Cloud. You are a helpful assistant." +
+				"\n\n# Tools\n\nYou may call one or more functions to assist with the user query.\n\n" +
+				"You are provided with function signatures within <tools></tools> XML tags:\n<tools>\n" +
+				`{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object", "required": ["city"]}}}` +
+				"\n</tools>\n\nFor each function call, return a json object with function name and arguments within <tool_call></tool_call> XML tags:\n" +
+				"<tool_call>\n{\"name\": <function-name>, \"arguments\": <args-json-object>}\n</tool_call><|im_end|>\n" +
+				"<|im_start|>user\nWeather in Paris?<|im_end|>\n" +
+				"<|im_start|>assistant\n<tool_call>\n" + `{"name": "get_weather", "arguments": {"city": "Paris", "days": 2}}` + "\n</tool_call><|im_end|>\n" +
+				"<|im_start|>user\n<tool_response>\n{\"temp\": 20.5}\n</tool_response>\n<tool_response>\nsunny\n</tool_response><|im_end|>\n",
+		},
+		{
+			name:     "llama3",
+			template: llama3,
+			messages: msgs[:2],
+			opts: []GGUFChatTemplateOption{
+				WithChatTemplateAddGenerationPrompt(),
+				WithChatTemplateNow(time.Date(2024, 7, 5, 0, 0, 0, 0, time.UTC)),
+			},
+			expected: "<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\n" +
+				"Cutting Knowledge Date: December 2023\nToday Date: 05 Jul 2024\n\n" +
+				"You are a bot.<|eot_id|>" +
+				"<|start_header_id|>user<|end_header_id|>\n\nHi<|eot_id|>" +
+				"<|start_header_id|>assistant<|end_header_id|>\n\n",
+		},
+		{
+			name:     "llama3 with date",
+			template: llama3,
+			messages: msgs[1:2],
+			opts:     []GGUFChatTemplateOption{WithChatTemplateVariable("date_string", "26 Jul 2024")},
+			expected: "<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\n" +
+				"Cutting Knowledge Date: December 2023\nToday Date: 26 Jul 2024\n\n" +
+				"<|eot_id|>" +
+				"<|start_header_id|>user<|end_header_id|>\n\nHi<|eot_id|>",
+		},
+		{
+			name:     "gemma",
+			template: gemma,
+			messages: msgs[1:],
+			opts:     []GGUFChatTemplateOption{WithChatTemplateAddGenerationPrompt()},
+			expected: "<bos><start_of_turn>user\nHi<end_of_turn>\n" +
+				"<start_of_turn>model\n<think>hmm</think>Hello!<end_of_turn>\n" +
+				"<start_of_turn>user\nWeather in Paris?<end_of_turn>\n" +
+				"<start_of_turn>model\n",
+		},
+		{
+			name:     "deepseek",
+			template: deepseek,
+			messages: msgs,
+			opts:     []GGUFChatTemplateOption{WithChatTemplateAddGenerationPrompt()},
+			expected: "<｜begin▁of▁sentence｜>You are a bot." +
+				"<｜User｜>Hi <｜Assistant｜>Hello!<｜end▁of▁sentence｜>" +
+				"<｜User｜>Weather in Paris?<｜Assistant｜><think>\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ct := GGUFChatTemplate{Name: "default", Template: tc.template}
+			switch tc.name {
+			case "llama3", "llama3 with date":
+				ct.BOSToken = "<|begin_of_text|>"
+			case "gemma":
+				ct.BOSToken = "<bos>"
+			case "deepseek":
+				ct.BOSToken = "<｜begin▁of▁sentence｜>"
+			}
+			actual, err := ct.Render(tc.messages, tc.opts...)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+
+	// raise_exception.
+	ct := GGUFChatTemplate{Template: gemma}
+	_, err := ct.Render(msgs)
+	var je *jinja.Exception
+	if assert.ErrorAs(t, err, &je) {
+		assert.Equal(t, "System role not supported", je.Message)
+	}
+
+	// Syntax error.
+	ct = GGUFChatTemplate{Template: "{% for m in messages %}{{ m }}"}
+	_, err = ct.Render(msgs)
+	assert.ErrorContains(t, err, "parse chat template")
+}
+
+func TestGGUFChatTemplate_Render_Jinja(t *testing.T) {
+	testCases := []struct {
+		template string
+		expected string
+	}{
+		{`{% for k, v in d | dictsort %}{{ k }}={{ v }}{% if not loop.last %},{% endif %}{% endfor %}`, `a=1,b=[1, 'x'],c=None`},
+		{`{{ d | tojson(indent=2) }}`, "{\n  \"b\": [\n    1,\n    \"x\"\n  ],\n  \"a\": 1,\n  \"c\": null\n}"},
+		{`{{ d.b | tojson(separators=(',', ':')) }}|{{ "ü\"<" | tojson }}`, `[1,"x"]|"ü\"<"`},
+		{`{{ 7 // 2 }} {{ -7 // 2 }} {{ -7 % 3 }} {{ 7 / 2 }} {{ 2 ** 10 }} {{ 1.0 }} {{ 'ab' * 2 }}`, `3 -4 2 3.5 1024 1.0 abab`},
+		{`{{ "a,b,,c".split(",") }} {{ "  x  ".strip() }}| {{ "abc"[::-1] }} {{ [1, 2, 3][-2:] }}`, `['a', 'b', '', 'c'] x| cba [2, 3]`},
+		{`{% set ns = namespace(n=0) %}{% for i in range(10) if i is odd %}{% if i > 6 %}{% break %}{% endif %}{% set ns.n = ns.n + i %}{% endfor %}{{ ns.n }}`, `9`},
+		{`{% for x in [] %}x{% else %}empty{% endfor %} {{ undefined_var is defined }} {{ none_var | default('dft') }} {{ none_var | default('dft', true) }}`, `empty False None dft`},
+		{`{{ l | selectattr('role', 'equalto', 'user') | map(attribute='content') | join('|') }}`, `a|c`},
+		{`{% macro greet(name, punct='!') %}Hi {{ name }}{{ punct }}{% endmacro %}{{ greet('x') }} {{ greet('y', punct='?') }}`, `Hi x! Hi y?`},
+		{"{%- set x -%}\n  block\n{%- endset -%}\n[{{ x }}]", `[block]`},
+		{"{% if true %}\n  a\n{% endif %}\n  {% if false %}b{% endif %}c", "  a\nc"},
+		{`{{ 'x' if l | length > 2 else 'y' }} {{ l[0].role | upper }} {{ "%s" ~ 1 }} {{ l | first | length }}`, `x USER %s1 2`},
+		{`{% raw %}{{ not rendered }}{% endraw %}`, `{{ not rendered }}`},
+	}
+
+	vars, err := jinja.FromJSON([]byte(`{
+		"d": {"b": [1, "x"], "a": 1, "c": null},
+		"l": [{"role": "user", "content": "a"}, {"role": "assistant", "content": "b"}, {"role": "user", "content": "c"}]
+	}`))
+	require.NoError(t, err)
+	for _, tc := range testCases {
+		tmpl, err := jinja.Parse(tc.template)
+		require.NoError(t, err, tc.template)
+		d := vars.(*jinja.Dict)
+		m := map[string]any{"none_var": nil}
+		for _, k := range d.Keys() {
+			m[k], _ = d.Get(k)
+		}
+		actual, err := tmpl.Render(m)
+		require.NoError(t, err, tc.template)
+		assert.Equal(t, tc.expected, actual, tc.template)
+	}
+}
@@ -0,0 +1,209 @@
+package gguf_parser
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGGUFFile_Conformance runs the parser, the metadata accessors and the estimators
+// against the synthetic fixtures, which requires no network access.
+func TestGGUFFile_Conformance(t *testing.T) {
+	cases := []struct {
+		version   GGUFVersion
+		bigEndian bool
+		alignment uint32
+		split     int
+	}{
+		{version: GGUFVersionV1},
+		{version: GGUFVersionV2},
+		{version: GGUFVersionV3},
+		{version: GGUFVersionV3, bigEndian: true},
+		{version: GGUFVersionV3, alignment: 64},
+		{version: GGUFVersionV1, split: 2},
+		{version: GGUFVersionV2, split: 3},
+		{version: GGUFVersionV3, split: 3},
+		{version: GGUFVersionV3, bigEndian: true, split: 2},
+	}
+	for _, tc := range cases {
+		name := fmt.Sprintf("v%d", tc.version)
+		if tc.bigEndian {
+			name += " big-endian"
+		}
+		if tc.alignment != 0 {
+			name += fmt.Sprintf(" alignment %d", tc.alignment)
+		}
+		if tc.split > 1 {
+			name += fmt.Sprintf(" split %d", tc.split)
+		}
+		t.Run(name, func(t *testing.T) {
+			fx := newTestLLaMAFixture(tc.version, tc.bigEndian)
+			if tc.alignment != 0 {
+				fx = fx.WithAlignment(tc.alignment)
+			}
+			ps := fx.WriteFiles(t, t.TempDir(), "fixture", tc.split)
+
+			var size int64
+			for _, p := range ps {
+				fi, err := os.Stat(p)
+				require.NoError(t, err)
+				size += fi.Size()
+			}
+
+			// Parse from any shard.
+			for _, p := range ps {
+				for _, opts := range [][]GGUFReadOption{nil, {UseMMap()}} {
+					gf, err := ParseGGUFFile(p, opts...)
+					require.NoError(t, err)
+					assertTestLLaMAFixture(t, fx, tc.split, size, gf)
+				}
+			}
+
+			// Skip large metadata.
+			gf, err := ParseGGUFFile(ps[0], SkipLargeMetadata())
+			require.NoError(t, err)
+			kv, ok := gf.Header.MetadataKV.Get("tokenizer.ggml.tokens")
+			require.True(t, ok)
+			assert.Nil(t, kv.ValueArray().Array)
+			assert.Equal(t, uint64(32), kv.ValueArray().Len)
+			assert.Equal(t, uint64(32), gf.Tokenizer().TokensLength)
+		})
+	}
+
+	t.Run("stable diffusion", func(t *testing.T) {
+		fx := newTestStableDiffusionFixture()
+		ps := fx.WriteFiles(t, t.TempDir(), "fixture", 1)
+
+		gf, err := ParseGGUFFile(ps[0])
+		require.NoError(t, err)
+		assert.Empty(t, gf.Validate())
+
+		a := gf.Architecture()
+		assert.Equal(t, "diffusion", a.Architecture)
+		assert.Equal(t, "Stable Diffusion 1.x", a.DiffusionArchitecture)
+		if assert.Len(t, a.DiffusionConditioners, 1) {
+			assert.Equal(t, "OpenAI CLIP ViT-L/14", a.DiffusionConditioners[0].Architecture)
+		}
+		if assert.NotNil(t, a.DiffusionAutoencoder) {
+			assert.Equal(t, "Stable Diffusion 1.x VAE", a.DiffusionAutoencoder.Architecture)
+		}
+
+		e := gf.EstimateStableDiffusionCppRun(
+			WithStableDiffusionCppWidth(512),
+			WithStableDiffusionCppHeight(512))
+		assert.True(t, e.FullOffloaded)
+		assert.Len(t, e.Conditioners, 1)
+		assert.NotNil(t, e.Autoencoder)
+		if assert.Len(t, e.Devices, 2) {
+			assert.Equal(t, GGUFBytesScalar(2*(3*3*4*32+64*32)), e.Devices[1].Weight)
+		}
+
+		es := e.Summarize(true, 0, 0)
+		if assert.Len(t, es.Items, 1) && assert.Len(t, es.Items[0].VRAMs, 1) {
+			assert.NotZero(t, es.Items[0].RAM.UMA)
+			assert.NotZero(t, es.Items[0].VRAMs[0].NonUMA)
+		}
+	})
+}
+
+// assertTestLLaMAFixture asserts the given GGUFFile is parsed from the given LLaMA fixture.
+func assertTestLLaMAFixture(t *testing.T, fx _TestGGUFFixture, split int, size int64, gf *GGUFFile) {
+	t.Helper()
+
+	// Header.
+	if fx.BigEndian {
+		assert.Equal(t, GGUFMagicGGUFBe, gf.Header.Magic)
+	} else {
+		assert.Equal(t, GGUFMagicGGUFLe, gf.Header.Magic)
+	}
+	assert.Equal(t, fx.Version, gf.Header.Version)
+	assert.Equal(t, uint64(len(fx.TensorInfos)), gf.Header.TensorCount)
+	assert.Equal(t, GGUFBytesScalar(size), gf.Size)
+	assert.Len(t, gf.SplitSizes, max(split, 1))
+
+	// Metadata.
+	for _, kv := range fx.MetadataKV {
+		actual, ok := gf.Header.MetadataKV.Get(kv.Key)
+		if assert.True(t, ok, kv.Key) {
+			assert.Equal(t, kv.ValueType, actual.ValueType, kv.Key)
+			assert.Equal(t, kv.Value, clearTestArrayOffsets(actual.Value), kv.Key)
+		}
+	}
+	assert.Empty(t, gf.Validate())
+
+	// Tensors.
+	if assert.Len(t, gf.TensorInfos, len(fx.TensorInfos)) {
+		for i, ti := range gf.TensorInfos {
+			assert.Equal(t, fx.TensorInfos[i].Name, ti.Name)
+			assert.Equal(t, fx.TensorInfos[i].Dimensions, ti.Dimensions, ti.Name)
+			assert.Equal(t, fx.TensorInfos[i].Type, ti.Type, ti.Name)
+			assert.Zero(t, ti.Offset%fx.Alignment(), ti.Name)
+		}
+	}
+
+	m := gf.Metadata()
+	assert.Equal(t, "llama", m.Architecture)
+	assert.Equal(t, "fixture", m.Name)
+	assert.Equal(t, GGUFFileTypeMostlyF16, m.FileType)
+	assert.Equal(t, fx.Version < GGUFVersionV3 || !fx.BigEndian, m.LittleEndian)
+	assert.Equal(t, GGUFParametersScalar(fx.TensorInfos.Elements()), m.Parameters)
+
+	a := gf.Architecture()
+	assert.Equal(t, "model", a.Type)
+	assert.Equal(t, "llama", a.Architecture)
+	assert.Equal(t, uint64(256), a.MaximumContextLength)
+	assert.Equal(t, uint64(64), a.EmbeddingLength)
+	assert.Equal(t, uint64(2), a.BlockCount)
+	assert.Equal(t, uint64(128), a.FeedForwardLength)
+	assert.Equal(t, uint64(4), a.AttentionHeadCount)
+	assert.Equal(t, uint64(2), a.AttentionHeadCountKV)
+	assert.Equal(t, uint64(2), a.EmbeddingGQA)
+	assert.Equal(t, uint64(32), a.VocabularyLength)
+
+	tk := gf.Tokenizer()
+	assert.Equal(t, "gpt2", tk.Model)
+	assert.Equal(t, uint64(32), tk.TokensLength)
+	assert.Equal(t, uint64(3), tk.MergesLength)
+	assert.Equal(t, int64(1), tk.BOSTokenID)
+	assert.Equal(t, int64(2), tk.EOSTokenID)
+	assert.Equal(t, int64(-1), tk.UnknownTokenID)
+
+	// Estimate.
+	e := gf.EstimateLLaMACppRun(WithLLaMACppContextSize(256))
+	assert.Equal(t, "llama", e.Architecture)
+	assert.Equal(t, uint64(256), e.ContextSize)
+	assert.Equal(t, uint64(2), e.OffloadLayers)
+	assert.True(t, e.FullOffloaded)
+	if assert.Len(t, e.Devices, 2) {
+		// F16 KV cache of 2 layers, 256 context size and 32 KV embedding length.
+		assert.Equal(t, GGUFBytesScalar(2*256*32*2), e.Devices[1].KVCache.Key)
+		assert.Equal(t, GGUFBytesScalar(2*256*32*2), e.Devices[1].KVCache.Value)
+		assert.NotZero(t, e.Devices[1].Weight.Compute)
+		assert.NotZero(t, e.Devices[1].Weight.Output)
+	}
+
+	es := e.Summarize(true, 0, 0)
+	if assert.Len(t, es.Items, 1) && assert.Len(t, es.Items[0].VRAMs, 1) {
+		assert.NotZero(t, es.Items[0].RAM.UMA)
+		assert.NotZero(t, es.Items[0].VRAMs[0].UMA)
+	}
+}
+
+// clearTestArrayOffsets clears the StartOffset and Size of the given GGUFMetadataKVArrayValue recursively,
+// which are filled by the parser.
+func clearTestArrayOffsets(v any) any {
+	av, ok := v.(GGUFMetadataKVArrayValue)
+	if !ok {
+		return v
+	}
+	av.StartOffset, av.Size = 0, 0
+	if av.Type == GGUFMetadataValueTypeArray {
+		for i := range av.Array {
+			av.Array[i] = clearTestArrayOffsets(av.Array[i])
+		}
+	}
+	return av
+}
@@ -0,0 +1,199 @@
+package gguf_parser
+
+import (
+	"slices"
+	"strings"
+)
+
+// GGUFDiffKind is the kind of a difference between two GGUF files.
+type GGUFDiffKind string
+
+// GGUFDiffKind constants.
+const (
+	// GGUFDiffKindAdded indicates the item only exists in the second file.
+	GGUFDiffKindAdded GGUFDiffKind = "added"
+	// GGUFDiffKindRemoved indicates the item only exists in the first file.
+	GGUFDiffKindRemoved GGUFDiffKind = "removed"
+	// GGUFDiffKindChanged indicates the item exists in both files but differs.
+	GGUFDiffKindChanged GGUFDiffKind = "changed"
+)
+
+// Types for GGUF file differences.
+type (
+	// GGUFFileDiff holds the differences between two GGUF files,
+	// the first file is named A and the second one is named B.
+	GGUFFileDiff struct {
+		// Metadata holds the different metadata, ordered by key.
+		Metadata []GGUFMetadataKVDiff `json:"metadata"`
+		// Tensors holds the different tensors,
+		// the removed and changed tensors are in the order of A,
+		// and then the added tensors in the order of B.
+		Tensors []GGUFTensorInfoDiff `json:"tensors"`
+		// ModelSize holds the model size of A and B.
+		ModelSize [2]GGUFBytesScalar `json:"modelSize"`
+		// ModelSizeDelta is the model size of B minus the one of A.
+		ModelSizeDelta int64 `json:"modelSizeDelta"`
+		// ModelParameters holds the model parameters of A and B.
+		ModelParameters [2]GGUFParametersScalar `json:"modelParameters"`
+		// ModelParametersDelta is the model parameters of B minus the one of A.
+		ModelParametersDelta int64 `json:"modelParametersDelta"`
+		// ModelBitsPerWeight holds the model bits per weight of A and B.
+		ModelBitsPerWeight [2]GGUFBitsPerWeightScalar `json:"modelBitsPerWeight"`
+		// ModelBitsPerWeightDelta is the model bits per weight of B minus the one of A.
+		ModelBitsPerWeightDelta float64 `json:"modelBitsPerWeightDelta"`
+		// Estimate holds the llama.cpp run estimate summary of A and B side by side,
+		// only available when WithDiffLLaMACppRunEstimate is given.
+		Estimate *[2]LLaMACppRunEstimateSummary `json:"estimate,omitempty"`
+	}
+
+	// GGUFMetadataKVDiff is a different metadata between two GGUF files.
+	GGUFMetadataKVDiff struct {
+		// Key is the key of the metadata.
+		Key string `json:"key"`
+		// Kind is the kind of the difference.
+		Kind GGUFDiffKind `json:"kind"`
+		// A is the metadata of the first file,
+		// nil if the metadata is added.
+		A *GGUFMetadataKV `json:"a,omitempty"`
+		// B is the metadata of the second file,
+		// nil if the metadata is removed.
+		B *GGUFMetadataKV `json:"b,omitempty"`
+	}
+
+	// GGUFTensorInfoDiff is a different tensor between two GGUF files,
+	// a tensor is changed if its type or dimensions differ.
+	GGUFTensorInfoDiff struct {
+		// Name is the name of the tensor.
+		Name string `json:"name"`
+		// Kind is the kind of the difference.
+		Kind GGUFDiffKind `json:"kind"`
+		// A is the tensor of the first file,
+		// nil if the tensor is added.
+		A *GGUFTensorInfo `json:"a,omitempty"`
+		// B is the tensor of the second file,
+		// nil if the tensor is removed.
+		B *GGUFTensorInfo `json:"b,omitempty"`
+	}
+)
+
+// DiffGGUFFiles compares the given two GGUF files,
+// and returns the differences from a to b.
+//
+// The split.* metadata is ignored,
+// as it describes the layout of the (split) files rather than the model.
+//
+// An array metadata skipped by SkipLargeMetadata is compared by its type, length and size.
+func DiffGGUFFiles(a, b *GGUFFile, opts ...GGUFDiffOption) (d GGUFFileDiff) {
+	var o _GGUFDiffOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Metadata.
+	{
+		akvs, bkvs := indexGGUFMetadataKVs(a.Header.MetadataKV), indexGGUFMetadataKVs(b.Header.MetadataKV)
+		for k, akv := range akvs {
+			bkv, ok := bkvs[k]
+			switch {
+			case !ok:
+				d.Metadata = append(d.Metadata, GGUFMetadataKVDiff{Key: k, Kind: GGUFDiffKindRemoved, A: &akv})
+			case akv.ValueType != bkv.ValueType || !equalGGUFMetadataValue(akv.Value, bkv.Value):
+				d.Metadata = append(d.Metadata, GGUFMetadataKVDiff{Key: k, Kind: GGUFDiffKindChanged, A: &akv, B: &bkv})
+			}
+		}
+		for k, bkv := range bkvs {
+			if _, ok := akvs[k]; !ok {
+				d.Metadata = append(d.Metadata, GGUFMetadataKVDiff{Key: k, Kind: GGUFDiffKindAdded, B: &bkv})
+			}
+		}
+		slices.SortFunc(d.Metadata, func(x, y GGUFMetadataKVDiff) int {
+			return strings.Compare(x.Key, y.Key)
+		})
+	}
+
+	// Tensors.
+	{
+		btis := make(map[string]int, len(b.TensorInfos))
+		for i := range b.TensorInfos {
+			btis[b.TensorInfos[i].Name] = i
+		}
+		atis := make(map[string]struct{}, len(a.TensorInfos))
+		for i := range a.TensorInfos {
+			ati := a.TensorInfos[i]
+			atis[ati.Name] = struct{}{}
+			j, ok := btis[ati.Name]
+			if !ok {
+				d.Tensors = append(d.Tensors, GGUFTensorInfoDiff{Name: ati.Name, Kind: GGUFDiffKindRemoved, A: &ati})
+				continue
+			}
+			if bti := b.TensorInfos[j]; ati.Type != bti.Type || !slices.Equal(ati.Dimensions, bti.Dimensions) {
+				d.Tensors = append(d.Tensors, GGUFTensorInfoDiff{Name: ati.Name, Kind: GGUFDiffKindChanged, A: &ati, B: &bti})
+			}
+		}
+		for i := range b.TensorInfos {
+			bti := b.TensorInfos[i]
+			if _, ok := atis[bti.Name]; !ok {
+				d.Tensors = append(d.Tensors, GGUFTensorInfoDiff{Name: bti.Name, Kind: GGUFDiffKindAdded, B: &bti})
+			}
+		}
+	}
+
+	// Model.
+	d.ModelSize = [2]GGUFBytesScalar{a.ModelSize, b.ModelSize}
+	d.ModelSizeDelta = int64(b.ModelSize) - int64(a.ModelSize)
+	d.ModelParameters = [2]GGUFParametersScalar{a.ModelParameters, b.ModelParameters}
+	d.ModelParametersDelta = int64(b.ModelParameters) - int64(a.ModelParameters)
+	d.ModelBitsPerWeight = [2]GGUFBitsPerWeightScalar{a.ModelBitsPerWeight, b.ModelBitsPerWeight}
+	d.ModelBitsPerWeightDelta = float64(b.ModelBitsPerWeight) - float64(a.ModelBitsPerWeight)
+
+	// Estimate.
+	if o.Estimate {
+		d.Estimate = &[2]LLaMACppRunEstimateSummary{
+			a.EstimateLLaMACppRun(o.EstimateOptions...).
+				Summarize(o.EstimateMMap, o.EstimateNonUMARamFootprint, o.EstimateNonUMAVramFootprint),
+			b.EstimateLLaMACppRun(o.EstimateOptions...).
+				Summarize(o.EstimateMMap, o.EstimateNonUMARamFootprint, o.EstimateNonUMAVramFootprint),
+		}
+	}
+
+	return d
+}
+
+// indexGGUFMetadataKVs indexes the given metadata by key,
+// the split.* metadata is ignored.
+func indexGGUFMetadataKVs(kvs GGUFMetadataKVs) map[string]GGUFMetadataKV {
+	m := make(map[string]GGUFMetadataKV, len(kvs))
+	for i := range kvs {
+		if strings.HasPrefix(kvs[i].Key, "split.") {
+			continue
+		}
+		m[kvs[i].Key] = kvs[i]
+	}
+	return m
+}
+
+// equalGGUFMetadataValue reports whether the given two metadata values are equal,
+// the StartOffset of the array values is ignored.
+func equalGGUFMetadataValue(x, y any) bool {
+	xav, ok := x.(GGUFMetadataKVArrayValue)
+	if !ok {
+		return x == y
+	}
+	yav, ok := y.(GGUFMetadataKVArrayValue)
+	if !ok || xav.Type != yav.Type || xav.Len != yav.Len {
+		return false
+	}
+	if xav.Array == nil || yav.Array == nil {
+		// Skipped by SkipLargeMetadata.
+		return xav.Array == nil && yav.Array == nil && xav.Size == yav.Size
+	}
+	if len(xav.Array) != len(yav.Array) {
+		return false
+	}
+	for i := range xav.Array {
+		if !equalGGUFMetadataValue(xav.Array[i], yav.Array[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package gguf_parser
+
+type (
+	_GGUFDiffOptions struct {
+		Estimate                    bool
+		EstimateOptions             []GGUFRunEstimateOption
+		EstimateMMap                bool
+		EstimateNonUMARamFootprint  uint64
+		EstimateNonUMAVramFootprint uint64
+	}
+
+	// GGUFDiffOption is the options for diffing GGUF files.
+	GGUFDiffOption func(*_GGUFDiffOptions)
+)
+
+// WithDiffLLaMACppRunEstimate enables the llama.cpp run estimate of both files,
+// the estimate is made with the given options,
+// and summarized with the given mmap flag and non-UMA footprints.
+func WithDiffLLaMACppRunEstimate(
+	mmap bool,
+	nonUMARamFootprint, nonUMAVramFootprint uint64,
+	opts ...GGUFRunEstimateOption,
+) GGUFDiffOption {
+	return func(o *_GGUFDiffOptions) {
+		o.Estimate = true
+		o.EstimateOptions = opts
+		o.EstimateMMap = mmap
+		o.EstimateNonUMARamFootprint = nonUMARamFootprint
+		o.EstimateNonUMAVramFootprint = nonUMAVramFootprint
+	}
+}
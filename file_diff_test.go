@@ -0,0 +1,115 @@
+package gguf_parser
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffGGUFFiles(t *testing.T) {
+	fx := newTestLLaMAFixture(GGUFVersionV3, false)
+	a, err := ParseGGUFFile(fx.WriteFiles(t, t.TempDir(), "a", 1)[0])
+	require.NoError(t, err)
+
+	t.Run("identical", func(t *testing.T) {
+		// Different versions, byte orders and splits describe the same model.
+		for _, bfx := range []_TestGGUFFixture{
+			newTestLLaMAFixture(GGUFVersionV2, false),
+			newTestLLaMAFixture(GGUFVersionV3, true),
+		} {
+			for _, split := range []int{1, 3} {
+				b, err := ParseGGUFFile(bfx.WriteFiles(t, t.TempDir(), "b", split)[0])
+				require.NoError(t, err)
+				d := DiffGGUFFiles(a, b)
+				assert.Empty(t, d.Metadata)
+				assert.Empty(t, d.Tensors)
+				assert.Zero(t, d.ModelSizeDelta)
+				assert.Zero(t, d.ModelParametersDelta)
+				assert.Zero(t, d.ModelBitsPerWeightDelta)
+				assert.Nil(t, d.Estimate)
+			}
+		}
+
+		// Skipped large metadata.
+		sa, err := ParseGGUFFile(fx.WriteFiles(t, t.TempDir(), "a", 1)[0], SkipLargeMetadata())
+		require.NoError(t, err)
+		sb, err := ParseGGUFFile(fx.WriteFiles(t, t.TempDir(), "b", 2)[0], SkipLargeMetadata())
+		require.NoError(t, err)
+		assert.Empty(t, DiffGGUFFiles(sa, sb).Metadata)
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		bfx := fx
+		bfx.MetadataKV = slices.Clone(fx.MetadataKV)
+		bfx.MetadataKV.Delete("test.bool")
+		for i := range bfx.MetadataKV {
+			switch bfx.MetadataKV[i].Key {
+			case "general.name":
+				bfx.MetadataKV[i].Value = "fixture-q8_0"
+			case "test.int32":
+				bfx.MetadataKV[i] = GGUFMetadataKV{Key: "test.int32", ValueType: GGUFMetadataValueTypeInt64, Value: int64(-19088744)}
+			case "tokenizer.ggml.merges":
+				av := bfx.MetadataKV[i].ValueArray()
+				av.Array = append(slices.Clone(av.Array[:len(av.Array)-1]), "x y")
+				bfx.MetadataKV[i].Value = av
+			}
+		}
+		bfx.MetadataKV = append(bfx.MetadataKV,
+			GGUFMetadataKV{Key: "general.license", ValueType: GGUFMetadataValueTypeString, Value: "mit"})
+		bfx.TensorInfos = slices.Clone(fx.TensorInfos)
+		bfx.TensorInfos[2].Type = GGMLTypeQ8_0                 // blk.0.attn_q.weight
+		bfx.TensorInfos[3].Dimensions = []uint64{64, 64}       // blk.0.attn_k.weight
+		bfx.TensorInfos = slices.Delete(bfx.TensorInfos, 1, 2) // blk.0.attn_norm.weight
+		bfx.TensorInfos = append(bfx.TensorInfos,
+			GGUFTensorInfo{Name: "rope_freqs.weight", NDimensions: 1, Dimensions: []uint64{8}, Type: GGMLTypeF32})
+
+		b, err := ParseGGUFFile(bfx.WriteFiles(t, t.TempDir(), "b", 1)[0])
+		require.NoError(t, err)
+
+		d := DiffGGUFFiles(a, b, WithDiffLLaMACppRunEstimate(true, 0, 0, WithLLaMACppContextSize(256)))
+
+		type kd struct {
+			Key  string
+			Kind GGUFDiffKind
+		}
+		var mkds []kd
+		for _, m := range d.Metadata {
+			mkds = append(mkds, kd{m.Key, m.Kind})
+			assert.Equal(t, m.Kind != GGUFDiffKindAdded, m.A != nil, m.Key)
+			assert.Equal(t, m.Kind != GGUFDiffKindRemoved, m.B != nil, m.Key)
+		}
+		assert.Equal(t, []kd{
+			{"general.license", GGUFDiffKindAdded},
+			{"general.name", GGUFDiffKindChanged},
+			{"test.bool", GGUFDiffKindRemoved},
+			{"test.int32", GGUFDiffKindChanged},
+			{"tokenizer.ggml.merges", GGUFDiffKindChanged},
+		}, mkds)
+		assert.Equal(t, GGUFMetadataValueTypeInt32, d.Metadata[3].A.ValueType)
+		assert.Equal(t, GGUFMetadataValueTypeInt64, d.Metadata[3].B.ValueType)
+
+		var tkds []kd
+		for _, ti := range d.Tensors {
+			tkds = append(tkds, kd{ti.Name, ti.Kind})
+		}
+		assert.Equal(t, []kd{
+			{"blk.0.attn_norm.weight", GGUFDiffKindRemoved},
+			{"blk.0.attn_q.weight", GGUFDiffKindChanged},
+			{"blk.0.attn_k.weight", GGUFDiffKindChanged},
+			{"rope_freqs.weight", GGUFDiffKindAdded},
+		}, tkds)
+
+		assert.Equal(t, [2]GGUFBytesScalar{a.ModelSize, b.ModelSize}, d.ModelSize)
+		assert.Equal(t, int64(b.ModelSize)-int64(a.ModelSize), d.ModelSizeDelta)
+		// attn_norm(-64) + attn_k(+64*32) + rope_freqs(+8).
+		assert.Equal(t, int64(-64+64*32+8), d.ModelParametersDelta)
+		assert.Less(t, d.ModelBitsPerWeightDelta, 0.0)
+		if assert.NotNil(t, d.Estimate) {
+			assert.Equal(t, uint64(256), d.Estimate[0].ContextSize)
+			assert.Equal(t, uint64(256), d.Estimate[1].ContextSize)
+			assert.NotEqual(t, d.Estimate[0].Items[0].VRAMs[0].NonUMA, d.Estimate[1].Items[0].VRAMs[0].NonUMA)
+		}
+	})
+}
@@ -1,9 +1,11 @@
 package gguf_parser
 
 import (
+	"math"
 	"regexp"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/gpustack/gguf-parser-go/util/anyx"
 	"github.com/gpustack/gguf-parser-go/util/ptr"
@@ -33,6 +35,10 @@ type (
 		FlashAttention bool `json:"flashAttention"`
 		// ContextSize is the size of the context.
 		ContextSize uint64 `json:"contextSize"`
+		// SlidingWindowContextSize is the context size of the sliding window attention layers.
+		//
+		// Only available when the model uses the sliding window attention.
+		SlidingWindowContextSize uint64 `json:"slidingWindowContextSize,omitempty"`
 		// OffloadLayers is the number of offloaded layers.
 		OffloadLayers uint64 `json:"offloadLayers"`
 		// FullOffloaded is the flag to indicate whether the layers are fully offloaded,
@@ -67,6 +73,23 @@ type (
 		Adapters []LLaMACppRunEstimate `json:"adapters,omitempty"`
 		// MaximumTokensPerSecond represents the maximum tokens per second for running the GGUF file.
 		MaximumTokensPerSecond *GGUFTokensPerSecondScalar `json:"maximumTokensPerSecond,omitempty"`
+		// PromptLength is the length of the prompt to estimate the prompt processing.
+		//
+		// Only available when MaximumPromptTokensPerSecond is not nil.
+		PromptLength uint64 `json:"promptLength,omitempty"`
+		// MaximumPromptTokensPerSecond represents the maximum tokens per second for processing the prompt(prefill).
+		MaximumPromptTokensPerSecond *GGUFTokensPerSecondScalar `json:"maximumPromptTokensPerSecond,omitempty"`
+		// MinimumTimeToFirstToken represents the minimum time to first token after processing the prompt.
+		MinimumTimeToFirstToken *time.Duration `json:"minimumTimeToFirstToken,omitempty"`
+		// SpeculativeDraftSize is the number of tokens to draft for each verification,
+		// which maximizes the MaximumSpeculativeTokensPerSecond,
+		// 0 if the speculative decoding is not faster than the plain decoding.
+		//
+		// Only available when MaximumSpeculativeTokensPerSecond is not nil.
+		SpeculativeDraftSize uint64 `json:"speculativeDraftSize,omitempty"`
+		// MaximumSpeculativeTokensPerSecond represents the maximum tokens per second for running the GGUF file
+		// with the Drafter in speculative decoding.
+		MaximumSpeculativeTokensPerSecond *GGUFTokensPerSecondScalar `json:"maximumSpeculativeTokensPerSecond,omitempty"`
 	}
 
 	// LLaMACppRunDeviceUsage represents the usage for running the GGUF file in llama.cpp.
@@ -186,6 +209,23 @@ func (gf *GGUFFile) EstimateLLaMACppRun(opts ...GGUFRunEstimateOption) (e LLaMAC
 	if o.LMCSplitMode >= _LLAMACppSplitModeMax {
 		panic("split mode must be less than max")
 	}
+	if o.LMCDraftMinSize == nil {
+		o.LMCDraftMinSize = ptr.To(int32(0))
+	}
+	if o.LMCDraftMaxSize == nil {
+		o.LMCDraftMaxSize = ptr.To(int32(16))
+	}
+	if *o.LMCDraftMinSize > *o.LMCDraftMaxSize {
+		o.LMCDraftMinSize = o.LMCDraftMaxSize
+	}
+	if o.LMCDraftAcceptRate == nil {
+		o.LMCDraftAcceptRate = ptr.To(0.7)
+	}
+	for _, ov := range o.LMCTensorOverrides {
+		if ov.Device < 0 || ov.Device > len(o.TensorSplitFraction) {
+			panic("tensor override device must be range of 0 to the length of tensor split fraction")
+		}
+	}
 
 	// Devices.
 	e.Devices = make([]LLaMACppRunDeviceUsage, len(o.TensorSplitFraction)+1)
@@ -420,6 +460,32 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 
 	// Weight & Parameter.
 	{
+		// overridden returns the tensors found by the given search function and claimed by the tensor overrides,
+		// the first matched override wins,
+		// see https://github.com/ggml-org/llama.cpp/blob/master/src/llama-model.cpp.
+		type overriddenTensor struct {
+			Device   int
+			Bytes    GGUFBytesScalar
+			Elements GGUFParametersScalar
+		}
+		overridden := func(search func(*regexp.Regexp) []GGUFTensorInfo) (ots []overriddenTensor) {
+			claimed := map[string]struct{}{}
+			for _, ov := range o.LMCTensorOverrides {
+				for _, ti := range search(ov.Regex) {
+					if _, ok := claimed[ti.Name]; ok {
+						continue
+					}
+					claimed[ti.Name] = struct{}{}
+					ots = append(ots, overriddenTensor{
+						Device:   ov.Device,
+						Bytes:    GGUFBytesScalar(ti.Bytes()),
+						Elements: GGUFParametersScalar(ti.Elements()),
+					})
+				}
+			}
+			return ots
+		}
+
 		// Compute.
 		for i, j, offloadStart := 0, 0, len(tfLs)-int(nOffloadLayers); i < len(tfLs); i++ {
 			idx := 0
@@ -428,8 +494,19 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 				j = slicex.UpperBound(o.TensorSplitFraction, x)
 				idx = j + 1
 			}
-			e.Devices[idx].Weight.Compute += GGUFBytesScalar(tfLs[i].Bytes())
-			e.Devices[idx].Parameter.Compute += GGUFParametersScalar(tfLs[i].Elements())
+			wg, ps := GGUFBytesScalar(tfLs[i].Bytes()), GGUFParametersScalar(tfLs[i].Elements())
+			// Reassign the weights of the overridden tensors.
+			for _, ot := range overridden(tfLs[i].Search) {
+				if ot.Device == idx {
+					continue
+				}
+				e.Devices[ot.Device].Weight.Compute += ot.Bytes
+				e.Devices[ot.Device].Parameter.Compute += ot.Elements
+				wg -= ot.Bytes
+				ps -= ot.Elements
+			}
+			e.Devices[idx].Weight.Compute += wg
+			e.Devices[idx].Parameter.Compute += ps
 		}
 
 		// IO,
@@ -454,26 +531,84 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 		} else {
 			e.Devices[0].Parameter.Output = ps
 		}
+
+		// Reassign the weights of the overridden tensors.
+		for _, ot := range overridden(ipLs.Search) {
+			if ot.Device == 0 {
+				continue
+			}
+			e.Devices[ot.Device].Weight.Input += ot.Bytes
+			e.Devices[ot.Device].Parameter.Input += ot.Elements
+			e.Devices[0].Weight.Input -= ot.Bytes
+			e.Devices[0].Parameter.Input -= ot.Elements
+		}
+		idxHolder := 0
+		if fullOffload {
+			idxHolder = idxOutputDevice
+		}
+		for _, ot := range overridden(opLs.Search) {
+			if ot.Device == idxHolder {
+				continue
+			}
+			// The CPU keeps the output weights even if fully offloaded.
+			e.Devices[idxHolder].Weight.Output -= ot.Bytes
+			if ot.Device != 0 {
+				e.Devices[ot.Device].Weight.Output += ot.Bytes
+			}
+			e.Devices[ot.Device].Parameter.Output += ot.Elements
+			e.Devices[idxHolder].Parameter.Output -= ot.Elements
+		}
+	}
+
+	// The MLA(Multi-head Latent Attention) caches the compressed latent and the RoPE part of the key,
+	// and the latent is the value,
+	// see https://github.com/ggml-org/llama.cpp/blob/master/src/llama-model.cpp.
+	embdKGQA, embdVGQA := a.EmbeddingKeyGQA, a.EmbeddingValueGQA
+	if a.AttentionMLA() {
+		embdKGQA = uint64(a.AttentionKVLoRARank) + a.RoPEDimensionCount
+		embdVGQA = uint64(a.AttentionKVLoRARank)
 	}
 
 	// KV cache,
 	// see https://github.com/ggerganov/llama.cpp/blob/d6ef0e77dd25f54fb5856af47e3926cf6f36c281/llama.cpp#L2479-L2501.
 	{
-		kps, vps := a.EmbeddingKeyGQA*nKV, a.EmbeddingValueGQA*nKV
-		krs, vrs := o.LMCCacheKeyType.RowSizeOf([]uint64{kps}), o.LMCCacheValueType.RowSizeOf([]uint64{vps})
+		// The KV cache of the sliding window attention(SWA) layers only holds the window,
+		// see https://github.com/ggml-org/llama.cpp/blob/master/src/llama-kv-cache-unified-iswa.cpp.
+		nKVSWA := nKV
+		if a.AttentionSlidingWindow > 0 && !o.LMCFullSWACache {
+			nKVSWA = min(nKV, GGMLPadding(a.AttentionSlidingWindow*nParallel+nTokens, 256))
+		}
+		if len(a.AttentionSlidingWindowLayers) != 0 {
+			e.SlidingWindowContextSize = nKVSWA
+		}
+
+		// kvc returns the KV cache usage of the layers in [start, end).
+		kvc := func(start, end uint64) (k, v GGUFBytesScalar, p GGUFParametersScalar) {
+			for i := start; i < end; i++ {
+				n := nKV
+				if i < uint64(len(a.AttentionSlidingWindowLayers)) && a.AttentionSlidingWindowLayers[i] {
+					n = nKVSWA
+				}
+				kps, vps := embdKGQA*n, embdVGQA*n
+				k += GGUFBytesScalar(o.LMCCacheKeyType.RowSizeOf([]uint64{kps}))
+				v += GGUFBytesScalar(o.LMCCacheValueType.RowSizeOf([]uint64{vps}))
+				p += GGUFParametersScalar(kps + vps)
+			}
+			return k, v, p
+		}
 
-		e.Devices[0].KVCache.Key = GGUFBytesScalar(krs * nLoadLayers)
-		e.Devices[0].KVCache.Value = GGUFBytesScalar(vrs * nLoadLayers)
-		e.Devices[0].Parameter.KVCache = GGUFParametersScalar((kps + vps) * nLoadLayers)
 		if !*o.LMCOffloadKVCache {
-			e.Devices[0].KVCache.Key += GGUFBytesScalar(krs * nOffloadLayers)
-			e.Devices[0].KVCache.Value += GGUFBytesScalar(vrs * nOffloadLayers)
-			e.Devices[0].Parameter.KVCache += GGUFParametersScalar((kps + vps) * nOffloadLayers)
-		} else if !zeroOffload {
-			for i, d := range e.Devices[1:] {
-				e.Devices[i+1].KVCache.Key = GGUFBytesScalar(krs * d.HandleLayers)
-				e.Devices[i+1].KVCache.Value = GGUFBytesScalar(vrs * d.HandleLayers)
-				e.Devices[i+1].Parameter.KVCache = GGUFParametersScalar((kps + vps) * d.HandleLayers)
+			e.Devices[0].KVCache.Key, e.Devices[0].KVCache.Value, e.Devices[0].Parameter.KVCache = kvc(0, nLoadLayers+nOffloadLayers)
+		} else {
+			e.Devices[0].KVCache.Key, e.Devices[0].KVCache.Value, e.Devices[0].Parameter.KVCache = kvc(0, nLoadLayers)
+			if !zeroOffload {
+				for i, d := range e.Devices[1:] {
+					if d.HandleLayers == 0 {
+						continue
+					}
+					start := uint64(d.HandleLastLayer+1) - d.HandleLayers
+					e.Devices[i+1].KVCache.Key, e.Devices[i+1].KVCache.Value, e.Devices[i+1].Parameter.KVCache = kvc(start, start+d.HandleLayers)
+				}
 			}
 		}
 	}
@@ -567,11 +702,16 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 				e.Devices[i+1].Computation.Compute = cp
 			}
 		default:
+			// The MLA attends to the latent as a single key and value head.
+			attnKL, attnVL, attnHKV := uint64(a.AttentionKeyLength), uint64(a.AttentionValueLength), a.AttentionHeadCountKV
+			if a.AttentionMLA() {
+				attnKL, attnVL, attnHKV = uint64(a.AttentionKVLoRARank)+a.RoPEDimensionCount, uint64(a.AttentionKVLoRARank), 1
+			}
 			loadAttnInc, offloadAttnInc := uint64(0), uint64(0)
 			{
-				rs := o.LMCCacheKeyType.RowSizeOf([]uint64{uint64(a.AttentionKeyLength), nKV, a.AttentionHeadCountKV})
+				rs := o.LMCCacheKeyType.RowSizeOf([]uint64{attnKL, nKV, attnHKV})
 				loadAttnInc = rs // k-?
-				rs = o.LMCCacheValueType.RowSizeOf([]uint64{uint64(a.AttentionValueLength), nKV, a.AttentionHeadCountKV})
+				rs = o.LMCCacheValueType.RowSizeOf([]uint64{attnVL, nKV, attnHKV})
 				loadAttnInc += rs // v-?
 			}
 			if o.FlashAttention {
@@ -587,10 +727,10 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 					offloadAttnInc += rs
 				}
 				// https://github.com/ggerganov/llama.cpp/blob/172c8256840ffd882ab9992ecedbb587d9b21f15/llama.cpp#L6986-L6992.
-				rs := o.LMCCacheKeyType.RowSizeOf([]uint64{uint64(a.AttentionKeyLength), nKV, a.AttentionHeadCountKV})
+				rs := o.LMCCacheKeyType.RowSizeOf([]uint64{attnKL, nKV, attnHKV})
 				offloadAttnInc += rs
 				// https://github.com/ggerganov/llama.cpp/blob/172c8256840ffd882ab9992ecedbb587d9b21f15/llama.cpp#L7000-L7007.
-				rs = o.LMCCacheValueType.RowSizeOf([]uint64{uint64(a.AttentionValueLength), nKV, a.AttentionHeadCountKV})
+				rs = o.LMCCacheValueType.RowSizeOf([]uint64{attnVL, nKV, attnHKV})
 				offloadAttnInc += rs
 			} else {
 				offloadAttnInc = uint64(0)
@@ -717,6 +857,98 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 		}
 		e.MaximumTokensPerSecond = ptr.To(GGUFTokensPerSecondScalar(1 / lt))
 	}
+
+	// Maximum prompt tokens per second and minimum time to first token.
+	//
+	// The prompt is split into the logical batches,
+	// and each logical batch is split into the physical batches,
+	// which are processed by the devices in a pipeline,
+	// see https://github.com/ggml-org/llama.cpp/blob/master/src/llama-context.cpp.
+	// Processing a physical batch is compute-bound in general,
+	// the weights are loaded once for all tokens of the batch,
+	// and the attention grows with the position of the tokens.
+	if ds, dmss := e.Devices, o.DeviceMetrics; len(dmss) != 0 {
+		nPrompt := min(uint64(ptr.Deref(o.LMCPromptLength, *o.LMCLogicalBatchSize)), nContext)
+		nLBatch := min(uint64(*o.LMCLogicalBatchSize), nContext)
+		nUBatch := max(nBatch, 1)
+		// Each query head attends to the keys and values of the positions,
+		// which is n_head * (n_embd_head_k + n_embd_head_v) per position and layer,
+		// rather than the cached n_head_kv heads of the GQA(Grouped-Query Attention) or the latent of the MLA.
+		attnScale := float64(a.AttentionHeadCount*uint64(a.AttentionKeyLength+a.AttentionValueLength)) /
+			float64(max(embdKGQA+embdVGQA, 1))
+
+		// ubatchLatency returns the latency of the devices for processing the physical batch,
+		// which contains nTks tokens and starts from the position pos.
+		ubatchLatency := func(nTks, pos uint64) []float64 {
+			ltss := make([]float64, len(dmss))
+			for i, dm := range dmss {
+				if ds[i].HandleLayers == 0 && !ds[i].HandleOutputLayer {
+					continue
+				}
+				fl, upbw, dwbw := float64(max(dm.FLOPS, 1)), float64(max(dm.UpBandwidth, 1)), float64(max(dm.DownBandwidth, 1))
+				tks, attn := float64(nTks), float64(pos)+float64(nTks)/2
+				cmpops := float64(ds[i].Parameter.Compute) * 2 /* FMA */ * tks
+				kvcops := float64(ds[i].Parameter.KVCache) * attnScale * 2 /* FMA */ * tks * attn / float64(max(nKV, 1))
+				cmps := float64(ds[i].Weight.Compute) + float64(ds[i].KVCache.Sum())*attn/float64(max(nKV, 1))
+				if ds[i].HandleOutputLayer {
+					// Only the last token of the prompt is outputted.
+					cmpops += float64(ds[i].Parameter.Output) * 2 /* FMA */
+					cmps += float64(ds[i].Weight.Output)
+				}
+				ffs := float64(GGMLTypeF32.RowSizeOf([]uint64{a.EmbeddingLength, nTks}))
+				ltss[i] = max((cmpops+kvcops)/fl, cmps/upbw) + ffs/dwbw
+			}
+			return ltss
+		}
+
+		lt := float64(0)
+		for s := uint64(0); s < nPrompt; s += nLBatch {
+			// The first physical batch passes through all devices,
+			// and the rest are pipelined behind the slowest device.
+			for j, l := uint64(0), min(nLBatch, nPrompt-s); j*nUBatch < l; j++ {
+				ltss := ubatchLatency(min(nUBatch, l-j*nUBatch), s+j*nUBatch)
+				if j == 0 {
+					for i := range ltss {
+						lt += ltss[i]
+					}
+				} else {
+					lt += slices.Max(ltss)
+				}
+			}
+		}
+		if lt > 0 {
+			e.PromptLength = nPrompt
+			e.MaximumPromptTokensPerSecond = ptr.To(GGUFTokensPerSecondScalar(float64(nPrompt) / lt))
+			e.MinimumTimeToFirstToken = ptr.To(time.Duration(lt * float64(time.Second)))
+		}
+	}
+
+	// Maximum speculative tokens per second.
+	//
+	// Each round, the drafter generates n tokens one by one,
+	// and the model verifies them in one batch,
+	// which costs as much as generating one token since decoding is memory-bound.
+	// With the acceptance rate a of each drafted token,
+	// the expected tokens of a round are (1 - a^(n+1)) / (1 - a),
+	// see https://arxiv.org/abs/2211.17192.
+	// The draft size is searched within the range of "--draft-min" and "--draft-max",
+	// see https://github.com/ggml-org/llama.cpp/blob/master/common/speculative.cpp,
+	// and it is 0 with the plain decoding throughput if drafting is not faster.
+	if dft := e.Drafter; dft != nil && e.MaximumTokensPerSecond != nil && dft.MaximumTokensPerSecond != nil {
+		e.SpeculativeDraftSize, e.MaximumSpeculativeTokensPerSecond = 0, ptr.To(*e.MaximumTokensPerSecond)
+		lt, dlt, ar := 1/float64(*e.MaximumTokensPerSecond), 1/float64(*dft.MaximumTokensPerSecond), *o.LMCDraftAcceptRate
+		for n := max(*o.LMCDraftMinSize, 1); n <= *o.LMCDraftMaxSize; n++ {
+			tks := float64(n + 1)
+			if ar < 1 {
+				tks = (1 - math.Pow(ar, float64(n+1))) / (1 - ar)
+			}
+			tps := GGUFTokensPerSecondScalar(tks / (float64(n)*dlt + lt))
+			if tps > *e.MaximumSpeculativeTokensPerSecond {
+				e.SpeculativeDraftSize = uint64(n)
+				e.MaximumSpeculativeTokensPerSecond = ptr.To(tps)
+			}
+		}
+	}
 }
 
 func (gf *GGUFFile) estimateLLaMACppRunInProjector(o *_GGUFRunEstimateOptions, a *GGUFArchitecture, e *LLaMACppRunEstimate) {
@@ -1111,6 +1343,18 @@ type (
 		FullOffloaded bool `json:"fullOffloaded"`
 		// MaximumTokensPerSecond is the maximum tokens per second for running the GGUF file.
 		MaximumTokensPerSecond *GGUFTokensPerSecondScalar `json:"maximumTokensPerSecond,omitempty"`
+		// PromptLength is the length of the prompt to estimate the prompt processing.
+		PromptLength uint64 `json:"promptLength,omitempty"`
+		// MaximumPromptTokensPerSecond is the maximum tokens per second for processing the prompt(prefill).
+		MaximumPromptTokensPerSecond *GGUFTokensPerSecondScalar `json:"maximumPromptTokensPerSecond,omitempty"`
+		// MinimumTimeToFirstToken is the minimum time to first token after processing the prompt.
+		MinimumTimeToFirstToken *time.Duration `json:"minimumTimeToFirstToken,omitempty"`
+		// SpeculativeDraftSize is the number of tokens to draft for each verification in speculative decoding,
+		// 0 if the speculative decoding is not faster than the plain decoding.
+		SpeculativeDraftSize uint64 `json:"speculativeDraftSize,omitempty"`
+		// MaximumSpeculativeTokensPerSecond is the maximum tokens per second for running the GGUF file
+		// with the drafter in speculative decoding.
+		MaximumSpeculativeTokensPerSecond *GGUFTokensPerSecondScalar `json:"maximumSpeculativeTokensPerSecond,omitempty"`
 		// RAM is the memory usage for loading the GGUF file in RAM.
 		RAM LLaMACppRunEstimateMemory `json:"ram"`
 		// VRAMs is the memory usage for loading the GGUF file in VRAM per device.
@@ -1149,6 +1393,11 @@ func (e LLaMACppRunEstimate) SummarizeItem(mmap bool, nonUMARamFootprint, nonUMA
 		emi.OffloadLayers++ // The output layer is offloaded.
 	}
 	emi.MaximumTokensPerSecond = e.MaximumTokensPerSecond
+	emi.PromptLength = e.PromptLength
+	emi.MaximumPromptTokensPerSecond = e.MaximumPromptTokensPerSecond
+	emi.MinimumTimeToFirstToken = e.MinimumTimeToFirstToken
+	emi.SpeculativeDraftSize = e.SpeculativeDraftSize
+	emi.MaximumSpeculativeTokensPerSecond = e.MaximumSpeculativeTokensPerSecond
 
 	// RAM.
 	{
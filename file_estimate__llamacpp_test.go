@@ -2,9 +2,17 @@ package gguf_parser
 
 import (
 	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gpustack/gguf-parser-go/util/ptr"
 )
 
 func TestGGUFFile_EstimateLLaMACppRun(t *testing.T) {
@@ -123,3 +131,296 @@ func TestGGUFFile_EstimateLLaMACppRun_OffloadLayers(t *testing.T) {
 		})
 	}
 }
+
+func TestGGUFFile_EstimateLLaMACppRun_SlidingWindow(t *testing.T) {
+	dir := t.TempDir()
+
+	fx := newTestLLaMAFixture(GGUFVersionV3, false)
+	f, err := ParseGGUFFile(fx.WriteFiles(t, dir, "full", 1)[0])
+	require.NoError(t, err)
+
+	// The first layer uses the sliding window attention.
+	fx.MetadataKV = append(fx.MetadataKV,
+		GGUFMetadataKV{Key: "llama.attention.sliding_window", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(16)},
+		GGUFMetadataKV{Key: "llama.attention.sliding_window_pattern", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(2)})
+	swaF, err := ParseGGUFFile(fx.WriteFiles(t, dir, "swa", 1)[0])
+	require.NoError(t, err)
+
+	const (
+		nEmbdKGQA = 32 // 16 key length * 2 KV heads
+		nCtx      = 4096
+		nCtxSWA   = 768 // padding(16 window + 512 ubatch, 256)
+	)
+
+	opts := []GGUFRunEstimateOption{WithLLaMACppContextSize(nCtx), WithLLaMACppOffloadLayers(1)}
+	e := f.EstimateLLaMACppRun(opts...)
+	swaE := swaF.EstimateLLaMACppRun(opts...)
+
+	assert.Equal(t, uint64(0), e.SlidingWindowContextSize)
+	assert.Equal(t, uint64(nCtxSWA), swaE.SlidingWindowContextSize)
+	// The first layer is on the CPU, the second layer is on the GPU.
+	assert.Equal(t, GGUFBytesScalar(nEmbdKGQA*nCtx*2), e.Devices[0].KVCache.Key)
+	assert.Equal(t, GGUFBytesScalar(nEmbdKGQA*nCtxSWA*2), swaE.Devices[0].KVCache.Key)
+	assert.Equal(t, GGUFBytesScalar(nEmbdKGQA*nCtxSWA*2), swaE.Devices[0].KVCache.Value)
+	assert.Equal(t, e.Devices[1].KVCache, swaE.Devices[1].KVCache)
+
+	// Without offloading KV cache, all layers are on the CPU.
+	swaE = swaF.EstimateLLaMACppRun(append(opts, WithoutLLaMACppOffloadKVCache())...)
+	assert.Equal(t, GGUFBytesScalar(nEmbdKGQA*(nCtx+nCtxSWA)*2), swaE.Devices[0].KVCache.Key)
+
+	// Full size SWA cache.
+	swaE = swaF.EstimateLLaMACppRun(append(opts, WithLLaMACppFullSWACache())...)
+	assert.Equal(t, e.Devices[0].KVCache, swaE.Devices[0].KVCache)
+}
+
+func TestGGUFFile_EstimateLLaMACppRun_MLA(t *testing.T) {
+	dir := t.TempDir()
+
+	// deepseek2 returns a DeepSeek V2 file renamed from the LLaMA fixture,
+	// with 4 heads, 24 key length(16 + 8 RoPE), 16 value length and 16 KV LoRA rank.
+	deepseek2 := func(name string, kvs map[string]uint32) *GGUFFile {
+		fx := newTestLLaMAFixture(GGUFVersionV3, false)
+		for i := range fx.MetadataKV {
+			switch kv := &fx.MetadataKV[i]; {
+			case kv.Key == "general.architecture":
+				kv.Value = "deepseek2"
+			case strings.HasPrefix(kv.Key, "llama."):
+				kv.Key = "deepseek2." + strings.TrimPrefix(kv.Key, "llama.")
+			}
+		}
+		kvs["rope.dimension_count"] = 8
+		kvs["attention.key_length"] = 24
+		kvs["attention.value_length"] = 16
+		kvs["attention.kv_lora_rank"] = 16
+		for k, v := range kvs {
+			kv := GGUFMetadataKV{Key: "deepseek2." + k, ValueType: GGUFMetadataValueTypeUint32, Value: v}
+			if i := slices.IndexFunc(fx.MetadataKV, func(e GGUFMetadataKV) bool { return e.Key == kv.Key }); i >= 0 {
+				fx.MetadataKV[i] = kv
+			} else {
+				fx.MetadataKV = append(fx.MetadataKV, kv)
+			}
+		}
+		f, err := ParseGGUFFile(fx.WriteFiles(t, dir, name, 1)[0])
+		require.NoError(t, err)
+		return f
+	}
+
+	const nCtx = 1024
+
+	opts := []GGUFRunEstimateOption{WithLLaMACppContextSize(nCtx), WithoutLLaMACppOffloadKVCache()}
+
+	// Converted before llama.cpp supports MLA, caches the key and value heads.
+	e := deepseek2("legacy", map[string]uint32{
+		"attention.head_count_kv": 4,
+	}).EstimateLLaMACppRun(opts...)
+	assert.Equal(t, GGUFBytesScalar(24*4*nCtx*2*2), e.Devices[0].KVCache.Key)
+	assert.Equal(t, GGUFBytesScalar(16*4*nCtx*2*2), e.Devices[0].KVCache.Value)
+
+	// MLA caches the latent and the RoPE part of the key,
+	// even if the KV heads are not rewritten.
+	for _, hkv := range []uint32{1, 4} {
+		e = deepseek2(fmt.Sprintf("mla-%d", hkv), map[string]uint32{
+			"attention.head_count_kv":    hkv,
+			"attention.key_length_mla":   24,
+			"attention.value_length_mla": 16,
+		}).EstimateLLaMACppRun(opts...)
+		assert.Equal(t, GGUFBytesScalar((16+8)*nCtx*2*2), e.Devices[0].KVCache.Key)
+		assert.Equal(t, GGUFBytesScalar(16*nCtx*2*2), e.Devices[0].KVCache.Value)
+		assert.Equal(t, GGUFParametersScalar((16+8+16)*nCtx*2), e.Devices[0].Parameter.KVCache)
+	}
+}
+
+func TestGGUFFile_EstimateLLaMACppRun_TensorOverrides(t *testing.T) {
+	fx := newTestLLaMAFixture(GGUFVersionV3, false)
+	f, err := ParseGGUFFile(fx.WriteFiles(t, t.TempDir(), "ot", 1)[0])
+	require.NoError(t, err)
+
+	var ffn, ffnDown GGUFBytesScalar
+	for _, ti := range f.TensorInfos.Search(regexp.MustCompile(`ffn_(gate|up|down)`)) {
+		ffn += GGUFBytesScalar(ti.Bytes())
+		if strings.Contains(ti.Name, "ffn_down") {
+			ffnDown += GGUFBytesScalar(ti.Bytes())
+		}
+	}
+
+	e := f.EstimateLLaMACppRun()
+	require.Equal(t, GGUFBytesScalar(0), e.Devices[0].Weight.Compute)
+
+	// Keep the FFN tensors on the CPU.
+	oe := f.EstimateLLaMACppRun(WithLLaMACppTensorOverrides([]LLaMACppTensorOverride{
+		{Regex: regexp.MustCompile(`ffn_(gate|up|down)`), Device: 0},
+	}))
+	assert.Equal(t, ffn, oe.Devices[0].Weight.Compute)
+	assert.Equal(t, e.Devices[1].Weight.Compute-ffn, oe.Devices[1].Weight.Compute)
+	assert.Equal(t, e.Devices[1].Parameter.Compute, oe.Devices[0].Parameter.Compute+oe.Devices[1].Parameter.Compute)
+	assert.Equal(t, e.Devices[1].HandleLayers, oe.Devices[1].HandleLayers)
+
+	// The first matched override wins.
+	oe = f.EstimateLLaMACppRun(WithLLaMACppTensorOverrides([]LLaMACppTensorOverride{
+		{Regex: regexp.MustCompile(`ffn_down`), Device: 1},
+		{Regex: regexp.MustCompile(`ffn_(gate|up|down)`), Device: 0},
+	}))
+	assert.Equal(t, ffn-ffnDown, oe.Devices[0].Weight.Compute)
+
+	// Pin the CPU layers to the GPU.
+	oe = f.EstimateLLaMACppRun(WithLLaMACppOffloadLayers(0), WithLLaMACppTensorOverrides([]LLaMACppTensorOverride{
+		{Regex: regexp.MustCompile(`ffn_(gate|up|down)`), Device: 1},
+	}))
+	assert.Equal(t, ffn, oe.Devices[1].Weight.Compute)
+
+	// Place the input and output tensors.
+	tew, _ := f.TensorInfos.Get("token_embd.weight")
+	ow, _ := f.TensorInfos.Get("output.weight")
+	oe = f.EstimateLLaMACppRun(WithLLaMACppTensorOverrides([]LLaMACppTensorOverride{
+		{Regex: regexp.MustCompile(`^token_embd\.weight$`), Device: 1},
+		{Regex: regexp.MustCompile(`^output\.weight$`), Device: 0},
+	}))
+	assert.Equal(t, e.Devices[0].Weight.Input-GGUFBytesScalar(tew.Bytes()), oe.Devices[0].Weight.Input)
+	assert.Equal(t, GGUFBytesScalar(tew.Bytes()), oe.Devices[1].Weight.Input)
+	assert.Equal(t, e.Devices[1].Weight.Output-GGUFBytesScalar(ow.Bytes()), oe.Devices[1].Weight.Output)
+	assert.Equal(t, e.Devices[0].Weight.Output, oe.Devices[0].Weight.Output)
+	assert.Equal(t, GGUFParametersScalar(ow.Elements()), oe.Devices[0].Parameter.Output)
+
+	// The override with a device out of range is rejected.
+	for _, d := range []int{-1, 2} {
+		assert.Panics(t, func() {
+			f.EstimateLLaMACppRun(WithLLaMACppTensorOverrides([]LLaMACppTensorOverride{
+				{Regex: regexp.MustCompile(`ffn_`), Device: d},
+			}))
+		}, d)
+	}
+	assert.NotPanics(t, func() {
+		f.EstimateLLaMACppRun(WithTensorSplitFraction([]float64{0.5, 1}), WithLLaMACppTensorOverrides([]LLaMACppTensorOverride{
+			{Regex: regexp.MustCompile(`ffn_`), Device: 2},
+		}))
+	})
+
+	// The override with a nil regex is dropped.
+	assert.Equal(t, e.Devices, f.EstimateLLaMACppRun(WithLLaMACppTensorOverrides([]LLaMACppTensorOverride{
+		{Device: 0},
+	})).Devices)
+}
+
+func TestGGUFFile_EstimateLLaMACppRun_Prompt(t *testing.T) {
+	fx := newTestLLaMAFixture(GGUFVersionV3, false)
+	f, err := ParseGGUFFile(fx.WriteFiles(t, t.TempDir(), "prompt", 1)[0])
+	require.NoError(t, err)
+
+	e := f.EstimateLLaMACppRun()
+	assert.Nil(t, e.MaximumPromptTokensPerSecond)
+	assert.Nil(t, e.MinimumTimeToFirstToken)
+
+	dms := []GGUFRunDeviceMetric{
+		{FLOPS: 1e12, UpBandwidth: 50e9, DownBandwidth: 10e9},
+		{FLOPS: 1e14, UpBandwidth: 1e12, DownBandwidth: 50e9},
+	}
+	estimate := func(opts ...GGUFRunEstimateOption) LLaMACppRunEstimate {
+		return f.EstimateLLaMACppRun(append([]GGUFRunEstimateOption{WithDeviceMetrics(dms)}, opts...)...)
+	}
+
+	// Defaults to the logical batch size, limited by the context size.
+	e = estimate()
+	require.NotNil(t, e.MaximumPromptTokensPerSecond)
+	require.NotNil(t, e.MinimumTimeToFirstToken)
+	assert.Equal(t, e.ContextSize, e.PromptLength)
+	assert.InEpsilon(t, float64(e.PromptLength)/e.MinimumTimeToFirstToken.Seconds(), float64(*e.MaximumPromptTokensPerSecond), 1e-2)
+	assert.Greater(t, float64(*e.MaximumPromptTokensPerSecond), float64(*e.MaximumTokensPerSecond))
+
+	emi := e.SummarizeItem(true, 0, 0)
+	assert.Equal(t, e.PromptLength, emi.PromptLength)
+	assert.Equal(t, e.MaximumPromptTokensPerSecond, emi.MaximumPromptTokensPerSecond)
+	assert.Equal(t, e.MinimumTimeToFirstToken, emi.MinimumTimeToFirstToken)
+
+	// The time to first token grows with the prompt length.
+	short := estimate(WithLLaMACppPromptLength(32))
+	long := estimate(WithLLaMACppPromptLength(128))
+	assert.Equal(t, uint64(32), short.PromptLength)
+	assert.Less(t, *short.MinimumTimeToFirstToken, *long.MinimumTimeToFirstToken)
+
+	// Splitting the prompt into smaller physical batches loads the weights more times.
+	small := estimate(WithLLaMACppPromptLength(128), WithLLaMACppPhysicalBatchSize(32))
+	assert.Less(t, *long.MinimumTimeToFirstToken, *small.MinimumTimeToFirstToken)
+
+	// The attention computes all query heads,
+	// so the GQA with 4 heads and 2 KV heads costs as much as the MHA with 4 KV heads on compute-bound devices,
+	// although the KV cache is halved.
+	mfx := newTestLLaMAFixture(GGUFVersionV3, false)
+	for i := range mfx.MetadataKV {
+		if mfx.MetadataKV[i].Key == "llama.attention.head_count_kv" {
+			mfx.MetadataKV[i].Value = uint32(4)
+		}
+	}
+	mf, err := ParseGGUFFile(mfx.WriteFiles(t, t.TempDir(), "prompt-mha", 1)[0])
+	require.NoError(t, err)
+	cdms := []GGUFRunDeviceMetric{
+		{FLOPS: 1e9, UpBandwidth: 1e15, DownBandwidth: 1e15},
+		{FLOPS: 1e9, UpBandwidth: 1e15, DownBandwidth: 1e15},
+	}
+	gqa := f.EstimateLLaMACppRun(WithDeviceMetrics(cdms), WithLLaMACppPromptLength(128))
+	mha := mf.EstimateLLaMACppRun(WithDeviceMetrics(cdms), WithLLaMACppPromptLength(128))
+	require.NotNil(t, gqa.MinimumTimeToFirstToken)
+	require.NotNil(t, mha.MinimumTimeToFirstToken)
+	assert.Equal(t, 2*gqa.Devices[1].KVCache.Sum(), mha.Devices[1].KVCache.Sum())
+	assert.InEpsilon(t, mha.MinimumTimeToFirstToken.Seconds(), gqa.MinimumTimeToFirstToken.Seconds(), 1e-6)
+}
+
+func TestGGUFFile_EstimateLLaMACppRun_Speculative(t *testing.T) {
+	fx := newTestLLaMAFixture(GGUFVersionV3, false)
+	f, err := ParseGGUFFile(fx.WriteFiles(t, t.TempDir(), "spec", 1)[0])
+	require.NoError(t, err)
+
+	dms := []GGUFRunDeviceMetric{
+		{FLOPS: 1e12, UpBandwidth: 50e9, DownBandwidth: 10e9},
+		{FLOPS: 1e14, UpBandwidth: 1e12, DownBandwidth: 50e9},
+	}
+	e := f.EstimateLLaMACppRun(WithDeviceMetrics(dms))
+	require.NotNil(t, e.MaximumTokensPerSecond)
+	assert.Nil(t, e.MaximumSpeculativeTokensPerSecond)
+
+	// Mock a drafter which is 10 times faster.
+	dft := e
+	dft.MaximumTokensPerSecond = ptr.To(*e.MaximumTokensPerSecond * 10)
+	estimate := func(opts ...GGUFRunEstimateOption) LLaMACppRunEstimate {
+		return f.EstimateLLaMACppRun(append([]GGUFRunEstimateOption{WithDeviceMetrics(dms), WithLLaMACppDrafter(&dft)}, opts...)...)
+	}
+
+	se := estimate()
+	require.NotNil(t, se.MaximumSpeculativeTokensPerSecond)
+	assert.Greater(t, float64(*se.MaximumSpeculativeTokensPerSecond), float64(*e.MaximumTokensPerSecond))
+	assert.GreaterOrEqual(t, se.SpeculativeDraftSize, uint64(1))
+	assert.LessOrEqual(t, se.SpeculativeDraftSize, uint64(16))
+
+	emi := se.SummarizeItem(true, 0, 0)
+	assert.Equal(t, se.SpeculativeDraftSize, emi.SpeculativeDraftSize)
+	assert.Equal(t, se.MaximumSpeculativeTokensPerSecond, emi.MaximumSpeculativeTokensPerSecond)
+
+	// The higher acceptance rate, the faster.
+	he := estimate(WithLLaMACppDraftAcceptanceRate(0.9))
+	assert.Greater(t, float64(*he.MaximumSpeculativeTokensPerSecond), float64(*se.MaximumSpeculativeTokensPerSecond))
+
+	// Accepting all drafted tokens drafts as many as possible.
+	ae := estimate(WithLLaMACppDraftAcceptanceRate(1), WithLLaMACppDraftSize(0, 8))
+	assert.Equal(t, uint64(8), ae.SpeculativeDraftSize)
+	assert.InEpsilon(t, 9/(8/float64(*dft.MaximumTokensPerSecond)+1/float64(*e.MaximumTokensPerSecond)),
+		float64(*ae.MaximumSpeculativeTokensPerSecond), 1e-6)
+
+	// Fixed draft size.
+	fe := estimate(WithLLaMACppDraftSize(4, 4))
+	assert.Equal(t, uint64(4), fe.SpeculativeDraftSize)
+
+	// The minimum is clamped to the maximum.
+	ce := estimate(WithLLaMACppDraftSize(8, 4))
+	assert.Equal(t, uint64(4), ce.SpeculativeDraftSize)
+	assert.NotPanics(t, func() {
+		ce = f.EstimateLLaMACppRun(WithDeviceMetrics(dms), WithLLaMACppDraftSize(20, 0))
+	})
+	assert.Nil(t, ce.MaximumSpeculativeTokensPerSecond)
+	ce = estimate(WithLLaMACppDraftSize(20, 0))
+	assert.Equal(t, uint64(16), ce.SpeculativeDraftSize)
+
+	// A slow drafter is not worth it.
+	dft.MaximumTokensPerSecond = e.MaximumTokensPerSecond
+	le := estimate()
+	assert.Equal(t, uint64(0), le.SpeculativeDraftSize)
+	assert.Equal(t, *e.MaximumTokensPerSecond, *le.MaximumSpeculativeTokensPerSecond)
+}
@@ -1,6 +1,7 @@
 package gguf_parser
 
 import (
+	"regexp"
 	"slices"
 
 	"github.com/gpustack/gguf-parser-go/util/ptr"
@@ -21,15 +22,21 @@ type (
 		LMCInMaxContextSize   bool
 		LMCLogicalBatchSize   *int32
 		LMCPhysicalBatchSize  *int32
+		LMCPromptLength       *int32
 		LMCVisualMaxImageSize *uint32
 		LMCCacheKeyType       *GGMLType
 		LMCCacheValueType     *GGMLType
 		LMCOffloadKVCache     *bool
+		LMCFullSWACache       bool
 		LMCOffloadLayers      *uint64
 		LMCSplitMode          LLaMACppSplitMode
 		LMCProjector          *LLaMACppRunEstimate
 		LMCDrafter            *LLaMACppRunEstimate
+		LMCDraftMinSize       *int32
+		LMCDraftMaxSize       *int32
+		LMCDraftAcceptRate    *float64
 		LMCAdapters           []LLaMACppRunEstimate
+		LMCTensorOverrides    []LLaMACppTensorOverride
 
 		// StableDiffusionCpp (SDC) specific
 		SDCOffloadLayers                *uint64
@@ -70,6 +77,18 @@ type (
 		DownBandwidth BytesPerSecondScalar
 	}
 
+	// LLaMACppTensorOverride places the tensors whose names match the regex on the device,
+	// as llama.cpp "--override-tensor" does,
+	// e.g. keep the expert FFN tensors of MoE models on the CPU.
+	LLaMACppTensorOverride struct {
+		// Regex matches the tensor names.
+		Regex *regexp.Regexp
+		// Device is the index of the device,
+		// 0 is the CPU, and i is the (i-1)-th GPU device,
+		// the RPC servers are in front of the local GPU devices.
+		Device int
+	}
+
 	// GGUFRunEstimateOption is the options for the estimate.
 	GGUFRunEstimateOption func(*_GGUFRunEstimateOptions)
 )
@@ -185,6 +204,18 @@ func WithLLaMACppPhysicalBatchSize(size int32) GGUFRunEstimateOption {
 	}
 }
 
+// WithLLaMACppPromptLength sets the length of the prompt for the estimate,
+// which is used to estimate the prompt processing throughput and the time to first token with WithDeviceMetrics,
+// default is the logical batch size.
+func WithLLaMACppPromptLength(length int32) GGUFRunEstimateOption {
+	return func(o *_GGUFRunEstimateOptions) {
+		if length <= 0 {
+			return
+		}
+		o.LMCPromptLength = &length
+	}
+}
+
 // _GGUFEstimateCacheTypeAllowList is the allow list of cache key and value types.
 var _GGUFEstimateCacheTypeAllowList = []GGMLType{
 	GGMLTypeF32,
@@ -221,6 +252,14 @@ func WithoutLLaMACppOffloadKVCache() GGUFRunEstimateOption {
 	}
 }
 
+// WithLLaMACppFullSWACache sizes the KV cache of the sliding window attention layers with the full context,
+// which is the same as the llama.cpp "--swa-full".
+func WithLLaMACppFullSWACache() GGUFRunEstimateOption {
+	return func(o *_GGUFRunEstimateOptions) {
+		o.LMCFullSWACache = true
+	}
+}
+
 // WithLLaMACppOffloadLayers sets the number of layers to offload.
 func WithLLaMACppOffloadLayers(layers uint64) GGUFRunEstimateOption {
 	return func(o *_GGUFRunEstimateOptions) {
@@ -264,6 +303,38 @@ func WithLLaMACppDrafter(dft *LLaMACppRunEstimate) GGUFRunEstimateOption {
 	}
 }
 
+// WithLLaMACppDraftSize sets the range of the number of tokens to draft for the speculative decoding,
+// default is [0, 16] as llama.cpp "--draft-min" and "--draft-max",
+// the minimum is clamped to the maximum.
+//
+// Works with WithLLaMACppDrafter and WithDeviceMetrics.
+func WithLLaMACppDraftSize(minSize, maxSize int32) GGUFRunEstimateOption {
+	return func(o *_GGUFRunEstimateOptions) {
+		if maxSize > 0 {
+			minSize = min(minSize, maxSize)
+		}
+		if minSize >= 0 {
+			o.LMCDraftMinSize = &minSize
+		}
+		if maxSize > 0 {
+			o.LMCDraftMaxSize = &maxSize
+		}
+	}
+}
+
+// WithLLaMACppDraftAcceptanceRate sets the probability that the target model accepts a drafted token,
+// which must be in the range of (0, 1], default is 0.7.
+//
+// Works with WithLLaMACppDrafter and WithDeviceMetrics.
+func WithLLaMACppDraftAcceptanceRate(rate float64) GGUFRunEstimateOption {
+	return func(o *_GGUFRunEstimateOptions) {
+		if rate <= 0 || rate > 1 {
+			return
+		}
+		o.LMCDraftAcceptRate = &rate
+	}
+}
+
 // WithLLaMACppProjector sets the multimodal projector estimate usage.
 func WithLLaMACppProjector(prj *LLaMACppRunEstimate) GGUFRunEstimateOption {
 	return func(o *_GGUFRunEstimateOptions) {
@@ -281,6 +352,25 @@ func WithLLaMACppAdapters(adp []LLaMACppRunEstimate) GGUFRunEstimateOption {
 	}
 }
 
+// WithLLaMACppTensorOverrides sets the tensor overrides for the estimate,
+// which reassigns the weights of the matched tensors to the given devices,
+// e.g. the tensors in the blocks, "token_embd.weight" and "output.weight",
+// the first matched override wins.
+//
+// The overrides with a nil regex are dropped,
+// and the estimate panics if the device of any override is out of range,
+// i.e. not in [0, the length of WithTensorSplitFraction].
+func WithLLaMACppTensorOverrides(overrides []LLaMACppTensorOverride) GGUFRunEstimateOption {
+	return func(o *_GGUFRunEstimateOptions) {
+		if len(overrides) == 0 {
+			return
+		}
+		o.LMCTensorOverrides = slices.DeleteFunc(slices.Clone(overrides), func(ov LLaMACppTensorOverride) bool {
+			return ov.Regex == nil
+		})
+	}
+}
+
 // WithStableDiffusionCppOffloadLayers sets the number of layers to offload.
 func WithStableDiffusionCppOffloadLayers(layers uint64) GGUFRunEstimateOption {
 	return func(o *_GGUFRunEstimateOptions) {
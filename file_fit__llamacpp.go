@@ -0,0 +1,262 @@
+package gguf_parser
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/gpustack/gguf-parser-go/util/ptr"
+)
+
+type (
+	// GGUFRunDeviceBudget holds the available memory of a device for fitting.
+	GGUFRunDeviceBudget struct {
+		// Memory is the available memory of the device.
+		Memory GGUFBytesScalar `json:"memory"`
+	}
+
+	// LLaMACppRunFitResult represents the fitted configuration for running the GGUF file in llama.cpp.
+	LLaMACppRunFitResult struct {
+		// ContextSize is the fitted context size.
+		ContextSize uint64 `json:"contextSize"`
+		// OffloadLayers is the fitted number of offloaded layers,
+		// includes the output layer if FullOffloaded is true.
+		OffloadLayers uint64 `json:"offloadLayers"`
+		// FullOffloaded is the flag to indicate whether the layers are fully offloaded.
+		FullOffloaded bool `json:"fullOffloaded"`
+		// CacheKeyType is the fitted type of the key cache.
+		CacheKeyType GGMLType `json:"cacheKeyType"`
+		// CacheValueType is the fitted type of the value cache,
+		// which falls back to F16 if the flash attention is disabled.
+		CacheValueType GGMLType `json:"cacheValueType"`
+		// ParallelSize is the fitted parallel size.
+		ParallelSize int32 `json:"parallelSize"`
+		// Options are the estimate options to reproduce the fitted estimate,
+		// includes the given estimate options.
+		Options []GGUFRunEstimateOption `json:"-"`
+		// Summary is the summary of the fitted estimate.
+		Summary LLaMACppRunEstimateSummary `json:"summary"`
+	}
+)
+
+// FitLLaMACppRun searches the configuration that fits the given device budgets to run the GGUF file in llama.cpp,
+// which searches the context size, offload layers, KV cache types and parallel size by binary search,
+// and maximizes the target given by WithLLaMACppFitTarget.
+//
+// The first budget is the RAM, and the rest are the VRAMs of the devices in order,
+// the layers are split by the VRAM budgets unless WithTensorSplitFraction is given.
+// With the RAM budget only, no layers are offloaded.
+// The non-UMA memory usage is compared with the budgets.
+func (gf *GGUFFile) FitLLaMACppRun(budgets []GGUFRunDeviceBudget, opts ...LLaMACppRunFitOption) (r LLaMACppRunFitResult, err error) {
+	// Options
+	var o _LLaMACppRunFitOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if len(budgets) == 0 {
+		return r, errors.New("at least one RAM budget is required")
+	}
+	if len(o.CacheTypes) == 0 {
+		o.CacheTypes = []GGMLType{GGMLTypeF16}
+	}
+
+	a := gf.Architecture()
+	if a.Type != "model" {
+		return r, fmt.Errorf("cannot fit %s file", a.Type)
+	}
+	nLayers := a.BlockCount
+	if nLayers == 0 {
+		nLayers = uint64(len(gf.Layers()))
+	}
+	maxCtx := o.MaxContextSize
+	if maxCtx <= 0 {
+		maxCtx = int32(min(a.MaximumContextLength, 1<<30))
+	}
+	minCtx := o.MinContextSize
+	if minCtx <= 0 {
+		minCtx = 4096
+	}
+	if maxCtx <= 0 {
+		maxCtx = minCtx
+	} else {
+		minCtx = min(minCtx, maxCtx)
+	}
+
+	// Split the layers by the VRAM budgets.
+	var bopts []GGUFRunEstimateOption
+	if vbs := budgets[1:]; len(vbs) > 1 {
+		var sum float64
+		for _, b := range vbs {
+			sum += float64(b.Memory)
+		}
+		if sum > 0 {
+			fs, acc := make([]float64, len(vbs)), float64(0)
+			for i, b := range vbs {
+				acc += float64(b.Memory)
+				fs[i] = acc / sum
+			}
+			fs[len(fs)-1] = 1
+			bopts = append(bopts, WithTensorSplitFraction(fs))
+		}
+	}
+	bopts = append(bopts, o.EstimateOptions...)
+	var eo _GGUFRunEstimateOptions
+	for _, opt := range bopts {
+		opt(&eo)
+	}
+	par := ptr.Deref(eo.ParallelSize, 1)
+
+	type config struct {
+		ctx    int32
+		layers uint64
+		typ    GGMLType
+		par    int32
+	}
+	options := func(c config) []GGUFRunEstimateOption {
+		return append(slices.Clone(bopts),
+			WithLLaMACppContextSize(c.ctx),
+			WithLLaMACppOffloadLayers(c.layers),
+			WithLLaMACppCacheKeyType(c.typ),
+			WithLLaMACppCacheValueType(c.typ),
+			WithParallelSize(c.par))
+	}
+
+	// fits returns whether the RAM and the VRAMs fit the budgets respectively.
+	fits := func(c config) (ram, vram bool) {
+		emi := gf.EstimateLLaMACppRun(options(c)...).SummarizeItem(!o.NoMMap, 0, 0)
+		ram, vram = emi.RAM.NonUMA <= budgets[0].Memory, true
+		for i, v := range emi.VRAMs {
+			if i+1 < len(budgets) && v.NonUMA > budgets[i+1].Memory {
+				vram = false
+				break
+			}
+		}
+		return ram, vram
+	}
+
+	// layersAt returns the maximum offload layers that fit the budgets.
+	//
+	// Within the partial offload, the VRAM usage grows with the offload layers while the RAM usage shrinks,
+	// so the maximum layers fitting the VRAMs is the candidate,
+	// the full offload and the zero offload are checked separately,
+	// as they get rid of the intermediate results between the devices.
+	layersAt := func(c config) (uint64, bool) {
+		if len(budgets) == 1 {
+			c.layers = 0
+			ram, _ := fits(c)
+			return 0, ram
+		}
+		c.layers = nLayers + 1 // The extra one is the output layer.
+		if ram, vram := fits(c); ram && vram {
+			return c.layers, true
+		}
+		lo, hi := uint64(0), nLayers
+		for lo < hi {
+			c.layers = (lo + hi + 1) / 2
+			if _, vram := fits(c); vram {
+				lo = c.layers
+			} else {
+				hi = c.layers - 1
+			}
+		}
+		for _, l := range []uint64{lo, 0} {
+			c.layers = l
+			if ram, vram := fits(c); ram && vram {
+				return l, true
+			}
+		}
+		return 0, false
+	}
+
+	// ctxAt returns the maximum context size in [minSize, maxCtx],
+	// which fits the budgets with at least the given offload layers.
+	ctxAt := func(c config, minSize int32, layers uint64) (int32, uint64, bool) {
+		ok := func(ctx int32) (uint64, bool) {
+			c.ctx = ctx
+			l, fit := layersAt(c)
+			return l, fit && l >= layers
+		}
+		l, fit := ok(minSize)
+		if !fit {
+			return 0, 0, false
+		}
+		// Search in the steps of 256, which is the padding of the KV cache.
+		lo, hi := int32(0), (maxCtx-minSize+255)/256
+		for lo < hi {
+			m := (lo + hi + 1) / 2
+			if _, fit = ok(min(minSize+m*256, maxCtx)); fit {
+				lo = m
+			} else {
+				hi = m - 1
+			}
+		}
+		ctx := min(minSize+lo*256, maxCtx)
+		l, _ = ok(ctx)
+		return ctx, l, true
+	}
+
+	var (
+		best  config
+		found bool
+	)
+	switch o.Target {
+	default: // Context size.
+		for _, t := range o.CacheTypes {
+			c := config{typ: t, par: par}
+			ctx, l, fit := ctxAt(c, minCtx, 0)
+			if fit && (!found || ctx > best.ctx || ctx == best.ctx && l > best.layers) {
+				c.ctx, c.layers = ctx, l
+				best, found = c, true
+			}
+		}
+	case LLaMACppRunFitTargetThroughput:
+		// tps returns the estimated maximum tokens per second,
+		// which is zero if the device metrics are not given.
+		tps := func(c config) float64 {
+			if len(eo.DeviceMetrics) == 0 {
+				return 0
+			}
+			return float64(ptr.Deref(gf.EstimateLLaMACppRun(options(c)...).MaximumTokensPerSecond, 0))
+		}
+		var bestTPS float64
+		for _, t := range o.CacheTypes {
+			c := config{ctx: min(minCtx*par, maxCtx), typ: t, par: par}
+			l, fit := layersAt(c)
+			if !fit {
+				continue
+			}
+			c.layers = l
+			if s := tps(c); !found || s > bestTPS || s == bestTPS && l > best.layers {
+				best, bestTPS, found = c, s, true
+			}
+		}
+		if !found {
+			break
+		}
+		// Keep the offload layers, and double the parallel size while fitting.
+		for p := best.par * 2; p <= o.MaxParallelSize && int64(minCtx)*int64(p) <= int64(maxCtx); p *= 2 {
+			c := best
+			c.ctx, c.par = minCtx*p, p
+			if l, fit := layersAt(c); !fit || l < best.layers {
+				break
+			}
+			best = c
+		}
+		best.ctx, best.layers, _ = ctxAt(best, best.ctx, best.layers)
+	}
+	if !found {
+		return r, errors.New("no configuration fits the budgets")
+	}
+
+	r.Options = options(best)
+	r.Summary = gf.EstimateLLaMACppRun(r.Options...).Summarize(!o.NoMMap, 0, 0)
+	r.ContextSize = r.Summary.ContextSize
+	r.OffloadLayers = r.Summary.Items[0].OffloadLayers
+	r.FullOffloaded = r.Summary.Items[0].FullOffloaded
+	r.CacheKeyType, r.CacheValueType = best.typ, best.typ
+	if best.typ.IsQuantized() && !r.Summary.FlashAttention {
+		r.CacheValueType = GGMLTypeF16
+	}
+	r.ParallelSize = best.par
+	return r, nil
+}
@@ -0,0 +1,137 @@
+package gguf_parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGGUFFile_FitLLaMACppRun(t *testing.T) {
+	fx := newTestLLaMAFixture(GGUFVersionV3, false)
+	f, err := ParseGGUFFile(fx.WriteFiles(t, t.TempDir(), "fit", 1)[0])
+	require.NoError(t, err)
+
+	// budgetsOf returns the budgets that exactly fit the estimate with the given options.
+	budgetsOf := func(opts ...GGUFRunEstimateOption) []GGUFRunDeviceBudget {
+		emi := f.EstimateLLaMACppRun(opts...).SummarizeItem(true, 0, 0)
+		bs := []GGUFRunDeviceBudget{{Memory: emi.RAM.NonUMA}}
+		for _, v := range emi.VRAMs {
+			bs = append(bs, GGUFRunDeviceBudget{Memory: v.NonUMA})
+		}
+		return bs
+	}
+
+	t.Run("context size", func(t *testing.T) {
+		r, err := f.FitLLaMACppRun(
+			budgetsOf(WithLLaMACppContextSize(1024)),
+			WithLLaMACppFitContextSizeRange(256, 4096))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1024), r.ContextSize)
+		assert.True(t, r.FullOffloaded)
+		assert.Equal(t, uint64(3), r.OffloadLayers)
+		assert.Equal(t, GGMLTypeF16, r.CacheKeyType)
+		assert.Equal(t, int32(1), r.ParallelSize)
+		assert.Equal(t, f.EstimateLLaMACppRun(r.Options...).Summarize(true, 0, 0), r.Summary)
+	})
+
+	t.Run("partial offload", func(t *testing.T) {
+		r, err := f.FitLLaMACppRun(
+			budgetsOf(WithLLaMACppContextSize(256), WithLLaMACppOffloadLayers(1)),
+			WithLLaMACppFitContextSizeRange(256, 4096),
+			WithLLaMACppFitTarget(LLaMACppRunFitTargetThroughput))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(256), r.ContextSize)
+		assert.False(t, r.FullOffloaded)
+		assert.Equal(t, uint64(1), r.OffloadLayers)
+	})
+
+	t.Run("cache types", func(t *testing.T) {
+		r, err := f.FitLLaMACppRun(
+			budgetsOf(WithLLaMACppContextSize(2048), WithFlashAttention(),
+				WithLLaMACppCacheKeyType(GGMLTypeQ8_0), WithLLaMACppCacheValueType(GGMLTypeQ8_0)),
+			WithLLaMACppFitEstimateOptions(WithFlashAttention()),
+			WithLLaMACppFitContextSizeRange(256, 4096),
+			WithLLaMACppFitCacheTypes(GGMLTypeF16, GGMLTypeQ8_0))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2048), r.ContextSize)
+		assert.Equal(t, GGMLTypeQ8_0, r.CacheKeyType)
+		assert.Equal(t, GGMLTypeQ8_0, r.CacheValueType)
+	})
+
+	t.Run("throughput with device metrics", func(t *testing.T) {
+		bs := budgetsOf(WithLLaMACppContextSize(2048), WithFlashAttention())
+		opts := []LLaMACppRunFitOption{
+			WithLLaMACppFitContextSizeRange(2048, 2048),
+			WithLLaMACppFitTarget(LLaMACppRunFitTargetThroughput),
+			WithLLaMACppFitCacheTypes(GGMLTypeF16, GGMLTypeQ8_0),
+		}
+
+		// Both cache types are fully offloaded, the first one is preferred.
+		r, err := f.FitLLaMACppRun(bs, append(opts, WithLLaMACppFitEstimateOptions(WithFlashAttention()))...)
+		require.NoError(t, err)
+		assert.True(t, r.FullOffloaded)
+		assert.Equal(t, GGMLTypeF16, r.CacheKeyType)
+
+		// The smaller cache is read faster.
+		dms := []GGUFRunDeviceMetric{
+			{FLOPS: 1e12, UpBandwidth: 1e9, DownBandwidth: 1e9},
+			{FLOPS: 1e12, UpBandwidth: 1e9, DownBandwidth: 1e9},
+		}
+		r, err = f.FitLLaMACppRun(bs, append(opts, WithLLaMACppFitEstimateOptions(WithFlashAttention(), WithDeviceMetrics(dms)))...)
+		require.NoError(t, err)
+		assert.True(t, r.FullOffloaded)
+		assert.Equal(t, GGMLTypeQ8_0, r.CacheKeyType)
+		require.NotNil(t, r.Summary.Items[0].MaximumTokensPerSecond)
+	})
+
+	t.Run("parallel size", func(t *testing.T) {
+		r, err := f.FitLLaMACppRun(
+			budgetsOf(WithLLaMACppContextSize(1024), WithParallelSize(4)),
+			WithLLaMACppFitContextSizeRange(256, 4096),
+			WithLLaMACppFitTarget(LLaMACppRunFitTargetThroughput),
+			WithLLaMACppFitMaxParallelSize(8))
+		require.NoError(t, err)
+		assert.Equal(t, int32(4), r.ParallelSize)
+		assert.Equal(t, uint64(1024), r.ContextSize)
+		assert.True(t, r.FullOffloaded)
+	})
+
+	t.Run("multiple devices", func(t *testing.T) {
+		bs := budgetsOf(WithLLaMACppContextSize(512), WithTensorSplitFraction([]float64{0.5, 1}))
+		r, err := f.FitLLaMACppRun(bs, WithLLaMACppFitContextSizeRange(256, 4096))
+		require.NoError(t, err)
+		assert.Len(t, r.Summary.Items[0].VRAMs, 2)
+		assert.GreaterOrEqual(t, r.ContextSize, uint64(512))
+	})
+
+	t.Run("model context limit", func(t *testing.T) {
+		// The default minimum context size is larger than the maximum context length of the model.
+		r, err := f.FitLLaMACppRun([]GGUFRunDeviceBudget{{Memory: 64 << 30}, {Memory: 24 << 30}})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(256), r.ContextSize)
+		assert.True(t, r.FullOffloaded)
+	})
+
+	t.Run("ram only", func(t *testing.T) {
+		bs := budgetsOf(WithLLaMACppContextSize(512), WithLLaMACppOffloadLayers(0))
+		r, err := f.FitLLaMACppRun(bs[:1], WithLLaMACppFitContextSizeRange(256, 4096))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(512), r.ContextSize)
+		assert.Equal(t, uint64(0), r.OffloadLayers)
+	})
+
+	t.Run("no fit", func(t *testing.T) {
+		bs := budgetsOf(WithLLaMACppContextSize(256))
+		bs[0].Memory /= 2
+		bs[1].Memory = 0
+		_, err := f.FitLLaMACppRun(bs, WithLLaMACppFitContextSizeRange(256, 4096))
+		assert.Error(t, err)
+
+		_, err = f.FitLLaMACppRun(bs[:1])
+		assert.Error(t, err)
+
+		_, err = f.FitLLaMACppRun(nil)
+		assert.Error(t, err)
+	})
+}
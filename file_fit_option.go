@@ -0,0 +1,101 @@
+package gguf_parser
+
+import (
+	"slices"
+)
+
+type (
+	_LLaMACppRunFitOptions struct {
+		EstimateOptions []GGUFRunEstimateOption
+		Target          LLaMACppRunFitTarget
+		NoMMap          bool
+		MinContextSize  int32
+		MaxContextSize  int32
+		CacheTypes      []GGMLType
+		MaxParallelSize int32
+	}
+
+	// LLaMACppRunFitOption is the options for fitting the GGUF file into the device budgets.
+	LLaMACppRunFitOption func(*_LLaMACppRunFitOptions)
+)
+
+// LLaMACppRunFitTarget is the target to maximize when fitting.
+type LLaMACppRunFitTarget uint
+
+const (
+	// LLaMACppRunFitTargetContextSize maximizes the context size,
+	// then the offload layers.
+	LLaMACppRunFitTargetContextSize LLaMACppRunFitTarget = iota
+	// LLaMACppRunFitTargetThroughput maximizes the estimated maximum tokens per second
+	// if the device metrics are given by WithDeviceMetrics, otherwise the offload layers,
+	// then the parallel size and the context size.
+	LLaMACppRunFitTargetThroughput
+	_LLaMACppRunFitTargetMax
+)
+
+// WithLLaMACppFitEstimateOptions sets the estimate options for fitting,
+// the context size, offload layers, cache types and parallel size are overridden by the searching.
+func WithLLaMACppFitEstimateOptions(opts ...GGUFRunEstimateOption) LLaMACppRunFitOption {
+	return func(o *_LLaMACppRunFitOptions) {
+		o.EstimateOptions = append(o.EstimateOptions, opts...)
+	}
+}
+
+// WithLLaMACppFitTarget sets the target to maximize when fitting,
+// default is LLaMACppRunFitTargetContextSize.
+func WithLLaMACppFitTarget(target LLaMACppRunFitTarget) LLaMACppRunFitOption {
+	return func(o *_LLaMACppRunFitOptions) {
+		if target < _LLaMACppRunFitTargetMax {
+			o.Target = target
+		}
+	}
+}
+
+// WithoutLLaMACppFitMMap disables the mmap when summarizing the memory usage.
+func WithoutLLaMACppFitMMap() LLaMACppRunFitOption {
+	return func(o *_LLaMACppRunFitOptions) {
+		o.NoMMap = true
+	}
+}
+
+// WithLLaMACppFitContextSizeRange limits the context size to search,
+// the minimum defaults to 4096 and the maximum defaults to the maximum context length of the model.
+//
+// With LLaMACppRunFitTargetThroughput,
+// the minimum is the context size that each parallel sequence requires.
+func WithLLaMACppFitContextSizeRange(minSize, maxSize int32) LLaMACppRunFitOption {
+	return func(o *_LLaMACppRunFitOptions) {
+		if minSize > 0 {
+			o.MinContextSize = minSize
+		}
+		if maxSize > 0 {
+			o.MaxContextSize = maxSize
+		}
+	}
+}
+
+// WithLLaMACppFitCacheTypes sets the candidate types of the KV cache in the order of preference,
+// default is F16 only.
+//
+// The quantized value cache requires the flash attention,
+// see WithFlashAttention.
+func WithLLaMACppFitCacheTypes(types ...GGMLType) LLaMACppRunFitOption {
+	return func(o *_LLaMACppRunFitOptions) {
+		if len(types) == 0 {
+			return
+		}
+		o.CacheTypes = slices.Clone(types)
+	}
+}
+
+// WithLLaMACppFitMaxParallelSize sets the maximum parallel size to search,
+// only works with LLaMACppRunFitTargetThroughput.
+//
+// The parallel size is searched in the powers of 2, default is 1.
+func WithLLaMACppFitMaxParallelSize(size int32) LLaMACppRunFitOption {
+	return func(o *_LLaMACppRunFitOptions) {
+		if size > 0 {
+			o.MaxParallelSize = size
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// _TestGGUFFixture describes a synthetic GGUF file for the offline tests,
+// which is encoded by the fixture itself rather than GGUFWriter,
+// so that the legacy versions and the byte orders can be covered.
+type _TestGGUFFixture struct {
+	// Version is the version of the GGUF file format.
+	Version GGUFVersion
+	// BigEndian is true if the file is encoded in big-endian,
+	// which is introduced since GGUF v3.
+	BigEndian bool
+	// MetadataKV are the key-value pairs in the metadata,
+	// the value type and the value must be matched,
+	// e.g. GGUFMetadataValueTypeUint8 with uint8, GGUFMetadataValueTypeArray with GGUFMetadataKVArrayValue.
+	MetadataKV GGUFMetadataKVs
+	// TensorInfos are the tensor infos,
+	// the offsets are computed by the fixture.
+	TensorInfos GGUFTensorInfos
+}
+
+// Alignment returns the alignment of the tensor data.
+func (fx _TestGGUFFixture) Alignment() uint64 {
+	if kv, ok := fx.MetadataKV.Get("general.alignment"); ok {
+		return uint64(kv.ValueUint32())
+	}
+	return 32
+}
+
+// Bytes encodes the fixture into the bytes of a GGUF file,
+// the data of each tensor is filled by its index.
+func (fx _TestGGUFFixture) Bytes(t *testing.T) []byte {
+	t.Helper()
+
+	var bo binary.ByteOrder = binary.LittleEndian
+	if fx.BigEndian {
+		bo = binary.BigEndian
+	}
+
+	var buf bytes.Buffer
+	w := func(v any) {
+		require.NoError(t, binary.Write(&buf, bo, v))
+	}
+	wl := func(l uint64) {
+		if fx.Version <= GGUFVersionV1 {
+			w(uint32(l))
+			return
+		}
+		w(l)
+	}
+	ws := func(s string) {
+		wl(uint64(len(s)))
+		buf.WriteString(s)
+	}
+	var wv func(vt GGUFMetadataValueType, v any)
+	wv = func(vt GGUFMetadataValueType, v any) {
+		switch vt {
+		case GGUFMetadataValueTypeString:
+			ws(v.(string))
+		case GGUFMetadataValueTypeBool:
+			w(v.(bool))
+		case GGUFMetadataValueTypeArray:
+			av := v.(GGUFMetadataKVArrayValue)
+			w(av.Type)
+			wl(uint64(len(av.Array)))
+			for i := range av.Array {
+				wv(av.Type, av.Array[i])
+			}
+		default:
+			w(v)
+		}
+	}
+
+	// Header,
+	// the magic written in big-endian is read as GGUFMagicGGUFBe.
+	w(GGUFMagicGGUFLe)
+	w(fx.Version)
+	wl(uint64(len(fx.TensorInfos)))
+	wl(uint64(len(fx.MetadataKV)))
+	for _, kv := range fx.MetadataKV {
+		ws(kv.Key)
+		w(kv.ValueType)
+		wv(kv.ValueType, kv.Value)
+	}
+
+	// Tensor infos.
+	ag := fx.Alignment()
+	var offset uint64
+	for _, ti := range fx.TensorInfos {
+		ws(ti.Name)
+		w(uint32(len(ti.Dimensions)))
+		for _, d := range ti.Dimensions {
+			wl(d)
+		}
+		w(ti.Type)
+		w(offset)
+		offset = GGMLPadding(offset+ti.Bytes(), ag)
+	}
+	buf.Write(make([]byte, GGMLPadding(uint64(buf.Len()), ag)-uint64(buf.Len())))
+
+	// Tensor data.
+	for i, ti := range fx.TensorInfos {
+		buf.Write(bytes.Repeat([]byte{byte(i)}, int(ti.Bytes())))
+		buf.Write(make([]byte, GGMLPadding(ti.Bytes(), ag)-ti.Bytes()))
+	}
+
+	return buf.Bytes()
+}
+
+// WithAlignment returns a copy of the fixture with the given general.alignment.
+func (fx _TestGGUFFixture) WithAlignment(ag uint32) _TestGGUFFixture {
+	fx.MetadataKV = append(slices.Clone(fx.MetadataKV),
+		GGUFMetadataKV{Key: "general.alignment", ValueType: GGUFMetadataValueTypeUint32, Value: ag})
+	return fx
+}
+
+// WriteFiles writes the fixture into the given directory with the given name,
+// and returns the paths of the written files.
+//
+// If the given split count is greater than 1,
+// the tensors are split into the shards named as llama.cpp does,
+// e.g. "name-00001-of-00002.gguf",
+// all shards start with the split metadata, and the first shard holds all the metadata following them.
+func (fx _TestGGUFFixture) WriteFiles(t *testing.T, dir, name string, split int) []string {
+	t.Helper()
+
+	if split <= 1 {
+		p := filepath.Join(dir, name+".gguf")
+		require.NoError(t, os.WriteFile(p, fx.Bytes(t), 0o600))
+		return []string{p}
+	}
+
+	ps := make([]string, split)
+	for i := 0; i < split; i++ {
+		sfx := fx
+		sfx.MetadataKV = GGUFMetadataKVs{
+			{Key: "split.no", ValueType: GGUFMetadataValueTypeUint16, Value: uint16(i)},
+			{Key: "split.count", ValueType: GGUFMetadataValueTypeUint16, Value: uint16(split)},
+			{Key: "split.tensors.count", ValueType: GGUFMetadataValueTypeInt32, Value: int32(len(fx.TensorInfos))},
+		}
+		if i == 0 {
+			sfx.MetadataKV = append(sfx.MetadataKV, fx.MetadataKV...)
+		}
+		n := (len(fx.TensorInfos) + split - 1) / split
+		sfx.TensorInfos = fx.TensorInfos[min(i*n, len(fx.TensorInfos)):min((i+1)*n, len(fx.TensorInfos))]
+
+		ps[i] = filepath.Join(dir, fmt.Sprintf("%s-%05d-of-%05d.gguf", name, i+1, split))
+		require.NoError(t, os.WriteFile(ps[i], sfx.Bytes(t), 0o600))
+	}
+	return ps
+}
+
+// newTestLLaMAFixture returns a tiny LLaMA fixture of the given version and byte order,
+// which has 2 blocks, 64 embedding length, 4 heads with 2 KV heads,
+// a GPT2 tokenizer with 32 tokens,
+// and the "test.*" metadata covering all value types.
+func newTestLLaMAFixture(version GGUFVersion, bigEndian bool) _TestGGUFFixture {
+	const (
+		nEmbd  = 64
+		nFF    = 128
+		nHead  = 4
+		nKV    = 2
+		nLayer = 2
+		nVocab = 32
+	)
+
+	tokens := make([]any, nVocab)
+	tokenTypes := make([]any, nVocab)
+	for i := range tokens {
+		tokens[i] = fmt.Sprintf("t%d", i)
+		tokenTypes[i] = int32(1)
+	}
+	merges := []any{"t1 t2", "t3 t4", "t5 t6"}
+
+	kvs := GGUFMetadataKVs{
+		{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+		{Key: "general.name", ValueType: GGUFMetadataValueTypeString, Value: "fixture"},
+		{Key: "general.file_type", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(GGUFFileTypeMostlyF16)},
+		{Key: "llama.context_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(256)},
+		{Key: "llama.embedding_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(nEmbd)},
+		{Key: "llama.block_count", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(nLayer)},
+		{Key: "llama.feed_forward_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(nFF)},
+		{Key: "llama.attention.head_count", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(nHead)},
+		{Key: "llama.attention.head_count_kv", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(nKV)},
+		{Key: "llama.attention.layer_norm_rms_epsilon", ValueType: GGUFMetadataValueTypeFloat32, Value: float32(1e-5)},
+		{Key: "llama.rope.dimension_count", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(nEmbd / nHead)},
+		{Key: "tokenizer.ggml.model", ValueType: GGUFMetadataValueTypeString, Value: "gpt2"},
+		{Key: "tokenizer.ggml.tokens", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+			Type: GGUFMetadataValueTypeString, Len: nVocab, Array: tokens,
+		}},
+		{Key: "tokenizer.ggml.token_type", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+			Type: GGUFMetadataValueTypeInt32, Len: nVocab, Array: tokenTypes,
+		}},
+		{Key: "tokenizer.ggml.merges", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+			Type: GGUFMetadataValueTypeString, Len: uint64(len(merges)), Array: merges,
+		}},
+		{Key: "tokenizer.ggml.bos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1)},
+		{Key: "tokenizer.ggml.eos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(2)},
+
+		{Key: "test.uint8", ValueType: GGUFMetadataValueTypeUint8, Value: uint8(0xfe)},
+		{Key: "test.int8", ValueType: GGUFMetadataValueTypeInt8, Value: int8(-2)},
+		{Key: "test.uint16", ValueType: GGUFMetadataValueTypeUint16, Value: uint16(0xfedc)},
+		{Key: "test.int16", ValueType: GGUFMetadataValueTypeInt16, Value: int16(-292)},
+		{Key: "test.uint32", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(0xfedcba98)},
+		{Key: "test.int32", ValueType: GGUFMetadataValueTypeInt32, Value: int32(-19088744)},
+		{Key: "test.float32", ValueType: GGUFMetadataValueTypeFloat32, Value: float32(3.5)},
+		{Key: "test.bool", ValueType: GGUFMetadataValueTypeBool, Value: true},
+		{Key: "test.string", ValueType: GGUFMetadataValueTypeString, Value: "fixture ✓"},
+		{Key: "test.array.empty", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+			Type: GGUFMetadataValueTypeUint8, Len: 0, Array: []any{},
+		}},
+		{Key: "test.array.nested", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+			Type: GGUFMetadataValueTypeArray, Len: 2, Array: []any{
+				GGUFMetadataKVArrayValue{Type: GGUFMetadataValueTypeInt16, Len: 2, Array: []any{int16(-1), int16(1)}},
+				GGUFMetadataKVArrayValue{Type: GGUFMetadataValueTypeArray, Len: 1, Array: []any{
+					GGUFMetadataKVArrayValue{Type: GGUFMetadataValueTypeString, Len: 2, Array: []any{"a", "b"}},
+				}},
+			},
+		}},
+	}
+	if version >= GGUFVersionV2 {
+		// 64-bit types are introduced since GGUF v2.
+		kvs = append(kvs,
+			GGUFMetadataKV{Key: "test.uint64", ValueType: GGUFMetadataValueTypeUint64, Value: uint64(0xfedcba9876543210)},
+			GGUFMetadataKV{Key: "test.int64", ValueType: GGUFMetadataValueTypeInt64, Value: int64(-81985529216486896)},
+			GGUFMetadataKV{Key: "test.float64", ValueType: GGUFMetadataValueTypeFloat64, Value: float64(-0.125)},
+		)
+	}
+
+	tis := GGUFTensorInfos{
+		{Name: "token_embd.weight", Dimensions: []uint64{nEmbd, nVocab}, Type: GGMLTypeF16},
+	}
+	for i := 0; i < nLayer; i++ {
+		tis = append(tis,
+			GGUFTensorInfo{Name: fmt.Sprintf("blk.%d.attn_norm.weight", i), Dimensions: []uint64{nEmbd}, Type: GGMLTypeF32},
+			GGUFTensorInfo{Name: fmt.Sprintf("blk.%d.attn_q.weight", i), Dimensions: []uint64{nEmbd, nEmbd}, Type: GGMLTypeF16},
+			GGUFTensorInfo{Name: fmt.Sprintf("blk.%d.attn_k.weight", i), Dimensions: []uint64{nEmbd, nEmbd / nHead * nKV}, Type: GGMLTypeF16},
+			GGUFTensorInfo{Name: fmt.Sprintf("blk.%d.attn_v.weight", i), Dimensions: []uint64{nEmbd, nEmbd / nHead * nKV}, Type: GGMLTypeF16},
+			GGUFTensorInfo{Name: fmt.Sprintf("blk.%d.attn_output.weight", i), Dimensions: []uint64{nEmbd, nEmbd}, Type: GGMLTypeF16},
+			GGUFTensorInfo{Name: fmt.Sprintf("blk.%d.ffn_norm.weight", i), Dimensions: []uint64{nEmbd}, Type: GGMLTypeF32},
+			GGUFTensorInfo{Name: fmt.Sprintf("blk.%d.ffn_gate.weight", i), Dimensions: []uint64{nEmbd, nFF}, Type: GGMLTypeF16},
+			GGUFTensorInfo{Name: fmt.Sprintf("blk.%d.ffn_up.weight", i), Dimensions: []uint64{nEmbd, nFF}, Type: GGMLTypeF16},
+			GGUFTensorInfo{Name: fmt.Sprintf("blk.%d.ffn_down.weight", i), Dimensions: []uint64{nFF, nEmbd}, Type: GGMLTypeQ8_0},
+		)
+	}
+	tis = append(tis,
+		GGUFTensorInfo{Name: "output_norm.weight", Dimensions: []uint64{nEmbd}, Type: GGMLTypeF32},
+		GGUFTensorInfo{Name: "output.weight", Dimensions: []uint64{nEmbd, nVocab}, Type: GGMLTypeQ8_0},
+	)
+	for i := range tis {
+		tis[i].NDimensions = uint32(len(tis[i].Dimensions))
+	}
+
+	return _TestGGUFFixture{
+		Version:     version,
+		BigEndian:   bigEndian,
+		MetadataKV:  kvs,
+		TensorInfos: tis,
+	}
+}
+
+// newTestStableDiffusionFixture returns a tiny Stable Diffusion 1.x fixture,
+// which has a diffusion model, an OpenAI CLIP ViT-L/14 conditioner and a VAE.
+func newTestStableDiffusionFixture() _TestGGUFFixture {
+	tis := GGUFTensorInfos{
+		{Name: "model.diffusion_model.input_blocks.0.0.weight", Dimensions: []uint64{3, 3, 4, 32}, Type: GGMLTypeF16},
+		{Name: "model.diffusion_model.output_blocks.11.1.transformer_blocks.0.attn2.to_v.weight", Dimensions: []uint64{64, 32}, Type: GGMLTypeF16},
+		{Name: "cond_stage_model.transformer.text_model.encoder.layers.11.self_attn.k_proj.weight", Dimensions: []uint64{64, 64}, Type: GGMLTypeF16},
+		{Name: "first_stage_model.decoder.conv_in.weight", Dimensions: []uint64{3, 3, 4, 32}, Type: GGMLTypeF32},
+	}
+	for i := range tis {
+		tis[i].NDimensions = uint32(len(tis[i].Dimensions))
+	}
+
+	return _TestGGUFFixture{
+		Version: GGUFVersionV3,
+		MetadataKV: GGUFMetadataKVs{
+			{Key: "general.file_type", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(GGUFFileTypeMostlyF16)},
+		},
+		TensorInfos: tis,
+	}
+}
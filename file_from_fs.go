@@ -0,0 +1,143 @@
+package gguf_parser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/gpustack/gguf-parser-go/util/osx"
+)
+
+// ParseGGUFFileFromReaderAt parses a GGUF file from the given io.ReaderAt with the given size,
+// and returns the GGUFFile, or an error if any.
+//
+// The given io.ReaderAt is not closed after parsing.
+func ParseGGUFFileFromReaderAt(r io.ReaderAt, size int64, opts ...GGUFReadOption) (*GGUFFile, error) {
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	files := []_GGUFFileReadSeeker{
+		{
+			ReadSeeker: io.NewSectionReader(r, 0, size),
+			Size:       size,
+		},
+	}
+	return parseGGUFFile(files, o)
+}
+
+// ParseGGUFFileFromFS parses a GGUF file from the given fs.FS with the given name,
+// and returns the GGUFFile, or an error if any.
+//
+// If the given name is a shard GGUF filename,
+// the other shards are completed by CompleteShardGGUFFilename and opened from the same fs.FS.
+//
+// The file is read sequentially if it does not implement io.Seeker or io.ReaderAt.
+func ParseGGUFFileFromFS(fsys fs.FS, name string, opts ...GGUFReadOption) (*GGUFFile, error) {
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	files, err := openGGUFFileFromFS(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for i := range files {
+			osx.Close(files[i])
+		}
+	}()
+
+	return parseGGUFFile(files, o)
+}
+
+// openGGUFFileFromFS opens the GGUF file and its shards from the given fs.FS,
+// and returns the list of _GGUFFileReadSeeker, or an error if any.
+func openGGUFFileFromFS(fsys fs.FS, name string) (_ []_GGUFFileReadSeeker, err error) {
+	names := CompleteShardGGUFFilename(name)
+	if names == nil {
+		names = []string{name}
+	}
+
+	files := make([]_GGUFFileReadSeeker, 0, len(names))
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := range files {
+			osx.Close(files[i])
+		}
+	}()
+
+	for i := range names {
+		f, err := fsys.Open(names[i])
+		if err != nil {
+			return nil, fmt.Errorf("open file: %w", err)
+		}
+
+		fi, err := f.Stat()
+		if err != nil {
+			osx.Close(f)
+			return nil, fmt.Errorf("stat file: %w", err)
+		}
+		if fi.IsDir() {
+			osx.Close(f)
+			return nil, fmt.Errorf("open file: %s is a directory", names[i])
+		}
+
+		var rs io.ReadSeeker
+		switch v := f.(type) {
+		case io.ReadSeeker:
+			rs = v
+		case io.ReaderAt:
+			rs = io.NewSectionReader(v, 0, fi.Size())
+		default:
+			rs = &_SequentialReadSeeker{r: bufio.NewReader(f)}
+		}
+
+		files = append(files, _GGUFFileReadSeeker{
+			Closer:     f,
+			ReadSeeker: rs,
+			Size:       fi.Size(),
+		})
+	}
+
+	return files, nil
+}
+
+// _SequentialReadSeeker wraps an io.Reader as an io.ReadSeeker,
+// which only supports seeking forward from the current position.
+type _SequentialReadSeeker struct {
+	r   io.Reader
+	pos int64
+}
+
+func (s *_SequentialReadSeeker) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+func (s *_SequentialReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		offset -= s.pos
+	case io.SeekCurrent:
+	default:
+		return s.pos, errors.New("seek from end is not supported")
+	}
+	if offset < 0 {
+		return s.pos, errors.New("seek backward is not supported")
+	}
+
+	n, err := io.CopyN(io.Discard, s.r, offset)
+	s.pos += n
+	if err != nil && !errors.Is(err, io.EOF) {
+		return s.pos, err
+	}
+	return s.pos, nil
+}
@@ -0,0 +1,100 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGGUFFileFromReaderAt(t *testing.T) {
+	b := newTestGGUFFileBytes(t, "blk.0.attn_q.weight")
+
+	gf, err := ParseGGUFFileFromReaderAt(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+	assert.Equal(t, GGUFBytesScalar(len(b)), gf.Size)
+	assert.Len(t, gf.TensorInfos, 1)
+
+	_, err = ParseGGUFFileFromReaderAt(bytes.NewReader(b[:16]), 16)
+	assert.Error(t, err)
+}
+
+func TestParseGGUFFileFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"model.gguf":                          {Data: newTestGGUFFileBytes(t, "output.weight")},
+		"shards/model-00001-of-00002.gguf":    {Data: newTestGGUFFileBytes(t, "blk.0.attn_q.weight")},
+		"shards/model-00002-of-00002.gguf":    {Data: newTestGGUFFileBytes(t, "blk.1.attn_q.weight")},
+		"missing/model-00001-of-00002.gguf":   {Data: newTestGGUFFileBytes(t, "blk.0.attn_q.weight")},
+		"directory/model-00001-of-00001.gguf": {Mode: fs.ModeDir},
+	}
+
+	t.Run("single", func(t *testing.T) {
+		gf, err := ParseGGUFFileFromFS(fsys, "model.gguf")
+		require.NoError(t, err)
+		assert.Equal(t, "output.weight", gf.TensorInfos[0].Name)
+	})
+
+	t.Run("shards", func(t *testing.T) {
+		for _, name := range []string{"shards/model-00001-of-00002.gguf", "shards/model-00002-of-00002.gguf"} {
+			gf, err := ParseGGUFFileFromFS(fsys, name)
+			require.NoError(t, err)
+			assert.Len(t, gf.SplitSizes, 2)
+			if assert.Len(t, gf.TensorInfos, 2) {
+				assert.Equal(t, "blk.0.attn_q.weight", gf.TensorInfos[0].Name)
+				assert.Equal(t, "blk.1.attn_q.weight", gf.TensorInfos[1].Name)
+			}
+		}
+	})
+
+	t.Run("sequential", func(t *testing.T) {
+		gf, err := ParseGGUFFileFromFS(_SequentialFS{fsys}, "model.gguf", SkipLargeMetadata())
+		require.NoError(t, err)
+		assert.Equal(t, "output.weight", gf.TensorInfos[0].Name)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := ParseGGUFFileFromFS(fsys, "missing/model-00001-of-00002.gguf")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		_, err = ParseGGUFFileFromFS(fsys, "directory/model-00001-of-00001.gguf")
+		assert.Error(t, err)
+	})
+}
+
+// newTestGGUFFileBytes returns the bytes of a GGUF file with the given tensor.
+func newTestGGUFFileBytes(t *testing.T, tensor string) []byte {
+	gf := &GGUFFile{
+		Header: GGUFHeader{
+			Magic:   GGUFMagicGGUFLe,
+			Version: GGUFVersionV3,
+			MetadataKV: GGUFMetadataKVs{
+				{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+				{Key: "tokenizer.ggml.tokens", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+					Type: GGUFMetadataValueTypeString, Len: 2, Array: []any{"a", "b"},
+				}},
+			},
+		},
+		TensorInfos: GGUFTensorInfos{
+			{Name: tensor, NDimensions: 2, Dimensions: []uint64{32, 2}, Type: GGMLTypeF16},
+		},
+	}
+	var buf bytes.Buffer
+	_, err := NewGGUFWriter(&buf).Write(gf)
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+// _SequentialFS hides the io.Seeker and io.ReaderAt of the opened files.
+type _SequentialFS struct {
+	fs.FS
+}
+
+func (s _SequentialFS) Open(name string) (fs.File, error) {
+	f, err := s.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ fs.File }{f}, nil
+}
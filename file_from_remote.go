@@ -59,7 +59,13 @@ func ParseGGUFFileRemote(ctx context.Context, url string, opts ...GGUFReadOption
 		}()
 	}
 
-	cli := httpx.Client(
+	cli := newGGUFFileRemoteClient(url, o)
+	return parseGGUFFileFromRemote(ctx, cli, url, o)
+}
+
+// newGGUFFileRemoteClient returns a http.Client to read the remote GGUF file with the given options.
+func newGGUFFileRemoteClient(url string, o _GGUFReadOptions) *http.Client {
+	return httpx.Client(
 		httpx.ClientOptions().
 			WithUserAgent("gguf-parser-go").
 			If(o.Debug,
@@ -101,11 +107,25 @@ func ParseGGUFFileRemote(ctx context.Context, url string, opts ...GGUFReadOption
 					),
 			),
 	)
-
-	return parseGGUFFileFromRemote(ctx, cli, url, o)
 }
 
 func parseGGUFFileFromRemote(ctx context.Context, cli *http.Client, url string, o _GGUFReadOptions) (*GGUFFile, error) {
+	fs, err := openGGUFFileRemote(ctx, cli, url, o)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for i := range fs {
+			osx.Close(fs[i])
+		}
+	}()
+
+	return parseGGUFFile(fs, o)
+}
+
+// openGGUFFileRemote opens the remote GGUF file and its shards,
+// and returns the list of _GGUFFileReadSeeker, or an error if any.
+func openGGUFFileRemote(ctx context.Context, cli *http.Client, url string, o _GGUFReadOptions) (_ []_GGUFFileReadSeeker, err error) {
 	var urls []string
 	{
 		rs := CompleteShardGGUFFilename(url)
@@ -118,28 +138,18 @@ func parseGGUFFileFromRemote(ctx context.Context, cli *http.Client, url string,
 
 	fs := make([]_GGUFFileReadSeeker, 0, len(urls))
 	defer func() {
+		if err == nil {
+			return
+		}
 		for i := range fs {
 			osx.Close(fs[i])
 		}
 	}()
 
 	for i := range urls {
-		req, err := httpx.NewGetRequestWithContext(ctx, urls[i])
+		sf, err := openRemoteSeekerFile(ctx, cli, urls[i], o)
 		if err != nil {
-			return nil, fmt.Errorf("new request: %w", err)
-		}
-
-		sf, err := httpx.OpenSeekerFile(cli, req,
-			httpx.SeekerFileOptions().
-				WithBufferSize(o.BufferSize).
-				If(o.SkipRangeDownloadDetection,
-					func(x *httpx.SeekerFileOption) *httpx.SeekerFileOption {
-						return x.WithoutRangeDownloadDetect()
-					},
-				),
-		)
-		if err != nil {
-			return nil, fmt.Errorf("open http file: %w", err)
+			return nil, err
 		}
 
 		fs = append(fs, _GGUFFileReadSeeker{
@@ -149,5 +159,27 @@ func parseGGUFFileFromRemote(ctx context.Context, cli *http.Client, url string,
 		})
 	}
 
-	return parseGGUFFile(fs, o)
+	return fs, nil
+}
+
+// openRemoteSeekerFile opens the remote file of the given url as a httpx.SeekerFile.
+func openRemoteSeekerFile(ctx context.Context, cli *http.Client, url string, o _GGUFReadOptions) (*httpx.SeekerFile, error) {
+	req, err := httpx.NewGetRequestWithContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+
+	sf, err := httpx.OpenSeekerFile(cli, req,
+		httpx.SeekerFileOptions().
+			WithBufferSize(o.BufferSize).
+			If(o.SkipRangeDownloadDetection,
+				func(x *httpx.SeekerFileOption) *httpx.SeekerFileOption {
+					return x.WithoutRangeDownloadDetect()
+				},
+			),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("open http file: %w", err)
+	}
+	return sf, nil
 }
@@ -0,0 +1,206 @@
+package gguf_parser
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/gpustack/gguf-parser-go/util/funcx"
+	"github.com/gpustack/gguf-parser-go/util/osx"
+)
+
+// ParseGGUFFileFromTar parses a GGUF file with the given name inside the local tar archive of the given path,
+// and returns the GGUFFile, or an error if any.
+//
+// If the given name is empty, the first entry with ".gguf" suffix is parsed.
+// If the given name is a shard GGUF filename,
+// the other shards are completed by CompleteShardGGUFFilename and located inside the same archive.
+//
+// The archive can be an uncompressed tar, e.g. an OCI image layer,
+// whose entry is read through a section reader without extracting,
+// or a gzip compressed tar, whose entry is read sequentially,
+// as gzip cannot be seeked without an index.
+func ParseGGUFFileFromTar(path, name string, opts ...GGUFReadOption) (*GGUFFile, error) {
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	f, err := osx.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer osx.Close(f)
+
+	return parseGGUFFileFromTar(f, funcx.MustNoError(f.Stat()).Size(), name, o)
+}
+
+// ParseGGUFFileFromTarRemote parses a GGUF file with the given name inside the remote tar archive of the given url,
+// and returns the GGUFFile, or an error if any.
+//
+// The archive is read by HTTP range requests,
+// see ParseGGUFFileFromTar for the details.
+func ParseGGUFFileFromTarRemote(ctx context.Context, url, name string, opts ...GGUFReadOption) (*GGUFFile, error) {
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	sf, err := openRemoteSeekerFile(ctx, newGGUFFileRemoteClient(url, o), url, o)
+	if err != nil {
+		return nil, err
+	}
+	defer osx.Close(sf)
+
+	return parseGGUFFileFromTar(sf, sf.Len(), name, o)
+}
+
+func parseGGUFFileFromTar(r io.ReaderAt, size int64, name string, o _GGUFReadOptions) (*GGUFFile, error) {
+	var magic [2]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return nil, fmt.Errorf("read archive magic: %w", err)
+	}
+
+	// Compressed.
+	if magic == [2]byte{0x1f, 0x8b} {
+		gr, err := gzip.NewReader(bufio.NewReader(io.NewSectionReader(r, 0, size)))
+		if err != nil {
+			return nil, fmt.Errorf("open gzip: %w", err)
+		}
+		defer osx.Close(gr)
+
+		tr := tar.NewReader(gr)
+		hdr, err := nextTarGGUFEntry(tr, name)
+		if err != nil {
+			return nil, err
+		}
+		if CompleteShardGGUFFilename(hdr.Name) != nil {
+			return nil, errors.New("shard GGUF files inside a compressed archive are not supported")
+		}
+
+		fs := []_GGUFFileReadSeeker{
+			{
+				ReadSeeker: &_SequentialReadSeeker{r: tr},
+				Size:       hdr.Size,
+			},
+		}
+		return parseGGUFFile(fs, o)
+	}
+
+	// Uncompressed.
+	sr := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(sr)
+
+	var names []string
+	if name = cleanTarEntryName(name); name != "" {
+		names = CompleteShardGGUFFilename(name)
+		if names == nil {
+			names = []string{name}
+		}
+	}
+	offsets := make(map[string][2]int64)
+	for names == nil || !hasAllKeys(offsets, names) {
+		hdr, err := tr.Next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("read archive entry: %w", err)
+			}
+			break
+		}
+		if !isTarRegularEntry(hdr) {
+			continue
+		}
+		n := cleanTarEntryName(hdr.Name)
+		pos, err := sr.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("seek archive entry: %w", err)
+		}
+		offsets[n] = [2]int64{pos, hdr.Size}
+		if names == nil && isTarGGUFEntry(hdr) {
+			names = CompleteShardGGUFFilename(n)
+			if names == nil {
+				names = []string{n}
+			}
+		}
+	}
+	if names == nil {
+		return nil, errors.New("no GGUF file found inside the archive")
+	}
+
+	fs := make([]_GGUFFileReadSeeker, 0, len(names))
+	for _, n := range names {
+		ofs, ok := offsets[n]
+		if !ok {
+			return nil, fmt.Errorf("%s not found inside the archive", n)
+		}
+		fs = append(fs, _GGUFFileReadSeeker{
+			ReadSeeker: io.NewSectionReader(r, ofs[0], ofs[1]),
+			Size:       ofs[1],
+		})
+	}
+	return parseGGUFFile(fs, o)
+}
+
+// hasAllKeys returns true if the given map contains all the given keys.
+func hasAllKeys[V any](m map[string]V, keys []string) bool {
+	for _, k := range keys {
+		if _, ok := m[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// nextTarGGUFEntry moves the given tar.Reader to the entry with the given name,
+// or the first entry with ".gguf" suffix if the given name is empty.
+func nextTarGGUFEntry(tr *tar.Reader, name string) (*tar.Header, error) {
+	name = cleanTarEntryName(name)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				if name == "" {
+					return nil, errors.New("no GGUF file found inside the archive")
+				}
+				return nil, fmt.Errorf("%s not found inside the archive", name)
+			}
+			return nil, fmt.Errorf("read archive entry: %w", err)
+		}
+		if name == "" {
+			if isTarGGUFEntry(hdr) {
+				return hdr, nil
+			}
+			continue
+		}
+		if cleanTarEntryName(hdr.Name) == name {
+			if !isTarRegularEntry(hdr) {
+				return nil, fmt.Errorf("%s is not a regular file inside the archive", name)
+			}
+			return hdr, nil
+		}
+	}
+}
+
+func isTarRegularEntry(hdr *tar.Header) bool {
+	// The tar.Reader has converted TypeRegA to TypeReg.
+	return hdr.Typeflag == tar.TypeReg
+}
+
+func isTarGGUFEntry(hdr *tar.Header) bool {
+	return isTarRegularEntry(hdr) && strings.HasSuffix(hdr.Name, ".gguf")
+}
+
+// cleanTarEntryName cleans the given name of the tar entry,
+// e.g. "./model.gguf" -> "model.gguf".
+func cleanTarEntryName(name string) string {
+	if name == "" {
+		return ""
+	}
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
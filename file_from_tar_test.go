@@ -0,0 +1,104 @@
+package gguf_parser
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGGUFFileFromTar(t *testing.T) {
+	entries := []struct {
+		name string
+		data []byte
+	}{
+		{"./README.md", []byte("# Model")},
+		{"./models/", nil},
+		{"./models/model-00002-of-00002.gguf", newTestGGUFFileBytes(t, "blk.1.attn_q.weight")},
+		{"./models/model-00001-of-00002.gguf", newTestGGUFFileBytes(t, "blk.0.attn_q.weight")},
+		{"./other.gguf", newTestGGUFFileBytes(t, "output.weight")},
+	}
+	var buf bytes.Buffer
+	{
+		tw := tar.NewWriter(&buf)
+		for _, e := range entries {
+			hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.data)), Typeflag: tar.TypeReg}
+			if e.data == nil {
+				hdr.Typeflag = tar.TypeDir
+			}
+			require.NoError(t, tw.WriteHeader(hdr))
+			_, err := tw.Write(e.data)
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+	}
+
+	dir := t.TempDir()
+	tarPath := filepath.Join(dir, "layer.tar")
+	require.NoError(t, os.WriteFile(tarPath, buf.Bytes(), 0o600))
+	tgzPath := filepath.Join(dir, "layer.tar.gz")
+	{
+		var gzBuf bytes.Buffer
+		gw := gzip.NewWriter(&gzBuf)
+		_, err := gw.Write(buf.Bytes())
+		require.NoError(t, err)
+		require.NoError(t, gw.Close())
+		require.NoError(t, os.WriteFile(tgzPath, gzBuf.Bytes(), 0o600))
+	}
+
+	assertShards := func(t *testing.T, gf *GGUFFile) {
+		assert.Len(t, gf.SplitSizes, 2)
+		if assert.Len(t, gf.TensorInfos, 2) {
+			assert.Equal(t, "blk.0.attn_q.weight", gf.TensorInfos[0].Name)
+			assert.Equal(t, "blk.1.attn_q.weight", gf.TensorInfos[1].Name)
+		}
+	}
+
+	t.Run("uncompressed", func(t *testing.T) {
+		gf, err := ParseGGUFFileFromTar(tarPath, "")
+		require.NoError(t, err)
+		assertShards(t, gf)
+
+		gf, err = ParseGGUFFileFromTar(tarPath, "models/model-00001-of-00002.gguf")
+		require.NoError(t, err)
+		assertShards(t, gf)
+
+		gf, err = ParseGGUFFileFromTar(tarPath, "other.gguf")
+		require.NoError(t, err)
+		assert.Equal(t, "output.weight", gf.TensorInfos[0].Name)
+
+		_, err = ParseGGUFFileFromTar(tarPath, "missing.gguf")
+		assert.Error(t, err)
+		_, err = ParseGGUFFileFromTar(tarPath, "README.md")
+		assert.ErrorIs(t, err, ErrGGUFFileInvalidFormat)
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		gf, err := ParseGGUFFileFromTar(tgzPath, "other.gguf")
+		require.NoError(t, err)
+		assert.Equal(t, "output.weight", gf.TensorInfos[0].Name)
+
+		_, err = ParseGGUFFileFromTar(tgzPath, "")
+		assert.Error(t, err, "shards are not supported")
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "layer.tar", time.Time{}, bytes.NewReader(buf.Bytes()))
+		}))
+		defer srv.Close()
+
+		gf, err := ParseGGUFFileFromTarRemote(context.Background(), srv.URL+"/layer.tar", "")
+		require.NoError(t, err)
+		assertShards(t, gf)
+	})
+}
@@ -0,0 +1,246 @@
+package gguf_parser
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gpustack/gguf-parser-go/util/httpx"
+	"github.com/gpustack/gguf-parser-go/util/json"
+	"github.com/gpustack/gguf-parser-go/util/osx"
+)
+
+// ErrGGUFFileHashMismatched is returned when the hash of a GGUF file
+// does not match the expected one.
+var ErrGGUFFileHashMismatched = errors.New("gguf file hash mismatched")
+
+// Types for GGUF hashes.
+type (
+	// GGUFTensorHashManifest holds the sha256 of the data of each tensor,
+	// which is used to detect the different tensors between two GGUF files.
+	GGUFTensorHashManifest struct {
+		// Tensors holds the tensor hashes in the order of GGUFFile.TensorInfos.
+		Tensors []GGUFTensorHash `json:"tensors"`
+	}
+
+	// GGUFTensorHash is the hash of the data of a tensor.
+	GGUFTensorHash struct {
+		// Name is the name of the tensor.
+		Name string `json:"name"`
+		// Type is the type of the tensor.
+		Type GGMLType `json:"type"`
+		// Size is the size of the tensor data in bytes.
+		Size uint64 `json:"size"`
+		// SHA256 is the lowercase hex-encoded sha256 of the tensor data.
+		SHA256 string `json:"sha256"`
+	}
+
+	// GGUFTensorHashDiff is a different tensor between two GGUFTensorHashManifests.
+	GGUFTensorHashDiff struct {
+		// Name is the name of the tensor.
+		Name string `json:"name"`
+		// Kind is the kind of the difference.
+		Kind GGUFDiffKind `json:"kind"`
+		// A is the hash of the tensor in the first manifest,
+		// empty if the tensor is added.
+		A string `json:"a,omitempty"`
+		// B is the hash of the tensor in the second manifest,
+		// empty if the tensor is removed.
+		B string `json:"b,omitempty"`
+	}
+)
+
+// HashGGUFFile streams the given reader,
+// and returns the lowercase hex-encoded sha256 of the whole content,
+// which is the same as the oid of the Git LFS object.
+func HashGGUFFile(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", fmt.Errorf("read file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FileHashes returns the lowercase hex-encoded sha256 of each (split) file of the GGUFFile,
+// or an error if any.
+//
+// The given sources are the (split) files of the GGUFFile in order.
+func (gf *GGUFFile) FileHashes(srcs ...io.ReaderAt) ([]string, error) {
+	sizes := gf.SplitSizes
+	if len(sizes) == 0 {
+		sizes = []GGUFBytesScalar{gf.Size}
+	}
+	if len(sizes) != len(srcs) {
+		return nil, fmt.Errorf("mismatched sources: want %d, got %d", len(sizes), len(srcs))
+	}
+
+	hs := make([]string, len(srcs))
+	for i := range srcs {
+		h, err := HashGGUFFile(io.NewSectionReader(srcs[i], 0, int64(sizes[i])))
+		if err != nil {
+			return nil, fmt.Errorf("hash split %d: %w", i, err)
+		}
+		hs[i] = h
+	}
+	return hs, nil
+}
+
+// TensorHashes returns the GGUFTensorHashManifest of the GGUFFile,
+// or an error if any.
+//
+// The given sources are the (split) files of the GGUFFile in order,
+// the tensor data is hashed as stored, i.e. without swapping the byte order,
+// and the legacy file is not supported.
+func (gf *GGUFFile) TensorHashes(srcs ...io.ReaderAt) (GGUFTensorHashManifest, error) {
+	if gf.Legacy {
+		return GGUFTensorHashManifest{}, errors.New("hashing tensors of legacy file is not supported")
+	}
+	m := GGUFTensorHashManifest{
+		Tensors: make([]GGUFTensorHash, len(gf.TensorInfos)),
+	}
+	for i, ti := range gf.TensorInfos {
+		sr, err := gf.openTensorAt(i, srcs)
+		if err != nil {
+			return GGUFTensorHashManifest{}, fmt.Errorf("open tensor %q: %w", ti.Name, err)
+		}
+		h, err := HashGGUFFile(sr)
+		if err != nil {
+			return GGUFTensorHashManifest{}, fmt.Errorf("hash tensor %q: %w", ti.Name, err)
+		}
+		m.Tensors[i] = GGUFTensorHash{
+			Name:   ti.Name,
+			Type:   ti.Type,
+			Size:   ti.Bytes(),
+			SHA256: h,
+		}
+	}
+	return m, nil
+}
+
+// Diff returns the different tensors from m to n,
+// the removed and changed tensors are in the order of m,
+// and then the added tensors in the order of n.
+func (m GGUFTensorHashManifest) Diff(n GGUFTensorHashManifest) (ds []GGUFTensorHashDiff) {
+	nhs := make(map[string]string, len(n.Tensors))
+	for i := range n.Tensors {
+		nhs[n.Tensors[i].Name] = n.Tensors[i].SHA256
+	}
+	mhs := make(map[string]struct{}, len(m.Tensors))
+	for _, t := range m.Tensors {
+		mhs[t.Name] = struct{}{}
+		h, ok := nhs[t.Name]
+		switch {
+		case !ok:
+			ds = append(ds, GGUFTensorHashDiff{Name: t.Name, Kind: GGUFDiffKindRemoved, A: t.SHA256})
+		case h != t.SHA256:
+			ds = append(ds, GGUFTensorHashDiff{Name: t.Name, Kind: GGUFDiffKindChanged, A: t.SHA256, B: h})
+		}
+	}
+	for _, t := range n.Tensors {
+		if _, ok := mhs[t.Name]; !ok {
+			ds = append(ds, GGUFTensorHashDiff{Name: t.Name, Kind: GGUFDiffKindAdded, B: t.SHA256})
+		}
+	}
+	return ds
+}
+
+// VerifyGGUFFileHash streams the given reader,
+// and returns ErrGGUFFileHashMismatched if the sha256 of the whole content is not the given one.
+func VerifyGGUFFileHash(r io.Reader, sha string) error {
+	h, err := HashGGUFFile(r)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(h, sha) {
+		return fmt.Errorf("%w: want %s, got %s", ErrGGUFFileHashMismatched, sha, h)
+	}
+	return nil
+}
+
+// VerifyGGUFFileFromHuggingFace streams the given reader,
+// and returns ErrGGUFFileHashMismatched if the sha256 of the whole content
+// is not the LFS oid of the file in the Hugging Face(https://huggingface.co/) repository.
+//
+// Only the BearerAuthToken, proxy and TLS options of the GGUFReadOption work.
+func VerifyGGUFFileFromHuggingFace(ctx context.Context, repo, file string, r io.Reader, opts ...GGUFReadOption) error {
+	oid, err := GetHuggingFaceLFSOid(ctx, repo, file, opts...)
+	if err != nil {
+		return err
+	}
+	return VerifyGGUFFileHash(r, oid)
+}
+
+// GetHuggingFaceLFSOid returns the LFS oid(sha256) of the file in the Hugging Face(https://huggingface.co/) repository,
+// which is listed by the tree API of the main revision,
+// or an error if any.
+//
+// Only the BearerAuthToken, proxy and TLS options of the GGUFReadOption work.
+func GetHuggingFaceLFSOid(ctx context.Context, repo, file string, opts ...GGUFReadOption) (string, error) {
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ep := osx.Getenv("HF_ENDPOINT", "https://huggingface.co")
+	url := fmt.Sprintf("%s/api/models/%s/tree/main", ep, repo)
+	if dir := path.Dir(file); dir != "." {
+		url += "/" + dir
+	}
+	cli := newGGUFFileRemoteClient(url, o)
+
+	// The tree API is paginated by the Link header.
+	for url != "" {
+		req, err := httpx.NewGetRequestWithContext(ctx, url)
+		if err != nil {
+			return "", fmt.Errorf("new request: %w", err)
+		}
+
+		var entries []struct {
+			Type string `json:"type"`
+			Path string `json:"path"`
+			LFS  *struct {
+				Oid string `json:"oid"`
+			} `json:"lfs"`
+		}
+		err = httpx.Do(cli, req, func(resp *http.Response) error {
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("status code %d", resp.StatusCode)
+			}
+			url = nextLinkURL(resp.Header.Get("Link"))
+			return json.NewDecoder(resp.Body).Decode(&entries)
+		})
+		if err != nil {
+			return "", fmt.Errorf("list tree of %s: %w", repo, err)
+		}
+
+		for _, e := range entries {
+			if e.Type != "file" || e.Path != file {
+				continue
+			}
+			if e.LFS == nil || e.LFS.Oid == "" {
+				return "", fmt.Errorf("file %s is not stored in LFS", file)
+			}
+			return e.LFS.Oid, nil
+		}
+	}
+
+	return "", fmt.Errorf("file %s not found in %s", file, repo)
+}
+
+var linkNextRegex = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextLinkURL returns the url of the "next" relation in the given Link header,
+// or empty if not found.
+func nextLinkURL(link string) string {
+	if m := linkNextRegex.FindStringSubmatch(link); m != nil {
+		return m[1]
+	}
+	return ""
+}
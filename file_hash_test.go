@@ -0,0 +1,144 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGGUFFile_TensorHashes(t *testing.T) {
+	fx := newTestLLaMAFixture(GGUFVersionV3, false)
+	dir := t.TempDir()
+	p := fx.WriteFiles(t, dir, "a", 1)[0]
+	b, err := os.ReadFile(p)
+	require.NoError(t, err)
+
+	gf, err := ParseGGUFFile(p)
+	require.NoError(t, err)
+	srcs, err := OpenGGUFFileSources(p)
+	require.NoError(t, err)
+	defer func() { _ = srcs.Close() }()
+
+	// File hashes.
+	fhs, err := gf.FileHashes(srcs.ReaderAts()...)
+	require.NoError(t, err)
+	sum := sha256.Sum256(b)
+	assert.Equal(t, []string{hex.EncodeToString(sum[:])}, fhs)
+	assert.NoError(t, VerifyGGUFFileHash(bytes.NewReader(b), fhs[0]))
+	assert.ErrorIs(t, VerifyGGUFFileHash(bytes.NewReader(b[1:]), fhs[0]), ErrGGUFFileHashMismatched)
+
+	// Tensor hashes.
+	m, err := gf.TensorHashes(srcs.ReaderAts()...)
+	require.NoError(t, err)
+	require.Len(t, m.Tensors, len(gf.TensorInfos))
+	for i, th := range m.Tensors {
+		ti := gf.TensorInfos[i]
+		assert.Equal(t, ti.Name, th.Name)
+		assert.Equal(t, ti.Bytes(), th.Size)
+		s := gf.TensorDataStartOffset + int64(ti.Offset)
+		sum := sha256.Sum256(b[s : s+int64(ti.Bytes())])
+		assert.Equal(t, hex.EncodeToString(sum[:]), th.SHA256, ti.Name)
+	}
+
+	// The split files hold the same tensor data.
+	sps, err := SplitGGUFFile(gf, srcs.ReaderAts(), filepath.Join(dir, "b"), WithSplitMaxTensors(8))
+	require.NoError(t, err)
+	sgf, err := ParseGGUFFile(sps[0])
+	require.NoError(t, err)
+	ssrcs, err := OpenGGUFFileSources(sps[0])
+	require.NoError(t, err)
+	defer func() { _ = ssrcs.Close() }()
+	sfhs, err := sgf.FileHashes(ssrcs.ReaderAts()...)
+	require.NoError(t, err)
+	assert.Len(t, sfhs, 3)
+	sm, err := sgf.TensorHashes(ssrcs.ReaderAts()...)
+	require.NoError(t, err)
+	assert.Empty(t, m.Diff(sm))
+
+	// Corrupt one tensor.
+	{
+		ti := gf.TensorInfos[3]
+		s := gf.TensorDataStartOffset + int64(ti.Offset)
+		cb := bytes.Clone(b)
+		cb[s+1] ^= 0xff
+		cgf, err := ParseGGUFFileFromReaderAt(bytes.NewReader(cb), int64(len(cb)))
+		require.NoError(t, err)
+		cm, err := cgf.TensorHashes(bytes.NewReader(cb))
+		require.NoError(t, err)
+		ds := m.Diff(cm)
+		if assert.Len(t, ds, 1) {
+			assert.Equal(t, ti.Name, ds[0].Name)
+			assert.Equal(t, GGUFDiffKindChanged, ds[0].Kind)
+			assert.Equal(t, m.Tensors[3].SHA256, ds[0].A)
+			assert.Equal(t, cm.Tensors[3].SHA256, ds[0].B)
+		}
+	}
+
+	// Added and removed tensors.
+	{
+		n := GGUFTensorHashManifest{Tensors: append(m.Tensors[1:], GGUFTensorHash{Name: "extra", SHA256: "00"})}
+		ds := m.Diff(n)
+		if assert.Len(t, ds, 2) {
+			assert.Equal(t, GGUFTensorHashDiff{Name: m.Tensors[0].Name, Kind: GGUFDiffKindRemoved, A: m.Tensors[0].SHA256}, ds[0])
+			assert.Equal(t, GGUFTensorHashDiff{Name: "extra", Kind: GGUFDiffKindAdded, B: "00"}, ds[1])
+		}
+	}
+
+	_, err = gf.FileHashes()
+	assert.ErrorContains(t, err, "mismatched sources")
+}
+
+func TestGetHuggingFaceLFSOid(t *testing.T) {
+	const oid = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	var auths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+		switch r.URL.Path + "?" + r.URL.RawQuery {
+		case "/api/models/org/repo/tree/main/sub?":
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s/api/models/org/repo/tree/main/sub?cursor=1>; rel="next"`, r.Host))
+			_, _ = w.Write([]byte(`[
+				{"type": "directory", "oid": "1", "size": 0, "path": "sub/dir"},
+				{"type": "file", "oid": "2", "size": 10, "path": "sub/README.md"}
+			]`))
+		case "/api/models/org/repo/tree/main/sub?cursor=1":
+			_, _ = w.Write([]byte(`[
+				{"type": "file", "oid": "3", "size": 64, "path": "sub/model.gguf",
+				 "lfs": {"oid": "` + oid + `", "size": 64, "pointerSize": 134}}
+			]`))
+		case "/api/models/org/repo/tree/main?":
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("HF_ENDPOINT", srv.URL)
+
+	ctx := context.Background()
+
+	actual, err := GetHuggingFaceLFSOid(ctx, "org/repo", "sub/model.gguf", UseBearerAuth("token"))
+	require.NoError(t, err)
+	assert.Equal(t, oid, actual)
+	assert.Equal(t, []string{"Bearer token", "Bearer token"}, auths)
+
+	_, err = GetHuggingFaceLFSOid(ctx, "org/repo", "sub/README.md")
+	assert.ErrorContains(t, err, "not stored in LFS")
+	_, err = GetHuggingFaceLFSOid(ctx, "org/repo", "model.gguf")
+	assert.ErrorContains(t, err, "not found")
+	_, err = GetHuggingFaceLFSOid(ctx, "org/missing", "model.gguf")
+	assert.ErrorContains(t, err, "status code 404")
+
+	err = VerifyGGUFFileFromHuggingFace(ctx, "org/repo", "sub/model.gguf", bytes.NewReader([]byte("gguf")))
+	assert.ErrorIs(t, err, ErrGGUFFileHashMismatched)
+}
@@ -0,0 +1,385 @@
+package gguf_parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// parseGGUFFileLegacy parses the legacy GGML, GGMF or GGJT file of the given magic,
+// which are the predecessors of GGUF file produced by llama.cpp,
+// see https://github.com/ggerganov/ggml/blob/master/docs/gguf.md#historical-state-of-affairs.
+//
+// The legacy file only describes the LLaMA model,
+// so the hyperparameters and the vocabulary are synthesized as the LLaMA metadata,
+// and the tensor names are converted to the GGUF ones,
+// which is inspired by
+// https://github.com/ggerganov/llama.cpp/blob/master/convert_llama_ggml_to_gguf.py.
+func parseGGUFFileLegacy(f _GGUFFileReadSeeker, magic GGUFMagic, o _GGUFReadOptions) (_ *GGUFFile, err error) {
+	var gf GGUFFile
+	gf.Legacy = true
+	gf.Header.Magic = magic
+
+	// The legacy file is always little-endian,
+	// and the length prefix of the string is uint32 as GGUF v1.
+	rd := _GGUFReader{v: GGUFVersionV1, o: o, f: f, s: f.Size, bo: binary.LittleEndian}
+
+	// version
+	var version uint32
+	if magic != GGUFMagicGGML {
+		if version, err = rd.ReadUint32(); err != nil {
+			return nil, fmt.Errorf("read version: %w", err)
+		}
+		switch {
+		case magic == GGUFMagicGGMF && version != 1,
+			magic == GGUFMagicGGJT && (version < 1 || version > 3):
+			return nil, fmt.Errorf("unsupported format: %s version %d", magic, version)
+		}
+	}
+	gf.Header.Version = GGUFVersion(version)
+
+	// hyperparameters
+	var hp _GGUFLegacyHyperparameters
+	if err = binary.Read(f, rd.bo, &hp); err != nil {
+		return nil, fmt.Errorf("read hyperparameters: %w", err)
+	}
+	if hp.Head == 0 || hp.Embd%hp.Head != 0 {
+		return nil, fmt.Errorf("%w: invalid head count %d of embedding length %d",
+			ErrGGUFFileInvalidFormat, hp.Head, hp.Embd)
+	}
+
+	// vocabulary
+	scored := magic != GGUFMagicGGML
+	tokens := GGUFMetadataKVArrayValue{Type: GGUFMetadataValueTypeString, Len: uint64(hp.Vocab)}
+	scores := GGUFMetadataKVArrayValue{Type: GGUFMetadataValueTypeFloat32, Len: uint64(hp.Vocab)}
+	{
+		itemSize := rd.MinValueSize(GGUFMetadataValueTypeString)
+		if scored {
+			itemSize += 4
+		}
+		if err = rd.CheckLength("vocabulary size", uint64(hp.Vocab), o.MaxArrayLength, itemSize); err != nil {
+			return nil, err
+		}
+
+		if tokens.StartOffset, err = f.Seek(0, io.SeekCurrent); err != nil {
+			return nil, fmt.Errorf("seek vocabulary start: %w", err)
+		}
+		scores.StartOffset = tokens.StartOffset
+		if !o.SkipLargeMetadata {
+			tokens.Array = make([]any, hp.Vocab)
+			if scored {
+				scores.Array = make([]any, hp.Vocab)
+			}
+		}
+		for i := uint32(0); i < hp.Vocab; i++ {
+			if o.SkipLargeMetadata {
+				err = rd.SkipReadingString()
+			} else {
+				tokens.Array[i], err = rd.ReadRawString()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("read vocabulary %d: %w", i, err)
+			}
+			if !scored {
+				continue
+			}
+			if o.SkipLargeMetadata {
+				_, err = f.Seek(4, io.SeekCurrent)
+			} else {
+				scores.Array[i], err = rd.ReadFloat32()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("read vocabulary score %d: %w", i, err)
+			}
+		}
+		if err = rd.CheckMetadataBytes(); err != nil {
+			return nil, err
+		}
+
+		pos, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("seek vocabulary end: %w", err)
+		}
+		tokens.Size = pos - tokens.StartOffset
+		if scored {
+			scores.Size = 4 * int64(hp.Vocab)
+			tokens.Size -= scores.Size
+		}
+	}
+
+	// tensor infos
+	tensorDataStartOffset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("seek tensor infos start: %w", err)
+	}
+	for pos := tensorDataStartOffset; pos < f.Size; {
+		if uint64(len(gf.TensorInfos)) >= o.MaxTensorCount {
+			return nil, &GGUFFileLimitError{Limit: "tensor count", Value: uint64(len(gf.TensorInfos)) + 1, Max: o.MaxTensorCount}
+		}
+
+		ti, n, err := readGGUFTensorInfoLegacy(rd, magic, version, pos)
+		if err != nil {
+			return nil, fmt.Errorf("read tensor info %d: %w", len(gf.TensorInfos), err)
+		}
+		ti.Offset -= uint64(tensorDataStartOffset)
+		gf.TensorInfos = append(gf.TensorInfos, ti)
+		pos += n
+	}
+	gf.Header.TensorCount = uint64(len(gf.TensorInfos))
+
+	// metadata kv
+	gf.Header.MetadataKV = hp.MetadataKVs(magic, version, gf.TensorInfos, tokens, scores, scored)
+	gf.Header.MetadataKVCount = uint64(len(gf.Header.MetadataKV))
+
+	// padding
+	gf.SplitPaddings = []int64{0}
+
+	// tensor data offset
+	gf.TensorDataStartOffset = tensorDataStartOffset
+	gf.SplitTensorDataStartOffsets = []int64{tensorDataStartOffset}
+	gf.SplitTensorCounts = []uint64{gf.Header.TensorCount}
+
+	// size
+	gf.Size = GGUFBytesScalar(f.Size)
+	gf.SplitSizes = []GGUFBytesScalar{gf.Size}
+
+	// model size
+	gf.ModelSize = GGUFBytesScalar(f.Size - tensorDataStartOffset)
+	gf.SplitModelSizes = []GGUFBytesScalar{gf.ModelSize}
+
+	// model parameters
+	gf.ModelParameters = GGUFParametersScalar(gf.TensorInfos.Elements())
+
+	// bpw
+	if gf.ModelParameters != 0 {
+		gf.ModelBitsPerWeight = GGUFBitsPerWeightScalar(float64(gf.ModelSize) * 8 / float64(gf.ModelParameters))
+	}
+
+	return &gf, nil
+}
+
+// readGGUFTensorInfoLegacy reads the legacy tensor info started at the given position,
+// and skips its following data,
+// returns the GGUFTensorInfo whose Offset is the start of the file,
+// and the total bytes read.
+func readGGUFTensorInfoLegacy(rd _GGUFReader, magic GGUFMagic, version uint32, pos int64) (ti GGUFTensorInfo, n int64, err error) {
+	ti.StartOffset = pos
+
+	var hdr struct {
+		NDimensions, NameLength, Type uint32
+	}
+	if err = binary.Read(rd.f, rd.bo, &hdr); err != nil {
+		return ti, 0, fmt.Errorf("read header: %w", err)
+	}
+	if hdr.NDimensions == 0 || hdr.NDimensions > GGMLMaxDims {
+		return ti, 0, fmt.Errorf("%w: invalid number of dimensions %d", ErrGGUFFileInvalidFormat, hdr.NDimensions)
+	}
+	ti.NDimensions = hdr.NDimensions
+	ti.Type = GGMLType(hdr.Type)
+
+	// dimensions
+	ti.Dimensions = make([]uint64, hdr.NDimensions)
+	for i := range ti.Dimensions {
+		if ti.Dimensions[i], err = rd.ReadUint64FromUint32(); err != nil {
+			return ti, 0, fmt.Errorf("read dimension %d: %w", i, err)
+		}
+	}
+
+	// name
+	if err = rd.CheckLength("string length", uint64(hdr.NameLength), rd.o.MaxStringLength, 1); err != nil {
+		return ti, 0, err
+	}
+	name := make([]byte, hdr.NameLength)
+	if _, err = io.ReadFull(rd.f, name); err != nil {
+		return ti, 0, fmt.Errorf("read name: %w", err)
+	}
+	ti.Name = legacyGGUFTensorName(string(name))
+
+	// data
+	start := pos + 12 + 4*int64(hdr.NDimensions) + int64(hdr.NameLength)
+	if magic == GGUFMagicGGJT {
+		// GGJT aligns the tensor data to 32 bytes from the start of the file.
+		if p := int64(GGMLPadding(uint64(start), 32)); p != start {
+			if _, err = rd.f.Seek(p-start, io.SeekCurrent); err != nil {
+				return ti, 0, fmt.Errorf("seek padding: %w", err)
+			}
+			start = p
+		}
+	}
+	size, err := legacyGGMLTypeBytes(ti.Type, magic, version, ti.Dimensions)
+	if err != nil {
+		return ti, 0, fmt.Errorf("tensor %q: %w", ti.Name, err)
+	}
+	if size > uint64(max(rd.s-start, 0)) {
+		return ti, 0, fmt.Errorf("%w: tensor %q data size %d exceeds the remaining %d bytes",
+			ErrGGUFFileInvalidFormat, ti.Name, size, max(rd.s-start, 0))
+	}
+	if _, err = rd.f.Seek(int64(size), io.SeekCurrent); err != nil {
+		return ti, 0, fmt.Errorf("seek data: %w", err)
+	}
+	ti.Offset = uint64(start)
+
+	return ti, start + int64(size) - pos, nil
+}
+
+// legacyGGMLTypeBytes returns the bytes of the legacy tensor data with the given type and dimensions.
+//
+// Before GGJT v3, the delta of Q4_0, Q4_1, Q8_0 and Q8_1 is stored in float32 rather than float16.
+func legacyGGMLTypeBytes(t GGMLType, magic GGUFMagic, version uint32, dimensions []uint64) (uint64, error) {
+	tt, ok := t.Trait()
+	if magic != GGUFMagicGGJT || version < 3 {
+		switch t {
+		case GGMLTypeQ4_0:
+			tt.TypeSize = 20
+		case GGMLTypeQ4_1:
+			tt.TypeSize = 24
+		case GGMLTypeQ8_0:
+			tt.TypeSize = 36
+		case GGMLTypeQ8_1:
+			tt.TypeSize = 40
+		}
+	}
+	switch {
+	case !ok:
+		return 0, fmt.Errorf("%w: unknown type %d", ErrGGUFFileInvalidFormat, uint32(t))
+	case tt.BlockSize == 0:
+		return 0, fmt.Errorf("unsupported type: %s", t)
+	case dimensions[0]%tt.BlockSize != 0:
+		return 0, fmt.Errorf("%w: first dimension %d is not a multiple of the block size %d of %s",
+			ErrGGUFFileInvalidFormat, dimensions[0], tt.BlockSize, t)
+	}
+
+	size := tt.TypeSize * (dimensions[0] / tt.BlockSize)
+	for _, d := range dimensions[1:] {
+		hi, lo := bits.Mul64(size, d)
+		if hi != 0 {
+			return 0, fmt.Errorf("%w: data size overflows", ErrGGUFFileInvalidFormat)
+		}
+		size = lo
+	}
+	return size, nil
+}
+
+// legacyGGUFTensorName converts the given legacy LLaMA tensor name to the GGUF one,
+// e.g. "layers.0.attention.wq.weight" -> "blk.0.attn_q.weight".
+//
+// The unknown name is returned as is.
+func legacyGGUFTensorName(name string) string {
+	base, ok := strings.CutSuffix(name, ".weight")
+	if !ok {
+		return name
+	}
+
+	switch base {
+	case "tok_embeddings":
+		return "token_embd.weight"
+	case "norm":
+		return "output_norm.weight"
+	case "output":
+		return "output.weight"
+	}
+
+	rest, ok := strings.CutPrefix(base, "layers.")
+	if !ok {
+		return name
+	}
+	idx, sub, ok := strings.Cut(rest, ".")
+	if !ok {
+		return name
+	}
+	if _, err := strconv.ParseUint(idx, 10, 32); err != nil {
+		return name
+	}
+	switch sub {
+	case "attention.wq":
+		sub = "attn_q"
+	case "attention.wk":
+		sub = "attn_k"
+	case "attention.wv":
+		sub = "attn_v"
+	case "attention.wo":
+		sub = "attn_output"
+	case "attention_norm":
+		sub = "attn_norm"
+	case "feed_forward.w1":
+		sub = "ffn_gate"
+	case "feed_forward.w2":
+		sub = "ffn_down"
+	case "feed_forward.w3":
+		sub = "ffn_up"
+	case "ffn_norm":
+		sub = "ffn_norm"
+	default:
+		return name
+	}
+	return "blk." + idx + "." + sub + ".weight"
+}
+
+// _GGUFLegacyHyperparameters is the hyperparameters of the legacy LLaMA file.
+type _GGUFLegacyHyperparameters struct {
+	Vocab, Embd, Mult, Head, Layer, Rot, FileType uint32
+}
+
+// MetadataKVs synthesizes the LLaMA metadata from the hyperparameters and the given vocabulary.
+//
+// The context length is not recorded by the legacy file, assume it is 2048 as LLaMA 1,
+// the feed forward length and the KV head count are derived from the tensors if possible.
+func (hp _GGUFLegacyHyperparameters) MetadataKVs(
+	magic GGUFMagic,
+	version uint32,
+	tis GGUFTensorInfos,
+	tokens, scores GGUFMetadataKVArrayValue,
+	scored bool,
+) GGUFMetadataKVs {
+	// Computed by llama.cpp before GGUF.
+	nFF := ((2*(4*hp.Embd)/3 + hp.Mult - 1) / max(hp.Mult, 1)) * hp.Mult
+	if ti, ok := tis.Get("blk.0.ffn_gate.weight"); ok && ti.NDimensions == 2 {
+		nFF = uint32(ti.Dimensions[1])
+	}
+	nHeadKV := hp.Head
+	if ti, ok := tis.Get("blk.0.attn_k.weight"); ok && ti.NDimensions == 2 {
+		if nHeadKV = uint32(ti.Dimensions[1]) / (hp.Embd / hp.Head); nHeadKV == 0 {
+			nHeadKV = hp.Head
+		}
+	}
+
+	// The quantization version was encoded into the file type of some converters.
+	const qntVersionFactor = 1000
+	qntVersion := hp.FileType / qntVersionFactor
+	ftype := hp.FileType % qntVersionFactor
+	if magic == GGUFMagicGGJT && qntVersion == 0 {
+		qntVersion = version - 1
+	}
+
+	kvs := GGUFMetadataKVs{
+		{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+		{Key: "general.file_type", ValueType: GGUFMetadataValueTypeUint32, Value: ftype},
+	}
+	if qntVersion != 0 {
+		kvs = append(kvs, GGUFMetadataKV{Key: "general.quantization_version", ValueType: GGUFMetadataValueTypeUint32, Value: qntVersion})
+	}
+	kvs = append(kvs,
+		GGUFMetadataKV{Key: "llama.context_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(2048)},
+		GGUFMetadataKV{Key: "llama.embedding_length", ValueType: GGUFMetadataValueTypeUint32, Value: hp.Embd},
+		GGUFMetadataKV{Key: "llama.block_count", ValueType: GGUFMetadataValueTypeUint32, Value: hp.Layer},
+		GGUFMetadataKV{Key: "llama.feed_forward_length", ValueType: GGUFMetadataValueTypeUint32, Value: nFF},
+		GGUFMetadataKV{Key: "llama.rope.dimension_count", ValueType: GGUFMetadataValueTypeUint32, Value: hp.Rot},
+		GGUFMetadataKV{Key: "llama.attention.head_count", ValueType: GGUFMetadataValueTypeUint32, Value: hp.Head},
+		GGUFMetadataKV{Key: "llama.attention.head_count_kv", ValueType: GGUFMetadataValueTypeUint32, Value: nHeadKV},
+		GGUFMetadataKV{Key: "llama.attention.layer_norm_rms_epsilon", ValueType: GGUFMetadataValueTypeFloat32, Value: float32(5e-6)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.model", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+		GGUFMetadataKV{Key: "tokenizer.ggml.tokens", ValueType: GGUFMetadataValueTypeArray, Value: tokens},
+	)
+	if scored {
+		kvs = append(kvs, GGUFMetadataKV{Key: "tokenizer.ggml.scores", ValueType: GGUFMetadataValueTypeArray, Value: scores})
+	}
+	kvs = append(kvs,
+		GGUFMetadataKV{Key: "tokenizer.ggml.bos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.eos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(2)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.unknown_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(0)},
+	)
+	return kvs
+}
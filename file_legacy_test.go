@@ -0,0 +1,224 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGGUFFile_Legacy(t *testing.T) {
+	cases := []struct {
+		name    string
+		magic   GGUFMagic
+		version uint32
+	}{
+		{name: "ggml", magic: GGUFMagicGGML},
+		{name: "ggmf", magic: GGUFMagicGGMF, version: 1},
+		{name: "ggjt v1", magic: GGUFMagicGGJT, version: 1},
+		{name: "ggjt v3", magic: GGUFMagicGGJT, version: 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, datas := newTestLegacyFileBytes(t, tc.magic, tc.version, GGMLTypeQ4_0)
+
+			gf, err := ParseGGUFFileFromReaderAt(bytes.NewReader(b), int64(len(b)))
+			require.NoError(t, err)
+			assert.True(t, gf.Legacy)
+			assert.Equal(t, tc.magic, gf.Header.Magic)
+			assert.Equal(t, GGUFVersion(tc.version), gf.Header.Version)
+			assert.Equal(t, GGUFBytesScalar(len(b)), gf.Size)
+
+			// Tensors.
+			if assert.Len(t, gf.TensorInfos, len(datas)) {
+				assert.Equal(t, "token_embd.weight", gf.TensorInfos[0].Name)
+				assert.Equal(t, "blk.0.attn_q.weight", gf.TensorInfos[3].Name)
+				assert.Equal(t, "blk.0.ffn_gate.weight", gf.TensorInfos[8].Name)
+				for i, ti := range gf.TensorInfos {
+					start := gf.TensorDataStartOffset + int64(ti.Offset)
+					if tc.magic == GGUFMagicGGJT {
+						assert.Zero(t, start%32, ti.Name)
+					}
+					assert.Equal(t, datas[i], b[start:start+int64(len(datas[i]))], ti.Name)
+				}
+			}
+			assert.False(t, gf.Validate().HasErrors(), gf.Validate())
+
+			// Metadata.
+			m := gf.Metadata()
+			assert.Equal(t, "llama", m.Architecture)
+			assert.Equal(t, GGUFFileTypeMostlyQ4_0, m.FileType)
+			assert.True(t, m.LittleEndian)
+
+			a := gf.Architecture()
+			assert.Equal(t, uint64(2048), a.MaximumContextLength)
+			assert.Equal(t, uint64(32), a.EmbeddingLength)
+			assert.Equal(t, uint64(1), a.BlockCount)
+			assert.Equal(t, uint64(64), a.FeedForwardLength)
+			assert.Equal(t, uint64(4), a.AttentionHeadCount)
+			assert.Equal(t, uint64(2), a.AttentionHeadCountKV)
+			assert.Equal(t, uint64(3), a.VocabularyLength)
+
+			tk := gf.Tokenizer()
+			assert.Equal(t, "llama", tk.Model)
+			assert.Equal(t, uint64(3), tk.TokensLength)
+			assert.Equal(t, int64(1), tk.BOSTokenID)
+
+			kv, ok := gf.Header.MetadataKV.Get("tokenizer.ggml.scores")
+			assert.Equal(t, tc.magic != GGUFMagicGGML, ok)
+			if ok {
+				assert.Equal(t, []any{float32(0), float32(-1), float32(-2)}, kv.ValueArray().Array)
+			}
+
+			// Estimate.
+			e := gf.EstimateLLaMACppRun()
+			assert.Equal(t, "llama", e.Architecture)
+			assert.NotEmpty(t, e.Devices)
+		})
+	}
+
+	t.Run("skip large metadata", func(t *testing.T) {
+		b, _ := newTestLegacyFileBytes(t, GGUFMagicGGJT, 3, GGMLTypeF16)
+
+		gf, err := ParseGGUFFileFromReaderAt(bytes.NewReader(b), int64(len(b)), SkipLargeMetadata())
+		require.NoError(t, err)
+		assert.Len(t, gf.TensorInfos, 11)
+		kv, ok := gf.Header.MetadataKV.Get("tokenizer.ggml.tokens")
+		require.True(t, ok)
+		assert.Equal(t, uint64(3), kv.ValueArray().Len)
+		assert.Nil(t, kv.ValueArray().Array)
+		assert.Equal(t, int64((4+5)+(4+3)+(4+4)), kv.ValueArray().Size)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		b, _ := newTestLegacyFileBytes(t, GGUFMagicGGJT, 3, GGMLTypeF16)
+		_, err := ParseGGUFFileFromReaderAt(bytes.NewReader(b[:len(b)-1]), int64(len(b)-1))
+		assert.ErrorIs(t, err, ErrGGUFFileInvalidFormat)
+
+		b, _ = newTestLegacyFileBytes(t, GGUFMagicGGJT, 4, GGMLTypeF16)
+		_, err = ParseGGUFFileFromReaderAt(bytes.NewReader(b), int64(len(b)))
+		assert.ErrorContains(t, err, "unsupported format")
+
+		b, _ = newTestLegacyFileBytes(t, GGUFMagicGGJT, 1, GGMLTypeQ4_2)
+		_, err = ParseGGUFFileFromReaderAt(bytes.NewReader(b), int64(len(b)))
+		assert.ErrorContains(t, err, "unsupported type")
+	})
+}
+
+func TestLegacyGGUFTensorName(t *testing.T) {
+	cases := map[string]string{
+		"tok_embeddings.weight":               "token_embd.weight",
+		"norm.weight":                         "output_norm.weight",
+		"output.weight":                       "output.weight",
+		"layers.12.attention.wo.weight":       "blk.12.attn_output.weight",
+		"layers.0.feed_forward.w2.weight":     "blk.0.ffn_down.weight",
+		"layers.x.attention.wq.weight":        "layers.x.attention.wq.weight",
+		"layers.0.attention.rotary_emb.freqs": "layers.0.attention.rotary_emb.freqs",
+	}
+	for given, expected := range cases {
+		assert.Equal(t, expected, legacyGGUFTensorName(given), given)
+	}
+}
+
+// newTestLegacyFileBytes returns the bytes of a legacy LLaMA file,
+// and the data of each tensor in order,
+// the attention query tensor is quantized by the given type.
+func newTestLegacyFileBytes(t *testing.T, magic GGUFMagic, version uint32, qt GGMLType) ([]byte, [][]byte) {
+	var buf bytes.Buffer
+	w := func(v any) {
+		require.NoError(t, binary.Write(&buf, binary.LittleEndian, v))
+	}
+
+	w(magic)
+	if magic != GGUFMagicGGML {
+		w(version)
+	}
+	// n_vocab, n_embd, n_mult, n_head, n_layer, n_rot, ftype.
+	w([]uint32{3, 32, 32, 4, 1, 8, uint32(GGUFFileTypeMostlyQ4_0)})
+	for i, tok := range []string{"<unk>", "<s>", "</s>"} {
+		w(uint32(len(tok)))
+		buf.WriteString(tok)
+		if magic != GGUFMagicGGML {
+			w(float32(-i))
+		}
+	}
+
+	tensors := []struct {
+		name string
+		typ  GGMLType
+		dims []uint32
+	}{
+		{"tok_embeddings.weight", GGMLTypeF16, []uint32{32, 3}},
+		{"norm.weight", GGMLTypeF32, []uint32{32}},
+		{"output.weight", GGMLTypeF16, []uint32{32, 3}},
+		{"layers.0.attention.wq.weight", qt, []uint32{32, 32}},
+		{"layers.0.attention.wk.weight", GGMLTypeF16, []uint32{32, 16}},
+		{"layers.0.attention.wv.weight", GGMLTypeF16, []uint32{32, 16}},
+		{"layers.0.attention.wo.weight", GGMLTypeF16, []uint32{32, 32}},
+		{"layers.0.attention_norm.weight", GGMLTypeF32, []uint32{32}},
+		{"layers.0.feed_forward.w1.weight", GGMLTypeF16, []uint32{32, 64}},
+		{"layers.0.feed_forward.w2.weight", GGMLTypeF16, []uint32{64, 32}},
+		{"layers.0.feed_forward.w3.weight", GGMLTypeF16, []uint32{32, 64}},
+	}
+	datas := make([][]byte, len(tensors))
+	for i, tt := range tensors {
+		w(uint32(len(tt.dims)))
+		w(uint32(len(tt.name)))
+		w(uint32(tt.typ))
+		w(tt.dims)
+		buf.WriteString(tt.name)
+		if magic == GGUFMagicGGJT {
+			buf.Write(make([]byte, GGMLPadding(uint64(buf.Len()), 32)-uint64(buf.Len())))
+		}
+
+		dims := make([]uint64, len(tt.dims))
+		for j := range tt.dims {
+			dims[j] = uint64(tt.dims[j])
+		}
+		size, err := legacyGGMLTypeBytes(tt.typ, magic, version, dims)
+		if err != nil {
+			// Write a placeholder to reach the unsupported type.
+			size = 1
+		}
+		datas[i] = make([]byte, size)
+		for j := range datas[i] {
+			datas[i][j] = byte(i + j)
+		}
+		buf.Write(datas[i])
+	}
+
+	return buf.Bytes(), datas
+}
+
+func TestGGUFFile_Legacy_Unsupported(t *testing.T) {
+	// Before GGJT v3, the Q4_0 block is 20 bytes instead of 18 bytes.
+	b, _ := newTestLegacyFileBytes(t, GGUFMagicGGJT, 1, GGMLTypeQ4_0)
+	gf, err := ParseGGUFFileFromReaderAt(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+	require.True(t, gf.Legacy)
+	src := bytes.NewReader(b)
+
+	t.Run("open tensor", func(t *testing.T) {
+		_, err := gf.OpenTensor("token_embd.weight", src)
+		assert.ErrorContains(t, err, "legacy")
+	})
+
+	t.Run("tensor statistics", func(t *testing.T) {
+		_, err := gf.TensorStatistics(src)
+		assert.ErrorContains(t, err, "legacy")
+	})
+
+	t.Run("tensor hashes", func(t *testing.T) {
+		_, err := gf.TensorHashes(src)
+		assert.ErrorContains(t, err, "legacy")
+	})
+
+	t.Run("write", func(t *testing.T) {
+		var w bytes.Buffer
+		_, err := NewGGUFWriter(&w).Write(gf, src)
+		assert.ErrorContains(t, err, "legacy")
+		assert.Zero(t, w.Len())
+	})
+}
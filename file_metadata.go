@@ -1,6 +1,7 @@
 package gguf_parser
 
 import (
+	"fmt"
 	"regexp"
 	"sort"
 	"strings"
@@ -54,6 +55,45 @@ type GGUFMetadata struct {
 	// FileType describes the type of the majority of the tensors in the GGUF file.
 	FileType GGUFFileType `json:"fileType"`
 
+	/* Provenance */
+
+	// Version to the model.
+	Version string `json:"version,omitempty"`
+	// Organization to the model.
+	Organization string `json:"organization,omitempty"`
+	// Basename to the model,
+	// which is the base name of the model family, e.g. "Mixtral".
+	Basename string `json:"basename,omitempty"`
+	// Finetune to the model,
+	// which describes what the base model has been fine-tuned for, e.g. "Instruct".
+	Finetune string `json:"finetune,omitempty"`
+	// SizeLabel to the model,
+	// which describes the size of the model, e.g. "8x7B".
+	SizeLabel string `json:"sizeLabel,omitempty"`
+	// QuantizedBy is the name of the individual who quantized the model.
+	QuantizedBy string `json:"quantizedBy,omitempty"`
+	// LicenseName is the human friendly name of the license, e.g. "Llama 3 Community License".
+	LicenseName string `json:"licenseName,omitempty"`
+	// LicenseLink is the URL to the license text.
+	LicenseLink string `json:"licenseLink,omitempty"`
+	// DOI to the model.
+	DOI string `json:"doi,omitempty"`
+	// UUID to the model.
+	UUID string `json:"uuid,omitempty"`
+	// RepoURL to the model's repository, e.g. a HuggingFace repository.
+	RepoURL string `json:"repoURL,omitempty"`
+	// Source is the reference to the original model that this GGUF file is converted from.
+	Source *GGUFModelReference `json:"source,omitempty"`
+	// BaseModels are the references to the models that this model is derived from,
+	// e.g. merged or fine-tuned from.
+	BaseModels []GGUFModelReference `json:"baseModels,omitempty"`
+	// Datasets are the references to the datasets that this model is trained on.
+	Datasets []GGUFModelReference `json:"datasets,omitempty"`
+	// Tags to the model, e.g. "text-generation".
+	Tags []string `json:"tags,omitempty"`
+	// Languages to the model, in ISO 639 codes, e.g. "en".
+	Languages []string `json:"languages,omitempty"`
+
 	/* Appendix */
 
 	// LittleEndian is true if the GGUF file is little-endian,
@@ -69,6 +109,29 @@ type GGUFMetadata struct {
 	BitsPerWeight GGUFBitsPerWeightScalar `json:"bitsPerWeight"`
 }
 
+// GGUFModelReference is a reference to a model or a dataset,
+// which is declared by "general.source.*", "general.base_model.{id}.*" or "general.dataset.{id}.*".
+type GGUFModelReference struct {
+	// Name to the model or dataset.
+	Name string `json:"name,omitempty"`
+	// Author to the model or dataset.
+	Author string `json:"author,omitempty"`
+	// Version to the model or dataset.
+	Version string `json:"version,omitempty"`
+	// Organization to the model or dataset.
+	Organization string `json:"organization,omitempty"`
+	// Description to the model or dataset.
+	Description string `json:"description,omitempty"`
+	// URL to the model or dataset's homepage.
+	URL string `json:"url,omitempty"`
+	// DOI to the model or dataset.
+	DOI string `json:"doi,omitempty"`
+	// UUID to the model or dataset.
+	UUID string `json:"uuid,omitempty"`
+	// RepoURL to the model or dataset's repository.
+	RepoURL string `json:"repoURL,omitempty"`
+}
+
 // GGUFFileType is a type of GGUF file,
 // see https://github.com/ggerganov/llama.cpp/blob/278d0e18469aacf505be18ce790a63c7cc31be26/ggml/include/ggml.h#L404-L433.
 type GGUFFileType uint32
@@ -130,6 +193,22 @@ func (gf *GGUFFile) Metadata() (gm GGUFMetadata) {
 		licenseKey      = "general.license"
 		fileTypeKey     = "general.file_type"
 
+		versionKey        = "general.version"
+		organizationKey   = "general.organization"
+		basenameKey       = "general.basename"
+		finetuneKey       = "general.finetune"
+		sizeLabelKey      = "general.size_label"
+		quantizedByKey    = "general.quantized_by"
+		licenseNameKey    = "general.license.name"
+		licenseLinkKey    = "general.license.link"
+		doiKey            = "general.doi"
+		uuidKey           = "general.uuid"
+		repoURLKey        = "general.repo_url"
+		baseModelCountKey = "general.base_model.count"
+		datasetCountKey   = "general.dataset.count"
+		tagsKey           = "general.tags"
+		languagesKey      = "general.languages"
+
 		controlVectorModelHintKey = "controlvector.model_hint"
 	)
 
@@ -146,6 +225,21 @@ func (gf *GGUFFile) Metadata() (gm GGUFMetadata) {
 		descriptionKey,
 		licenseKey,
 		fileTypeKey,
+		versionKey,
+		organizationKey,
+		basenameKey,
+		finetuneKey,
+		sizeLabelKey,
+		quantizedByKey,
+		licenseNameKey,
+		licenseLinkKey,
+		doiKey,
+		uuidKey,
+		repoURLKey,
+		baseModelCountKey,
+		datasetCountKey,
+		tagsKey,
+		languagesKey,
 		controlVectorModelHintKey,
 	})
 
@@ -202,7 +296,54 @@ func (gf *GGUFFile) Metadata() (gm GGUFMetadata) {
 		gm.FileType = gf.guessFileType(gm.Architecture)
 	}
 
-	gm.LittleEndian = gf.Header.Version < GGUFVersionV3 || gf.Header.Magic == GGUFMagicGGUFLe
+	for _, p := range []struct {
+		key string
+		v   *string
+	}{
+		{versionKey, &gm.Version},
+		{organizationKey, &gm.Organization},
+		{basenameKey, &gm.Basename},
+		{finetuneKey, &gm.Finetune},
+		{sizeLabelKey, &gm.SizeLabel},
+		{quantizedByKey, &gm.QuantizedBy},
+		{licenseNameKey, &gm.LicenseName},
+		{licenseLinkKey, &gm.LicenseLink},
+		{doiKey, &gm.DOI},
+		{uuidKey, &gm.UUID},
+		{repoURLKey, &gm.RepoURL},
+	} {
+		if v, ok := m[p.key]; ok && v.ValueType == GGUFMetadataValueTypeString {
+			*p.v = v.ValueString()
+		}
+	}
+	if r := gf.modelReference("general.source"); r != (GGUFModelReference{}) {
+		gm.Source = &r
+	}
+	if v, ok := m[baseModelCountKey]; ok && isGGUFMetadataValueTypeNumeric(v.ValueType) {
+		for i, n := 0, min(ValueNumeric[int](v), len(gf.Header.MetadataKV)); i < n; i++ {
+			gm.BaseModels = append(gm.BaseModels, gf.modelReference(fmt.Sprintf("general.base_model.%d", i)))
+		}
+	}
+	if v, ok := m[datasetCountKey]; ok && isGGUFMetadataValueTypeNumeric(v.ValueType) {
+		for i, n := 0, min(ValueNumeric[int](v), len(gf.Header.MetadataKV)); i < n; i++ {
+			gm.Datasets = append(gm.Datasets, gf.modelReference(fmt.Sprintf("general.dataset.%d", i)))
+		}
+	}
+	for _, p := range []struct {
+		key string
+		v   *[]string
+	}{
+		{tagsKey, &gm.Tags},
+		{languagesKey, &gm.Languages},
+	} {
+		if v, ok := m[p.key]; ok && v.ValueType == GGUFMetadataValueTypeArray {
+			if av := v.ValueArray(); av.Type == GGUFMetadataValueTypeString {
+				*p.v = av.ValuesString()
+			}
+		}
+	}
+
+	gm.LittleEndian = gf.Legacy || gf.Header.Version < GGUFVersionV3 || gf.Header.Magic == GGUFMagicGGUFLe
 	gm.FileSize = gf.Size
 	gm.Size = gf.ModelSize
 	gm.Parameters = gf.ModelParameters
@@ -211,6 +352,36 @@ func (gf *GGUFFile) Metadata() (gm GGUFMetadata) {
 	return gm
 }
 
+// modelReference returns the reference declared by "<prefix>.*".
+func (gf *GGUFFile) modelReference(prefix string) (r GGUFModelReference) {
+	fields := []struct {
+		key string
+		v   *string
+	}{
+		{prefix + ".name", &r.Name},
+		{prefix + ".author", &r.Author},
+		{prefix + ".version", &r.Version},
+		{prefix + ".organization", &r.Organization},
+		{prefix + ".description", &r.Description},
+		{prefix + ".url", &r.URL},
+		{prefix + ".doi", &r.DOI},
+		{prefix + ".uuid", &r.UUID},
+		{prefix + ".repo_url", &r.RepoURL},
+	}
+	keys := make([]string, len(fields))
+	for i := range fields {
+		keys[i] = fields[i].key
+	}
+
+	m, _ := gf.Header.MetadataKV.Index(keys)
+	for _, f := range fields {
+		if v, ok := m[f.key]; ok && v.ValueType == GGUFMetadataValueTypeString {
+			*f.v = v.ValueString()
+		}
+	}
+	return r
+}
+
 // GGMLType returns the GGMLType of the GGUFFileType,
 // which is inspired by
 // https://github.com/ggerganov/ggml/blob/a10a8b880c059b3b29356eb9a9f8df72f03cdb6a/src/ggml.c#L2730-L2763.
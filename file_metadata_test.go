@@ -8,6 +8,7 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGGUFFile_Metadata(t *testing.T) {
@@ -79,3 +80,79 @@ func TestGGUFFile_guessFileType(t *testing.T) {
 		})
 	}
 }
+
+func TestGGUFFile_Metadata_Provenance(t *testing.T) {
+	str := func(k, v string) GGUFMetadataKV {
+		return GGUFMetadataKV{Key: k, ValueType: GGUFMetadataValueTypeString, Value: v}
+	}
+	strs := func(k string, vs ...any) GGUFMetadataKV {
+		return GGUFMetadataKV{Key: k, ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+			Type: GGUFMetadataValueTypeString, Len: uint64(len(vs)), Array: vs,
+		}}
+	}
+
+	fx := newTestLLaMAFixture(GGUFVersionV3, false)
+	fx.MetadataKV = append(fx.MetadataKV,
+		str("general.organization", "Fixture-Org"),
+		str("general.basename", "fixture"),
+		str("general.finetune", "Instruct"),
+		str("general.size_label", "8x7B"),
+		str("general.quantized_by", "someone"),
+		str("general.license.name", "fixture license"),
+		str("general.repo_url", "https://example.com/fixture"),
+		str("general.source.url", "https://example.com/source"),
+		GGUFMetadataKV{Key: "general.base_model.count", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(2)},
+		str("general.base_model.0.name", "Base A"),
+		str("general.base_model.0.organization", "Org-A"),
+		str("general.base_model.0.repo_url", "https://example.com/org-a/base-a"),
+		str("general.base_model.1.name", "Base B"),
+		str("general.base_model.1.version", "v2"),
+		GGUFMetadataKV{Key: "general.dataset.count", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1)},
+		str("general.dataset.0.name", "Dataset A"),
+		strs("general.tags", "text-generation", "merge"),
+		strs("general.languages", "en", "zh"),
+	)
+	p := fx.WriteFiles(t, t.TempDir(), "a", 1)[0]
+
+	// The tags and languages are kept with SkipLargeMetadata.
+	gf, err := ParseGGUFFile(p, SkipLargeMetadata())
+	require.NoError(t, err)
+	m := gf.Metadata()
+	assert.Equal(t, "Fixture-Org", m.Organization)
+	assert.Equal(t, "fixture", m.Basename)
+	assert.Equal(t, "Instruct", m.Finetune)
+	assert.Equal(t, "8x7B", m.SizeLabel)
+	assert.Equal(t, "someone", m.QuantizedBy)
+	assert.Equal(t, "fixture license", m.LicenseName)
+	assert.Equal(t, "https://example.com/fixture", m.RepoURL)
+	assert.Equal(t, &GGUFModelReference{URL: "https://example.com/source"}, m.Source)
+	assert.Equal(t, []GGUFModelReference{
+		{Name: "Base A", Organization: "Org-A", RepoURL: "https://example.com/org-a/base-a"},
+		{Name: "Base B", Version: "v2"},
+	}, m.BaseModels)
+	assert.Equal(t, []GGUFModelReference{{Name: "Dataset A"}}, m.Datasets)
+	assert.Equal(t, []string{"text-generation", "merge"}, m.Tags)
+	assert.Equal(t, []string{"en", "zh"}, m.Languages)
+
+	// Absent.
+	gf, err = ParseGGUFFile(newTestLLaMAFixture(GGUFVersionV3, false).WriteFiles(t, t.TempDir(), "b", 1)[0])
+	require.NoError(t, err)
+	m = gf.Metadata()
+	assert.Nil(t, m.Source)
+	assert.Nil(t, m.BaseModels)
+	assert.Nil(t, m.Tags)
+
+	// The counts are skipped if not numeric.
+	fx = newTestLLaMAFixture(GGUFVersionV3, false)
+	fx.MetadataKV = append(fx.MetadataKV,
+		str("general.base_model.count", "2"),
+		str("general.base_model.0.name", "Base A"),
+		GGUFMetadataKV{Key: "general.dataset.count", ValueType: GGUFMetadataValueTypeBool, Value: true},
+		str("general.dataset.0.name", "Dataset A"),
+	)
+	gf, err = ParseGGUFFile(fx.WriteFiles(t, t.TempDir(), "c", 1)[0])
+	require.NoError(t, err)
+	assert.NotPanics(t, func() { m = gf.Metadata() })
+	assert.Nil(t, m.BaseModels)
+	assert.Nil(t, m.Datasets)
+}
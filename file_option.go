@@ -14,6 +14,13 @@ type (
 	_GGUFReadOptions struct {
 		Debug             bool
 		SkipLargeMetadata bool
+		RawStrings        bool
+
+		// Limits.
+		MaxStringLength  uint64
+		MaxArrayLength   uint64
+		MaxTensorCount   uint64
+		MaxMetadataBytes uint64
 
 		// Local.
 		MMap bool
@@ -43,12 +50,72 @@ func UseDebug() GGUFReadOption {
 
 // SkipLargeMetadata skips reading large GGUFMetadataKV items,
 // which are not necessary for most cases.
+//
+// The "general.tags", "general.languages" and "<arch>.attention.sliding_window_pattern" arrays are always read.
 func SkipLargeMetadata() GGUFReadOption {
 	return func(o *_GGUFReadOptions) {
 		o.SkipLargeMetadata = true
 	}
 }
 
+// UseRawStrings reads the strings as is,
+// which keeps the leading and trailing whitespaces of the keys, the values and the tensor names,
+// e.g. the trailing "\n" of the "tokenizer.chat_template".
+//
+// By default, the strings are trimmed,
+// use this option to write the file back without changing the untouched metadata.
+func UseRawStrings() GGUFReadOption {
+	return func(o *_GGUFReadOptions) {
+		o.RawStrings = true
+	}
+}
+
+// Default limits for reading the file,
+// which are large enough for the known models.
+const (
+	// DefaultMaxStringLength is the default maximum length in bytes of a string.
+	DefaultMaxStringLength = 16 * 1024 * 1024
+	// DefaultMaxArrayLength is the default maximum length of an array.
+	DefaultMaxArrayLength = 16 * 1024 * 1024
+	// DefaultMaxTensorCount is the default maximum count of the tensors.
+	DefaultMaxTensorCount = 1024 * 1024
+	// DefaultMaxMetadataBytes is the default maximum size in bytes of the metadata,
+	// including the header and the tensor infos.
+	DefaultMaxMetadataBytes = 1024 * 1024 * 1024
+)
+
+// UseMaxStringLength limits the length in bytes of a string,
+// which is DefaultMaxStringLength by default.
+func UseMaxStringLength(n uint64) GGUFReadOption {
+	return func(o *_GGUFReadOptions) {
+		o.MaxStringLength = n
+	}
+}
+
+// UseMaxArrayLength limits the length of an array,
+// which is DefaultMaxArrayLength by default.
+func UseMaxArrayLength(n uint64) GGUFReadOption {
+	return func(o *_GGUFReadOptions) {
+		o.MaxArrayLength = n
+	}
+}
+
+// UseMaxTensorCount limits the count of the tensors,
+// which is DefaultMaxTensorCount by default.
+func UseMaxTensorCount(n uint64) GGUFReadOption {
+	return func(o *_GGUFReadOptions) {
+		o.MaxTensorCount = n
+	}
+}
+
+// UseMaxMetadataBytes limits the size in bytes of the metadata of each (split) file,
+// which is DefaultMaxMetadataBytes by default.
+func UseMaxMetadataBytes(n uint64) GGUFReadOption {
+	return func(o *_GGUFReadOptions) {
+		o.MaxMetadataBytes = n
+	}
+}
+
 // UseMMap uses mmap to read the local file.
 func UseMMap() GGUFReadOption {
 	return func(o *_GGUFReadOptions) {
@@ -0,0 +1,225 @@
+package gguf_parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gpustack/gguf-parser-go/util/anyx"
+	"github.com/gpustack/gguf-parser-go/util/funcx"
+	"github.com/gpustack/gguf-parser-go/util/osx"
+)
+
+// Metadata keys of the split GGUF files,
+// see https://github.com/ggerganov/llama.cpp/blob/master/examples/gguf-split/gguf-split.cpp.
+const (
+	// GGUFSplitNoKey is the key of the index(start from 0) of the split file, in uint16.
+	GGUFSplitNoKey = "split.no"
+	// GGUFSplitCountKey is the key of the total number of the split files, in uint16.
+	GGUFSplitCountKey = "split.count"
+	// GGUFSplitTensorsCountKey is the key of the total number of the tensors in all split files, in int32.
+	GGUFSplitTensorsCountKey = "split.tensors.count"
+)
+
+// SplitGGUFFile splits the given GGUFFile into shards as llama.cpp gguf-split does,
+// and returns the paths of the written shards, or an error if any.
+//
+// The tensor data is read from the given sources,
+// each source represents a (split) file of the GGUFFile.
+//
+// The shards are named with the given path prefix,
+// e.g. "path/to/model" -> "path/to/model-00001-of-00003.gguf".
+// All shards start with the split.no, split.count and split.tensors.count metadata,
+// and the first shard holds all the metadata following them.
+//
+// To split the file losslessly, the given GGUFFile should be parsed with UseRawStrings.
+//
+// Either WithSplitMaxSize or WithSplitMaxTensors must be given.
+func SplitGGUFFile(gf *GGUFFile, srcs []io.ReaderAt, prefix string, opts ...GGUFSplitOption) (paths []string, err error) {
+	var o _GGUFSplitOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	switch {
+	case gf == nil:
+		return nil, errors.New("nil GGUF file")
+	case gf.Legacy:
+		return nil, errors.New("splitting legacy file is not supported")
+	case (o.MaxSize == 0) == (o.MaxTensors == 0):
+		return nil, errors.New("either max size or max tensors must be specified")
+	}
+
+	// Plan the shards,
+	// a new shard is started if the current one is not empty and exceeds the limit.
+	bounds := []int{0}
+	{
+		ag, err := ggufAlignment(gf.Header.MetadataKV)
+		if err != nil {
+			return nil, err
+		}
+		var size uint64
+		for i := range gf.TensorInfos {
+			n := GGMLPadding(gf.TensorInfos[i].Bytes(), ag)
+			if c := i - bounds[len(bounds)-1]; c > 0 &&
+				(o.MaxSize != 0 && size+n > o.MaxSize || o.MaxTensors != 0 && uint64(c) >= o.MaxTensors) {
+				bounds = append(bounds, i)
+				size = 0
+			}
+			size += n
+		}
+		bounds = append(bounds, len(gf.TensorInfos))
+	}
+	count := len(bounds) - 1
+	if count > 0xffff {
+		return nil, fmt.Errorf("too many shards: %d", count)
+	}
+
+	kvs := make(GGUFMetadataKVs, 0, len(gf.Header.MetadataKV)+3)
+	for i := range gf.Header.MetadataKV {
+		if strings.HasPrefix(gf.Header.MetadataKV[i].Key, "split.") {
+			continue
+		}
+		kvs = append(kvs, gf.Header.MetadataKV[i])
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		// Remove the written shards.
+		for i := range paths {
+			_ = os.Remove(paths[i])
+		}
+		paths = nil
+	}()
+
+	for s := 0; s < count; s++ {
+		skvs := GGUFMetadataKVs{
+			{Key: GGUFSplitNoKey, ValueType: GGUFMetadataValueTypeUint16, Value: uint16(s)},
+			{Key: GGUFSplitCountKey, ValueType: GGUFMetadataValueTypeUint16, Value: uint16(count)},
+			{Key: GGUFSplitTensorsCountKey, ValueType: GGUFMetadataValueTypeInt32, Value: int32(len(gf.TensorInfos))},
+		}
+		if s == 0 {
+			skvs = append(skvs, kvs...)
+		}
+
+		start, end := bounds[s], bounds[s+1]
+		path := fmt.Sprintf("%s-%05d-of-%05d.gguf", prefix, s+1, count)
+		if err = writeGGUFFile(path, gf.Header.Magic, skvs, gf.TensorInfos[start:end], func(i int) (*io.SectionReader, error) {
+			return gf.openTensorAt(start+i, srcs)
+		}); err != nil {
+			return paths, fmt.Errorf("write shard %d: %w", s+1, err)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// MergeGGUFFiles merges the given shards into one GGUF file of the given path as llama.cpp gguf-split does,
+// and returns an error if any.
+//
+// The given shards must be in order,
+// if only one shard is given, the others are completed by CompleteShardGGUFFilename.
+//
+// The split.* metadata is dropped from the merged file.
+func MergeGGUFFiles(paths []string, path string) error {
+	if len(paths) == 1 {
+		if ps := CompleteShardGGUFFilename(paths[0]); ps != nil {
+			paths = ps
+		}
+	}
+	if len(paths) == 0 {
+		return errors.New("no shards specified")
+	}
+	for i := range paths {
+		if filepath.Clean(paths[i]) == filepath.Clean(path) {
+			return fmt.Errorf("output %s is one of the shards", path)
+		}
+	}
+
+	fs := make([]_GGUFFileReadSeeker, 0, len(paths))
+	srcs := make([]io.ReaderAt, 0, len(paths))
+	defer func() {
+		for i := range fs {
+			osx.Close(fs[i])
+		}
+	}()
+	for i := range paths {
+		f, err := osx.Open(paths[i])
+		if err != nil {
+			return fmt.Errorf("open shard: %w", err)
+		}
+		fs = append(fs, _GGUFFileReadSeeker{
+			Closer:     f,
+			ReadSeeker: f,
+			Size:       funcx.MustNoError(f.Stat()).Size(),
+		})
+		srcs = append(srcs, f)
+	}
+
+	gf, err := parseGGUFFile(fs, _GGUFReadOptions{RawStrings: true})
+	if err != nil {
+		return fmt.Errorf("parse shards: %w", err)
+	}
+	if gf.Legacy {
+		return errors.New("merging legacy file is not supported")
+	}
+	if v, ok := gf.Header.MetadataKV.Get(GGUFSplitCountKey); ok {
+		if c := anyx.Number[int](v.Value); c != len(paths) {
+			return fmt.Errorf("mismatched shards: want %d, got %d", c, len(paths))
+		}
+	} else if len(paths) > 1 {
+		return fmt.Errorf("mismatched shards: %s is missing", GGUFSplitCountKey)
+	}
+	if v, ok := gf.Header.MetadataKV.Get(GGUFSplitTensorsCountKey); ok {
+		if c := anyx.Number[uint64](v.Value); c != gf.Header.TensorCount {
+			return fmt.Errorf("mismatched tensors: want %d, got %d", c, gf.Header.TensorCount)
+		}
+	}
+
+	kvs := make(GGUFMetadataKVs, 0, len(gf.Header.MetadataKV))
+	for i := range gf.Header.MetadataKV {
+		if strings.HasPrefix(gf.Header.MetadataKV[i].Key, "split.") {
+			continue
+		}
+		kvs = append(kvs, gf.Header.MetadataKV[i])
+	}
+
+	return writeGGUFFile(path, gf.Header.Magic, kvs, gf.TensorInfos, func(i int) (*io.SectionReader, error) {
+		return gf.openTensorAt(i, srcs)
+	})
+}
+
+// writeGGUFFile creates the GGUF file of the given path,
+// and writes the given header along with the tensor data opened by the given function,
+// the file is removed if failed to write.
+func writeGGUFFile(
+	path string,
+	magic GGUFMagic,
+	kvs GGUFMetadataKVs,
+	tis GGUFTensorInfos,
+	open func(i int) (*io.SectionReader, error),
+) (err error) {
+	f, err := osx.CreateFile(path, 0o644)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	defer func() {
+		osx.Close(f)
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if _, err = NewGGUFWriter(f).write(magic, kvs, tis, open); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("sync file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package gguf_parser
+
+type (
+	_GGUFSplitOptions struct {
+		MaxSize    uint64
+		MaxTensors uint64
+	}
+
+	// GGUFSplitOption is the options for splitting a GGUF file.
+	GGUFSplitOption func(*_GGUFSplitOptions)
+)
+
+// WithSplitMaxSize limits the tensor data size in bytes of each shard,
+// a shard may exceed the limit if it holds only one tensor.
+//
+// WithSplitMaxSize conflicts with WithSplitMaxTensors.
+func WithSplitMaxSize(size uint64) GGUFSplitOption {
+	return func(o *_GGUFSplitOptions) {
+		o.MaxSize = size
+	}
+}
+
+// WithSplitMaxTensors limits the number of tensors of each shard.
+//
+// WithSplitMaxTensors conflicts with WithSplitMaxSize.
+func WithSplitMaxTensors(count uint64) GGUFSplitOption {
+	return func(o *_GGUFSplitOptions) {
+		o.MaxTensors = count
+	}
+}
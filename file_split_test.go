@@ -0,0 +1,171 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitGGUFFile(t *testing.T) {
+	fx := newTestLLaMAFixture(GGUFVersionV3, false)
+	fx.MetadataKV = append(slices.Clone(fx.MetadataKV),
+		GGUFMetadataKV{Key: "tokenizer.chat_template", ValueType: GGUFMetadataValueTypeString, Value: "{{ messages }}\n"})
+	src := fx.WriteFiles(t, t.TempDir(), "fixture", 1)[0]
+
+	gf, err := ParseGGUFFile(src, UseRawStrings())
+	require.NoError(t, err)
+	srcs, err := OpenGGUFFileSources(src)
+	require.NoError(t, err)
+	defer func() { _ = srcs.Close() }()
+
+	// Splitting and merging is lossless, the merged file is the same as the original file.
+	expected, err := os.ReadFile(src)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name   string
+		opts   []GGUFSplitOption
+		shards int
+	}{
+		{
+			name:   "max tensors",
+			opts:   []GGUFSplitOption{WithSplitMaxTensors(4)},
+			shards: (len(fx.TensorInfos) + 3) / 4,
+		},
+		{
+			name:   "max size",
+			opts:   []GGUFSplitOption{WithSplitMaxSize(40 << 10)},
+			shards: 5,
+		},
+		{
+			name:   "max size less than tensor",
+			opts:   []GGUFSplitOption{WithSplitMaxSize(1)},
+			shards: len(fx.TensorInfos),
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ps, err := SplitGGUFFile(gf, srcs.ReaderAts(), filepath.Join(dir, "split"), tc.opts...)
+			require.NoError(t, err)
+			require.Len(t, ps, tc.shards)
+			assert.Equal(t, ps, CompleteShardGGUFFilename(ps[0]))
+
+			for i, p := range ps {
+				// The parser drops split.no, so read the metadata directly.
+				kvs := readTestMetadataKVs(t, p)
+				no, ok := kvs.Get(GGUFSplitNoKey)
+				if assert.True(t, ok) {
+					assert.Equal(t, GGUFMetadataValueTypeUint16, no.ValueType)
+					assert.Equal(t, uint16(i), no.ValueUint16())
+				}
+				count, ok := kvs.Get(GGUFSplitCountKey)
+				if assert.True(t, ok) {
+					assert.Equal(t, GGUFMetadataValueTypeUint16, count.ValueType)
+					assert.Equal(t, uint16(len(ps)), count.ValueUint16())
+				}
+				tcount, ok := kvs.Get(GGUFSplitTensorsCountKey)
+				if assert.True(t, ok) {
+					assert.Equal(t, GGUFMetadataValueTypeInt32, tcount.ValueType)
+					assert.Equal(t, int32(len(fx.TensorInfos)), tcount.ValueInt32())
+				}
+				// The split metadata comes first as llama.cpp does.
+				assert.Equal(t, []string{GGUFSplitNoKey, GGUFSplitCountKey, GGUFSplitTensorsCountKey},
+					[]string{kvs[0].Key, kvs[1].Key, kvs[2].Key})
+				if i == 0 {
+					assert.Len(t, kvs, len(fx.MetadataKV)+3)
+					for j := range fx.MetadataKV {
+						assert.Equal(t, fx.MetadataKV[j].Key, kvs[3+j].Key)
+					}
+				} else {
+					assert.Len(t, kvs, 3)
+				}
+			}
+
+			// Parse the shards as a whole.
+			sgf, err := ParseGGUFFile(ps[0])
+			require.NoError(t, err)
+			assert.Empty(t, sgf.Validate())
+			assert.Equal(t, gf.Metadata().Parameters, sgf.Metadata().Parameters)
+			ssrcs, err := OpenGGUFFileSources(ps[0])
+			require.NoError(t, err)
+			defer func() { _ = ssrcs.Close() }()
+			require.Len(t, sgf.TensorInfos, len(gf.TensorInfos))
+			for i := range gf.TensorInfos {
+				assert.Equal(t, gf.TensorInfos[i].Name, sgf.TensorInfos[i].Name)
+				assert.Equal(t,
+					readTestTensor(t, gf, gf.TensorInfos[i].Name, srcs.ReaderAts()),
+					readTestTensor(t, sgf, gf.TensorInfos[i].Name, ssrcs.ReaderAts()),
+					gf.TensorInfos[i].Name)
+			}
+
+			// Merge from the first shard.
+			out := filepath.Join(dir, "merged.gguf")
+			require.NoError(t, MergeGGUFFiles(ps[:1], out))
+			actual, err := os.ReadFile(out)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := SplitGGUFFile(gf, srcs.ReaderAts(), filepath.Join(dir, "split"))
+		assert.ErrorContains(t, err, "either max size or max tensors")
+		_, err = SplitGGUFFile(gf, srcs.ReaderAts(), filepath.Join(dir, "split"),
+			WithSplitMaxSize(1), WithSplitMaxTensors(1))
+		assert.ErrorContains(t, err, "either max size or max tensors")
+		_, err = SplitGGUFFile(gf, nil, filepath.Join(dir, "split"), WithSplitMaxTensors(1))
+		assert.ErrorContains(t, err, "mismatched sources")
+		es, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, es, "written shards should be removed")
+
+		ps, err := SplitGGUFFile(gf, srcs.ReaderAts(), filepath.Join(dir, "split"), WithSplitMaxTensors(4))
+		require.NoError(t, err)
+		assert.ErrorContains(t, MergeGGUFFiles(ps[:2], filepath.Join(dir, "merged.gguf")), "mismatched shards")
+		assert.ErrorContains(t, MergeGGUFFiles(ps, ps[1]), "is one of the shards")
+		assert.Error(t, MergeGGUFFiles(nil, filepath.Join(dir, "merged.gguf")))
+	})
+}
+
+// readTestMetadataKVs reads all the metadata of the given little-endian GGUF v3 file,
+// without completing the shards.
+func readTestMetadataKVs(t *testing.T, path string) GGUFMetadataKVs {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	f := bytes.NewReader(b)
+	// Skip the magic, version and tensor count.
+	_, err = f.Seek(4+4+8, io.SeekStart)
+	require.NoError(t, err)
+
+	rd := _GGUFMetadataReader{_GGUFReader: _GGUFReader{v: GGUFVersionV3, o: _GGUFReadOptions{RawStrings: true}, f: f, s: int64(len(b)), bo: binary.LittleEndian}}
+	n, err := rd.ReadUint64()
+	require.NoError(t, err)
+	kvs := make(GGUFMetadataKVs, n)
+	for i := range kvs {
+		kvs[i], err = rd.Read()
+		require.NoError(t, err)
+	}
+	return kvs
+}
+
+// readTestTensor reads all the data of the tensor with the given name.
+func readTestTensor(t *testing.T, gf *GGUFFile, name string, srcs []io.ReaderAt) []byte {
+	t.Helper()
+
+	sr, err := gf.OpenTensor(name, srcs...)
+	require.NoError(t, err)
+	b, err := io.ReadAll(sr)
+	require.NoError(t, err)
+	return b
+}
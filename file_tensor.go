@@ -0,0 +1,356 @@
+package gguf_parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/gpustack/gguf-parser-go/util/bytex"
+)
+
+// OpenTensor returns an io.SectionReader of the data of the tensor with the given name,
+// or an error if the tensor is not found.
+//
+// The given sources are the (split) files of the GGUFFile in order,
+// the tensor data is located via SplitTensorDataStartOffsets for the split files,
+// and the legacy file is not supported.
+func (gf *GGUFFile) OpenTensor(name string, srcs ...io.ReaderAt) (*io.SectionReader, error) {
+	for i := range gf.TensorInfos {
+		if gf.TensorInfos[i].Name == name {
+			return gf.openTensorAt(i, srcs)
+		}
+	}
+	return nil, fmt.Errorf("tensor %q not found", name)
+}
+
+// openTensorAt returns an io.SectionReader of the data of the i-th tensor.
+func (gf *GGUFFile) openTensorAt(i int, srcs []io.ReaderAt) (*io.SectionReader, error) {
+	if gf.Legacy {
+		// The legacy quantized types have different block sizes,
+		// the size of the tensor data cannot be measured by GGUFTensorInfo.Bytes.
+		return nil, errors.New("opening tensor of legacy file is not supported")
+	}
+	if ns := max(len(gf.SplitTensorDataStartOffsets), 1); ns != len(srcs) {
+		return nil, fmt.Errorf("mismatched sources: want %d, got %d", ns, len(srcs))
+	}
+	sidxs, err := gf.tensorInfoSplitIndexes()
+	if err != nil {
+		return nil, fmt.Errorf("resolve tensor splits: %w", err)
+	}
+
+	ti, s := gf.TensorInfos[i], sidxs[i]
+	so := gf.TensorDataStartOffset
+	if len(gf.SplitTensorDataStartOffsets) != 0 {
+		so = gf.SplitTensorDataStartOffsets[s]
+	}
+	return io.NewSectionReader(srcs[s], so+int64(ti.Offset), int64(ti.Bytes())), nil
+}
+
+// GGUFFileSources holds the opened (split) files of a GGUF file in order,
+// which is used to read the tensor data of the GGUFFile.
+type GGUFFileSources struct {
+	rs []io.ReaderAt
+	cs []io.Closer
+}
+
+// OpenGGUFFileSources opens the local GGUF file(and its shards) of the given path,
+// and returns the GGUFFileSources, or an error if any.
+//
+// Only UseMMap option works.
+func OpenGGUFFileSources(path string, opts ...GGUFReadOption) (*GGUFFileSources, error) {
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	fs, err := openGGUFFile(path, o)
+	if err != nil {
+		return nil, err
+	}
+	return newGGUFFileSources(fs), nil
+}
+
+// OpenGGUFFileSourcesRemote opens the remote GGUF file(and its shards) of the given url,
+// and returns the GGUFFileSources, or an error if any.
+func OpenGGUFFileSourcesRemote(ctx context.Context, url string, opts ...GGUFReadOption) (*GGUFFileSources, error) {
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	fs, err := openGGUFFileRemote(ctx, newGGUFFileRemoteClient(url, o), url, o)
+	if err != nil {
+		return nil, err
+	}
+	return newGGUFFileSources(fs), nil
+}
+
+func newGGUFFileSources(fs []_GGUFFileReadSeeker) *GGUFFileSources {
+	s := &GGUFFileSources{
+		rs: make([]io.ReaderAt, len(fs)),
+		cs: make([]io.Closer, len(fs)),
+	}
+	for i := range fs {
+		// Both *os.File and *io.SectionReader implement io.ReaderAt.
+		s.rs[i] = fs[i].ReadSeeker.(io.ReaderAt)
+		s.cs[i] = fs[i].Closer
+	}
+	return s
+}
+
+// ReaderAts returns the io.ReaderAt list of the GGUFFileSources.
+func (s *GGUFFileSources) ReaderAts() []io.ReaderAt {
+	return s.rs
+}
+
+// Close closes all the opened files.
+func (s *GGUFFileSources) Close() error {
+	var errs []error
+	for i := range s.cs {
+		if err := s.cs[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GGUFSparsityBounds are the exclusive upper bounds of the magnitude buckets of GGUFNumericStatistics.Sparsity,
+// the magnitudes not less than the last bound fall into the last bucket.
+var GGUFSparsityBounds = [...]float64{1e-8, 1e-6, 1e-4, 1e-2, 1}
+
+// Types for GGUF tensor statistics.
+type (
+	// GGUFNumericStatistics holds the numeric statistics of the dequantized values.
+	//
+	// Min, Max, Mean and Std only count the finite values.
+	GGUFNumericStatistics struct {
+		// Elements is the number of values.
+		Elements uint64 `json:"elements"`
+		// Min is the minimum value.
+		Min float64 `json:"min"`
+		// Max is the maximum value.
+		Max float64 `json:"max"`
+		// Mean is the arithmetic mean.
+		Mean float64 `json:"mean"`
+		// Std is the population standard deviation.
+		Std float64 `json:"std"`
+		// NaNs is the number of NaN values.
+		NaNs uint64 `json:"nans"`
+		// Infs is the number of (positive or negative) infinite values.
+		Infs uint64 `json:"infs"`
+		// Zeros is the number of zero values.
+		Zeros uint64 `json:"zeros"`
+		// Sparsity is the histogram of the magnitudes of the non-zero finite values,
+		// the i-th bucket counts the magnitudes in [GGUFSparsityBounds[i-1], GGUFSparsityBounds[i]).
+		Sparsity [len(GGUFSparsityBounds) + 1]uint64 `json:"sparsity"`
+	}
+
+	// GGUFTensorStatistics holds the numeric statistics of a tensor.
+	GGUFTensorStatistics struct {
+		// Name is the name of the tensor.
+		Name string `json:"name"`
+		// Type is the type of the tensor.
+		Type GGMLType `json:"type"`
+		// Skipped indicates the tensor cannot be dequantized,
+		// or the tensor is quantized in the big-endian file,
+		// and the statistics are empty.
+		Skipped bool `json:"skipped,omitempty"`
+
+		GGUFNumericStatistics `json:",inline"`
+	}
+
+	// GGUFLayerStatistics holds the numeric statistics of a layer,
+	// which is grouped by GGUFLayerTensorInfos.
+	GGUFLayerStatistics struct {
+		// Name is the name of the layer.
+		Name string `json:"name"`
+		// Count is the number of the counted tensors.
+		Count uint64 `json:"count"`
+
+		GGUFNumericStatistics `json:",inline"`
+	}
+
+	// GGUFTensorsStatistics holds the numeric statistics of all tensors and layers.
+	GGUFTensorsStatistics struct {
+		// Tensors holds the statistics of each tensor, in order of the GGUFTensorInfos.
+		Tensors []GGUFTensorStatistics `json:"tensors"`
+		// Layers holds the statistics of each (nested) layer, in order of the GGUFLayerTensorInfos.
+		Layers []GGUFLayerStatistics `json:"layers"`
+	}
+)
+
+// TensorStatistics streams the data of all tensors from the given sources,
+// and returns the numeric statistics of each tensor and each layer, or an error if any.
+//
+// The given sources are the (split) files of the GGUFFile in order,
+// the tensors cannot be dequantized are skipped,
+// so are the quantized tensors of the big-endian file,
+// and the legacy file is not supported.
+func (gf *GGUFFile) TensorStatistics(srcs ...io.ReaderAt) (GGUFTensorsStatistics, error) {
+	if gf.Legacy {
+		return GGUFTensorsStatistics{}, errors.New("computing statistics of legacy file is not supported")
+	}
+
+	const bs = 4 << 20
+	b := bytex.GetBytes(bs)
+	defer bytex.Put(b)
+
+	var (
+		tss = make([]GGUFTensorStatistics, len(gf.TensorInfos))
+		tas = make(map[string]*_GGUFNumericAccumulator, len(gf.TensorInfos))
+	)
+	for i, ti := range gf.TensorInfos {
+		tss[i] = GGUFTensorStatistics{Name: ti.Name, Type: ti.Type}
+		tt, _ := ti.Type.Trait()
+		// The blocks of the quantized types mix the fields of different sizes,
+		// which cannot be swapped as a whole in the big-endian file.
+		if !ti.Type.IsDequantizable() || gf.Header.Magic == GGUFMagicGGUFBe && tt.Quantized {
+			tss[i].Skipped = true
+			continue
+		}
+
+		sr, err := gf.openTensorAt(i, srcs)
+		if err != nil {
+			return GGUFTensorsStatistics{}, fmt.Errorf("open tensor %q: %w", ti.Name, err)
+		}
+
+		cs := int64(bs / tt.TypeSize * tt.TypeSize)
+		ta := newGGUFNumericAccumulator()
+		for r := sr.Size(); r > 0; {
+			n := min(r, cs)
+			if _, err = io.ReadFull(sr, b[:n]); err != nil {
+				return GGUFTensorsStatistics{}, fmt.Errorf("read tensor %q: %w", ti.Name, err)
+			}
+			r -= n
+			if gf.Header.Magic == GGUFMagicGGUFBe {
+				swapGGMLBytes(b[:n], tt.TypeSize)
+			}
+			vs, err := Dequantize(ti.Type, b[:n])
+			if err != nil {
+				return GGUFTensorsStatistics{}, fmt.Errorf("dequantize tensor %q: %w", ti.Name, err)
+			}
+			for _, v := range vs {
+				ta.Add(float64(v))
+			}
+		}
+		tss[i].GGUFNumericStatistics = ta.Statistics()
+		tas[ti.Name] = ta
+	}
+
+	var lss []GGUFLayerStatistics
+	var walk func(ltis GGUFLayerTensorInfos) (*_GGUFNumericAccumulator, uint64)
+	walk = func(ltis GGUFLayerTensorInfos) (*_GGUFNumericAccumulator, uint64) {
+		la, lc := newGGUFNumericAccumulator(), uint64(0)
+		for i := range ltis {
+			switch v := ltis[i].(type) {
+			case GGUFTensorInfo:
+				if ta, ok := tas[v.Name]; ok {
+					la.Merge(ta)
+					lc++
+				}
+			case *GGUFNamedTensorInfos:
+				idx := len(lss)
+				lss = append(lss, GGUFLayerStatistics{Name: v.Name})
+				na, nc := walk(v.GGUFLayerTensorInfos)
+				lss[idx].Count = nc
+				lss[idx].GGUFNumericStatistics = na.Statistics()
+				la.Merge(na)
+				lc += nc
+			}
+		}
+		return la, lc
+	}
+	walk(gf.Layers())
+
+	return GGUFTensorsStatistics{Tensors: tss, Layers: lss}, nil
+}
+
+// swapGGMLBytes swaps the byte order of each element with the given size in place.
+func swapGGMLBytes(b []byte, size uint64) {
+	if size <= 1 {
+		return
+	}
+	for i := uint64(0); i+size <= uint64(len(b)); i += size {
+		slices.Reverse(b[i : i+size])
+	}
+}
+
+// _GGUFNumericAccumulator accumulates the numeric statistics,
+// the mean and variance are computed by Welford's online algorithm.
+type _GGUFNumericAccumulator struct {
+	n, nans, infs, zeros uint64
+	min, max, mean, m2   float64
+	sparsity             [len(GGUFSparsityBounds) + 1]uint64
+}
+
+func newGGUFNumericAccumulator() *_GGUFNumericAccumulator {
+	return &_GGUFNumericAccumulator{min: math.Inf(1), max: math.Inf(-1)}
+}
+
+// Add adds the given value.
+func (a *_GGUFNumericAccumulator) Add(v float64) {
+	switch {
+	case math.IsNaN(v):
+		a.nans++
+		return
+	case math.IsInf(v, 0):
+		a.infs++
+		return
+	case v == 0:
+		a.zeros++
+	default:
+		m, i := math.Abs(v), 0
+		for i < len(GGUFSparsityBounds) && m >= GGUFSparsityBounds[i] {
+			i++
+		}
+		a.sparsity[i]++
+	}
+	a.n++
+	a.min = min(a.min, v)
+	a.max = max(a.max, v)
+	d := v - a.mean
+	a.mean += d / float64(a.n)
+	a.m2 += d * (v - a.mean)
+}
+
+// Merge merges the given accumulator,
+// see https://en.wikipedia.org/wiki/Algorithms_for_calculating_variance#Parallel_algorithm.
+func (a *_GGUFNumericAccumulator) Merge(b *_GGUFNumericAccumulator) {
+	a.nans += b.nans
+	a.infs += b.infs
+	a.zeros += b.zeros
+	for i := range a.sparsity {
+		a.sparsity[i] += b.sparsity[i]
+	}
+	if b.n == 0 {
+		return
+	}
+	n := a.n + b.n
+	d := b.mean - a.mean
+	a.mean += d * float64(b.n) / float64(n)
+	a.m2 += b.m2 + d*d*float64(a.n)*float64(b.n)/float64(n)
+	a.n = n
+	a.min = min(a.min, b.min)
+	a.max = max(a.max, b.max)
+}
+
+// Statistics returns the GGUFNumericStatistics.
+func (a *_GGUFNumericAccumulator) Statistics() GGUFNumericStatistics {
+	s := GGUFNumericStatistics{
+		Elements: a.n + a.nans + a.infs,
+		NaNs:     a.nans,
+		Infs:     a.infs,
+		Zeros:    a.zeros,
+		Sparsity: a.sparsity,
+	}
+	if a.n != 0 {
+		s.Min = a.min
+		s.Max = a.max
+		s.Mean = a.mean
+		s.Std = math.Sqrt(a.m2 / float64(a.n))
+	}
+	return s
+}
@@ -0,0 +1,250 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGGUFFile_OpenTensor(t *testing.T) {
+	splits := []GGUFTensorInfos{
+		{
+			{Name: "token_embd.weight", NDimensions: 2, Dimensions: []uint64{64, 10}, Type: GGMLTypeF16},
+			{Name: "blk.0.attn_q.weight", NDimensions: 2, Dimensions: []uint64{64, 64}, Type: GGMLTypeQ8_0},
+		},
+		{
+			{Name: "blk.0.ffn_up.weight", NDimensions: 2, Dimensions: []uint64{64, 32}, Type: GGMLTypeQ4_K},
+			{Name: "output_norm.weight", NDimensions: 1, Dimensions: []uint64{7}, Type: GGMLTypeF32},
+		},
+	}
+
+	// Prepare the split files with random tensor data.
+	var (
+		fs    = make([]_GGUFFileReadSeeker, len(splits))
+		srcs  = make([]io.ReaderAt, len(splits))
+		datas = map[string][]byte{}
+	)
+	rd := rand.New(rand.NewSource(1))
+	for i, tis := range splits {
+		gf := &GGUFFile{
+			Header: GGUFHeader{
+				Magic:   GGUFMagicGGUFLe,
+				Version: GGUFVersionV3,
+				MetadataKV: GGUFMetadataKVs{
+					{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+				},
+			},
+			TensorInfos: tis,
+		}
+		var src []byte
+		for j := range gf.TensorInfos {
+			gf.TensorInfos[j].Offset = uint64(len(src))
+			b := make([]byte, gf.TensorInfos[j].Bytes())
+			_, _ = rd.Read(b)
+			src = append(src, b...)
+			datas[gf.TensorInfos[j].Name] = b
+		}
+
+		var buf bytes.Buffer
+		_, err := NewGGUFWriter(&buf).Write(gf, bytes.NewReader(src))
+		require.NoError(t, err)
+		r := bytes.NewReader(buf.Bytes())
+		fs[i] = _GGUFFileReadSeeker{ReadSeeker: r, Size: r.Size()}
+		srcs[i] = r
+	}
+
+	gf, err := parseGGUFFile(fs, _GGUFReadOptions{})
+	require.NoError(t, err)
+	require.Len(t, gf.TensorInfos, 4)
+
+	for name, expected := range datas {
+		sr, err := gf.OpenTensor(name, srcs...)
+		require.NoError(t, err)
+		actual, err := io.ReadAll(sr)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual, name)
+	}
+
+	_, err = gf.OpenTensor("output.weight", srcs...)
+	assert.Error(t, err)
+	_, err = gf.OpenTensor("output_norm.weight", srcs[0])
+	assert.Error(t, err)
+}
+
+func TestGGUFFile_TensorStatistics(t *testing.T) {
+	f32s := func(vs ...float32) []byte {
+		var b []byte
+		for _, v := range vs {
+			b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+		}
+		return b
+	}
+
+	var (
+		nan = float32(math.NaN())
+		inf = float32(math.Inf(1))
+	)
+	tis := GGUFTensorInfos{
+		{Name: "token_embd.weight", NDimensions: 1, Dimensions: []uint64{4}, Type: GGMLTypeF32},
+		{Name: "blk.0.attn_q.weight", NDimensions: 1, Dimensions: []uint64{4}, Type: GGMLTypeF32},
+		{Name: "blk.0.attn_k.weight", NDimensions: 1, Dimensions: []uint64{4}, Type: GGMLTypeF32},
+		{Name: "blk.0.ffn_up.weight", NDimensions: 1, Dimensions: []uint64{32}, Type: GGMLTypeQ4_0_4_4},
+	}
+	datas := [][]byte{
+		f32s(1, 2, 3, 4),
+		f32s(0, 0, nan, inf),
+		f32s(-2, 2, -2, 2),
+		make([]byte, 18),
+	}
+	var src []byte
+	for i := range tis {
+		tis[i].Offset = uint64(len(src))
+		src = append(src, datas[i]...)
+	}
+	gf := &GGUFFile{
+		Header: GGUFHeader{
+			Magic:   GGUFMagicGGUFLe,
+			Version: GGUFVersionV3,
+			MetadataKV: GGUFMetadataKVs{
+				{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+			},
+		},
+		TensorInfos: tis,
+	}
+
+	var buf bytes.Buffer
+	_, err := NewGGUFWriter(&buf).Write(gf, bytes.NewReader(src))
+	require.NoError(t, err)
+	r := bytes.NewReader(buf.Bytes())
+	gf, err = parseGGUFFile([]_GGUFFileReadSeeker{{ReadSeeker: r, Size: r.Size()}}, _GGUFReadOptions{})
+	require.NoError(t, err)
+
+	actual, err := gf.TensorStatistics(r)
+	require.NoError(t, err)
+
+	assert.Equal(t, []GGUFTensorStatistics{
+		{
+			Name: "token_embd.weight",
+			Type: GGMLTypeF32,
+			GGUFNumericStatistics: GGUFNumericStatistics{
+				Elements: 4, Min: 1, Max: 4, Mean: 2.5, Std: math.Sqrt(1.25),
+				Sparsity: [6]uint64{5: 4},
+			},
+		},
+		{
+			Name: "blk.0.attn_q.weight",
+			Type: GGMLTypeF32,
+			GGUFNumericStatistics: GGUFNumericStatistics{
+				Elements: 4, NaNs: 1, Infs: 1, Zeros: 2,
+			},
+		},
+		{
+			Name: "blk.0.attn_k.weight",
+			Type: GGMLTypeF32,
+			GGUFNumericStatistics: GGUFNumericStatistics{
+				Elements: 4, Min: -2, Max: 2, Std: 2,
+				Sparsity: [6]uint64{5: 4},
+			},
+		},
+		{
+			Name:    "blk.0.ffn_up.weight",
+			Type:    GGMLTypeQ4_0_4_4,
+			Skipped: true,
+		},
+	}, actual.Tensors)
+
+	ls := map[string]GGUFLayerStatistics{}
+	for _, l := range actual.Layers {
+		ls[l.Name] = l
+	}
+	if assert.Contains(t, ls, "blk.0") {
+		l := ls["blk.0"]
+		assert.Equal(t, uint64(2), l.Count)
+		assert.Equal(t, uint64(8), l.Elements)
+		assert.Equal(t, uint64(1), l.NaNs)
+		assert.Equal(t, uint64(1), l.Infs)
+		assert.Equal(t, uint64(2), l.Zeros)
+		assert.Equal(t, [6]uint64{5: 4}, l.Sparsity)
+		assert.Equal(t, float64(-2), l.Min)
+		assert.Equal(t, float64(2), l.Max)
+		assert.InDelta(t, 0, l.Mean, 1e-9)
+		assert.InDelta(t, math.Sqrt(8.0/3), l.Std, 1e-9)
+	}
+	assert.Len(t, ls, 1, "top-level tensors are not grouped")
+}
+
+func TestGGUFFile_TensorStatistics_BigEndian(t *testing.T) {
+	var src []byte
+	for _, v := range []float32{1, -1, 3, -3} {
+		src = binary.BigEndian.AppendUint32(src, math.Float32bits(v))
+	}
+	// Pad to 32 bytes, then a block of Q8_0.
+	src = append(src, make([]byte, 16)...)
+	src = append(src, make([]byte, 34)...)
+	gf := &GGUFFile{
+		Header: GGUFHeader{
+			Magic:   GGUFMagicGGUFBe,
+			Version: GGUFVersionV3,
+			MetadataKV: GGUFMetadataKVs{
+				{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+			},
+		},
+		TensorInfos: GGUFTensorInfos{
+			{Name: "token_embd.weight", NDimensions: 1, Dimensions: []uint64{4}, Type: GGMLTypeF32, Offset: 0},
+			{Name: "output.weight", NDimensions: 1, Dimensions: []uint64{32}, Type: GGMLTypeQ8_0, Offset: 32},
+		},
+	}
+
+	var buf bytes.Buffer
+	_, err := NewGGUFWriter(&buf).Write(gf, bytes.NewReader(src))
+	require.NoError(t, err)
+	r := bytes.NewReader(buf.Bytes())
+	gf, err = parseGGUFFile([]_GGUFFileReadSeeker{{ReadSeeker: r, Size: r.Size()}}, _GGUFReadOptions{})
+	require.NoError(t, err)
+
+	actual, err := gf.TensorStatistics(r)
+	require.NoError(t, err)
+	assert.Equal(t, []GGUFTensorStatistics{
+		{
+			Name: "token_embd.weight",
+			Type: GGMLTypeF32,
+			GGUFNumericStatistics: GGUFNumericStatistics{
+				Elements: 4, Min: -3, Max: 3, Std: math.Sqrt(5),
+				Sparsity: [6]uint64{5: 4},
+			},
+		},
+		{
+			Name:    "output.weight",
+			Type:    GGMLTypeQ8_0,
+			Skipped: true,
+		},
+	}, actual.Tensors)
+}
+
+func TestGGUFNumericAccumulator_Sparsity(t *testing.T) {
+	a, b := newGGUFNumericAccumulator(), newGGUFNumericAccumulator()
+	for _, v := range []float64{0, 1e-9, -1e-8, 5e-7, -3e-5} {
+		a.Add(v)
+	}
+	for _, v := range []float64{0.001, -0.5, 1, -100, math.NaN(), math.Inf(-1)} {
+		b.Add(v)
+	}
+	assert.Equal(t, [6]uint64{1, 2, 1, 0, 0, 0}, a.Statistics().Sparsity)
+	assert.Equal(t, [6]uint64{0, 0, 0, 1, 1, 2}, b.Statistics().Sparsity)
+
+	a.Merge(b)
+	s := a.Statistics()
+	assert.Equal(t, uint64(1), s.Zeros)
+	assert.Equal(t, [6]uint64{1, 2, 1, 1, 1, 2}, s.Sparsity)
+	var n uint64
+	for _, c := range s.Sparsity {
+		n += c
+	}
+	assert.Equal(t, s.Elements-s.NaNs-s.Infs-s.Zeros, n)
+}
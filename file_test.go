@@ -1,12 +1,17 @@
 package gguf_parser
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseGGUFFile(t *testing.T) {
@@ -257,3 +262,224 @@ func TestParseGGUFFileFromOllama(t *testing.T) {
 		})
 	}
 }
+
+func TestGGUFMetadataKVs_Set(t *testing.T) {
+	kvs := GGUFMetadataKVs{
+		{Key: "general.name", ValueType: GGUFMetadataValueTypeString, Value: "foo"},
+	}
+
+	assert.NoError(t, kvs.Set("general.name", GGUFMetadataValueTypeString, "bar"))
+	assert.NoError(t, kvs.Set("general.alignment", GGUFMetadataValueTypeUint32, uint32(64)))
+	assert.NoError(t, kvs.Set("general.tags", GGUFMetadataValueTypeArray, GGUFMetadataKVArrayValue{
+		Type:  GGUFMetadataValueTypeString,
+		Len:   1,
+		Array: []any{"text-generation"},
+	}))
+	assert.Error(t, kvs.Set("general.alignment", GGUFMetadataValueTypeUint32, 64))
+	assert.Error(t, kvs.Set("general.tags", GGUFMetadataValueTypeArray, GGUFMetadataKVArrayValue{
+		Type:  GGUFMetadataValueTypeString,
+		Len:   1,
+		Array: []any{1},
+	}))
+	assert.Error(t, kvs.Set("", GGUFMetadataValueTypeBool, true))
+
+	assert.Len(t, kvs, 3)
+	assert.Equal(t, "bar", kvs[0].ValueString())
+	assert.Equal(t, uint32(64), kvs[1].ValueUint32())
+}
+
+func TestGGUFMetadataKVs_Delete(t *testing.T) {
+	kvs := GGUFMetadataKVs{
+		{Key: "general.name", ValueType: GGUFMetadataValueTypeString, Value: "foo"},
+		{Key: "general.license", ValueType: GGUFMetadataValueTypeString, Value: "mit"},
+	}
+
+	assert.True(t, kvs.Delete("general.name"))
+	assert.False(t, kvs.Delete("general.name"))
+	assert.Equal(t, GGUFMetadataKVs{
+		{Key: "general.license", ValueType: GGUFMetadataValueTypeString, Value: "mit"},
+	}, kvs)
+}
+
+func TestGGUFMetadataKVs_Rename(t *testing.T) {
+	kvs := GGUFMetadataKVs{
+		{Key: "general.name", ValueType: GGUFMetadataValueTypeString, Value: "foo"},
+		{Key: "general.license", ValueType: GGUFMetadataValueTypeString, Value: "mit"},
+	}
+
+	assert.NoError(t, kvs.Rename("general.name", "general.basename"))
+	assert.Error(t, kvs.Rename("general.name", "general.basename"))
+	assert.Error(t, kvs.Rename("general.basename", "general.license"))
+	assert.Equal(t, "general.basename", kvs[0].Key)
+}
+
+func TestParseGGUFFile_Limits(t *testing.T) {
+	gf := &GGUFFile{
+		Header: GGUFHeader{
+			Magic:   GGUFMagicGGUFLe,
+			Version: GGUFVersionV3,
+			MetadataKV: GGUFMetadataKVs{
+				{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+				{Key: "tokenizer.ggml.tokens", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+					Type: GGUFMetadataValueTypeString, Len: 3, Array: []any{"a", "bb", "ccc"},
+				}},
+			},
+		},
+		TensorInfos: GGUFTensorInfos{
+			{Name: "token_embd.weight", NDimensions: 2, Dimensions: []uint64{32, 3}, Type: GGMLTypeF32},
+			{Name: "output.weight", NDimensions: 2, Dimensions: []uint64{32, 3}, Type: GGMLTypeF32},
+		},
+	}
+	var buf bytes.Buffer
+	_, err := NewGGUFWriter(&buf).Write(gf)
+	require.NoError(t, err)
+
+	parse := func(b []byte, opts ...GGUFReadOption) error {
+		var o _GGUFReadOptions
+		for _, opt := range opts {
+			opt(&o)
+		}
+		r := bytes.NewReader(b)
+		_, err := parseGGUFFile([]_GGUFFileReadSeeker{{ReadSeeker: r, Size: r.Size()}}, o)
+		return err
+	}
+
+	assert.NoError(t, parse(buf.Bytes()))
+
+	cases := []struct {
+		name  string
+		opt   GGUFReadOption
+		limit string
+	}{
+		{"string length", UseMaxStringLength(4), "string length"},
+		{"array length", UseMaxArrayLength(2), "array length"},
+		{"tensor count", UseMaxTensorCount(1), "tensor count"},
+		{"metadata bytes", UseMaxMetadataBytes(64), "metadata bytes"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := parse(buf.Bytes(), tc.opt)
+			assert.ErrorIs(t, err, ErrGGUFFileInvalidFormat)
+			var le *GGUFFileLimitError
+			if assert.ErrorAs(t, err, &le) {
+				assert.Equal(t, tc.limit, le.Limit)
+			}
+		})
+	}
+
+	t.Run("forged length", func(t *testing.T) {
+		// The length of the first key "general.architecture" starts at 24.
+		b := bytes.Clone(buf.Bytes())
+		binary.LittleEndian.PutUint64(b[24:], 1<<40)
+		assert.ErrorIs(t, parse(b, UseMaxStringLength(1<<50)), ErrGGUFFileInvalidFormat)
+
+		// The tensor count starts at 8.
+		b = bytes.Clone(buf.Bytes())
+		binary.LittleEndian.PutUint64(b[8:], 1<<40)
+		assert.ErrorIs(t, parse(b, UseMaxTensorCount(1<<50)), ErrGGUFFileInvalidFormat)
+	})
+}
+
+func FuzzParseGGUFFile(f *testing.F) {
+	for _, magic := range []GGUFMagic{GGUFMagicGGUFLe, GGUFMagicGGUFBe} {
+		gf := &GGUFFile{
+			Header: GGUFHeader{
+				Magic:   magic,
+				Version: GGUFVersionV3,
+				MetadataKV: GGUFMetadataKVs{
+					{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+					{Key: "general.alignment", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(32)},
+					{Key: "llama.block_count", ValueType: GGUFMetadataValueTypeUint64, Value: uint64(1)},
+					{Key: "tokenizer.ggml.tokens", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+						Type: GGUFMetadataValueTypeString, Len: 2, Array: []any{"a", "b"},
+					}},
+					{Key: "tokenizer.ggml.nested", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+						Type: GGUFMetadataValueTypeArray, Len: 1, Array: []any{
+							GGUFMetadataKVArrayValue{Type: GGUFMetadataValueTypeFloat32, Len: 1, Array: []any{float32(1)}},
+						},
+					}},
+				},
+			},
+			TensorInfos: GGUFTensorInfos{
+				{Name: "token_embd.weight", NDimensions: 2, Dimensions: []uint64{32, 2}, Type: GGMLTypeQ8_0},
+				{Name: "blk.0.attn_q.weight", NDimensions: 1, Dimensions: []uint64{32}, Type: GGMLTypeF16},
+			},
+		}
+		var buf bytes.Buffer
+		if _, err := NewGGUFWriter(&buf).Write(gf); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes(), false)
+		f.Add(buf.Bytes(), true)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte, skipLargeMetadata bool) {
+		o := _GGUFReadOptions{
+			SkipLargeMetadata: skipLargeMetadata,
+			MaxStringLength:   1 << 16,
+			MaxArrayLength:    1 << 16,
+			MaxTensorCount:    1 << 10,
+			MaxMetadataBytes:  1 << 20,
+		}
+		r := bytes.NewReader(b)
+		gf, err := parseGGUFFile([]_GGUFFileReadSeeker{{ReadSeeker: r, Size: r.Size()}}, o)
+		if err != nil {
+			return
+		}
+		_ = gf.Validate()
+	})
+}
+
+func TestParseGGUFFile_Padding(t *testing.T) {
+	// The header takes 134 bytes plus the length of "general.name",
+	// the tensor data starts at the next multiple of the alignment,
+	// and no padding is needed if the header is already aligned.
+	cases := []struct {
+		name    string
+		value   string
+		padding int64
+		offset  int64
+	}{
+		{
+			name:    "unaligned header",
+			value:   "x",
+			padding: 25,
+			offset:  160,
+		},
+		{
+			name:    "aligned header",
+			value:   strings.Repeat("x", 26),
+			padding: 0,
+			offset:  160,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gf := &GGUFFile{
+				Header: GGUFHeader{
+					Magic:   GGUFMagicGGUFLe,
+					Version: GGUFVersionV3,
+					MetadataKV: GGUFMetadataKVs{
+						{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+						{Key: "general.name", ValueType: GGUFMetadataValueTypeString, Value: tc.value},
+					},
+				},
+				TensorInfos: GGUFTensorInfos{
+					{Name: "w", NDimensions: 1, Dimensions: []uint64{8}, Type: GGMLTypeF32},
+				},
+			}
+			var buf bytes.Buffer
+			_, err := NewGGUFWriter(&buf).Write(gf)
+			require.NoError(t, err)
+
+			r := bytes.NewReader(buf.Bytes())
+			gf, err = parseGGUFFile([]_GGUFFileReadSeeker{{ReadSeeker: r, Size: r.Size()}}, _GGUFReadOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, tc.padding, gf.Padding)
+			assert.Equal(t, []int64{tc.padding}, gf.SplitPaddings)
+			assert.Equal(t, tc.offset, gf.TensorDataStartOffset)
+			assert.Equal(t, []int64{tc.offset}, gf.SplitTensorDataStartOffsets)
+			assert.Equal(t, tc.offset+32, r.Size())
+		})
+	}
+}
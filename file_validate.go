@@ -0,0 +1,366 @@
+package gguf_parser
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// GGUFValidationSeverity is the severity of a GGUFValidationFinding.
+type GGUFValidationSeverity string
+
+// GGUFValidationSeverity constants.
+const (
+	// GGUFValidationSeverityError indicates the file is broken,
+	// which is likely to fail loading.
+	GGUFValidationSeverityError GGUFValidationSeverity = "error"
+	// GGUFValidationSeverityWarning indicates the file is suspicious,
+	// which may still be loaded.
+	GGUFValidationSeverityWarning GGUFValidationSeverity = "warning"
+)
+
+// GGUFValidationCode is the code of a GGUFValidationFinding.
+type GGUFValidationCode string
+
+// GGUFValidationCode constants.
+const (
+	// GGUFValidationCodeAlignmentInvalid indicates the general.alignment is not a power of 2 uint32.
+	GGUFValidationCodeAlignmentInvalid GGUFValidationCode = "alignment-invalid"
+	// GGUFValidationCodeMetadataDuplicated indicates the metadata key is duplicated.
+	GGUFValidationCodeMetadataDuplicated GGUFValidationCode = "metadata-duplicated"
+	// GGUFValidationCodeMetadataMissing indicates the required metadata key is missing.
+	GGUFValidationCodeMetadataMissing GGUFValidationCode = "metadata-missing"
+	// GGUFValidationCodeTensorDuplicated indicates the tensor name is duplicated.
+	GGUFValidationCodeTensorDuplicated GGUFValidationCode = "tensor-duplicated"
+	// GGUFValidationCodeTensorInvalid indicates the tensor type or shape is invalid.
+	GGUFValidationCodeTensorInvalid GGUFValidationCode = "tensor-invalid"
+	// GGUFValidationCodeTensorMisaligned indicates the tensor offset is not aligned to general.alignment.
+	GGUFValidationCodeTensorMisaligned GGUFValidationCode = "tensor-misaligned"
+	// GGUFValidationCodeTensorOutOfBounds indicates the tensor data exceeds the data region of the file.
+	GGUFValidationCodeTensorOutOfBounds GGUFValidationCode = "tensor-out-of-bounds"
+	// GGUFValidationCodeTensorOverlapped indicates the tensor data overlaps with another tensor.
+	GGUFValidationCodeTensorOverlapped GGUFValidationCode = "tensor-overlapped"
+	// GGUFValidationCodeDataSizeMismatched indicates the data region of the file
+	// is not equal to the size computed from the tensor infos.
+	GGUFValidationCodeDataSizeMismatched GGUFValidationCode = "data-size-mismatched"
+	// GGUFValidationCodeTokenizerMismatched indicates the length of the tokenizer array
+	// is not equal to the vocabulary length.
+	GGUFValidationCodeTokenizerMismatched GGUFValidationCode = "tokenizer-mismatched"
+)
+
+// GGUFValidationFinding is a finding of GGUFFile.Validate.
+type GGUFValidationFinding struct {
+	// Code is the code of the finding.
+	Code GGUFValidationCode `json:"code"`
+	// Severity is the severity of the finding.
+	Severity GGUFValidationSeverity `json:"severity"`
+	// Split is the index of the split file where the finding is located.
+	Split int `json:"split"`
+	// Subject is the metadata key or the tensor name of the finding,
+	// empty if the finding is about the whole file.
+	Subject string `json:"subject,omitempty"`
+	// Message describes the finding.
+	Message string `json:"message"`
+}
+
+func (f GGUFValidationFinding) String() string {
+	var sb strings.Builder
+	sb.WriteString(string(f.Severity))
+	sb.WriteString(": ")
+	sb.WriteString(string(f.Code))
+	if f.Subject != "" {
+		sb.WriteString(" [")
+		sb.WriteString(f.Subject)
+		sb.WriteString("]")
+	}
+	sb.WriteString(": ")
+	sb.WriteString(f.Message)
+	return sb.String()
+}
+
+// GGUFValidationFindings is a list of GGUFValidationFinding.
+type GGUFValidationFindings []GGUFValidationFinding
+
+// HasErrors returns true if any finding is an error.
+func (fs GGUFValidationFindings) HasErrors() bool {
+	return slices.ContainsFunc(fs, func(f GGUFValidationFinding) bool {
+		return f.Severity == GGUFValidationSeverityError
+	})
+}
+
+// Validate checks the structure of the GGUF file,
+// and returns the findings, an empty result means the file is valid.
+//
+// Validate works on the parsed GGUFFile without reading the tensor data,
+// the data region of each split file is computed from the file size.
+func (gf *GGUFFile) Validate() GGUFValidationFindings {
+	var fs GGUFValidationFindings
+	add := func(code GGUFValidationCode, sev GGUFValidationSeverity, split int, subject, format string, args ...any) {
+		fs = append(fs, GGUFValidationFinding{
+			Code:     code,
+			Severity: sev,
+			Split:    split,
+			Subject:  subject,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	// Metadata.
+	var align uint64 = 32
+	{
+		split := len(gf.SplitSizes) > 1
+		seen := make(map[string]struct{}, len(gf.Header.MetadataKV))
+		for _, kv := range gf.Header.MetadataKV {
+			// The split files repeat the split.* keys.
+			if split && strings.HasPrefix(kv.Key, "split.") {
+				continue
+			}
+			if _, ok := seen[kv.Key]; ok {
+				add(GGUFValidationCodeMetadataDuplicated, GGUFValidationSeverityError, 0, kv.Key,
+					"duplicated metadata key")
+				continue
+			}
+			seen[kv.Key] = struct{}{}
+		}
+
+		if kv, ok := gf.Header.MetadataKV.Get("general.alignment"); ok {
+			switch {
+			case kv.ValueType != GGUFMetadataValueTypeUint32:
+				add(GGUFValidationCodeAlignmentInvalid, GGUFValidationSeverityError, 0, kv.Key,
+					"want uint32, got %s", kv.ValueType)
+			case kv.ValueUint32() == 0 || kv.ValueUint32()&(kv.ValueUint32()-1) != 0:
+				add(GGUFValidationCodeAlignmentInvalid, GGUFValidationSeverityError, 0, kv.Key,
+					"want a power of 2, got %d", kv.ValueUint32())
+			default:
+				align = uint64(kv.ValueUint32())
+			}
+		}
+
+		fs = append(fs, gf.validateRequiredMetadata()...)
+	}
+	if gf.Legacy {
+		// The legacy file aligns the tensor data to the start of the file, if any.
+		align = 1
+	}
+
+	// Tensor infos.
+	valids := make([]bool, len(gf.TensorInfos))
+	{
+		seen := make(map[string]struct{}, len(gf.TensorInfos))
+		for i, ti := range gf.TensorInfos {
+			if _, ok := seen[ti.Name]; ok {
+				add(GGUFValidationCodeTensorDuplicated, GGUFValidationSeverityError, 0, ti.Name,
+					"duplicated tensor name")
+			}
+			seen[ti.Name] = struct{}{}
+
+			tt, ok := ti.Type.Trait()
+			switch {
+			case !ok:
+				add(GGUFValidationCodeTensorInvalid, GGUFValidationSeverityError, 0, ti.Name,
+					"unknown type %d", uint32(ti.Type))
+			case ti.NDimensions != uint32(len(ti.Dimensions)):
+				add(GGUFValidationCodeTensorInvalid, GGUFValidationSeverityError, 0, ti.Name,
+					"want %d dimensions, got %d", ti.NDimensions, len(ti.Dimensions))
+			case ti.NDimensions != 0 && ti.Dimensions[0]%tt.BlockSize != 0:
+				add(GGUFValidationCodeTensorInvalid, GGUFValidationSeverityError, 0, ti.Name,
+					"first dimension %d is not a multiple of the block size %d of %s",
+					ti.Dimensions[0], tt.BlockSize, ti.Type)
+			default:
+				valids[i] = true
+			}
+		}
+	}
+
+	// Tensor data.
+	sidxs, err := gf.tensorInfoSplitIndexes()
+	if err != nil {
+		add(GGUFValidationCodeTensorOutOfBounds, GGUFValidationSeverityError, 0, "",
+			"cannot locate tensors: %v", err)
+	} else {
+		type span struct {
+			name       string
+			start, end uint64
+		}
+		spans := make([][]span, max(len(gf.SplitTensorDataStartOffsets), 1))
+		for i, ti := range gf.TensorInfos {
+			if !valids[i] {
+				continue
+			}
+			s := sidxs[i]
+			if ti.Offset%align != 0 {
+				add(GGUFValidationCodeTensorMisaligned, GGUFValidationSeverityError, s, ti.Name,
+					"offset %d is not aligned to %d", ti.Offset, align)
+			}
+			spans[s] = append(spans[s], span{name: ti.Name, start: ti.Offset, end: ti.Offset + ti.Bytes()})
+		}
+
+		for s := range spans {
+			slices.SortStableFunc(spans[s], func(a, b span) int {
+				switch {
+				case a.start < b.start:
+					return -1
+				case a.start > b.start:
+					return 1
+				}
+				return 0
+			})
+
+			var last span
+			for _, sp := range spans[s] {
+				if sp.start < last.end {
+					add(GGUFValidationCodeTensorOverlapped, GGUFValidationSeverityError, s, sp.name,
+						"data [%d, %d) overlaps with tensor %q [%d, %d)", sp.start, sp.end, last.name, last.start, last.end)
+				}
+				if sp.end > last.end {
+					last = sp
+				}
+			}
+
+			// Data region.
+			size, start := int64(gf.Size), gf.TensorDataStartOffset
+			if len(gf.SplitSizes) > s && len(gf.SplitTensorDataStartOffsets) > s {
+				size, start = int64(gf.SplitSizes[s]), gf.SplitTensorDataStartOffsets[s]
+			}
+			if size == 0 {
+				// Not parsed from a file.
+				continue
+			}
+			region := uint64(max(size-start, 0))
+			for _, sp := range spans[s] {
+				if sp.end > region {
+					add(GGUFValidationCodeTensorOutOfBounds, GGUFValidationSeverityError, s, sp.name,
+						"data [%d, %d) exceeds the data region size %d", sp.start, sp.end, region)
+				}
+			}
+			// The last tensor may be padded or not.
+			if region < last.end {
+				add(GGUFValidationCodeDataSizeMismatched, GGUFValidationSeverityError, s, "",
+					"data region size %d is less than the tensors size %d", region, last.end)
+			} else if pe := GGMLPadding(last.end, align); region > pe {
+				add(GGUFValidationCodeDataSizeMismatched, GGUFValidationSeverityWarning, s, "",
+					"data region size %d is greater than the tensors size %d, %d bytes trailing", region, pe, region-pe)
+			}
+		}
+	}
+
+	// Tokenizer.
+	fs = append(fs, gf.validateTokenizer()...)
+
+	return fs
+}
+
+// validateRequiredMetadata checks the required metadata keys of the transformer model.
+func (gf *GGUFFile) validateRequiredMetadata() (fs GGUFValidationFindings) {
+	if gf.TensorInfos.Match(regexp.MustCompile(`^model\.diffusion_model\..*`)) ||
+		gf.TensorInfos.Match(regexp.MustCompile(`^double_blocks\..*`)) {
+		return nil
+	}
+
+	missing := func(key string) GGUFValidationFinding {
+		return GGUFValidationFinding{
+			Code:     GGUFValidationCodeMetadataMissing,
+			Severity: GGUFValidationSeverityError,
+			Subject:  key,
+			Message:  "required metadata key is missing",
+		}
+	}
+
+	kv, ok := gf.Header.MetadataKV.Get("general.architecture")
+	if !ok {
+		return append(fs, missing("general.architecture"))
+	}
+	if kv.ValueType != GGUFMetadataValueTypeString {
+		return nil
+	}
+	arch := kv.ValueString()
+	if arch == "clip" || arch == "controlvector" {
+		return nil
+	}
+	if v, ok := gf.Header.MetadataKV.Get("general.type"); ok &&
+		v.ValueType == GGUFMetadataValueTypeString && v.ValueString() == "adapter" {
+		return nil
+	}
+
+	keys := []string{
+		arch + ".context_length",
+		arch + ".embedding_length",
+		arch + ".block_count",
+	}
+	m, _ := gf.Header.MetadataKV.Index(keys)
+	for _, k := range keys {
+		if _, ok := m[k]; !ok {
+			fs = append(fs, missing(k))
+		}
+	}
+	return fs
+}
+
+// validateTokenizer checks the length of the tokenizer arrays against the vocabulary length.
+func (gf *GGUFFile) validateTokenizer() (fs GGUFValidationFindings) {
+	const (
+		tokensKey    = "tokenizer.ggml.tokens"
+		scoresKey    = "tokenizer.ggml.scores"
+		tokenTypeKey = "tokenizer.ggml.token_type"
+	)
+
+	kv, ok := gf.Header.MetadataKV.Get("general.architecture")
+	if !ok || kv.ValueType != GGUFMetadataValueTypeString {
+		return nil
+	}
+	vocabularyLengthKey := kv.ValueString() + ".vocab_size"
+
+	m, _ := gf.Header.MetadataKV.Index([]string{
+		vocabularyLengthKey,
+		tokensKey,
+		scoresKey,
+		tokenTypeKey,
+	})
+
+	var (
+		vl  uint64
+		vlk string
+	)
+	if v, ok := m[vocabularyLengthKey]; ok && isGGUFMetadataValueTypeNumeric(v.ValueType) {
+		vl, vlk = ValueNumeric[uint64](v), vocabularyLengthKey
+	} else if v, ok := m[tokensKey]; ok && v.ValueType == GGUFMetadataValueTypeArray {
+		vl, vlk = v.ValueArray().Len, tokensKey
+	} else {
+		return nil
+	}
+
+	for _, k := range []string{tokensKey, scoresKey, tokenTypeKey} {
+		v, ok := m[k]
+		if !ok || k == vlk {
+			continue
+		}
+		if v.ValueType != GGUFMetadataValueTypeArray {
+			fs = append(fs, GGUFValidationFinding{
+				Code:     GGUFValidationCodeTokenizerMismatched,
+				Severity: GGUFValidationSeverityError,
+				Subject:  k,
+				Message:  fmt.Sprintf("want array, got %s", v.ValueType),
+			})
+			continue
+		}
+		if l := v.ValueArray().Len; l != vl {
+			fs = append(fs, GGUFValidationFinding{
+				Code:     GGUFValidationCodeTokenizerMismatched,
+				Severity: GGUFValidationSeverityError,
+				Subject:  k,
+				Message:  fmt.Sprintf("array length %d mismatches the vocabulary length %d of %s", l, vl, vlk),
+			})
+		}
+	}
+	return fs
+}
+
+// isGGUFMetadataValueTypeNumeric returns true if the given type is numeric.
+func isGGUFMetadataValueTypeNumeric(vt GGUFMetadataValueType) bool {
+	switch vt {
+	case GGUFMetadataValueTypeBool, GGUFMetadataValueTypeString, GGUFMetadataValueTypeArray:
+		return false
+	}
+	return vt < _GGUFMetadataValueTypeCount
+}
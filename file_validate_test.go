@@ -0,0 +1,127 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGGUFFile_Validate(t *testing.T) {
+	newGGUFFile := func() *GGUFFile {
+		return &GGUFFile{
+			Header: GGUFHeader{
+				Magic:   GGUFMagicGGUFLe,
+				Version: GGUFVersionV3,
+				MetadataKV: GGUFMetadataKVs{
+					{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+					{Key: "llama.context_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(128)},
+					{Key: "llama.embedding_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(64)},
+					{Key: "llama.block_count", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1)},
+					{Key: "tokenizer.ggml.tokens", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+						Type: GGUFMetadataValueTypeString, Len: 3, Array: []any{"a", "b", "c"},
+					}},
+					{Key: "tokenizer.ggml.scores", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+						Type: GGUFMetadataValueTypeFloat32, Len: 3, Array: []any{float32(0), float32(0), float32(0)},
+					}},
+				},
+			},
+			TensorInfos: GGUFTensorInfos{
+				{Name: "token_embd.weight", NDimensions: 2, Dimensions: []uint64{64, 3}, Type: GGMLTypeF16},
+				{Name: "blk.0.attn_q.weight", NDimensions: 2, Dimensions: []uint64{64, 64}, Type: GGMLTypeQ8_0},
+				{Name: "output_norm.weight", NDimensions: 1, Dimensions: []uint64{64}, Type: GGMLTypeF32},
+			},
+		}
+	}
+	parse := func(t *testing.T, gf *GGUFFile) (*GGUFFile, []byte) {
+		var buf bytes.Buffer
+		_, err := NewGGUFWriter(&buf).Write(gf)
+		require.NoError(t, err)
+		r := bytes.NewReader(buf.Bytes())
+		gf, err = parseGGUFFile([]_GGUFFileReadSeeker{{ReadSeeker: r, Size: r.Size()}}, _GGUFReadOptions{})
+		require.NoError(t, err)
+		return gf, buf.Bytes()
+	}
+	codes := func(fs GGUFValidationFindings) (r []GGUFValidationCode) {
+		for _, f := range fs {
+			r = append(r, f.Code)
+		}
+		return r
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		gf, _ := parse(t, newGGUFFile())
+		fs := gf.Validate()
+		assert.Empty(t, fs)
+		assert.False(t, fs.HasErrors())
+	})
+
+	t.Run("tensor data", func(t *testing.T) {
+		gf, bs := parse(t, newGGUFFile())
+		gf.TensorInfos[1].Offset -= 32
+		gf.TensorInfos[2].Offset -= 4
+		fs := gf.Validate()
+		assert.ElementsMatch(t, []GGUFValidationCode{
+			GGUFValidationCodeTensorOverlapped,
+			GGUFValidationCodeTensorMisaligned,
+		}, codes(fs))
+
+		gf, _ = parse(t, newGGUFFile())
+		gf.Size = GGUFBytesScalar(len(bs) - 64)
+		gf.SplitSizes = []GGUFBytesScalar{gf.Size}
+		fs = gf.Validate()
+		assert.ElementsMatch(t, []GGUFValidationCode{
+			GGUFValidationCodeTensorOutOfBounds,
+			GGUFValidationCodeDataSizeMismatched,
+		}, codes(fs))
+		assert.True(t, fs.HasErrors())
+
+		gf.Size = GGUFBytesScalar(len(bs) + 64)
+		gf.SplitSizes = []GGUFBytesScalar{gf.Size}
+		fs = gf.Validate()
+		assert.Equal(t, []GGUFValidationCode{GGUFValidationCodeDataSizeMismatched}, codes(fs))
+		assert.False(t, fs.HasErrors())
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		gf, _ := parse(t, newGGUFFile())
+		gf.Header.MetadataKV = append(gf.Header.MetadataKV[:3:3],
+			GGUFMetadataKV{Key: "llama.context_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(256)},
+			GGUFMetadataKV{Key: "general.alignment", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(48)})
+		gf.TensorInfos = append(gf.TensorInfos, gf.TensorInfos[2])
+		fs := gf.Validate()
+		assert.ElementsMatch(t, []GGUFValidationCode{
+			GGUFValidationCodeMetadataDuplicated,
+			GGUFValidationCodeAlignmentInvalid,
+			GGUFValidationCodeMetadataMissing,
+			GGUFValidationCodeTensorDuplicated,
+			GGUFValidationCodeTensorOverlapped,
+		}, codes(fs))
+		for _, f := range fs {
+			if f.Code == GGUFValidationCodeMetadataMissing {
+				assert.Equal(t, "llama.block_count", f.Subject)
+			}
+		}
+	})
+
+	t.Run("tokenizer", func(t *testing.T) {
+		gf, _ := parse(t, newGGUFFile())
+		gf.Header.MetadataKV = append(gf.Header.MetadataKV,
+			GGUFMetadataKV{Key: "llama.vocab_size", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(4)})
+		fs := gf.Validate()
+		assert.Equal(t, []GGUFValidationCode{
+			GGUFValidationCodeTokenizerMismatched,
+			GGUFValidationCodeTokenizerMismatched,
+		}, codes(fs))
+
+		gf, _ = parse(t, newGGUFFile())
+		gf.Header.MetadataKV[5].Value = GGUFMetadataKVArrayValue{
+			Type: GGUFMetadataValueTypeFloat32, Len: 2, Array: []any{float32(0), float32(0)},
+		}
+		fs = gf.Validate()
+		if assert.Len(t, fs, 1) {
+			assert.Equal(t, "tokenizer.ggml.scores", fs[0].Subject)
+		}
+	})
+}
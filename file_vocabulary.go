@@ -0,0 +1,544 @@
+package gguf_parser
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// GGUFTokenType is the type of a token,
+// which is the value of "tokenizer.ggml.token_type".
+type GGUFTokenType int32
+
+// GGUFTokenType constants.
+const (
+	GGUFTokenTypeUndefined GGUFTokenType = iota
+	GGUFTokenTypeNormal
+	GGUFTokenTypeUnknown
+	GGUFTokenTypeControl
+	GGUFTokenTypeUserDefined
+	GGUFTokenTypeUnused
+	GGUFTokenTypeByte
+)
+
+// GGUFVocabularyToken is a token of the vocabulary.
+type GGUFVocabularyToken struct {
+	// Text is the text of the token.
+	Text string `json:"text"`
+	// Score is the score of the token,
+	// which is used by the SentencePiece and Unigram tokenizers.
+	Score float32 `json:"score"`
+	// Type is the type of the token.
+	Type GGUFTokenType `json:"type"`
+}
+
+// GGUFVocabulary is the full vocabulary of a GGUF file,
+// which encodes the text into tokens and decodes the tokens into text as llama.cpp does.
+//
+// The supported tokenizer models are:
+//   - "llama", the SentencePiece BPE tokenizer,
+//   - "gpt2", the byte-level BPE tokenizer,
+//   - "bert", the WordPiece tokenizer,
+//   - "t5", the Unigram tokenizer.
+type GGUFVocabulary struct {
+	// Model is the model of the tokenizer.
+	Model string `json:"model"`
+	// Pre is the pre-tokenizer of the byte-level BPE tokenizer.
+	Pre string `json:"pre,omitempty"`
+	// Tokens are the tokens of the vocabulary, indexed by the token ID.
+	Tokens []GGUFVocabularyToken `json:"tokens"`
+	// Merges are the merges of the byte-level BPE tokenizer, in priority order.
+	Merges []string `json:"merges,omitempty"`
+	// BOSTokenID is the ID of the beginning of sentence token.
+	//
+	// Use -1 if the token is not found.
+	BOSTokenID int64 `json:"bosTokenID"`
+	// EOSTokenID is the ID of the end of sentence token.
+	//
+	// Use -1 if the token is not found.
+	EOSTokenID int64 `json:"eosTokenID"`
+	// UnknownTokenID is the ID of the unknown token.
+	//
+	// Use -1 if the token is not found.
+	UnknownTokenID int64 `json:"unknownTokenID"`
+	// SeparatorTokenID is the ID of the separator token.
+	//
+	// Use -1 if the token is not found.
+	SeparatorTokenID int64 `json:"separatorTokenID"`
+	// PaddingTokenID is the ID of the padding token.
+	//
+	// Use -1 if the token is not found.
+	PaddingTokenID int64 `json:"paddingTokenID"`
+	// AddBOS is true if the BOS token is added to the encoding with special tokens.
+	AddBOS bool `json:"addBOS"`
+	// AddEOS is true if the EOS token is added to the encoding with special tokens.
+	AddEOS bool `json:"addEOS"`
+	// AddSEP is true if the separator token is added to the encoding with special tokens.
+	AddSEP bool `json:"addSEP"`
+	// AddSpacePrefix is true if a space is prepended to the text before encoding.
+	AddSpacePrefix bool `json:"addSpacePrefix"`
+	// RemoveExtraWhitespaces is true if the consecutive whitespaces are merged before encoding,
+	// which is used by the Unigram tokenizer.
+	RemoveExtraWhitespaces bool `json:"removeExtraWhitespaces"`
+	// CleanSpaces is true if the spaces before the punctuations and contractions are removed after decoding,
+	// which is used by the byte-level BPE and WordPiece tokenizers.
+	CleanSpaces bool `json:"cleanSpaces"`
+
+	textToID map[string]int64
+	// specials are the IDs of the control, user-defined and unknown tokens,
+	// sorted by the length of the text in descending order.
+	specials []int64
+	// maxTokenLen is the max length of the token texts in bytes.
+	maxTokenLen int
+
+	bpe *_GGUFVocabularyBPE
+	ugm *_GGUFVocabularyUGM
+}
+
+// Vocabulary loads the full vocabulary of the GGUF file.
+//
+// The GGUF file must be parsed without SkipLargeMetadata,
+// otherwise the tokens are not available.
+func (gf *GGUFFile) Vocabulary() (*GGUFVocabulary, error) {
+	const (
+		modelKey                  = "tokenizer.ggml.model"
+		preKey                    = "tokenizer.ggml.pre"
+		tokensKey                 = "tokenizer.ggml.tokens"
+		scoresKey                 = "tokenizer.ggml.scores"
+		tokenTypeKey              = "tokenizer.ggml.token_type"
+		mergesKey                 = "tokenizer.ggml.merges"
+		addBOSKey                 = "tokenizer.ggml.add_bos_token"
+		addEOSKey                 = "tokenizer.ggml.add_eos_token"
+		addSEPKey                 = "tokenizer.ggml.add_sep_token"
+		addSpacePrefixKey         = "tokenizer.ggml.add_space_prefix"
+		removeExtraWhitespacesKey = "tokenizer.ggml.remove_extra_whitespaces"
+		precompiledCharsmapKey    = "tokenizer.ggml.precompiled_charsmap"
+		// The misspelled key is what llama.cpp reads and convert_hf_to_gguf.py writes.
+		seperatorTokenIDKey = "tokenizer.ggml.seperator_token_id"
+	)
+
+	m, _ := gf.Header.MetadataKV.Index([]string{
+		modelKey,
+		preKey,
+		tokensKey,
+		scoresKey,
+		tokenTypeKey,
+		mergesKey,
+		addBOSKey,
+		addEOSKey,
+		addSEPKey,
+		addSpacePrefixKey,
+		removeExtraWhitespacesKey,
+		precompiledCharsmapKey,
+		seperatorTokenIDKey,
+	})
+
+	kv, ok := m[modelKey]
+	if !ok || kv.ValueType != GGUFMetadataValueTypeString {
+		return nil, errors.New("tokenizer model not found")
+	}
+	v := &GGUFVocabulary{Model: kv.ValueString()}
+
+	// Defaults of the special tokens and flags.
+	gt := gf.Tokenizer()
+	v.BOSTokenID, v.EOSTokenID, v.UnknownTokenID, v.SeparatorTokenID, v.PaddingTokenID = -1, -1, -1, -1, -1
+	switch v.Model {
+	case "llama":
+		v.BOSTokenID, v.EOSTokenID, v.UnknownTokenID = 1, 2, 0
+		v.AddBOS, v.AddSpacePrefix = true, true
+	case "gpt2":
+		v.BOSTokenID, v.EOSTokenID = 11, 11
+		v.CleanSpaces = true
+		if kv, ok := m[preKey]; ok && kv.ValueType == GGUFMetadataValueTypeString {
+			v.Pre = kv.ValueString()
+		}
+		switch v.Pre {
+		case "llama3", "llama-v3", "llama-bpe", "falcon3":
+			v.AddBOS = true
+		case "tekken", "chameleon":
+			v.AddBOS, v.CleanSpaces = true, false
+		case "chatglm-bpe":
+			v.BOSTokenID = -1
+		case "deepseek-llm", "deepseek-coder", "deepseek-v3", "command-r", "qwen2", "deepseek-r1-qwen",
+			"poro-chat", "viking", "smollm", "gpt-4o":
+			v.CleanSpaces = false
+		}
+	case "bert":
+		v.BOSTokenID, v.UnknownTokenID, v.SeparatorTokenID, v.PaddingTokenID = 101, 100, 102, 0
+		v.AddBOS, v.AddSEP, v.CleanSpaces = true, true, true
+	case "t5":
+		v.EOSTokenID, v.UnknownTokenID, v.PaddingTokenID = 1, 2, 0
+		v.AddEOS = true
+	default:
+		return nil, fmt.Errorf("unsupported tokenizer model %q", v.Model)
+	}
+	for _, p := range []struct {
+		id  *int64
+		gid int64
+	}{
+		{&v.BOSTokenID, gt.BOSTokenID},
+		{&v.EOSTokenID, gt.EOSTokenID},
+		{&v.UnknownTokenID, gt.UnknownTokenID},
+		{&v.SeparatorTokenID, gt.SeparatorTokenID},
+		{&v.PaddingTokenID, gt.PaddingTokenID},
+	} {
+		if p.gid >= 0 {
+			*p.id = p.gid
+		}
+	}
+	if kv, ok := m[seperatorTokenIDKey]; ok {
+		v.SeparatorTokenID = ValueNumeric[int64](kv)
+	}
+	for _, p := range []struct {
+		key string
+		b   *bool
+	}{
+		{addBOSKey, &v.AddBOS},
+		{addEOSKey, &v.AddEOS},
+		{addSEPKey, &v.AddSEP},
+		{addSpacePrefixKey, &v.AddSpacePrefix},
+		{removeExtraWhitespacesKey, &v.RemoveExtraWhitespaces},
+	} {
+		if kv, ok := m[p.key]; ok && kv.ValueType == GGUFMetadataValueTypeBool {
+			*p.b = kv.ValueBool()
+		}
+	}
+
+	// Arrays.
+	array := func(key string, required bool) (GGUFMetadataKVArrayValue, bool, error) {
+		kv, ok := m[key]
+		if !ok {
+			if required {
+				return GGUFMetadataKVArrayValue{}, false, fmt.Errorf("%s not found", key)
+			}
+			return GGUFMetadataKVArrayValue{}, false, nil
+		}
+		if kv.ValueType != GGUFMetadataValueTypeArray {
+			return GGUFMetadataKVArrayValue{}, false, fmt.Errorf("%s is not an array", key)
+		}
+		av := kv.ValueArray()
+		if uint64(len(av.Array)) != av.Len {
+			return GGUFMetadataKVArrayValue{}, false, fmt.Errorf("%s is skipped, parse without SkipLargeMetadata", key)
+		}
+		return av, true, nil
+	}
+	tokens, _, err := array(tokensKey, true)
+	if err != nil {
+		return nil, err
+	}
+	if tokens.Type != GGUFMetadataValueTypeString || tokens.Len == 0 {
+		return nil, fmt.Errorf("invalid %s", tokensKey)
+	}
+	texts := tokens.ValuesString()
+	v.Tokens = make([]GGUFVocabularyToken, len(texts))
+	for i := range texts {
+		v.Tokens[i] = GGUFVocabularyToken{Text: texts[i], Type: GGUFTokenTypeNormal}
+	}
+	scores, ok, err := array(scoresKey, false)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if scores.Len != tokens.Len {
+			return nil, fmt.Errorf("mismatched %s length", scoresKey)
+		}
+		for i, s := range ValuesNumeric[float32](scores) {
+			v.Tokens[i].Score = s
+		}
+	}
+	types, ok, err := array(tokenTypeKey, false)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if types.Len != tokens.Len {
+			return nil, fmt.Errorf("mismatched %s length", tokenTypeKey)
+		}
+		for i, t := range ValuesNumeric[int32](types) {
+			if t != int32(GGUFTokenTypeUndefined) {
+				v.Tokens[i].Type = GGUFTokenType(t)
+			}
+		}
+	}
+
+	// Indexes.
+	v.textToID = make(map[string]int64, len(v.Tokens))
+	for i := range v.Tokens {
+		t := v.Tokens[i]
+		v.textToID[t.Text] = int64(i)
+		v.maxTokenLen = max(v.maxTokenLen, len(t.Text))
+		switch t.Type {
+		case GGUFTokenTypeControl, GGUFTokenTypeUserDefined, GGUFTokenTypeUnknown:
+			v.specials = append(v.specials, int64(i))
+		}
+	}
+	slices.SortStableFunc(v.specials, func(a, b int64) int {
+		return len(v.Tokens[b].Text) - len(v.Tokens[a].Text)
+	})
+	for _, id := range []*int64{&v.BOSTokenID, &v.EOSTokenID, &v.UnknownTokenID, &v.SeparatorTokenID, &v.PaddingTokenID} {
+		if *id >= int64(len(v.Tokens)) {
+			*id = -1
+		}
+	}
+
+	// Model specific.
+	switch v.Model {
+	case "gpt2":
+		merges, _, err := array(mergesKey, true)
+		if err != nil {
+			return nil, err
+		}
+		v.Merges = merges.ValuesString()
+		if v.bpe, err = newGGUFVocabularyBPE(v.Pre, v.Merges); err != nil {
+			return nil, err
+		}
+	case "t5":
+		var charsmap []byte
+		cm, ok, err := array(precompiledCharsmapKey, false)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			charsmap = ValuesNumeric[byte](cm)
+		}
+		if v.ugm, err = newGGUFVocabularyUGM(v.Tokens, charsmap); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// Encode encodes the given text into tokens as llama_tokenize of llama.cpp does,
+// the BOS/EOS/SEP tokens are added if addSpecial is true and the vocabulary requires,
+// and the control tokens inside the text are parsed if parseSpecial is true.
+//
+// The user-defined tokens inside the text are always parsed.
+func (v *GGUFVocabulary) Encode(text string, addSpecial, parseSpecial bool) []int64 {
+	var out []int64
+	if addSpecial && v.AddBOS && v.BOSTokenID >= 0 {
+		out = append(out, v.BOSTokenID)
+	}
+
+	isPrevSpecial := true
+	for _, f := range v.partition(text, parseSpecial) {
+		if f.id >= 0 {
+			out = append(out, f.id)
+			isPrevSpecial = true
+			continue
+		}
+		switch v.Model {
+		case "llama":
+			s := f.text
+			if v.AddSpacePrefix && isPrevSpecial {
+				s = " " + s
+			}
+			out = v.encodeSPM(strings.ReplaceAll(s, " ", "▁"), out)
+		case "gpt2":
+			out = v.encodeBPE(f.text, out)
+		case "bert":
+			out = v.encodeWPM(f.text, out)
+		case "t5":
+			out = v.encodeUGM(f.text, out)
+		}
+		isPrevSpecial = false
+	}
+
+	if addSpecial && v.AddSEP && v.SeparatorTokenID >= 0 {
+		out = append(out, v.SeparatorTokenID)
+	}
+	if addSpecial && v.AddEOS && v.EOSTokenID >= 0 {
+		out = append(out, v.EOSTokenID)
+	}
+	return out
+}
+
+// Decode decodes the given tokens into text as llama_detokenize of llama.cpp does,
+// the leading BOS token and the trailing EOS token are removed if removeSpecial is true,
+// and the control tokens are rendered if unparseSpecial is true.
+func (v *GGUFVocabulary) Decode(tokens []int64, removeSpecial, unparseSpecial bool) (string, error) {
+	removeSpace := v.AddSpacePrefix
+	if removeSpecial && v.AddBOS && len(tokens) > 0 && tokens[0] == v.BOSTokenID {
+		removeSpace = false
+		tokens = tokens[1:]
+	}
+	if removeSpecial && v.AddEOS && len(tokens) > 0 && tokens[len(tokens)-1] == v.EOSTokenID {
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	var sb strings.Builder
+	for _, id := range tokens {
+		if id < 0 || id >= int64(len(v.Tokens)) {
+			return "", fmt.Errorf("token ID %d out of range", id)
+		}
+		p := v.piece(id, unparseSpecial)
+		if removeSpace {
+			p = strings.TrimPrefix(p, " ")
+		}
+		removeSpace = false
+		sb.WriteString(p)
+	}
+	if !v.CleanSpaces {
+		return sb.String(), nil
+	}
+	return cleanSpaces(sb.String()), nil
+}
+
+// cleanSpaces removes the spaces before the punctuations and contractions as llama.cpp does,
+// e.g. " ," to ",", " ' " to "'", and " 's" to "'s",
+// but keeps the spaces before "'t", "'d" and "'ll".
+func cleanSpaces(s string) string {
+	b := []byte(s)
+	if len(b) == 0 {
+		return s
+	}
+
+	// Punctuations.
+	n := 1
+	for i := 1; i < len(b); i++ {
+		x := b[i]
+		if b[i-1] == ' ' && (x == '?' || x == '!' || x == '.' || x == ',') {
+			n--
+		}
+		b[n] = x
+		n++
+	}
+	b = b[:n]
+
+	// Single apostrophes between spaces.
+	n = 1
+	for i := 1; i < len(b); i++ {
+		x := b[i]
+		if x == '\'' && i+1 < len(b) && b[i-1] == ' ' && b[i+1] == ' ' {
+			n--
+			i++
+			b[i] = 0
+		}
+		b[n] = x
+		n++
+	}
+	b = b[:n]
+
+	// Contractions.
+	n = 1
+	for i := 1; i < len(b); i++ {
+		x := b[i]
+		if b[i-1] == ' ' && x == '\'' && i+1 < len(b) {
+			switch x1 := b[i+1]; {
+			case x1 == 's' || x1 == 'm':
+				n--
+			case i+2 < len(b) && (x1 == 'r' || x1 == 'v') && b[i+2] == 'e':
+				n--
+			}
+		}
+		b[n] = x
+		n++
+	}
+	return string(b[:n])
+}
+
+// TokenID returns the ID of the token with the given text,
+// and true if found, and false otherwise.
+func (v *GGUFVocabulary) TokenID(text string) (int64, bool) {
+	id, ok := v.textToID[text]
+	return id, ok
+}
+
+// piece returns the text piece of the given token.
+func (v *GGUFVocabulary) piece(id int64, special bool) string {
+	t := v.Tokens[id]
+	switch t.Type {
+	case GGUFTokenTypeControl, GGUFTokenTypeUnknown:
+		if !special {
+			return ""
+		}
+		return t.Text
+	case GGUFTokenTypeUserDefined:
+		return t.Text
+	case GGUFTokenTypeNormal:
+		if v.Model == "gpt2" {
+			return decodeByteLevel(t.Text)
+		}
+		return strings.ReplaceAll(t.Text, "▁", " ")
+	case GGUFTokenTypeByte:
+		if v.Model != "gpt2" {
+			if b, ok := parseByteToken(t.Text); ok {
+				return string([]byte{b})
+			}
+		}
+	}
+	return ""
+}
+
+// parseByteToken parses the byte token in the form of "<0xXX>".
+func parseByteToken(s string) (byte, bool) {
+	if len(s) != 6 || !strings.HasPrefix(s, "<0x") || s[5] != '>' {
+		return 0, false
+	}
+	var b byte
+	for _, c := range s[3:5] {
+		b <<= 4
+		switch {
+		case '0' <= c && c <= '9':
+			b |= byte(c - '0')
+		case 'A' <= c && c <= 'F':
+			b |= byte(c - 'A' + 10)
+		case 'a' <= c && c <= 'f':
+			b |= byte(c - 'a' + 10)
+		default:
+			return 0, false
+		}
+	}
+	return b, true
+}
+
+// _GGUFVocabularyFragment is a fragment of the text,
+// which is either a raw text or a special token.
+type _GGUFVocabularyFragment struct {
+	text string
+	// id is the ID of the special token, or -1 for the raw text.
+	id int64
+}
+
+// partition splits the given text by the special tokens as llama.cpp does,
+// the longer special tokens are matched first.
+func (v *GGUFVocabulary) partition(text string, parseSpecial bool) []_GGUFVocabularyFragment {
+	frags := []_GGUFVocabularyFragment{{text: text, id: -1}}
+	for _, id := range v.specials {
+		t := v.Tokens[id]
+		if t.Text == "" || !parseSpecial && (t.Type == GGUFTokenTypeControl || t.Type == GGUFTokenTypeUnknown) {
+			continue
+		}
+		var nfrags []_GGUFVocabularyFragment
+		for _, f := range frags {
+			if f.id >= 0 {
+				nfrags = append(nfrags, f)
+				continue
+			}
+			s := f.text
+			for {
+				i := strings.Index(s, t.Text)
+				if i < 0 {
+					break
+				}
+				if i > 0 {
+					nfrags = append(nfrags, _GGUFVocabularyFragment{text: s[:i], id: -1})
+				}
+				nfrags = append(nfrags, _GGUFVocabularyFragment{id: id})
+				s = s[i+len(t.Text):]
+			}
+			if s != "" {
+				nfrags = append(nfrags, _GGUFVocabularyFragment{text: s, id: -1})
+			}
+		}
+		frags = nfrags
+	}
+	return frags
+}
+
+// utf8Len returns the length of the UTF-8 sequence by the given leading byte as llama.cpp does,
+// which returns 1 for the invalid leading bytes.
+func utf8Len(b byte) int {
+	return [16]int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 2, 2, 3, 4}[b>>4]
+}
@@ -0,0 +1,656 @@
+package gguf_parser
+
+import (
+	"container/heap"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// _GGUFVocabularyBPE holds the state of the byte-level BPE tokenizer.
+type _GGUFVocabularyBPE struct {
+	// ranks are the ranks of the merges, indexed by the pair.
+	ranks map[[2]string]int
+	// splitters are applied in order to pre-tokenize the text.
+	splitters []_GGUFVocabularyBPESplitter
+	// ignoreMerges is true if a word found in the vocabulary is used directly.
+	ignoreMerges bool
+}
+
+// _GGUFVocabularyBPESplitter splits each segment of the code points further,
+// the segments are represented by their lengths.
+type _GGUFVocabularyBPESplitter func(cpts []rune, offsets []int) []int
+
+func newGGUFVocabularyBPE(pre string, merges []string) (*_GGUFVocabularyBPE, error) {
+	b := &_GGUFVocabularyBPE{ranks: make(map[[2]string]int, len(merges))}
+	for i, m := range merges {
+		// Search from the second byte, as the first part can be a space.
+		j := -1
+		if len(m) > 1 {
+			j = strings.IndexByte(m[1:], ' ')
+		}
+		if j < 0 {
+			return nil, fmt.Errorf("invalid merge %q", m)
+		}
+		b.ranks[[2]string{m[:j+1], m[j+2:]}] = i
+	}
+
+	// Pre-tokenizers of llama.cpp.
+	switch pre {
+	case "", "default":
+		b.splitters = []_GGUFVocabularyBPESplitter{
+			bpeRegexSplitter(`[\p{P}\$\+<=>\^~\|]+`),
+			bpeGPT2Splitter,
+			bpeRegexSplitter(`\p{N}+`),
+			bpeRegexSplitter(`[0-9][0-9][0-9]`),
+		}
+	case "gpt-2", "phi-2", "mpt", "olmo", "jais", "roberta-bpe", "gigachat",
+		"jina-es", "jina-de", "jina-v1-en", "jina-v2-es", "jina-v2-de", "jina-v2-code":
+		b.splitters = []_GGUFVocabularyBPESplitter{bpeGPT2Splitter}
+	case "llama3", "llama-v3", "llama-bpe", "falcon3":
+		b.splitters = []_GGUFVocabularyBPESplitter{bpeLLaMA3Splitter(3)}
+		b.ignoreMerges = true
+	case "dbrx", "smaug-bpe":
+		b.splitters = []_GGUFVocabularyBPESplitter{bpeLLaMA3Splitter(3)}
+	case "qwen2", "deepseek-r1-qwen", "megrez", "stablelm2":
+		b.splitters = []_GGUFVocabularyBPESplitter{bpeLLaMA3Splitter(1)}
+	case "chatglm-bpe":
+		b.splitters = []_GGUFVocabularyBPESplitter{bpeLLaMA3Splitter(3)}
+	case "falcon":
+		b.splitters = []_GGUFVocabularyBPESplitter{
+			bpeRegexSplitter("[\\p{P}\\$\\+<=>\\^~\\|`]+"),
+			bpeGPT2Splitter,
+			bpeRegexSplitter(`[0-9][0-9][0-9]`),
+		}
+	case "starcoder", "refact", "command-r", "smollm", "codeshell", "exaone", "minerva-7b":
+		b.splitters = []_GGUFVocabularyBPESplitter{
+			bpeRegexSplitter(`\p{N}`),
+			bpeGPT2Splitter,
+		}
+	case "deepseek-llm":
+		// The \s of std::wregex matches \v as well.
+		b.splitters = []_GGUFVocabularyBPESplitter{
+			bpeRegexSplitter(`[\r\n]`),
+			bpeRegexSplitter(`[\t-\r ]?[A-Za-zµÀ-ÖØ-öø-ƺƼ-ƿǄ-ʓʕ-ʯͰ-ͳͶͷͻ-ͽͿΆΈ-ΊΌΎ-ΡΣ-ϵϷ-ҁҊ-ԯԱ-ՖႠ-ჅᎠ-Ᏽᏸ-ᏽᲐ-ᲺᲽ-Ჿᴀ-ᴫᵫ-ᵷ` +
+				`ᵹ-ᶚḀ-ἕἘ-Ἕἠ-ὅὈ-Ὅὐ-ὗὙὛὝὟ-ώᾀ-ᾴᾶ-ᾼιῂ-ῄῆ-ῌῐ-ΐῖ-Ίῠ-Ῥῲ-ῴῶ-ῼℂℇℊ-ℓℕℙ-ℝℤΩℨK-ℭ` +
+				`ℯ-ℴℹℼ-ℿⅅ-ⅉⅎↃↄⰀ-ⱻⱾ-ⳤⳫ-ⳮⳲⳳꙀ-ꙭꚀ-ꚛꜢ-ꝯꝱ-ꞇꞋ-ꞎꭰ-ꮿﬀ-ﬆﬓ-ﬗＡ-Ｚａ-ｚ\x{10400}-\x{1044f}𐒰-𐓓𐓘-𐓻𐲀-𐲲𐳀-𐳲𑢠-𑣟𞤀-𞥃]+`),
+			bpeRegexSplitter(`[\t-\r ]?[!-/:-~！-／：-～‘-‟　-。]+`),
+			bpeRegexSplitter(`[\t-\r ]+$`),
+			bpeRegexSplitter(`[一-龥ࠀ-一가-퟿]+`),
+			bpeRegexSplitter(`\p{N}+`),
+		}
+	case "deepseek-v3":
+		b.splitters = []_GGUFVocabularyBPESplitter{
+			bpeRegexSplitter(`\p{N}{1,3}`),
+			bpeRegexSplitter(`[一-龥぀-ゟ゠-ヿ]+`),
+			bpeDeepSeekV3Splitter,
+		}
+	case "tekken":
+		b.splitters = []_GGUFVocabularyBPESplitter{bpeTekkenSplitter(1, false)}
+		b.ignoreMerges = true
+	case "gpt-4o":
+		b.splitters = []_GGUFVocabularyBPESplitter{bpeTekkenSplitter(3, true)}
+	default:
+		return nil, fmt.Errorf("unsupported pre-tokenizer %q", pre)
+	}
+	return b, nil
+}
+
+type (
+	_GGUFVocabularyBPEBigram struct {
+		left, right int
+		text        string
+		rank        int
+	}
+
+	// _GGUFVocabularyBPEBigrams is a priority queue of the bigrams,
+	// the lower rank goes first, and the left one goes first if the ranks are equal.
+	_GGUFVocabularyBPEBigrams []_GGUFVocabularyBPEBigram
+)
+
+func (q _GGUFVocabularyBPEBigrams) Len() int { return len(q) }
+
+func (q _GGUFVocabularyBPEBigrams) Less(i, j int) bool {
+	return q[i].rank < q[j].rank || q[i].rank == q[j].rank && q[i].left < q[j].left
+}
+
+func (q _GGUFVocabularyBPEBigrams) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *_GGUFVocabularyBPEBigrams) Push(x any) { *q = append(*q, x.(_GGUFVocabularyBPEBigram)) }
+
+func (q *_GGUFVocabularyBPEBigrams) Pop() any {
+	o := *q
+	x := o[len(o)-1]
+	*q = o[:len(o)-1]
+	return x
+}
+
+// encodeBPE encodes the given text with the byte-level BPE tokenizer,
+// which merges the bigram with the lowest rank repeatedly inside each pre-tokenized word.
+func (v *GGUFVocabulary) encodeBPE(text string, out []int64) []int64 {
+	for _, word := range v.bpe.preTokenize(text) {
+		word = encodeByteLevel(word)
+		if v.bpe.ignoreMerges {
+			if id, ok := v.textToID[word]; ok {
+				out = append(out, id)
+				continue
+			}
+		}
+
+		syms := newGGUFVocabularySymbols(word)
+		if len(syms) == 0 {
+			continue
+		}
+		symText := func(i int) string {
+			return word[syms[i].start : syms[i].start+syms[i].n]
+		}
+
+		q := &_GGUFVocabularyBPEBigrams{}
+		tryAdd := func(l, r int) {
+			if l < 0 || r < 0 {
+				return
+			}
+			lt, rt := symText(l), symText(r)
+			rank, ok := v.bpe.ranks[[2]string{lt, rt}]
+			if !ok {
+				return
+			}
+			heap.Push(q, _GGUFVocabularyBPEBigram{left: l, right: r, text: lt + rt, rank: rank})
+		}
+		for i := 1; i < len(syms); i++ {
+			tryAdd(i-1, i)
+		}
+
+		for q.Len() != 0 {
+			b := heap.Pop(q).(_GGUFVocabularyBPEBigram)
+			ls, rs := &syms[b.left], &syms[b.right]
+			// Skip if the bigram is outdated.
+			if ls.n == 0 || rs.n == 0 || symText(b.left)+symText(b.right) != b.text {
+				continue
+			}
+			ls.n += rs.n
+			rs.n = 0
+			ls.next = rs.next
+			if rs.next >= 0 {
+				syms[rs.next].prev = b.left
+			}
+			tryAdd(ls.prev, b.left)
+			tryAdd(b.left, ls.next)
+		}
+
+		for i := 0; i != -1; i = syms[i].next {
+			s := symText(i)
+			if id, ok := v.textToID[s]; ok {
+				out = append(out, id)
+				continue
+			}
+			for j := 0; j < len(s); j++ {
+				if id, ok := v.textToID[s[j:j+1]]; ok {
+					out = append(out, id)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// preTokenize splits the given text into words.
+func (b *_GGUFVocabularyBPE) preTokenize(text string) []string {
+	cpts := []rune(text)
+	offsets := []int{len(cpts)}
+	for _, s := range b.splitters {
+		offsets = s(cpts, offsets)
+	}
+	words := make([]string, 0, len(offsets))
+	start := 0
+	for _, o := range offsets {
+		words = append(words, string(cpts[start:start+o]))
+		start += o
+	}
+	return words
+}
+
+// bpeRegexSplitter returns a splitter that splits the segments by the matches of the given regex,
+// the unmatched parts are kept as segments.
+//
+// As llama.cpp does, the non-ASCII whitespaces are matched as \v.
+func bpeRegexSplitter(expr string) _GGUFVocabularyBPESplitter {
+	re := regexp.MustCompile(expr)
+	return func(cpts []rune, offsets []int) []int {
+		var r []int
+		start := 0
+		for _, o := range offsets {
+			seg := strings.Map(func(r rune) rune {
+				if r >= utf8.RuneSelf && unicode.IsSpace(r) {
+					return '\v'
+				}
+				return r
+			}, string(cpts[start:start+o]))
+			prev := 0
+			for _, m := range re.FindAllStringIndex(seg, -1) {
+				ms, me := utf8.RuneCountInString(seg[:m[0]]), utf8.RuneCountInString(seg[:m[1]])
+				if ms > prev {
+					r = append(r, ms-prev)
+				}
+				if me > ms {
+					r = append(r, me-ms)
+				}
+				prev = me
+			}
+			if prev < o {
+				r = append(r, o-prev)
+			}
+			start += o
+		}
+		return r
+	}
+}
+
+// _GGUFVocabularyBPECursor is the cursor of a segment in the custom splitters.
+type _GGUFVocabularyBPECursor struct {
+	cpts     []rune
+	ini, end int
+	prevEnd  int
+	offsets  []int
+}
+
+const bpeOutOfRange = rune(-1)
+
+func (c *_GGUFVocabularyBPECursor) cpt(pos int) rune {
+	if c.ini <= pos && pos < c.end {
+		return c.cpts[pos]
+	}
+	return bpeOutOfRange
+}
+
+func (c *_GGUFVocabularyBPECursor) isLetter(pos int) bool {
+	r := c.cpt(pos)
+	return r != bpeOutOfRange && unicode.IsLetter(r)
+}
+
+func (c *_GGUFVocabularyBPECursor) isNumber(pos int) bool {
+	r := c.cpt(pos)
+	return r != bpeOutOfRange && unicode.IsNumber(r)
+}
+
+func (c *_GGUFVocabularyBPECursor) isSpace(pos int) bool {
+	r := c.cpt(pos)
+	return r != bpeOutOfRange && unicode.IsSpace(r)
+}
+
+func (c *_GGUFVocabularyBPECursor) isMark(pos int) bool {
+	r := c.cpt(pos)
+	return r != bpeOutOfRange && unicode.IsMark(r)
+}
+
+// isPunctOrSymbol reports whether the code point is a punctuation or a symbol, i.e. [\p{P}\p{S}],
+// '~' is excluded as the ASCII symbols of llama.cpp miss it.
+func (c *_GGUFVocabularyBPECursor) isPunctOrSymbol(pos int) bool {
+	r := c.cpt(pos)
+	return r != bpeOutOfRange && r != '~' && (unicode.IsPunct(r) || unicode.IsSymbol(r))
+}
+
+// isOther reports whether the code point is neither space, letter nor number, i.e. [^\s\p{L}\p{N}].
+func (c *_GGUFVocabularyBPECursor) isOther(pos int) bool {
+	return c.cpt(pos) != bpeOutOfRange && !c.isSpace(pos) && !c.isLetter(pos) && !c.isNumber(pos)
+}
+
+func (c *_GGUFVocabularyBPECursor) add(end int) {
+	if n := end - c.prevEnd; n > 0 {
+		c.offsets = append(c.offsets, n)
+	}
+	c.prevEnd = end
+}
+
+// bpeCustomSplit applies the given matcher on each segment,
+// the matcher consumes from the given position and returns the next position,
+// the code points consumed without adding are merged into one segment.
+func bpeCustomSplit(cpts []rune, offsets []int, match func(c *_GGUFVocabularyBPECursor, pos int) int) []int {
+	c := &_GGUFVocabularyBPECursor{cpts: cpts}
+	start := 0
+	for _, o := range offsets {
+		c.ini, c.end, c.prevEnd = start, start+o, start
+		for pos := c.ini; pos < c.end; {
+			pos = match(c, pos)
+		}
+		// Keep the unmatched tail as a segment.
+		c.add(c.end)
+		start += o
+	}
+	return c.offsets
+}
+
+// bpeMatchContraction matches 's|'t|'re|'ve|'m|'ll|'d, optionally case-insensitive.
+func bpeMatchContraction(c *_GGUFVocabularyBPECursor, pos int, fold bool) (int, bool) {
+	n := bpeContractionLen(c, pos, fold)
+	if n == 0 {
+		return pos, false
+	}
+	c.add(pos + n)
+	return pos + n, true
+}
+
+// bpeContractionLen returns the length of the contraction at the given position,
+// or 0 if no contractions.
+func bpeContractionLen(c *_GGUFVocabularyBPECursor, pos int, fold bool) int {
+	if c.cpt(pos) != '\'' || pos+1 >= c.end {
+		return 0
+	}
+	lower := func(r rune) rune {
+		if fold {
+			return unicode.ToLower(r)
+		}
+		return r
+	}
+	n := lower(c.cpt(pos + 1))
+	if n == 's' || n == 't' || n == 'm' || n == 'd' {
+		return 2
+	}
+	if pos+2 < c.end {
+		nn := lower(c.cpt(pos + 2))
+		if n == 'r' && nn == 'e' || n == 'v' && nn == 'e' || n == 'l' && nn == 'l' {
+			return 3
+		}
+	}
+	return 0
+}
+
+// bpeGPT2Splitter splits as the regex of GPT2,
+// 's|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+.
+func bpeGPT2Splitter(cpts []rune, offsets []int) []int {
+	return bpeCustomSplit(cpts, offsets, func(c *_GGUFVocabularyBPECursor, pos int) int {
+		if p, ok := bpeMatchContraction(c, pos, false); ok {
+			return p
+		}
+
+		p2 := pos
+		if c.cpt(pos) == ' ' {
+			p2++
+		}
+		for _, is := range []func(int) bool{c.isLetter, c.isNumber, c.isOther} {
+			// <space>?\p{L}+, <space>?\p{N}+, <space>?[^\s\p{L}\p{N}]+
+			if is(p2) {
+				for is(p2) {
+					p2++
+				}
+				c.add(p2)
+				return p2
+			}
+		}
+
+		return bpeMatchSpaces(c, pos, false)
+	})
+}
+
+// bpeLLaMA3Splitter splits as the regex of LLaMA3 with the given max digits,
+// (?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+.
+func bpeLLaMA3Splitter(maxDigits int) _GGUFVocabularyBPESplitter {
+	return func(cpts []rune, offsets []int) []int {
+		return bpeCustomSplit(cpts, offsets, func(c *_GGUFVocabularyBPECursor, pos int) int {
+			if p, ok := bpeMatchContraction(c, pos, true); ok {
+				return p
+			}
+
+			r := c.cpt(pos)
+
+			// [^\r\n\p{L}\p{N}]?\p{L}+
+			if r != '\r' && r != '\n' && !c.isNumber(pos) && (c.isLetter(pos) || c.isLetter(pos+1)) {
+				pos++
+				for c.isLetter(pos) {
+					pos++
+				}
+				c.add(pos)
+				return pos
+			}
+
+			// \p{N}{1,3}
+			if c.isNumber(pos) {
+				ini := pos
+				for c.isNumber(pos) {
+					pos++
+					if pos-ini >= maxDigits {
+						c.add(pos)
+						ini = pos
+					}
+				}
+				c.add(pos)
+				return pos
+			}
+
+			// <space>?[^\s\p{L}\p{N}]+[\r\n]*
+			p2 := pos
+			if r == ' ' {
+				p2++
+			}
+			if c.isOther(p2) {
+				for c.isOther(p2) {
+					p2++
+				}
+				for c.cpt(p2) == '\r' || c.cpt(p2) == '\n' {
+					p2++
+				}
+				c.add(p2)
+				return p2
+			}
+
+			return bpeMatchSpaces(c, pos, true)
+		})
+	}
+}
+
+// bpeTekkenSplitter splits as the regex of Tekken with the given max digits,
+// [^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*|\p{N}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+,
+// and the words end with the optional (?i:'s|'t|'re|'ve|'m|'ll|'d) if withContractions as GPT-4o does.
+//
+// As llama.cpp adapts, the upper case letters are the letters except a-z,
+// and the lower case letters are the letters except A-Z.
+func bpeTekkenSplitter(maxDigits int, withContractions bool) _GGUFVocabularyBPESplitter {
+	return func(cpts []rune, offsets []int) []int {
+		return bpeCustomSplit(cpts, offsets, func(c *_GGUFVocabularyBPECursor, pos int) int {
+			isUpper := func(p int) bool {
+				r := c.cpt(p)
+				return c.isLetter(p) && (r < 'a' || r > 'z')
+			}
+			isLower := func(p int) bool {
+				r := c.cpt(p)
+				return c.isLetter(p) && (r < 'A' || r > 'Z')
+			}
+
+			r := c.cpt(pos)
+
+			// [^\r\n\p{L}\p{N}]?<upper>*<lower>+, or [^\r\n\p{L}\p{N}]?<upper>+<lower>*
+			p := pos
+			if r != '\r' && r != '\n' && !c.isLetter(pos) && !c.isNumber(pos) && c.isLetter(pos+1) {
+				p++
+			}
+			if c.isLetter(p) {
+				u := p
+				for isUpper(u) {
+					u++
+				}
+				end := u
+				if isLower(u) {
+					for isLower(end) {
+						end++
+					}
+				} else {
+					// Backtrack to the last upper case letter which is lower case as well.
+					for k := u - 1; k >= p; k-- {
+						if isLower(k) {
+							end = k + 1
+							break
+						}
+					}
+				}
+				if withContractions {
+					end += bpeContractionLen(c, end, true)
+				}
+				c.add(end)
+				return end
+			}
+
+			// \p{N}{1,3}
+			if c.isNumber(pos) {
+				ini := pos
+				for c.isNumber(pos) {
+					pos++
+					if pos-ini >= maxDigits {
+						c.add(pos)
+						ini = pos
+					}
+				}
+				c.add(pos)
+				return pos
+			}
+
+			// <space>?[^\s\p{L}\p{N}]+[\r\n/]*
+			p2 := pos
+			if r == ' ' {
+				p2++
+			}
+			if c.isOther(p2) {
+				for c.isOther(p2) {
+					p2++
+				}
+				for c.cpt(p2) == '\r' || c.cpt(p2) == '\n' || c.cpt(p2) == '/' {
+					p2++
+				}
+				c.add(p2)
+				return p2
+			}
+
+			return bpeMatchSpaces(c, pos, true)
+		})
+	}
+}
+
+// bpeDeepSeekV3Splitter splits as the last regex of DeepSeek V3,
+// [!"#$%&'()*+,\-./:;<=>?@\[\\\]^_`{|}~][A-Za-z]+|[^\r\n\p{L}\p{P}\p{S}]?[\p{L}\p{M}]+| ?[\p{P}\p{S}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+,
+// the unmatched code points, e.g. the numbers, are kept as segments.
+func bpeDeepSeekV3Splitter(cpts []rune, offsets []int) []int {
+	return bpeCustomSplit(cpts, offsets, func(c *_GGUFVocabularyBPECursor, pos int) int {
+		isASCIILetter := func(p int) bool {
+			r := c.cpt(p)
+			return 'A' <= r && r <= 'Z' || 'a' <= r && r <= 'z'
+		}
+		isLetterOrMark := func(p int) bool {
+			return c.isLetter(p) || c.isMark(p)
+		}
+
+		r := c.cpt(pos)
+		end := -1
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsPunct(r) || unicode.IsSymbol(r)) && isASCIILetter(pos+1):
+			// [!"#$%&'()*+,\-./:;<=>?@\[\\\]^_`{|}~][A-Za-z]+
+			end = pos + 1
+			for isASCIILetter(end) {
+				end++
+			}
+		case isLetterOrMark(pos) ||
+			r != '\r' && r != '\n' && !c.isLetter(pos) && !c.isPunctOrSymbol(pos) && isLetterOrMark(pos+1):
+			// [^\r\n\p{L}\p{P}\p{S}]?[\p{L}\p{M}]+
+			end = pos + 1
+			for isLetterOrMark(end) {
+				end++
+			}
+		default:
+			// <space>?[\p{P}\p{S}]+[\r\n]*
+			p2 := pos
+			if r == ' ' {
+				p2++
+			}
+			if c.isPunctOrSymbol(p2) {
+				end = p2
+				for c.isPunctOrSymbol(end) {
+					end++
+				}
+				for c.cpt(end) == '\r' || c.cpt(end) == '\n' {
+					end++
+				}
+			}
+		}
+
+		switch {
+		case end >= 0:
+			c.add(pos)
+			c.add(end)
+			return end
+		case c.isSpace(pos):
+			c.add(pos)
+			return bpeMatchSpaces(c, pos, true)
+		}
+		return pos + 1
+	})
+}
+
+// bpeMatchSpaces matches \s*[\r\n]+ if withNewlines, \s+(?!\S) and \s+,
+// or consumes one code point if no matches.
+func bpeMatchSpaces(c *_GGUFVocabularyBPECursor, pos int, withNewlines bool) int {
+	n, lastNewline := 0, 0
+	for c.isSpace(pos + n) {
+		if r := c.cpt(pos + n); r == '\r' || r == '\n' {
+			lastNewline = pos + n + 1
+		}
+		n++
+	}
+	switch {
+	case withNewlines && lastNewline > 0:
+		// \s*[\r\n]+
+		pos = lastNewline
+	case n > 1 && c.cpt(pos+n) != bpeOutOfRange:
+		// \s+(?!\S)
+		pos += n - 1
+	case n > 0:
+		// \s+
+		pos += n
+	default:
+		pos++
+	}
+	c.add(pos)
+	return pos
+}
+
+// bpeByteToRune maps the bytes to the printable runes as GPT2 does,
+// and bpeRuneToByte is the reverse.
+var (
+	bpeByteToRune [256]rune
+	bpeRuneToByte = map[rune]byte{}
+)
+
+func init() {
+	n := 0
+	for b := 0; b < 256; b++ {
+		if '!' <= b && b <= '~' || 0xa1 <= b && b <= 0xac || 0xae <= b && b <= 0xff {
+			bpeByteToRune[b] = rune(b)
+		} else {
+			bpeByteToRune[b] = rune(256 + n)
+			n++
+		}
+		bpeRuneToByte[bpeByteToRune[b]] = byte(b)
+	}
+}
+
+// encodeByteLevel maps each byte of the given text to the printable rune.
+func encodeByteLevel(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		sb.WriteRune(bpeByteToRune[s[i]])
+	}
+	return sb.String()
+}
+
+// decodeByteLevel maps each rune of the given text back to the byte,
+// the unmapped runes are kept.
+func decodeByteLevel(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if b, ok := bpeRuneToByte[r]; ok {
+			sb.WriteByte(b)
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
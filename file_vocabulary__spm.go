@@ -0,0 +1,127 @@
+package gguf_parser
+
+import (
+	"container/heap"
+	"fmt"
+)
+
+// _GGUFVocabularySymbol is a symbol of the text in merging,
+// which is linked with the previous and next symbols.
+type _GGUFVocabularySymbol struct {
+	prev, next int
+	// start is the offset of the symbol in the text.
+	start int
+	// n is the length of the symbol in bytes,
+	// which is 0 if merged into the previous symbol.
+	n int
+}
+
+// newGGUFVocabularySymbols splits the given text into UTF-8 characters as symbols.
+func newGGUFVocabularySymbols(text string) []_GGUFVocabularySymbol {
+	syms := make([]_GGUFVocabularySymbol, 0, len(text))
+	for offs := 0; offs < len(text); {
+		n := min(utf8Len(text[offs]), len(text)-offs)
+		syms = append(syms, _GGUFVocabularySymbol{prev: len(syms) - 1, next: len(syms) + 1, start: offs, n: n})
+		offs += n
+	}
+	if len(syms) != 0 {
+		syms[len(syms)-1].next = -1
+	}
+	return syms
+}
+
+type (
+	_GGUFVocabularySPMBigram struct {
+		left, right int
+		score       float32
+		size        int
+	}
+
+	// _GGUFVocabularySPMBigrams is a priority queue of the bigrams,
+	// the higher score goes first, and the left one goes first if the scores are equal.
+	_GGUFVocabularySPMBigrams []_GGUFVocabularySPMBigram
+)
+
+func (q _GGUFVocabularySPMBigrams) Len() int { return len(q) }
+
+func (q _GGUFVocabularySPMBigrams) Less(i, j int) bool {
+	return q[i].score > q[j].score || q[i].score == q[j].score && q[i].left < q[j].left
+}
+
+func (q _GGUFVocabularySPMBigrams) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *_GGUFVocabularySPMBigrams) Push(x any) { *q = append(*q, x.(_GGUFVocabularySPMBigram)) }
+
+func (q *_GGUFVocabularySPMBigrams) Pop() any {
+	o := *q
+	x := o[len(o)-1]
+	*q = o[:len(o)-1]
+	return x
+}
+
+// encodeSPM encodes the given escaped text with the SentencePiece BPE tokenizer,
+// which merges the bigram with the highest score repeatedly.
+func (v *GGUFVocabulary) encodeSPM(text string, out []int64) []int64 {
+	syms := newGGUFVocabularySymbols(text)
+	if len(syms) == 0 {
+		return out
+	}
+
+	q := &_GGUFVocabularySPMBigrams{}
+	tryAdd := func(l, r int) {
+		if l < 0 || r < 0 {
+			return
+		}
+		s := text[syms[l].start : syms[l].start+syms[l].n+syms[r].n]
+		id, ok := v.textToID[s]
+		if !ok {
+			return
+		}
+		heap.Push(q, _GGUFVocabularySPMBigram{left: l, right: r, score: v.Tokens[id].Score, size: len(s)})
+	}
+	for i := 1; i < len(syms); i++ {
+		tryAdd(i-1, i)
+	}
+
+	for q.Len() != 0 {
+		b := heap.Pop(q).(_GGUFVocabularySPMBigram)
+		ls, rs := &syms[b.left], &syms[b.right]
+		// Skip if one of the symbols already got merged.
+		if ls.n == 0 || rs.n == 0 || ls.n+rs.n != b.size {
+			continue
+		}
+		ls.n += rs.n
+		rs.n = 0
+		ls.next = rs.next
+		if rs.next >= 0 {
+			syms[rs.next].prev = b.left
+		}
+		tryAdd(ls.prev, b.left)
+		tryAdd(b.left, ls.next)
+	}
+
+	for i := 0; i != -1; i = syms[i].next {
+		s := text[syms[i].start : syms[i].start+syms[i].n]
+		if id, ok := v.textToID[s]; ok {
+			out = append(out, id)
+			continue
+		}
+		// Output the symbols that did not form tokens as bytes.
+		for j := 0; j < len(s); j++ {
+			out = append(out, v.byteToken(s[j]))
+		}
+	}
+	return out
+}
+
+// byteToken returns the token of the given byte,
+// which is "<0xXX>" or the byte itself, or the unknown token if not found.
+func (v *GGUFVocabulary) byteToken(b byte) int64 {
+	if id, ok := v.textToID[fmt.Sprintf("<0x%02X>", b)]; ok {
+		return id
+	}
+	if id, ok := v.textToID[string([]byte{b})]; ok {
+		return id
+	}
+	return v.UnknownTokenID
+}
@@ -0,0 +1,276 @@
+package gguf_parser
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// _GGUFVocabularyUGM holds the state of the Unigram tokenizer.
+type _GGUFVocabularyUGM struct {
+	// tokens matches the normal, user-defined and unused tokens.
+	tokens *_GGUFVocabularyTrie
+	// userDefined matches the user-defined tokens.
+	userDefined *_GGUFVocabularyTrie
+	// unknownScore is the score of the unknown token,
+	// which is lower than the min score of the normal tokens.
+	unknownScore float32
+
+	// xcda is the XOR-compressed compact double array of the precompiled charsmap.
+	xcda []uint32
+	// replacements are the null-terminated normalized sequences of the precompiled charsmap.
+	replacements []byte
+}
+
+func newGGUFVocabularyUGM(tokens []GGUFVocabularyToken, charsmap []byte) (*_GGUFVocabularyUGM, error) {
+	u := &_GGUFVocabularyUGM{
+		tokens:      &_GGUFVocabularyTrie{},
+		userDefined: &_GGUFVocabularyTrie{},
+	}
+
+	if len(charsmap) != 0 {
+		if len(charsmap) < 4 {
+			return nil, errors.New("invalid precompiled charsmap")
+		}
+		n := uint64(binary.LittleEndian.Uint32(charsmap))
+		if n+4 >= uint64(len(charsmap)) {
+			return nil, errors.New("invalid precompiled charsmap, index out of range")
+		}
+		u.xcda = make([]uint32, n/4)
+		for i := range u.xcda {
+			u.xcda[i] = binary.LittleEndian.Uint32(charsmap[4+i*4:])
+		}
+		u.replacements = charsmap[4+n:]
+	}
+
+	minScore := float32(math.MaxFloat32)
+	for i := range tokens {
+		t := tokens[i]
+		switch t.Type {
+		case GGUFTokenTypeNormal:
+			minScore = min(minScore, t.Score)
+			u.tokens.insert(t.Text, int64(i))
+		case GGUFTokenTypeUserDefined:
+			u.tokens.insert(t.Text, int64(i))
+			u.userDefined.insert(t.Text, int64(i))
+		case GGUFTokenTypeUnused:
+			u.tokens.insert(t.Text, int64(i))
+		}
+	}
+	u.unknownScore = minScore - 10
+
+	return u, nil
+}
+
+// encodeUGM encodes the given text with the Unigram tokenizer,
+// which finds the tokenization with the highest score sum by the Viterbi algorithm.
+func (v *GGUFVocabulary) encodeUGM(text string, out []int64) []int64 {
+	norm := v.normalizeUGM(text)
+	n := len(norm)
+	if n == 0 {
+		return out
+	}
+
+	type best struct {
+		id     int64
+		offset int
+		score  float32
+	}
+	bests := make([]best, n+1)
+	for i := range bests {
+		bests[i] = best{id: v.UnknownTokenID, score: -math.MaxFloat32}
+	}
+	bests[0].score = 0
+
+	for offs := 0; offs < n; {
+		cn := min(utf8Len(norm[offs]), n-offs)
+		cur := bests[offs]
+
+		singleFound := false
+		node := v.ugm.tokens
+		for p := offs; p < n; p++ {
+			if node = node.children[norm[p]]; node == nil {
+				break
+			}
+			if !node.ok {
+				continue
+			}
+			if p+1-offs == cn {
+				singleFound = true
+			}
+			score := v.Tokens[node.id].Score
+			if v.Tokens[node.id].Type == GGUFTokenTypeUserDefined {
+				score = 0
+			}
+			if s := float32(float64(cur.score) + float64(score)); s > bests[p+1].score {
+				bests[p+1] = best{id: node.id, offset: offs, score: s}
+			}
+		}
+		if !singleFound {
+			if s := float32(float64(cur.score) + float64(v.ugm.unknownScore)); s > bests[offs+cn].score {
+				bests[offs+cn] = best{id: v.UnknownTokenID, offset: offs, score: s}
+			}
+		}
+
+		offs += cn
+	}
+
+	// Backtrack, and merge the consecutive unknown tokens.
+	c := len(out)
+	isPrevUnknown := false
+	for b := bests[n]; ; b = bests[b.offset] {
+		isUnknown := b.id == v.UnknownTokenID
+		if !isPrevUnknown || !isUnknown {
+			out = append(out, b.id)
+		}
+		if b.offset == 0 {
+			break
+		}
+		isPrevUnknown = isUnknown
+	}
+	for i, j := c, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// normalizeUGM normalizes the given text as SentencePiece does,
+// which applies the precompiled charsmap and escapes the spaces.
+func (v *GGUFVocabulary) normalizeUGM(text string) string {
+	const space = "▁"
+
+	var (
+		sb               strings.Builder
+		isSpacePrepended bool
+		processingNonWS  bool
+	)
+	for offs := 0; offs < len(text); {
+		norm, consumed := v.ugm.normalizePrefix(text[offs:])
+		for i := 0; i < len(norm); i++ {
+			c := norm[i]
+			if c != ' ' {
+				if !processingNonWS {
+					processingNonWS = true
+					if v.AddSpacePrefix && !isSpacePrepended || v.RemoveExtraWhitespaces {
+						sb.WriteString(space)
+						isSpacePrepended = true
+					}
+				}
+				sb.WriteByte(c)
+			} else {
+				processingNonWS = false
+				if !v.RemoveExtraWhitespaces {
+					sb.WriteString(space)
+				}
+			}
+		}
+		offs += consumed
+	}
+	return sb.String()
+}
+
+// normalizePrefix normalizes the prefix of the given text,
+// and returns the normalized sequence and the consumed length.
+func (u *_GGUFVocabularyUGM) normalizePrefix(s string) (string, int) {
+	if s == "" {
+		return "", 0
+	}
+
+	// Keep the user-defined tokens, or the prefixes of them.
+	if n := u.userDefined.longestPrefix(s); n > 0 {
+		return s[:n], n
+	}
+
+	// Find the longest prefix in the XCDA.
+	if len(u.xcda) != 0 {
+		var (
+			length int
+			offset uint32
+		)
+		node, ok := u.xcdaBase(0)
+		for i := 0; ok && i < len(s) && s[i] != 0; i++ {
+			c := uint32(s[i])
+			node ^= c
+			var p uint32
+			if p, ok = u.xcdaNode(node); !ok || p&(1<<31|0xff) != c {
+				break
+			}
+			isLeaf := (p>>8)&1 == 1
+			var b uint32
+			if b, ok = u.xcdaBase(node); !ok {
+				break
+			}
+			node ^= b
+			if isLeaf {
+				var q uint32
+				if q, ok = u.xcdaNode(node); !ok {
+					break
+				}
+				length, offset = i+1, q&(1<<31-1)
+			}
+		}
+		if length > 0 && int(offset) < len(u.replacements) {
+			r := u.replacements[offset:]
+			if i := strings.IndexByte(string(r), 0); i >= 0 {
+				r = r[:i]
+			}
+			return string(r), length
+		}
+	}
+
+	// Keep the valid UTF-8 character, or replace with U+FFFD.
+	r, n := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError && n <= 1 {
+		return "�", 1
+	}
+	return s[:n], n
+}
+
+func (u *_GGUFVocabularyUGM) xcdaNode(i uint32) (uint32, bool) {
+	if int(i) >= len(u.xcda) {
+		return 0, false
+	}
+	return u.xcda[i], true
+}
+
+func (u *_GGUFVocabularyUGM) xcdaBase(i uint32) (uint32, bool) {
+	p, ok := u.xcdaNode(i)
+	return (p >> 10) << ((p & (1 << 9)) >> 6), ok
+}
+
+// _GGUFVocabularyTrie is a byte trie of the token texts.
+type _GGUFVocabularyTrie struct {
+	children map[byte]*_GGUFVocabularyTrie
+	id       int64
+	ok       bool
+}
+
+func (t *_GGUFVocabularyTrie) insert(s string, id int64) {
+	n := t
+	for i := 0; i < len(s); i++ {
+		if n.children == nil {
+			n.children = map[byte]*_GGUFVocabularyTrie{}
+		}
+		c, ok := n.children[s[i]]
+		if !ok {
+			c = &_GGUFVocabularyTrie{}
+			n.children[s[i]] = c
+		}
+		n = c
+	}
+	n.id, n.ok = id, true
+}
+
+// longestPrefix returns the length of the longest path of the given text in the trie,
+// as llama.cpp does, the path may end halfway through an inserted text.
+func (t *_GGUFVocabularyTrie) longestPrefix(s string) int {
+	n := t
+	for i := 0; i < len(s); i++ {
+		if n = n.children[s[i]]; n == nil {
+			return i
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,95 @@
+package gguf_parser
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// encodeWPM encodes the given text with the WordPiece tokenizer,
+// which matches the longest tokens greedily inside each word.
+func (v *GGUFVocabulary) encodeWPM(text string, out []int64) []int64 {
+	for _, word := range preprocessWPM(text) {
+		// Prepend the phantom space.
+		w := "▁" + word
+		n := len(w)
+
+		c := len(out)
+		for i := 0; i < n; i++ {
+			match := false
+			for j := min(n, i+v.maxTokenLen+1); j > i; j-- {
+				if id, ok := v.textToID[w[i:j]]; ok {
+					out = append(out, id)
+					match = true
+					i = j - 1
+					break
+				}
+			}
+			// Discard the whole word if any part is not matched.
+			if !match {
+				out = out[:c]
+				break
+			}
+		}
+		if len(out) == c {
+			out = append(out, v.UnknownTokenID)
+		}
+	}
+	return out
+}
+
+// preprocessWPM normalizes the given text and splits it into words,
+// the punctuations, symbols and CJK characters are split as single character words.
+func preprocessWPM(text string) []string {
+	words := []string{""}
+	for _, r := range text {
+		r = wpmBaseRune(r)
+		if unicode.IsSpace(r) {
+			if words[len(words)-1] != "" {
+				words = append(words, "")
+			}
+			continue
+		}
+		if r == 0 || r == unicode.ReplacementChar || unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			continue
+		}
+
+		s := string(unicode.ToLower(r))
+		if unicode.IsPunct(r) || r < 0x7f && unicode.IsSymbol(r) || isCJKRune(r) {
+			if words[len(words)-1] != "" {
+				words = append(words, "")
+			}
+			words[len(words)-1] = s
+			words = append(words, "")
+		} else {
+			words[len(words)-1] += s
+		}
+	}
+	if words[len(words)-1] == "" {
+		words = words[:len(words)-1]
+	}
+	return words
+}
+
+// wpmBaseRune returns the first rune of the NFD normalization of the given rune,
+// the rest of the decomposition, e.g. the combining marks, is dropped as llama.cpp does.
+func wpmBaseRune(r rune) rune {
+	if r < utf8.RuneSelf {
+		return r
+	}
+	b, _ := utf8.DecodeRuneInString(norm.NFD.String(string(r)))
+	return b
+}
+
+// isCJKRune reports whether the given rune is a CJK character as BERT does.
+func isCJKRune(r rune) bool {
+	return 0x4e00 <= r && r <= 0x9fff ||
+		0x3400 <= r && r <= 0x4dbf ||
+		0x20000 <= r && r <= 0x2a6df ||
+		0x2a700 <= r && r <= 0x2b73f ||
+		0x2b740 <= r && r <= 0x2b81f ||
+		0x2b920 <= r && r <= 0x2ceaf ||
+		0xf900 <= r && r <= 0xfaff ||
+		0x2f800 <= r && r <= 0x2fa1f
+}
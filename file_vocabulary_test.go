@@ -0,0 +1,771 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestVocabulary loads the vocabulary from the given tokenizer metadata,
+// the types and scores are optional.
+func newTestVocabulary(t *testing.T, model string, tokens []string, types []GGUFTokenType, scores []float32, kvs ...GGUFMetadataKV) *GGUFVocabulary {
+	t.Helper()
+
+	array := func(key string, typ GGUFMetadataValueType, n int, f func(i int) any) GGUFMetadataKV {
+		vs := make([]any, n)
+		for i := range vs {
+			vs[i] = f(i)
+		}
+		return GGUFMetadataKV{Key: key, ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+			Type: typ, Len: uint64(n), Array: vs,
+		}}
+	}
+	kvs = append(GGUFMetadataKVs{
+		{Key: "tokenizer.ggml.model", ValueType: GGUFMetadataValueTypeString, Value: model},
+		array("tokenizer.ggml.tokens", GGUFMetadataValueTypeString, len(tokens), func(i int) any { return tokens[i] }),
+	}, kvs...)
+	if types != nil {
+		kvs = append(kvs, array("tokenizer.ggml.token_type", GGUFMetadataValueTypeInt32, len(types), func(i int) any { return int32(types[i]) }))
+	}
+	if scores != nil {
+		kvs = append(kvs, array("tokenizer.ggml.scores", GGUFMetadataValueTypeFloat32, len(scores), func(i int) any { return scores[i] }))
+	}
+
+	gf := &GGUFFile{Header: GGUFHeader{MetadataKV: kvs}}
+	v, err := gf.Vocabulary()
+	require.NoError(t, err)
+	return v
+}
+
+func testStringsKV(key string, vs ...string) GGUFMetadataKV {
+	as := make([]any, len(vs))
+	for i := range vs {
+		as[i] = vs[i]
+	}
+	return GGUFMetadataKV{Key: key, ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+		Type: GGUFMetadataValueTypeString, Len: uint64(len(vs)), Array: as,
+	}}
+}
+
+// newTestSlicedVocabulary loads the vocabulary sliced from a real one,
+// which keeps the given tokens at their IDs and pads the others as unused tokens like convert_hf_to_gguf.py does,
+// the types of the given tokens are normal if not specified.
+func newTestSlicedVocabulary(t *testing.T, model string, size int, tokens map[int]string, types map[int]GGUFTokenType, scores map[int]float32, kvs ...GGUFMetadataKV) *GGUFVocabulary {
+	t.Helper()
+
+	ts := make([]string, size)
+	tts := make([]GGUFTokenType, size)
+	var ss []float32
+	if scores != nil {
+		ss = make([]float32, size)
+	}
+	for i := range ts {
+		text, ok := tokens[i]
+		if !ok {
+			ts[i], tts[i] = fmt.Sprintf("[PAD%d]", i), GGUFTokenTypeUnused
+			continue
+		}
+		ts[i], tts[i] = text, GGUFTokenTypeNormal
+		if typ, ok := types[i]; ok {
+			tts[i] = typ
+		}
+		if scores != nil {
+			ss[i] = scores[i]
+		}
+	}
+	return newTestVocabulary(t, model, ts, tts, ss, kvs...)
+}
+
+func TestGGUFFile_Vocabulary(t *testing.T) {
+	fx := newTestLLaMAFixture(GGUFVersionV3, false)
+	p := fx.WriteFiles(t, t.TempDir(), "a", 1)[0]
+
+	gf, err := ParseGGUFFile(p)
+	require.NoError(t, err)
+	v, err := gf.Vocabulary()
+	require.NoError(t, err)
+	assert.Equal(t, "gpt2", v.Model)
+	assert.Len(t, v.Tokens, 32)
+	assert.Equal(t, GGUFVocabularyToken{Text: "t5", Type: GGUFTokenTypeNormal}, v.Tokens[5])
+	assert.Equal(t, []string{"t1 t2", "t3 t4", "t5 t6"}, v.Merges)
+	assert.Equal(t, int64(1), v.BOSTokenID)
+	assert.Equal(t, int64(2), v.EOSTokenID)
+	assert.Equal(t, int64(-1), v.UnknownTokenID)
+	id, ok := v.TokenID("t31")
+	assert.True(t, ok)
+	assert.Equal(t, int64(31), id)
+
+	// The tokens are skipped.
+	gf, err = ParseGGUFFile(p, SkipLargeMetadata())
+	require.NoError(t, err)
+	_, err = gf.Vocabulary()
+	assert.ErrorContains(t, err, "parse without SkipLargeMetadata")
+
+	// The whitespaces of the tokens are kept.
+	var b bytes.Buffer
+	_, err = NewGGUFWriter(&b).Write(&GGUFFile{Header: GGUFHeader{
+		Magic:   GGUFMagicGGUFLe,
+		Version: GGUFVersionV3,
+		MetadataKV: GGUFMetadataKVs{
+			{Key: "tokenizer.ggml.model", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+			testStringsKV("tokenizer.ggml.tokens", "<unk>", "<s>", "</s>", "\n", "\n\n", " x "),
+		},
+	}})
+	require.NoError(t, err)
+	r := bytes.NewReader(b.Bytes())
+	gf, err = parseGGUFFile([]_GGUFFileReadSeeker{{ReadSeeker: r, Size: r.Size()}}, _GGUFReadOptions{})
+	require.NoError(t, err)
+	v, err = gf.Vocabulary()
+	require.NoError(t, err)
+	assert.Equal(t, "\n", v.Tokens[3].Text)
+	assert.Equal(t, "\n\n", v.Tokens[4].Text)
+	assert.Equal(t, " x ", v.Tokens[5].Text)
+
+	// Unsupported.
+	gf = &GGUFFile{Header: GGUFHeader{MetadataKV: GGUFMetadataKVs{
+		{Key: "tokenizer.ggml.model", ValueType: GGUFMetadataValueTypeString, Value: "rwkv"},
+	}}}
+	_, err = gf.Vocabulary()
+	assert.ErrorContains(t, err, "unsupported tokenizer model")
+	gf = &GGUFFile{Header: GGUFHeader{MetadataKV: GGUFMetadataKVs{
+		{Key: "tokenizer.ggml.model", ValueType: GGUFMetadataValueTypeString, Value: "gpt2"},
+		{Key: "tokenizer.ggml.pre", ValueType: GGUFMetadataValueTypeString, Value: "unknown"},
+		testStringsKV("tokenizer.ggml.tokens", "a"),
+		testStringsKV("tokenizer.ggml.merges"),
+	}}}
+	_, err = gf.Vocabulary()
+	assert.ErrorContains(t, err, "unsupported pre-tokenizer")
+}
+
+func TestGGUFVocabulary_SPM(t *testing.T) {
+	var (
+		N = GGUFTokenTypeNormal
+		U = GGUFTokenTypeUnknown
+		C = GGUFTokenTypeControl
+		D = GGUFTokenTypeUserDefined
+		B = GGUFTokenTypeByte
+	)
+	v := newTestVocabulary(t, "llama",
+		[]string{
+			"<unk>", "<s>", "</s>", "▁", "h", "e", "l", "o", "w", "r", "d",
+			"ll", "he", "llo", "hello", "▁hello", "or", "▁w", "ld", "<0x0A>", "<0x21>", "<|user|>",
+			"<0x3C>", "<0x3E>", "<0x73>", "<0x78>",
+		},
+		[]GGUFTokenType{U, C, C, N, N, N, N, N, N, N, N, N, N, N, N, N, N, N, N, B, B, D, B, B, B, B},
+		[]float32{
+			0, 0, 0, -1, -2, -2, -2, -2, -2, -2, -2,
+			-0.5, -0.7, -0.4, -0.3, -0.2, -0.9, -1.0, -1.1, 0, 0, 0,
+			0, 0, 0, 0,
+		})
+	assert.True(t, v.AddBOS)
+	assert.True(t, v.AddSpacePrefix)
+
+	testCases := []struct {
+		given        string
+		parseSpecial bool
+		expected     []int64
+	}{
+		{"", false, []int64{1}},
+		{"hello world", false, []int64{1, 15, 17, 16, 18}},
+		{"hello world!\n", false, []int64{1, 15, 17, 16, 18, 20, 19}},
+		// Fall back to the bytes.
+		{"x", false, []int64{1, 3, 25}},
+		{"hello<|user|>world", false, []int64{1, 15, 21, 17, 16, 18}},
+		{"<s>hello", true, []int64{1, 1, 15}},
+		{"<s>hello", false, []int64{1, 3, 22, 24, 23, 14}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			assert.Equal(t, tc.expected, v.Encode(tc.given, true, tc.parseSpecial))
+		})
+	}
+	assert.Equal(t, []int64{15, 17, 16, 18}, v.Encode("hello world", false, false))
+
+	actual, err := v.Decode([]int64{15, 17, 16, 18, 20, 19}, false, false)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", actual)
+	actual, err = v.Decode([]int64{1, 15, 21, 17, 16, 18}, true, false)
+	require.NoError(t, err)
+	assert.Equal(t, " hello<|user|> world", actual)
+	actual, err = v.Decode([]int64{1, 15, 2}, false, true)
+	require.NoError(t, err)
+	assert.Equal(t, "<s> hello</s>", actual)
+	_, err = v.Decode([]int64{26}, false, false)
+	assert.Error(t, err)
+}
+
+func TestGGUFVocabulary_BPE(t *testing.T) {
+	tokens := []string{
+		"h", "e", "l", "o", "Ġ", "w", "r", "d", "1", "2", "3", "4", "!",
+		"he", "ll", "llo", "hello", "Ġw", "or", "Ġwor", "ld", "Ġworld", "12", "123",
+		"<|endoftext|>", "'s", "'", "s", "lo", "Ċ",
+	}
+	types := make([]GGUFTokenType, len(tokens))
+	for i := range types {
+		types[i] = GGUFTokenTypeNormal
+	}
+	types[24] = GGUFTokenTypeControl
+	merges := testStringsKV("tokenizer.ggml.merges",
+		"l l", "h e", "ll o", "he llo", "Ġ w", "o r", "Ġw or", "l d", "Ġwor ld", "1 2", "12 3", "' s")
+
+	testCases := []struct {
+		pre      string
+		given    string
+		expected []int64
+	}{
+		{"gpt-2", "hello world 1234!", []int64{16, 21, 4, 23, 11, 12}},
+		{"default", "hello world 1234!", []int64{16, 21, 4, 23, 11, 12}},
+		// The BOS token is added, which is "4" by default.
+		{"llama-bpe", "hello world 1234!", []int64{11, 16, 21, 4, 23, 11, 12}},
+		{"qwen2", "hello world 1234!", []int64{16, 21, 4, 8, 9, 10, 11, 12}},
+		{"gpt-2", "he's", []int64{13, 25}},
+		{"llama-bpe", "he's", []int64{11, 13, 25}},
+		{"llama-bpe", "hello\n\nworld", []int64{11, 16, 29, 29, 5, 18, 20}},
+		{"gpt-2", "hello\n\nworld", []int64{16, 29, 29, 5, 18, 20}},
+		// Merges are ignored if the word is a token.
+		{"llama-bpe", "lo", []int64{11, 28}},
+		{"dbrx", "lo", []int64{2, 3}},
+		{"gpt-2", "hello<|endoftext|>", []int64{16, 24}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.pre+"/"+tc.given, func(t *testing.T) {
+			v := newTestVocabulary(t, "gpt2", tokens, types, nil, merges,
+				GGUFMetadataKV{Key: "tokenizer.ggml.pre", ValueType: GGUFMetadataValueTypeString, Value: tc.pre})
+			assert.Equal(t, tc.expected, v.Encode(tc.given, true, true))
+
+			actual, err := v.Decode(tc.expected, true, true)
+			require.NoError(t, err)
+			assert.Equal(t, tc.given, actual)
+		})
+	}
+}
+
+func TestGGUFVocabulary_WPM(t *testing.T) {
+	var (
+		N = GGUFTokenTypeNormal
+		U = GGUFTokenTypeUnknown
+		C = GGUFTokenTypeControl
+	)
+	v := newTestVocabulary(t, "bert",
+		[]string{
+			"[PAD]", "[UNK]", "[CLS]", "[SEP]", "▁hello", "▁world", "▁un", "aff", "able", "▁!", "▁,", "▁中", "▁cafe",
+		},
+		[]GGUFTokenType{C, U, C, C, N, N, N, N, N, N, N, N, N},
+		nil,
+		GGUFMetadataKV{Key: "tokenizer.ggml.bos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(2)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.unknown_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.separator_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(3)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.padding_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(0)},
+	)
+
+	assert.Equal(t, []int64{2, 4, 10, 5, 9, 6, 7, 8, 12, 11, 1, 3},
+		v.Encode("Hello, WORLD! unaffable\tcafé 中文", true, false))
+	// The word is discarded if not fully matched.
+	assert.Equal(t, []int64{1}, v.Encode("unbelievable", false, false))
+	assert.Empty(t, v.Encode(" \x00​ ", false, false))
+
+	actual, err := v.Decode([]int64{2, 4, 5, 3}, true, false)
+	require.NoError(t, err)
+	assert.Equal(t, " hello world", actual)
+}
+
+func TestGGUFVocabulary_UGM(t *testing.T) {
+	var (
+		N = GGUFTokenTypeNormal
+		U = GGUFTokenTypeUnknown
+		C = GGUFTokenTypeControl
+		D = GGUFTokenTypeUserDefined
+	)
+	tokens := []string{
+		"<pad>", "</s>", "<unk>", "▁", "▁hello", "▁he", "llo", "▁world", "h", "e", "l", "o", "w", "r", "d", "<x>",
+	}
+	types := []GGUFTokenType{C, C, U, N, N, N, N, N, N, N, N, N, N, N, N, D}
+	scores := []float32{0, 0, 0, -2, -5, -3, -3, -4, -6, -6, -6, -6, -6, -6, -6, 0}
+
+	// A precompiled charsmap normalizing "x" to "h",
+	// the root base is 256, the node of "x" is 256^'x' with base 1,
+	// and the value node is 256^'x'^1 with the offset 0 of the replacements.
+	xcda := make([]uint32, 378)
+	xcda[0] = 256 << 10
+	xcda[256^'x'] = 1<<10 | 1<<8 | 'x'
+	charsmap := binary.LittleEndian.AppendUint32(nil, uint32(len(xcda)*4))
+	for _, p := range xcda {
+		charsmap = binary.LittleEndian.AppendUint32(charsmap, p)
+	}
+	charsmap = append(charsmap, 'h', 0)
+	charsmapVs := make([]any, len(charsmap))
+	for i := range charsmap {
+		charsmapVs[i] = charsmap[i]
+	}
+
+	v := newTestVocabulary(t, "t5", tokens, types, scores,
+		GGUFMetadataKV{Key: "tokenizer.ggml.add_space_prefix", ValueType: GGUFMetadataValueTypeBool, Value: true},
+		GGUFMetadataKV{Key: "tokenizer.ggml.remove_extra_whitespaces", ValueType: GGUFMetadataValueTypeBool, Value: true},
+		GGUFMetadataKV{Key: "tokenizer.ggml.precompiled_charsmap", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+			Type: GGUFMetadataValueTypeUint8, Len: uint64(len(charsmapVs)), Array: charsmapVs,
+		}},
+	)
+
+	testCases := []struct {
+		given    string
+		expected []int64
+	}{
+		{"hello  world", []int64{4, 7, 1}},
+		{"hi", []int64{3, 8, 2, 1}},
+		// The consecutive unknown tokens are merged.
+		{"hiiz", []int64{3, 8, 2, 1}},
+		{"hello<x>world", []int64{4, 15, 7, 1}},
+		{"xello", []int64{4, 1}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			assert.Equal(t, tc.expected, v.Encode(tc.given, true, false))
+		})
+	}
+
+	actual, err := v.Decode([]int64{4, 7, 1}, true, false)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", actual)
+
+	// Keep the extra whitespaces.
+	v = newTestVocabulary(t, "t5", tokens, types, scores,
+		GGUFMetadataKV{Key: "tokenizer.ggml.add_space_prefix", ValueType: GGUFMetadataValueTypeBool, Value: true})
+	assert.Equal(t, []int64{4, 3, 7, 1}, v.Encode("hello  world", true, false))
+}
+
+func TestGGUFVocabulary_BPEPreTokenize(t *testing.T) {
+	// The expected words are split by llama.cpp.
+	given := "Hello WORLD's 1234567 ÀbcDEF!!~ 中文カナ\n\n  x"
+
+	testCases := []struct {
+		pre      string
+		expected []string
+	}{
+		{"default", []string{"Hello", " WORLD", "'", "s", " ", "123", "456", "7", " ÀbcDEF", "!!~", " 中文カナ", "\n\n ", " x"}},
+		{"gpt-2", []string{"Hello", " WORLD", "'s", " 1234567", " ÀbcDEF", "!!~", " 中文カナ", "\n\n ", " x"}},
+		{"llama-bpe", []string{"Hello", " WORLD", "'s", " ", "123", "456", "7", " ÀbcDEF", "!!~", " 中文カナ", "\n\n", " ", " x"}},
+		{"dbrx", []string{"Hello", " WORLD", "'s", " ", "123", "456", "7", " ÀbcDEF", "!!~", " 中文カナ", "\n\n", " ", " x"}},
+		{"qwen2", []string{"Hello", " WORLD", "'s", " ", "1", "2", "3", "4", "5", "6", "7", " ÀbcDEF", "!!~", " 中文カナ", "\n\n", " ", " x"}},
+		{"stablelm2", []string{"Hello", " WORLD", "'s", " ", "1", "2", "3", "4", "5", "6", "7", " ÀbcDEF", "!!~", " 中文カナ", "\n\n", " ", " x"}},
+		{"chatglm-bpe", []string{"Hello", " WORLD", "'s", " ", "123", "456", "7", " ÀbcDEF", "!!~", " 中文カナ", "\n\n", " ", " x"}},
+		{"falcon", []string{"Hello", " WORLD", "'", "s", " ", "123", "456", "7", " ÀbcDEF", "!!~", " 中文カナ", "\n\n ", " x"}},
+		{"starcoder", []string{"Hello", " WORLD", "'s", " ", "1", "2", "3", "4", "5", "6", "7", " ÀbcDEF", "!!~", " 中文カナ", "\n\n ", " x"}},
+		{"refact", []string{"Hello", " WORLD", "'s", " ", "1", "2", "3", "4", "5", "6", "7", " ÀbcDEF", "!!~", " 中文カナ", "\n\n ", " x"}},
+		{"command-r", []string{"Hello", " WORLD", "'s", " ", "1", "2", "3", "4", "5", "6", "7", " ÀbcDEF", "!!~", " 中文カナ", "\n\n ", " x"}},
+		{"smollm", []string{"Hello", " WORLD", "'s", " ", "1", "2", "3", "4", "5", "6", "7", " ÀbcDEF", "!!~", " 中文カナ", "\n\n ", " x"}},
+		{"deepseek-llm", []string{"Hello", " WORLD", "'", "s", " ", "1234567", " À", "bcDEF", "!!~", " ", "中文カナ", "\n", "\n", " ", " x"}},
+		{"deepseek-v3", []string{"Hello", " WORLD", "'s", " ", "123", "456", "7", " ÀbcDEF", "!!", "~", " ", "中文カナ", "\n\n", " ", " x"}},
+		{"tekken", []string{"Hello", " WORLD", "'s", " ", "1", "2", "3", "4", "5", "6", "7", " Àbc", "DEF", "!!~", " 中文カナ", "\n\n", " ", " x"}},
+		{"gpt-4o", []string{"Hello", " WORLD's", " ", "123", "456", "7", " Àbc", "DEF", "!!~", " 中文カナ", "\n\n", " ", " x"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.pre, func(t *testing.T) {
+			b, err := newGGUFVocabularyBPE(tc.pre, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, b.preTokenize(given))
+		})
+	}
+}
+
+// The expected IDs of the following tests are produced by llama.cpp, as vendored in Ollama v0.6.0,
+// with the real vocabularies sliced to the tokens that the given texts need.
+
+func TestGGUFVocabulary_LLaMA3(t *testing.T) {
+	C := GGUFTokenTypeControl
+	// The vocabulary of Meta-Llama-3-8B-Instruct.
+	tokens := map[int]string{
+		0: "!", 6: "'", 11: ",", 13: ".", 16: "1", 17: "2", 18: "3", 19: "4", 20: "5", 27: "<", 29: ">",
+		39: "H", 40: "I", 62: "_", 64: "a", 65: "b", 66: "c", 67: "d", 68: "e", 69: "f", 70: "g", 71: "h",
+		72: "i", 74: "k", 75: "l", 76: "m", 77: "n", 78: "o", 79: "p", 81: "r", 82: "s", 83: "t", 84: "u",
+		85: "v", 86: "w", 89: "z", 91: "|", 102: "©", 107: "¯", 116: "¸", 127: "Ã", 160: "ä", 162: "æ",
+		172: "ð", 197: "ĉ", 198: "Ċ", 201: "č", 220: "Ġ", 222: "Ģ", 229: "ĩ", 244: "ĸ", 246: "ĺ", 253: "Ł",
+		255: "Ń", 256: "ĠĠ", 258: "in", 259: "Ġt", 261: "er", 262: "ĠĠĠ", 264: "Ġa", 267: "st", 268: "en",
+		269: "or", 270: "Ġth", 271: "ĊĊ", 272: "Ġc", 273: "le", 274: "Ġs", 275: "it", 276: "an", 277: "ar",
+		279: "Ġthe", 287: "ing", 288: "es", 289: "Ġw", 296: "Ġm", 301: "el", 303: "nd", 307: "id",
+		308: "Ġn", 311: "Ġto", 319: "čĊ", 323: "Ġand", 325: "se", 329: "ad", 339: "th", 346: "ce",
+		354: "ot", 355: "us", 358: "ĠI", 360: "ul", 370: "ab", 372: "um", 383: "he", 385: "lo", 388: "ers",
+		397: ">Ċ", 408: "end", 411: "ith", 438: "and", 441: "ke", 449: "Ġwith", 450: "iz", 451: "de",
+		459: "Ġan", 472: "art", 478: "est", 495: "ult", 501: "pl", 509: "ld", 553: "ize", 564: "ok",
+		575: "ip", 580: "ace", 582: "ac", 588: "ve", 616: "ell", 655: "ber", 657: "ll", 668: "te",
+		698: "ple", 717: "12", 805: "ser", 817: "use", 851: "_id", 882: "user", 900: "umber", 936: "ca",
+		978: "Ã©", 983: "ng", 993: "Ġsp", 998: "to", 1013: "ader", 1028: "Ġte", 1037: "ade", 1126: "der",
+		1146: "wo", 1296: "Ġtest", 1302: "bs", 1303: "ting", 1330: "pace", 1363: ">ĊĊ", 1395: "be",
+		1396: "Ġnumber", 1410: "orld", 1419: "23", 1548: "He", 1552: "_h", 1634: "ces", 1661: "Ġnum",
+		1713: "oken", 1774: "45", 1820: "the", 1917: "Ġworld", 1941: "bers", 1958: "34", 1985: "test",
+		2025: "head", 2203: "sp", 2211: "Ġca", 2392: "tes", 2438: "rl", 2470: "num", 2492: "aces",
+		2527: "start", 2629: "ta", 2642: "af", 2775: "header", 2779: "ken", 2814: "Ġmult", 2846: "'m",
+		3059: "ze", 3172: "mb", 3213: "izer", 3228: "ead", 3423: "rt", 3458: "na", 3518: "abs", 3574: "ä¸",
+		3634: "Ġspace", 3635: "umb", 3863: "iple", 4037: "Ġtoken", 4174: "number", 4191: "Ġwor",
+		4291: "with", 4513: "123", 4845: "oke", 4896: "ello", 4937: "lt", 5219: "Ġnumbers",
+		5361: "Ġmultiple", 5431: "_i", 5544: "rs", 5963: "token", 6323: "tab", 6733: "pa", 7213: "ulti",
+		7215: "zer", 7447: "Ġmulti", 7649: "Ġtesting", 7741: "æĸ", 7907: "ni", 8920: "space",
+		8932: "_header", 9016: "testing", 9110: "nu", 9468: "ðŁ", 9825: "Ġtok", 9906: "Hello",
+		10046: "ultip", 10462: "ti", 10567: "ipl", 11148: "Ġnu", 11410: "ĠðŁ", 11575: "ĉa", 11727: "234",
+		12097: "Ġmu", 12134: "star", 12508: "ultiple", 12791: "ea", 12842: "Ġmultip", 12901: "345",
+		12908: "Ġspaces", 13347: "Hi", 13439: "_head", 13446: "tip", 14957: "world", 15479: "mu",
+		15975: "Ġmul", 16325: "ä¸Ń", 17043: "wi", 17161: "æĸĩ", 21127: "sta", 24129: "Ġwi", 24670: "Ġwo",
+		25133: "mul", 25634: "eo", 26961: "mult", 27364: "multi", 27623: "ĠðŁĺ", 27835: "tar",
+		28438: "paces", 30203: "Ġcaf", 30694: "tok", 31493: "Ġspa", 32093: "tabs", 33813: "Hel",
+		34229: "eni", 36773: "multiple", 38467: "Ġwit", 38478: "numbers", 38672: "Ã¯", 41033: "hea",
+		42976: "_he", 45385: "spaces", 46051: "pac", 47058: "Ġtokenizer", 48561: "stin", 50810: "wor",
+		51309: "Ġtes", 53050: "ĠcafÃ©", 53577: "ĉand", 54583: "esti", 57071: "tin", 57371: "Ġnumb",
+		59958: "fÃ©", 60955: "esting", 69896: "caf", 73958: "Ġä¸Ń", 76460: "ðŁĺ", 78751: "Ġtokenize",
+		79076: "multip", 80557: "ĉan", 81394: "Hell", 84519: "sti", 86693: "tokenizer", 88032: "!<",
+		89619: "wit", 90298: "spa", 91416: "ĠðŁĺĢ", 100108: "Ġspac", 104455: "eniz", 106181: "Ġä¸",
+		108891: "ä¸Ńæĸĩ", 109697: "Ġð", 128000: "<|begin_of_text|>", 128006: "<|start_header_id|>",
+		128007: "<|end_header_id|>", 128009: "<|eot_id|>",
+	}
+	types := map[int]GGUFTokenType{
+		128000: C, 128006: C, 128007: C, 128009: C,
+	}
+	merges := testStringsKV("tokenizer.ggml.merges",
+		"Ġ Ġ", "i n", "Ġ t", "e r", "Ġ ĠĠ", "ĠĠ Ġ", "Ġ a", "s t", "e n", "o r", "Ġ th", "Ġt h", "Ċ Ċ",
+		"Ġ c", "l e", "Ġ s", "i t", "a n", "a r", "Ġ the", "Ġt he", "Ġth e", "i ng", "in g", "e s", "Ġ w",
+		"Ġ m", "e l", "n d", "i d", "Ġ n", "Ġ to", "Ġt o", "č Ċ", "Ġ and", "Ġa nd", "Ġan d", "s e", "a d",
+		"t h", "c e", "o t", "u s", "Ġ I", "u l", "a b", "u m", "h e", "l o", "e rs", "er s", "> Ċ", "e nd",
+		"en d", "i th", "it h", "a nd", "an d", "k e", "Ġ with", "Ġw ith", "Ġwi th", "Ġwit h", "i z", "d e",
+		"Ġ an", "Ġa n", "a rt", "ar t", "e st", "es t", "u lt", "ul t", "p l", "l d", "i ze", "iz e", "o k",
+		"i p", "a ce", "ac e", "a c", "v e", "e ll", "el l", "b er", "be r", "l l", "t e", "p le", "pl e",
+		"1 2", "s er", "se r", "u se", "us e", "_ id", "_i d", "u ser", "us er", "use r", "um ber",
+		"umb er", "c a", "Ã ©", "n g", "Ġ sp", "Ġs p", "t o", "a der", "ad er", "ade r", "Ġ te", "Ġt e",
+		"a de", "ad e", "d er", "de r", "w o", "Ġ test", "Ġt est", "Ġte st", "Ġtes t", "b s", "t ing",
+		"ti ng", "tin g", "p ace", "pa ce", "pac e", "> ĊĊ", ">Ċ Ċ", "b e", "Ġ number", "Ġn umber",
+		"Ġnum ber", "Ġnumb er", "or ld", "2 3", "H e", "_ h", "c es", "ce s", "Ġ num", "Ġn um", "Ġnu m",
+		"o ken", "ok en", "oke n", "4 5", "t he", "th e", "Ġ world", "Ġw orld", "Ġwor ld", "b ers", "ber s",
+		"be rs", "3 4", "t est", "te st", "tes t", "h ead", "he ad", "hea d", "s p", "Ġ ca", "Ġc a", "t es",
+		"te s", "r l", "n um", "nu m", "a ces", "ace s", "ac es", "st art", "star t", "sta rt", "t a",
+		"a f", "he ader", "head er", "hea der", "k en", "ke n", "Ġ mult", "Ġm ult", "Ġmu lt", "Ġmul t",
+		"' m", "z e", "m b", "i zer", "iz er", "ize r", "e ad", "ea d", "r t", "n a", "a bs", "ab s", "ä ¸",
+		"Ġ space", "Ġs pace", "Ġsp ace", "Ġspa ce", "Ġspac e", "u mb", "um b", "i ple", "ip le", "ipl e",
+		"Ġ token", "Ġt oken", "Ġto ken", "Ġtok en", "n umber", "num ber", "Ġ wor", "Ġw or", "Ġwo r",
+		"w ith", "wi th", "wit h", "1 23", "12 3", "o ke", "ok e", "el lo", "ell o", "l t", "Ġ numbers",
+		"Ġnumber s", "Ġnum bers", "Ġnumb ers", "Ġ multiple", "Ġm ultiple", "Ġmult iple", "Ġmulti ple",
+		"Ġmultip le", "_ i", "r s", "t oken", "to ken", "tok en", "t ab", "ta b", "p a", "ul ti", "ult i",
+		"z er", "ze r", "Ġ multi", "Ġm ulti", "Ġmult i", "Ġmul ti", "Ġ testing", "Ġt esting", "Ġtest ing",
+		"Ġtes ting", "æ ĸ", "n i", "s pace", "sp ace", "spa ce", "_ header", "_head er", "_he ader",
+		"t esting", "test ing", "tes ting", "n u", "ð Ł", "Ġ tok", "Ġt ok", "Ġto k", "H ello", "Hel lo",
+		"Hell o", "ul tip", "ult ip", "ulti p", "t i", "i pl", "ip l", "Ġ nu", "Ġn u", "Ġ ðŁ", "Ġð Ł",
+		"ĉ a", "2 34", "23 4", "Ġ mu", "Ġm u", "s tar", "st ar", "sta r", "ult iple", "ulti ple",
+		"ultip le", "e a", "Ġ multip", "Ġm ultip", "Ġmult ip", "Ġmulti p", "Ġmul tip", "3 45", "34 5",
+		"Ġ spaces", "Ġs paces", "Ġsp aces", "Ġspace s", "Ġspa ces", "Ġspac es", "H i", "_ head", "_h ead",
+		"_he ad", "t ip", "ti p", "w orld", "wor ld", "m u", "Ġ mul", "Ġm ul", "Ġmu l", "ä¸ Ń", "w i",
+		"æĸ ĩ", "s ta", "st a", "Ġ wi", "Ġw i", "Ġ wo", "Ġw o", "m ul", "mu l", "e o", "m ult", "mu lt",
+		"mul t", "m ulti", "mul ti", "mult i", "Ġ ðŁĺ", "ĠðŁ ĺ", "t ar", "ta r", "p aces", "pace s",
+		"pa ces", "pac es", "Ġ caf", "Ġc af", "Ġca f", "t ok", "to k", "Ġ spa", "Ġs pa", "Ġsp a", "t abs",
+		"ta bs", "tab s", "H el", "He l", "e ni", "en i", "m ultiple", "mult iple", "multi ple",
+		"multip le", "Ġ wit", "Ġw it", "Ġwi t", "num bers", "number s", "Ã ¯", "h ea", "he a", "_ he",
+		"_h e", "s paces", "sp aces", "space s", "spa ces", "p ac", "pa c", "Ġ tokenizer", "Ġtoken izer",
+		"Ġtokenize r", "s tin", "st in", "sti n", "w or", "wo r", "Ġ tes", "Ġt es", "Ġte s", "Ġca fÃ©",
+		"Ġcaf Ã©", "ĉ and", "ĉa nd", "ĉan d", "e sti", "es ti", "est i", "t in", "ti n", "Ġn umb", "Ġnum b",
+		"Ġnu mb", "f Ã©", "es ting", "est ing", "esti ng", "c af", "ca f", "Ġ ä¸Ń", "Ġä¸ Ń", "ðŁ ĺ",
+		"Ġtoken ize", "m ultip", "mul tip", "mult ip", "multi p", "ĉ an", "ĉa n", "H ell", "He ll", "Hel l",
+		"s ti", "st i", "token izer", "! <", "w it", "wi t", "s pa", "sp a", "ĠðŁĺ Ģ", "Ġs pac", "Ġsp ac",
+		"Ġspa c", "en iz", "eni z", "Ġ ä¸", "ä¸Ń æĸĩ", "Ġ ð",
+	)
+	v := newTestSlicedVocabulary(t, "gpt2", 128256, tokens, types, nil,
+		merges,
+		GGUFMetadataKV{Key: "tokenizer.ggml.pre", ValueType: GGUFMetadataValueTypeString, Value: "llama-bpe"},
+		GGUFMetadataKV{Key: "tokenizer.ggml.bos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(128000)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.eos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(128009)},
+	)
+
+	testCases := []struct {
+		given        string
+		addSpecial   bool
+		parseSpecial bool
+		expected     []int64
+		decoded      string
+	}{
+		{
+			"Hello, world! I'm testing the tokenizer with 12345 numbers.", true, false,
+			[]int64{128000, 9906, 11, 1917, 0, 358, 2846, 7649, 279, 47058, 449, 220, 4513, 1774, 5219, 13},
+			"<|begin_of_text|>Hello, world! I'm testing the tokenizer with 12345 numbers.",
+		},
+		{
+			"  multiple   spaces\n\n\tand\r\ntabs ", true, false,
+			[]int64{128000, 220, 5361, 256, 12908, 271, 53577, 319, 32093, 220},
+			"<|begin_of_text|>  multiple   spaces\n\n\tand\r\ntabs ",
+		},
+		{
+			"naïve café, 中文 and 😀", true, false,
+			[]int64{128000, 3458, 38672, 588, 53050, 11, 73958, 17161, 323, 91416},
+			"<|begin_of_text|>naïve café, 中文 and 😀",
+		},
+		{
+			"<|start_header_id|>user<|end_header_id|>\n\nHi!<|eot_id|>", false, true,
+			[]int64{128006, 882, 128007, 271, 13347, 0, 128009},
+			"<|start_header_id|>user<|end_header_id|>\n\nHi!<|eot_id|>",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			assert.Equal(t, tc.expected, v.Encode(tc.given, tc.addSpecial, tc.parseSpecial))
+
+			actual, err := v.Decode(tc.expected, false, true)
+			require.NoError(t, err)
+			assert.Equal(t, tc.decoded, actual)
+		})
+	}
+}
+
+func TestGGUFVocabulary_Gemma2(t *testing.T) {
+	var (
+		B = GGUFTokenTypeByte
+		C = GGUFTokenTypeControl
+		D = GGUFTokenTypeUserDefined
+		U = GGUFTokenTypeUnknown
+	)
+	// The vocabulary of Gemma 2.
+	tokens := map[int]string{
+		0: "<pad>", 1: "<eos>", 2: "<bos>", 3: "<unk>", 106: "<start_of_turn>", 107: "<end_of_turn>",
+		108: "\n", 109: "\n\n", 139: "▁▁", 140: "▁▁▁", 473: "in", 474: "▁t", 475: "er", 476: "▁a",
+		479: "en", 480: "he", 481: "an", 483: "or", 484: "es", 485: "▁s", 486: "ar", 487: "ti", 488: "te",
+		489: "th", 490: "st", 491: "nd", 494: "le", 497: "se", 498: "▁c", 500: "it", 511: "to", 512: "ng",
+		513: "▁w", 516: "ta", 519: "▁m", 521: "el", 524: "ve", 525: "ur", 529: "ll", 532: "ce", 545: "lo",
+		550: "ac", 552: "▁n", 553: "us", 555: "be", 556: "na", 557: "ca", 559: "of", 569: "pa", 573: "▁the",
+		574: "ing", 577: "▁to", 578: "▁and", 580: "▁th", 590: "▁I", 600: "um", 601: "ul", 613: "▁wi",
+		615: "end", 618: "ers", 639: "and", 644: "est", 652: "ith", 655: "ke", 670: "ab", 671: "▁an",
+		675: "▁with", 690: "urn", 706: "ld", 716: "iz", 758: "ber", 760: "art", 765: "tu", 766: "ze",
+		801: "sp", 806: "ell", 847: "▁sp", 855: "ult", 889: "ize", 900: "ple", 915: "ces", 940: "ni",
+		995: "mb", 1088: "▁te", 1098: "ser", 1100: "wo", 1124: "ok", 1150: "▁mu", 1175: "the", 1189: "tab",
+		1227: "umber", 1314: "ip", 1322: "▁wor", 1389: "pl", 1486: "ting", 1550: "mber", 1589: "use",
+		1645: "user", 1678: "pace", 1753: "ken", 1758: "▁number", 1774: "ulti", 1912: "wit", 1949: "He",
+		1962: "▁ca", 2020: "umb", 2121: "▁test", 2134: "▁world", 2151: "Hi", 2195: "test", 2231: "tes",
+		2295: "rt", 2405: "Hel", 2446: "rs", 2473: "bs", 2518: "af", 2704: "mu", 2750: "sta", 2780: "orld",
+		2976: "esti", 2997: "start", 3004: "zer", 3041: "with", 3056: "num", 3103: "▁multi", 3200: "ace",
+		3261: "▁nu", 3586: "▁ta", 3641: "▁space", 3979: "llo", 4308: "number", 4366: "rl", 4507: "▁num",
+		4521: "Hello", 4526: "lt", 4577: "umbers", 4917: "aces", 5202: "▁wo", 5378: "wi", 5526: "token",
+		5572: "izer", 5583: "star", 5909: "fé", 5968: "▁numbers", 6144: "nu", 6467: "multi", 6529: "estin",
+		6684: "▁tab", 6733: "▁multiple", 7749: "bers", 8231: "▁wit", 8447: "▁token", 8488: "abs",
+		8603: "▁testing", 9097: "world", 9435: "▁中", 9513: "tar", 9568: "tur", 9878: "▁spa", 9881: "▁tes",
+		10007: "▁mul", 10117: "tok", 10682: "tip", 11035: "space", 11246: "mul", 12757: "tin", 13184: "eni",
+		13444: "ello", 14130: "▁spaces", 14229: "esting", 14319: "testing", 14508: "▁testi",
+		14942: "▁multip", 15508: "turn", 16021: "▁tok", 17987: "wor", 18688: "▁café", 21223: "sti",
+		22979: "rn", 23337: "pac", 25805: "oke", 27267: "spa", 27320: "▁mult", 28229: "mbers",
+		28359: "numbers", 31824: "stin", 31973: "tabs", 34074: "Hell", 38571: "multiple", 41680: "▁caf",
+		42607: "▁tabs", 43204: "mult", 43359: "▁spac", 46633: "spaces", 50039: "中文", 52565: "niz",
+		57431: "oken", 63544: "paces", 64430: "sting", 64565: "▁numb", 67504: "caf", 79937: "▁😀",
+		81453: "café", 82641: "testi", 95907: "tokenizer", 102546: "▁中文", 113215: "multip", 114889: "tart",
+		122615: "numb", 129374: "tokenize", 142224: "▁tokenizer", 149907: "!<", 166402: "tiple",
+		194173: "mbe", 206777: "umbe", 223491: "▁tokenize", 233667: "spac", 235248: "▁", 235249: "e",
+		235250: "a", 235251: "t", 235252: "i", 235253: "o", 235254: "n", 235255: "r", 235256: "s",
+		235257: "l", 235258: "d", 235259: "h", 235260: "c", 235261: "u", 235262: "m", 235263: "p",
+		235264: "g", 235265: ".", 235266: "f", 235268: "b", 235269: ",", 235271: "w", 235272: "v",
+		235273: "k", 235274: "1", 235284: "2", 235285: "I", 235298: "_", 235303: "'", 235304: "3",
+		235306: "z", 235308: "5", 235310: "4", 235313: ">", 235314: "H", 235322: "<", 235335: "é",
+		235341: "!", 235493: "中", 235642: "文", 236370: "ï", 239061: "😀",
+	}
+	types := map[int]GGUFTokenType{
+		0: C, 1: C, 2: C, 3: U, 106: D, 107: D, 108: D, 109: D, 139: D, 140: D,
+	}
+	scores := map[int]float32{}
+	for id := range tokens {
+		if _, ok := types[id]; !ok {
+			// The scores of the normal tokens decrease with the IDs.
+			scores[id] = float32(473 - id)
+		}
+	}
+	for b := 0; b < 256; b++ {
+		tokens[217+b], types[217+b] = fmt.Sprintf("<0x%02X>", b), B
+	}
+	v := newTestSlicedVocabulary(t, "llama", 256000, tokens, types, scores,
+		GGUFMetadataKV{Key: "tokenizer.ggml.add_space_prefix", ValueType: GGUFMetadataValueTypeBool, Value: false},
+		GGUFMetadataKV{Key: "tokenizer.ggml.add_bos_token", ValueType: GGUFMetadataValueTypeBool, Value: true},
+		GGUFMetadataKV{Key: "tokenizer.ggml.add_eos_token", ValueType: GGUFMetadataValueTypeBool, Value: false},
+		GGUFMetadataKV{Key: "tokenizer.ggml.bos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(2)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.eos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.unknown_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(3)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.padding_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(0)},
+	)
+
+	testCases := []struct {
+		given        string
+		addSpecial   bool
+		parseSpecial bool
+		expected     []int64
+		decoded      string
+	}{
+		{
+			"Hello, world! I'm testing the tokenizer with 12345 numbers.", true, false,
+			[]int64{2, 4521, 235269, 2134, 235341, 590, 235303, 235262, 8603, 573, 142224, 675, 235248, 235274, 235284, 235304, 235310, 235308, 5968, 235265},
+			"<bos>Hello, world! I'm testing the tokenizer with 12345 numbers.",
+		},
+		{
+			"  multiple   spaces\n\n\tand tabs", true, false,
+			[]int64{2, 139, 38571, 140, 46633, 109, 226, 639, 42607},
+			"<bos>▁▁multiple▁▁▁spaces\n\n\tand tabs",
+		},
+		{
+			"naïve café, 中文 and 😀", true, false,
+			[]int64{2, 556, 236370, 524, 18688, 235269, 102546, 578, 79937},
+			"<bos>naïve café, 中文 and 😀",
+		},
+		{
+			"<start_of_turn>user\nHi!<end_of_turn>\n", false, true,
+			[]int64{106, 1645, 108, 2151, 235341, 107, 108},
+			"<start_of_turn>user\nHi!<end_of_turn>\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			assert.Equal(t, tc.expected, v.Encode(tc.given, tc.addSpecial, tc.parseSpecial))
+
+			actual, err := v.Decode(tc.expected, false, true)
+			require.NoError(t, err)
+			assert.Equal(t, tc.decoded, actual)
+		})
+	}
+}
+
+func TestGGUFVocabulary_BERT(t *testing.T) {
+	C := GGUFTokenTypeControl
+	// The vocabulary of bert-base-uncased.
+	tokens := map[int]string{
+		0: "[PAD]", 100: "[UNK]", 101: "[CLS]", 102: "[SEP]", 999: "▁!", 1005: "▁'", 1010: "▁,", 1012: "▁.",
+		1031: "▁[", 1033: "▁]", 1037: "▁a", 1038: "▁b", 1039: "▁c", 1040: "▁d", 1041: "▁e", 1042: "▁f",
+		1044: "▁h", 1045: "▁i", 1048: "▁l", 1049: "▁m", 1050: "▁n", 1051: "▁o", 1052: "▁p", 1054: "▁r",
+		1055: "▁s", 1057: "▁u", 1058: "▁v", 1059: "▁w", 1746: "▁中", 1861: "▁文", 2002: "▁he", 2014: "▁her",
+		2015: "s", 2030: "▁or", 2050: "a", 2063: "e", 2072: "i", 2078: "n", 2080: "o", 2088: "▁world",
+		2094: "d", 2099: "r", 2121: "er", 2128: "▁re", 2140: "l", 2182: "▁here", 2213: "m", 2222: "▁ll",
+		2226: "u", 2232: "h", 2278: "c", 2310: "▁ve", 2361: "p", 2368: "en", 2497: "b", 2532: "na",
+		2546: "f", 2571: "le", 2583: "▁able", 2615: "v", 2860: "w", 2884: "el", 2890: "re", 2953: "or",
+		3085: "able", 3109: "▁hell", 3363: "ll", 3366: "se", 3393: "▁le", 3449: "▁el", 3468: "ble",
+		3512: "ive", 3540: "ca", 3726: "ve", 4135: "lo", 4246: "ff", 4372: "▁en", 4609: "un", 4877: "ls",
+		4886: "ai", 4895: "▁un", 4921: "▁iv", 4958: "▁ep", 5349: "ell", 5369: "he", 5886: "her",
+		6187: "▁ca", 6392: "ld", 6583: "▁na", 6904: "▁fa", 7011: "fa", 7174: "llo", 7367: "▁se",
+		7592: "▁hello", 7668: "▁cafe", 7770: "len", 7869: "ere", 7875: "ab", 7959: "fe", 8189: "ena",
+		8586: "ec", 8840: "▁lo", 9413: "▁er", 9521: "una", 9932: "▁ai", 10354: "af", 10768: "▁fe",
+		11108: "world", 11113: "▁ab", 12155: "wo", 12190: "rl", 12848: "iv", 13699: "ep", 14229: "▁lena",
+		14477: "▁una", 14925: "▁ec", 15350: "ello", 15743: "▁naive", 16001: "hel", 16558: "bl",
+		18223: "hell", 18798: "▁len", 18856: "▁cl", 19281: "eca", 19802: "▁sep", 20464: "cl", 20844: "lena",
+		20961: "ffa", 21358: "▁af", 21461: "▁ff", 24185: "▁wo", 24689: "▁caf", 25510: "▁ld", 26416: "nai",
+		28458: "▁fable", 29612: "!", 29618: "'", 29623: ",", 29625: ".", 29634: "[", 29636: "]", 30272: "中",
+		30387: "文",
+	}
+	types := map[int]GGUFTokenType{
+		0: C, 100: C, 101: C, 102: C,
+	}
+	v := newTestSlicedVocabulary(t, "bert", 30522, tokens, types, nil,
+		GGUFMetadataKV{Key: "tokenizer.ggml.bos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(101)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.unknown_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(100)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.seperator_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(102)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.padding_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(0)},
+	)
+
+	testCases := []struct {
+		given        string
+		addSpecial   bool
+		parseSpecial bool
+		expected     []int64
+		decoded      string
+	}{
+		{
+			"Hello, World! Unaffable naïve café 中文.", true, false,
+			[]int64{101, 7592, 1010, 2088, 999, 14477, 20961, 3468, 15743, 7668, 1746, 1861, 1012, 102},
+			"[CLS] hello, world! unaffable naive cafe 中 文.[SEP]",
+		},
+		{
+			"[CLS] I'm here [SEP]", false, true,
+			[]int64{101, 1045, 1005, 1049, 2182, 102},
+			"[CLS] i'm here[SEP]",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			assert.Equal(t, tc.expected, v.Encode(tc.given, tc.addSpecial, tc.parseSpecial))
+
+			actual, err := v.Decode(tc.expected, false, true)
+			require.NoError(t, err)
+			assert.Equal(t, tc.decoded, actual)
+		})
+	}
+}
+
+func TestGGUFVocabulary_XLNet(t *testing.T) {
+	var (
+		C = GGUFTokenTypeControl
+		D = GGUFTokenTypeUserDefined
+		U = GGUFTokenTypeUnknown
+	)
+	// The vocabulary of xlnet-base-cased.
+	tokens := map[int]string{
+		0: "<unk>", 1: "<s>", 2: "</s>", 3: "<cls>", 4: "<sep>", 5: "<pad>", 6: "<mask>", 7: "<eod>",
+		8: "<eop>", 9: ".", 10: "(", 11: ")", 12: "\"", 13: "-", 14: "–", 15: "£", 16: "€", 17: "▁",
+		19: ",", 21: "▁and", 23: "s", 24: "▁a", 26: "'", 34: "▁as", 36: "▁it", 38: "▁at", 46: "t",
+		48: "▁an", 49: "▁or", 66: "d", 69: "▁He", 93: "e", 101: "a", 150: "i", 155: "o", 156: "▁1",
+		159: "▁2", 174: "1", 180: "n", 184: "2", 185: "▁world", 202: "es", 213: "r", 215: "ll", 218: "or",
+		262: "an", 368: "l", 369: "c", 443: "and", 450: "p", 469: "x", 530: "el", 599: "▁low", 627: "at",
+		639: "st", 669: "it", 694: "w", 712: "as", 732: "▁H", 775: "te", 840: "ra", 852: "He", 874: "H",
+		888: "▁space", 934: "▁test", 943: "▁p", 1138: "ce", 1167: "ate", 1277: "est", 1329: "nd",
+		1506: "ex", 1512: "sa", 1588: "▁extra", 1831: "pa", 1929: "lo", 2002: "▁ex", 2044: "tra",
+		2162: "▁sat", 2349: "▁c", 2637: "low", 2940: "ow", 2996: "ac", 3268: "▁pace", 3512: "▁x",
+		3848: "sp", 4172: "▁sand", 4247: "tes", 4297: "ell", 4639: "ace", 5067: "san", 5358: "world",
+		6362: "wo", 6702: "test", 6909: "ces", 7063: "▁pa", 7628: "tr", 7645: "▁Hell", 7861: "ates",
+		8092: "ello", 8304: "ras", 8491: "space", 8768: "ld", 8963: "▁spaces", 9476: "pac", 9570: "▁lo",
+		10221: "llo", 11368: "Hello", 11951: "▁spa", 12253: "rl", 13521: "wor", 13805: "▁Hel",
+		19715: "▁ext", 21810: "▁rasp", 31999: "•",
+	}
+	types := map[int]GGUFTokenType{
+		0: U, 1: C, 2: C, 3: C, 4: C, 5: C, 6: C, 7: C, 8: D, 9: D, 10: D, 11: D, 12: D, 13: D, 14: D,
+		15: D, 16: D,
+	}
+	scores := map[int]float32{
+		17: -2.1267834, 19: -3.2507782, 21: -3.95722, 23: -3.9759443, 24: -4.1491785, 26: -4.6535563,
+		34: -5.511917, 36: -5.575939, 38: -5.662534, 46: -5.880455, 48: -5.9892554, 49: -6.0453086,
+		66: -6.498979, 69: -6.5710673, 93: -6.8816824, 101: -6.963011, 150: -7.5379195, 155: -7.548425,
+		156: -7.559421, 159: -7.5675626, 174: -7.6837068, 180: -7.7190557, 184: -7.7464952, 185: -7.7491875,
+		202: -7.8212914, 213: -7.861923, 215: -7.8701673, 218: -7.8864264, 262: -8.083267, 368: -8.4060135,
+		369: -8.408602, 443: -8.553801, 450: -8.569366, 469: -8.595345, 530: -8.68698, 599: -8.780804,
+		627: -8.822339, 639: -8.839145, 669: -8.873779, 694: -8.898957, 712: -8.920726, 732: -8.95095,
+		775: -9.001445, 840: -9.064979, 852: -9.077957, 874: -9.096591, 888: -9.114931, 934: -9.150883,
+		943: -9.155739, 1138: -9.322927, 1167: -9.340357, 1277: -9.415674, 1329: -9.449012, 1506: -9.576277,
+		1512: -9.579087, 1588: -9.626424, 1831: -9.763499, 1929: -9.816227, 2002: -9.860896,
+		2044: -9.878286, 2162: -9.92885, 2349: -10.016436, 2637: -10.135446, 2940: -10.249502,
+		2996: -10.2656, 3268: -10.356032, 3512: -10.424933, 3848: -10.52052, 4172: -10.610051,
+		4247: -10.629095, 4297: -10.643419, 4639: -10.719383, 5067: -10.804571, 5358: -10.86259,
+		6362: -11.056616, 6702: -11.113501, 6909: -11.147711, 7063: -11.1736355, 7628: -11.256918,
+		7645: -11.259678, 7861: -11.29253, 8092: -11.326403, 8304: -11.358135, 8491: -11.384704,
+		8768: -11.425315, 8963: -11.450022, 9476: -11.519262, 9570: -11.530901, 10221: -11.607052,
+		11368: -11.739491, 11951: -11.8045225, 12253: -11.833303, 13521: -11.963669, 13805: -11.989605,
+		19715: -12.489275, 21810: -12.654279, 31999: -14.792165,
+	}
+	v := newTestSlicedVocabulary(t, "t5", 32000, tokens, types, scores,
+		GGUFMetadataKV{Key: "tokenizer.ggml.add_space_prefix", ValueType: GGUFMetadataValueTypeBool, Value: true},
+		GGUFMetadataKV{Key: "tokenizer.ggml.remove_extra_whitespaces", ValueType: GGUFMetadataValueTypeBool, Value: true},
+		GGUFMetadataKV{Key: "tokenizer.ggml.unknown_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(0)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.bos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1)},
+		GGUFMetadataKV{Key: "tokenizer.ggml.eos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(2)},
+	)
+
+	testCases := []struct {
+		given        string
+		addSpecial   bool
+		parseSpecial bool
+		expected     []int64
+		decoded      string
+	}{
+		{
+			"Hello world, it's a test.", true, false,
+			[]int64{17, 11368, 185, 19, 36, 26, 23, 24, 934, 9, 2},
+			"Hello world, it's a test.</s>",
+		},
+		{
+			"  extra   spaces and 1–2 €", true, false,
+			[]int64{1588, 8963, 21, 156, 14, 159, 16, 2},
+			"extra spaces and 1– 2€</s>",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			assert.Equal(t, tc.expected, v.Encode(tc.given, tc.addSpecial, tc.parseSpecial))
+
+			actual, err := v.Decode(tc.expected, false, true)
+			require.NoError(t, err)
+			assert.Equal(t, tc.decoded, actual)
+		})
+	}
+}
@@ -0,0 +1,432 @@
+package gguf_parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gpustack/gguf-parser-go/util/anyx"
+	"github.com/gpustack/gguf-parser-go/util/funcx"
+	"github.com/gpustack/gguf-parser-go/util/osx"
+)
+
+// GGUFWriter writes a GGUFFile along with its tensor data into a GGUF file,
+// see https://github.com/ggerganov/ggml/blob/master/docs/gguf.md#file-structure.
+//
+// The written file is always in GGUF v3,
+// and the byte order is inherited from the magic of the GGUFFile.
+type GGUFWriter struct {
+	w io.Writer
+}
+
+// NewGGUFWriter returns a GGUFWriter that writes to the given io.Writer.
+func NewGGUFWriter(w io.Writer) *GGUFWriter {
+	return &GGUFWriter{w: w}
+}
+
+// Write writes the given GGUFFile to the underlying io.Writer,
+// and returns the number of bytes written, or an error if any.
+//
+// The tensor data is read from the given sources,
+// each source represents a (split) file of the GGUFFile,
+// if no sources are given, the tensor data is zero-filled.
+//
+// The tensor data is laid out as llama.cpp does,
+// each tensor is padded to `general.alignment`,
+// and the `split.*` metadata is dropped if writing multiple sources into one file.
+//
+// The legacy file is not supported.
+func (gw *GGUFWriter) Write(gf *GGUFFile, srcs ...io.ReaderAt) (int64, error) {
+	switch {
+	case gf == nil:
+		return 0, errors.New("nil GGUF file")
+	case gf.Legacy:
+		// The legacy quantized types have different block sizes.
+		return 0, errors.New("writing legacy file is not supported")
+	}
+
+	kvs := gf.Header.MetadataKV
+	if len(srcs) > 1 {
+		kvs = make(GGUFMetadataKVs, 0, len(gf.Header.MetadataKV))
+		for i := range gf.Header.MetadataKV {
+			if strings.HasPrefix(gf.Header.MetadataKV[i].Key, "split.") {
+				continue
+			}
+			kvs = append(kvs, gf.Header.MetadataKV[i])
+		}
+	}
+
+	var open func(i int) (*io.SectionReader, error)
+	if len(srcs) != 0 {
+		open = func(i int) (*io.SectionReader, error) {
+			return gf.openTensorAt(i, srcs)
+		}
+	}
+	return gw.write(gf.Header.Magic, kvs, gf.TensorInfos, open)
+}
+
+// write writes the header with the given GGUFMetadataKVs and GGUFTensorInfos,
+// along with the tensor data opened by the given function in order,
+// the tensor data is zero-filled if the given function is nil.
+func (gw *GGUFWriter) write(
+	magic GGUFMagic,
+	kvs GGUFMetadataKVs,
+	tis GGUFTensorInfos,
+	open func(i int) (*io.SectionReader, error),
+) (int64, error) {
+	ag, err := ggufAlignment(kvs)
+	if err != nil {
+		return 0, err
+	}
+	tis = layoutGGUFTensorInfos(tis, ag)
+
+	bw := bufio.NewWriter(gw.w)
+	wr := _GGUFWriter{w: bw, bo: ggufByteOrder(magic)}
+
+	// header
+	if err := wr.WriteHeader(kvs, tis); err != nil {
+		return wr.n, err
+	}
+
+	// padding
+	if err := wr.WritePadding(ag); err != nil {
+		return wr.n, fmt.Errorf("write padding: %w", err)
+	}
+
+	// tensor data
+	for i := range tis {
+		sz := int64(tis[i].Bytes())
+		if open != nil {
+			sr, err := open(i)
+			if err != nil {
+				return wr.n, fmt.Errorf("open tensor %q: %w", tis[i].Name, err)
+			}
+			if err = wr.WriteFrom(sr, sz); err != nil {
+				return wr.n, fmt.Errorf("write tensor %q data: %w", tis[i].Name, err)
+			}
+		} else {
+			if err := wr.WriteZeros(sz); err != nil {
+				return wr.n, fmt.Errorf("write tensor %q data: %w", tis[i].Name, err)
+			}
+		}
+		if err := wr.WritePadding(ag); err != nil {
+			return wr.n, fmt.Errorf("write tensor %q padding: %w", tis[i].Name, err)
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return wr.n, fmt.Errorf("flush: %w", err)
+	}
+	return wr.n, nil
+}
+
+// ggufByteOrder returns the byte order of the given GGUFMagic.
+func ggufByteOrder(magic GGUFMagic) binary.ByteOrder {
+	if magic == GGUFMagicGGUFBe {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// ggufAlignment returns the `general.alignment` of the given GGUFMetadataKVs,
+// or 32 if not specified.
+//
+// As the parser does, the alignment must be a power of two in uint32.
+func ggufAlignment(kvs GGUFMetadataKVs) (uint64, error) {
+	v, ok := kvs.Get("general.alignment")
+	if !ok {
+		return 32, nil
+	}
+	if v.ValueType != GGUFMetadataValueTypeUint32 {
+		return 0, fmt.Errorf("invalid alignment type %v", v.ValueType)
+	}
+	ag := v.ValueUint32()
+	if ag == 0 || ag&(ag-1) != 0 {
+		return 0, fmt.Errorf("invalid alignment %d", ag)
+	}
+	return uint64(ag), nil
+}
+
+// layoutGGUFTensorInfos returns a copy of the given GGUFTensorInfos,
+// which offsets are relocated one by one with the given alignment.
+func layoutGGUFTensorInfos(tis GGUFTensorInfos, align uint64) GGUFTensorInfos {
+	ret := make(GGUFTensorInfos, len(tis))
+	var offset uint64
+	for i := range tis {
+		ret[i] = tis[i]
+		ret[i].Offset = offset
+		offset += GGMLPadding(tis[i].Bytes(), align)
+	}
+	return ret
+}
+
+type _GGUFWriter struct {
+	w  io.Writer
+	bo binary.ByteOrder
+	n  int64
+}
+
+func (wr *_GGUFWriter) write(v any) error {
+	if err := binary.Write(wr.w, wr.bo, v); err != nil {
+		return err
+	}
+	wr.n += int64(binary.Size(v))
+	return nil
+}
+
+func (wr *_GGUFWriter) WriteHeader(kvs GGUFMetadataKVs, tis GGUFTensorInfos) error {
+	if err := wr.write(GGUFMagicGGUFLe); err != nil {
+		return fmt.Errorf("write magic: %w", err)
+	}
+	if err := wr.write(GGUFVersionV3); err != nil {
+		return fmt.Errorf("write version: %w", err)
+	}
+	if err := wr.WriteUint64(uint64(len(tis))); err != nil {
+		return fmt.Errorf("write tensor count: %w", err)
+	}
+	if err := wr.WriteUint64(uint64(len(kvs))); err != nil {
+		return fmt.Errorf("write metadata kv count: %w", err)
+	}
+	for i := range kvs {
+		if err := wr.WriteMetadataKV(kvs[i]); err != nil {
+			return fmt.Errorf("write metadata kv %d: %w", i, err)
+		}
+	}
+	for i := range tis {
+		if err := wr.WriteTensorInfo(tis[i]); err != nil {
+			return fmt.Errorf("write tensor info %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (wr *_GGUFWriter) WriteUint64(v uint64) error {
+	if err := wr.write(v); err != nil {
+		return fmt.Errorf("write uint64: %w", err)
+	}
+	return nil
+}
+
+func (wr *_GGUFWriter) WriteString(v string) error {
+	if err := wr.WriteUint64(uint64(len(v))); err != nil {
+		return fmt.Errorf("write string length: %w", err)
+	}
+	n, err := io.WriteString(wr.w, v)
+	wr.n += int64(n)
+	if err != nil {
+		return fmt.Errorf("write string: %w", err)
+	}
+	return nil
+}
+
+func (wr *_GGUFWriter) WriteArray(v GGUFMetadataKVArrayValue) error {
+	if uint64(len(v.Array)) != v.Len {
+		return fmt.Errorf("incomplete array: want %d items, got %d, parse without SkipLargeMetadata", v.Len, len(v.Array))
+	}
+	if err := wr.write(uint32(v.Type)); err != nil {
+		return fmt.Errorf("write array item type: %w", err)
+	}
+	if err := wr.WriteUint64(v.Len); err != nil {
+		return fmt.Errorf("write array length: %w", err)
+	}
+	for i := range v.Array {
+		if err := wr.WriteValue(v.Type, v.Array[i]); err != nil {
+			return fmt.Errorf("write array item %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (wr *_GGUFWriter) WriteValue(vt GGUFMetadataValueType, v any) (err error) {
+	switch vt {
+	case GGUFMetadataValueTypeUint8:
+		err = wr.write(anyx.Number[uint8](v))
+	case GGUFMetadataValueTypeInt8:
+		err = wr.write(anyx.Number[int8](v))
+	case GGUFMetadataValueTypeUint16:
+		err = wr.write(anyx.Number[uint16](v))
+	case GGUFMetadataValueTypeInt16:
+		err = wr.write(anyx.Number[int16](v))
+	case GGUFMetadataValueTypeUint32:
+		err = wr.write(anyx.Number[uint32](v))
+	case GGUFMetadataValueTypeInt32:
+		err = wr.write(anyx.Number[int32](v))
+	case GGUFMetadataValueTypeFloat32:
+		err = wr.write(anyx.Number[float32](v))
+	case GGUFMetadataValueTypeBool:
+		err = wr.write(anyx.Bool(v))
+	case GGUFMetadataValueTypeString:
+		err = wr.WriteString(anyx.String(v))
+	case GGUFMetadataValueTypeArray:
+		av, ok := v.(GGUFMetadataKVArrayValue)
+		if !ok {
+			return fmt.Errorf("invalid array value: %T", v)
+		}
+		err = wr.WriteArray(av)
+	case GGUFMetadataValueTypeUint64:
+		err = wr.write(anyx.Number[uint64](v))
+	case GGUFMetadataValueTypeInt64:
+		err = wr.write(anyx.Number[int64](v))
+	case GGUFMetadataValueTypeFloat64:
+		err = wr.write(anyx.Number[float64](v))
+	default:
+		return fmt.Errorf("invalid type: %v", vt)
+	}
+	return err
+}
+
+func (wr *_GGUFWriter) WriteMetadataKV(kv GGUFMetadataKV) error {
+	if err := wr.WriteString(kv.Key); err != nil {
+		return fmt.Errorf("write key: %w", err)
+	}
+	if err := wr.write(uint32(kv.ValueType)); err != nil {
+		return fmt.Errorf("write value type: %w", err)
+	}
+	if err := wr.WriteValue(kv.ValueType, kv.Value); err != nil {
+		return fmt.Errorf("write %s value: %w", kv.Key, err)
+	}
+	return nil
+}
+
+func (wr *_GGUFWriter) WriteTensorInfo(ti GGUFTensorInfo) error {
+	if err := wr.WriteString(ti.Name); err != nil {
+		return fmt.Errorf("write name: %w", err)
+	}
+	if err := wr.write(ti.NDimensions); err != nil {
+		return fmt.Errorf("write n dimensions: %w", err)
+	}
+	for i := uint32(0); i < ti.NDimensions; i++ {
+		if err := wr.WriteUint64(ti.Dimensions[i]); err != nil {
+			return fmt.Errorf("write dimension %d: %w", i, err)
+		}
+	}
+	if err := wr.write(uint32(ti.Type)); err != nil {
+		return fmt.Errorf("write type: %w", err)
+	}
+	if err := wr.WriteUint64(ti.Offset); err != nil {
+		return fmt.Errorf("write offset: %w", err)
+	}
+	return nil
+}
+
+func (wr *_GGUFWriter) WriteFrom(r io.Reader, size int64) error {
+	n, err := io.CopyN(wr.w, r, size)
+	wr.n += n
+	return err
+}
+
+func (wr *_GGUFWriter) WriteZeros(size int64) error {
+	return wr.WriteFrom(_GGUFZeroReader{}, size)
+}
+
+func (wr *_GGUFWriter) WritePadding(align uint64) error {
+	return wr.WriteZeros(int64(GGMLPadding(uint64(wr.n), align)) - wr.n)
+}
+
+type _GGUFZeroReader struct{}
+
+func (_GGUFZeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// RewriteGGUFFileMetadata rewrites the metadata of the local GGUF file at the given path,
+// and returns true if the tensor data has been shifted, or an error if any.
+//
+// Only the header and the tensor infos are rewritten in place,
+// if the new header fits the original padding, i.e. the tensor data start offset is unchanged.
+//
+// Otherwise, the tensor data must be shifted,
+// since GGUF readers locate the tensor data at the aligned end of the header,
+// the whole file is written to a sibling temporary file and renamed to the path,
+// so the original file keeps intact if the rewriting is interrupted.
+func RewriteGGUFFileMetadata(path string, kvs GGUFMetadataKVs) (shifted bool, err error) {
+	path = osx.InlineTilde(filepath.Clean(path))
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return false, fmt.Errorf("open file: %w", err)
+	}
+	defer osx.Close(f)
+
+	fi := funcx.MustNoError(f.Stat())
+	gf, err := parseGGUFFile([]_GGUFFileReadSeeker{{Closer: f, ReadSeeker: f, Size: fi.Size()}}, _GGUFReadOptions{RawStrings: true})
+	if err != nil {
+		return false, fmt.Errorf("parse file: %w", err)
+	}
+	if gf.Legacy {
+		return false, errors.New("rewriting legacy file is not supported")
+	}
+	if _, ok := gf.Header.MetadataKV.Get("split.count"); ok {
+		return false, errors.New("rewriting split file is not supported")
+	}
+
+	ag, err := ggufAlignment(kvs)
+	if err != nil {
+		return false, err
+	}
+	for i := range gf.TensorInfos {
+		if gf.TensorInfos[i].Offset%ag != 0 {
+			return false, fmt.Errorf("tensor %q offset is not aligned to %d", gf.TensorInfos[i].Name, ag)
+		}
+	}
+
+	var hb bytes.Buffer
+	wr := _GGUFWriter{w: &hb, bo: ggufByteOrder(gf.Header.Magic)}
+	if err = wr.WriteHeader(kvs, gf.TensorInfos); err != nil {
+		return false, err
+	}
+	if err = wr.WritePadding(ag); err != nil {
+		return false, fmt.Errorf("write padding: %w", err)
+	}
+
+	// Rewrite the header in place.
+	if wr.n == gf.TensorDataStartOffset {
+		if _, err = f.WriteAt(hb.Bytes(), 0); err != nil {
+			return false, fmt.Errorf("write header: %w", err)
+		}
+		if err = f.Sync(); err != nil {
+			return false, fmt.Errorf("sync file: %w", err)
+		}
+		return false, nil
+	}
+
+	// Rewrite the whole file to a temporary file.
+	tf, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return false, fmt.Errorf("create temporary file: %w", err)
+	}
+	defer func() {
+		osx.Close(tf)
+		if err != nil {
+			_ = os.Remove(tf.Name())
+		}
+	}()
+
+	if _, err = tf.Write(hb.Bytes()); err != nil {
+		return false, fmt.Errorf("write header: %w", err)
+	}
+	ds := io.NewSectionReader(f, gf.TensorDataStartOffset, fi.Size()-gf.TensorDataStartOffset)
+	if _, err = io.Copy(tf, ds); err != nil {
+		return false, fmt.Errorf("copy tensor data: %w", err)
+	}
+	if err = tf.Chmod(fi.Mode().Perm()); err != nil {
+		return false, fmt.Errorf("chmod temporary file: %w", err)
+	}
+	if err = tf.Sync(); err != nil {
+		return false, fmt.Errorf("sync temporary file: %w", err)
+	}
+	if err = tf.Close(); err != nil {
+		return false, fmt.Errorf("close temporary file: %w", err)
+	}
+	osx.Close(f)
+	if err = os.Rename(tf.Name(), path); err != nil {
+		return false, fmt.Errorf("rename temporary file: %w", err)
+	}
+	return true, nil
+}
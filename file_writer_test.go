@@ -0,0 +1,306 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGGUFWriter_Write(t *testing.T) {
+	cases := []struct {
+		name  string
+		magic GGUFMagic
+		align uint32
+	}{
+		{
+			name:  "little endian",
+			magic: GGUFMagicGGUFLe,
+			align: 32,
+		},
+		{
+			name:  "big endian",
+			magic: GGUFMagicGGUFBe,
+			align: 64,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gf := &GGUFFile{
+				Header: GGUFHeader{
+					Magic:   tc.magic,
+					Version: GGUFVersionV3,
+					MetadataKV: GGUFMetadataKVs{
+						{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+						{Key: "general.alignment", ValueType: GGUFMetadataValueTypeUint32, Value: tc.align},
+						{Key: "general.name", ValueType: GGUFMetadataValueTypeString, Value: " padded name\n"},
+						{Key: "general.description", ValueType: GGUFMetadataValueTypeString, Value: ""},
+						{Key: "test.uint8", ValueType: GGUFMetadataValueTypeUint8, Value: uint8(8)},
+						{Key: "test.int8", ValueType: GGUFMetadataValueTypeInt8, Value: int8(-8)},
+						{Key: "test.uint16", ValueType: GGUFMetadataValueTypeUint16, Value: uint16(16)},
+						{Key: "test.int16", ValueType: GGUFMetadataValueTypeInt16, Value: int16(-16)},
+						{Key: "test.int32", ValueType: GGUFMetadataValueTypeInt32, Value: int32(-32)},
+						{Key: "test.float32", ValueType: GGUFMetadataValueTypeFloat32, Value: float32(3.2)},
+						{Key: "test.bool", ValueType: GGUFMetadataValueTypeBool, Value: true},
+						{Key: "test.uint64", ValueType: GGUFMetadataValueTypeUint64, Value: uint64(64)},
+						{Key: "test.int64", ValueType: GGUFMetadataValueTypeInt64, Value: int64(-64)},
+						{Key: "test.float64", ValueType: GGUFMetadataValueTypeFloat64, Value: float64(6.4)},
+						{Key: "test.array", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+							Type: GGUFMetadataValueTypeArray,
+							Len:  2,
+							Array: []any{
+								GGUFMetadataKVArrayValue{Type: GGUFMetadataValueTypeString, Len: 2, Array: []any{"a", "b c"}},
+								GGUFMetadataKVArrayValue{Type: GGUFMetadataValueTypeInt32, Len: 3, Array: []any{int32(1), int32(2), int32(3)}},
+							},
+						}},
+					},
+				},
+				TensorInfos: GGUFTensorInfos{
+					{Name: "token_embd.weight", NDimensions: 2, Dimensions: []uint64{64, 10}, Type: GGMLTypeF16},
+					{Name: "blk.0.attn_q.weight", NDimensions: 2, Dimensions: []uint64{64, 64}, Type: GGMLTypeQ8_0},
+					{Name: "output_norm.weight", NDimensions: 1, Dimensions: []uint64{7}, Type: GGMLTypeF32},
+				},
+			}
+
+			// Prepare the tensor data source.
+			var src []byte
+			{
+				tis := layoutGGUFTensorInfos(gf.TensorInfos, uint64(tc.align))
+				rd := rand.New(rand.NewSource(1))
+				for i := range tis {
+					gf.TensorInfos[i].Offset = uint64(len(src))
+					b := make([]byte, tis[i].Bytes())
+					_, _ = rd.Read(b)
+					src = append(src, b...)
+				}
+			}
+
+			var b1 bytes.Buffer
+			n, err := NewGGUFWriter(&b1).Write(gf, bytes.NewReader(src))
+			require.NoError(t, err)
+			assert.Equal(t, int64(b1.Len()), n)
+			assert.Zero(t, b1.Len()%int(tc.align))
+
+			gf1, err := parseGGUFFile([]_GGUFFileReadSeeker{{
+				ReadSeeker: bytes.NewReader(b1.Bytes()),
+				Size:       int64(b1.Len()),
+			}}, _GGUFReadOptions{RawStrings: true})
+			require.NoError(t, err)
+			assert.Equal(t, tc.magic, gf1.Header.Magic)
+			assert.Zero(t, gf1.TensorDataStartOffset%int64(tc.align))
+			require.Len(t, gf1.Header.MetadataKV, len(gf.Header.MetadataKV))
+			for i, kv := range gf.Header.MetadataKV {
+				kv1 := gf1.Header.MetadataKV[i]
+				assert.Equal(t, kv.Key, kv1.Key)
+				assert.Equal(t, kv.ValueType, kv1.ValueType)
+				if kv.ValueType != GGUFMetadataValueTypeArray {
+					assert.Equal(t, kv.Value, kv1.Value, kv.Key)
+					continue
+				}
+				av, av1 := kv.ValueArray(), kv1.ValueArray()
+				for j := range av.Array {
+					assert.Equal(t,
+						av.Array[j].(GGUFMetadataKVArrayValue).Array,
+						av1.Array[j].(GGUFMetadataKVArrayValue).Array)
+				}
+			}
+			require.Len(t, gf1.TensorInfos, len(gf.TensorInfos))
+			for i, ti := range gf.TensorInfos {
+				ti1 := gf1.TensorInfos[i]
+				assert.Equal(t, ti.Name, ti1.Name)
+				assert.Equal(t, ti.Dimensions, ti1.Dimensions)
+				assert.Equal(t, ti.Type, ti1.Type)
+				assert.Zero(t, ti1.Offset%uint64(tc.align))
+				s := gf1.TensorDataStartOffset + int64(ti1.Offset)
+				assert.Equal(t, src[ti.Offset:ti.Offset+ti.Bytes()], b1.Bytes()[s:s+int64(ti.Bytes())], ti.Name)
+			}
+
+			// Rewriting the read file is lossless.
+			var b2 bytes.Buffer
+			_, err = NewGGUFWriter(&b2).Write(gf1, bytes.NewReader(b1.Bytes()))
+			require.NoError(t, err)
+			assert.Equal(t, b1.Bytes(), b2.Bytes())
+		})
+	}
+}
+
+func TestGGUFWriter_Write_IncompleteArray(t *testing.T) {
+	gf := &GGUFFile{
+		Header: GGUFHeader{
+			Magic:   GGUFMagicGGUFLe,
+			Version: GGUFVersionV3,
+			MetadataKV: GGUFMetadataKVs{
+				{Key: "tokenizer.ggml.tokens", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+					Type: GGUFMetadataValueTypeString,
+					Len:  10,
+				}},
+			},
+		},
+	}
+
+	_, err := NewGGUFWriter(&bytes.Buffer{}).Write(gf)
+	assert.Error(t, err)
+}
+
+func TestGGUFWriter_Write_InvalidAlignment(t *testing.T) {
+	cases := []GGUFMetadataKV{
+		{Key: "general.alignment", ValueType: GGUFMetadataValueTypeUint64, Value: uint64(32)},
+		{Key: "general.alignment", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(0)},
+		{Key: "general.alignment", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(48)},
+	}
+	for _, kv := range cases {
+		gf := &GGUFFile{
+			Header: GGUFHeader{
+				Magic:      GGUFMagicGGUFLe,
+				Version:    GGUFVersionV3,
+				MetadataKV: GGUFMetadataKVs{kv},
+			},
+		}
+
+		var buf bytes.Buffer
+		_, err := NewGGUFWriter(&buf).Write(gf)
+		assert.ErrorContains(t, err, "invalid alignment", kv.Value)
+		assert.Zero(t, buf.Len())
+	}
+}
+
+func TestRewriteGGUFFileMetadata(t *testing.T) {
+	gf := &GGUFFile{
+		Header: GGUFHeader{
+			Magic:   GGUFMagicGGUFLe,
+			Version: GGUFVersionV3,
+			MetadataKV: GGUFMetadataKVs{
+				{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+				{Key: "general.name", ValueType: GGUFMetadataValueTypeString, Value: "foo"},
+				{Key: "general.description", ValueType: GGUFMetadataValueTypeString, Value: " padded description\n"},
+				{Key: "tokenizer.ggml.tokens", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+					Type:  GGUFMetadataValueTypeString,
+					Len:   3,
+					Array: []any{"a", "\n", " b"},
+				}},
+			},
+		},
+		TensorInfos: GGUFTensorInfos{
+			{Name: "token_embd.weight", NDimensions: 2, Dimensions: []uint64{64, 10}, Type: GGMLTypeF32},
+			{Name: "output_norm.weight", NDimensions: 1, Dimensions: []uint64{64}, Type: GGMLTypeF32},
+		},
+	}
+
+	// Prepare the file with random tensor data.
+	var src []byte
+	{
+		rd := rand.New(rand.NewSource(1))
+		for i := range gf.TensorInfos {
+			gf.TensorInfos[i].Offset = uint64(len(src))
+			b := make([]byte, gf.TensorInfos[i].Bytes())
+			_, _ = rd.Read(b)
+			src = append(src, b...)
+		}
+	}
+	p := filepath.Join(t.TempDir(), "model.gguf")
+	{
+		var b bytes.Buffer
+		_, err := NewGGUFWriter(&b).Write(gf, bytes.NewReader(src))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(p, b.Bytes(), 0o600))
+	}
+
+	// The untouched metadata must be kept byte by byte.
+	var untouched [][]byte
+	for _, k := range []string{"general.architecture", "general.description", "tokenizer.ggml.tokens"} {
+		kv, ok := gf.Header.MetadataKV.Get(k)
+		require.True(t, ok)
+		var b bytes.Buffer
+		wr := _GGUFWriter{w: &b, bo: ggufByteOrder(gf.Header.Magic)}
+		require.NoError(t, wr.WriteMetadataKV(kv))
+		untouched = append(untouched, b.Bytes())
+	}
+
+	cases := []struct {
+		name    string
+		mutate  func(kvs *GGUFMetadataKVs)
+		shifted bool
+	}{
+		{
+			name: "fit in padding",
+			mutate: func(kvs *GGUFMetadataKVs) {
+				_ = kvs.Set("general.name", GGUFMetadataValueTypeString, "bar")
+			},
+			shifted: false,
+		},
+		{
+			name: "grow header",
+			mutate: func(kvs *GGUFMetadataKVs) {
+				_ = kvs.Set("tokenizer.chat_template", GGUFMetadataValueTypeString, strings.Repeat("{{ x }}", 100))
+			},
+			shifted: true,
+		},
+		{
+			name: "shrink header",
+			mutate: func(kvs *GGUFMetadataKVs) {
+				// Delete 700+ bytes, the tensor data moves forward to the aligned end of the header.
+				kvs.Delete("tokenizer.chat_template")
+			},
+			shifted: true,
+		},
+		{
+			name: "shrink header within padding",
+			mutate: func(kvs *GGUFMetadataKVs) {
+				_ = kvs.Set("general.name", GGUFMetadataValueTypeString, "ba")
+			},
+			shifted: false,
+		},
+		{
+			name: "rename key",
+			mutate: func(kvs *GGUFMetadataKVs) {
+				_ = kvs.Rename("general.name", "general.basename")
+			},
+			shifted: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gf, err := ParseGGUFFile(p, UseRawStrings())
+			require.NoError(t, err)
+			kvs := gf.Header.MetadataKV
+			tc.mutate(&kvs)
+
+			shifted, err := RewriteGGUFFileMetadata(p, kvs)
+			require.NoError(t, err)
+			assert.Equal(t, tc.shifted, shifted)
+
+			b, err := os.ReadFile(p)
+			require.NoError(t, err)
+			gf1, err := ParseGGUFFile(p, UseRawStrings())
+			require.NoError(t, err)
+			require.Len(t, gf1.Header.MetadataKV, len(kvs))
+			for i := range kvs {
+				assert.Equal(t, kvs[i].Key, gf1.Header.MetadataKV[i].Key)
+				if kvs[i].ValueType == GGUFMetadataValueTypeArray {
+					// The offset of the array moves along with the header.
+					assert.Equal(t, kvs[i].ValueArray().Array, gf1.Header.MetadataKV[i].ValueArray().Array)
+					continue
+				}
+				assert.Equal(t, kvs[i].Value, gf1.Header.MetadataKV[i].Value)
+			}
+			for _, u := range untouched {
+				assert.True(t, bytes.Contains(b[:gf1.TensorDataStartOffset], u))
+			}
+			assert.Equal(t, src, b[gf1.TensorDataStartOffset:gf1.TensorDataStartOffset+int64(len(src))])
+			assert.Equal(t, gf1.TensorDataStartOffset+int64(len(src)), int64(len(b)))
+
+			// The temporary file is renamed, and the file mode is kept.
+			es, err := os.ReadDir(filepath.Dir(p))
+			require.NoError(t, err)
+			assert.Len(t, es, 1)
+			fi, err := os.Stat(p)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+		})
+	}
+}
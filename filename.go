@@ -2,6 +2,7 @@ package gguf_parser
 
 import (
 	"fmt"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
@@ -104,6 +105,115 @@ func (gn GGUFFilename) IsShard() bool {
 	return ptr.Deref(gn.Shard, 0) > 0 && ptr.Deref(gn.ShardTotal, 0) > 0
 }
 
+// SuggestedFilename returns the GGUFFilename derived from the contents of the GGUF file,
+// following the GGUF naming convention as llama.cpp convert_hf_to_gguf.py does.
+//
+// The BaseName, FineTune, Version and SizeLabel prefer the "general.*" metadata,
+// the SizeLabel is computed from the ModelParameters and the ExpertCount if missing, e.g. "8x7.2B".
+// The Encoding is derived from the GGUFFileType,
+// and the Type is "LoRA" for the LoRA adapters or "vocab" for the vocabulary only files.
+//
+// If the GGUF file is split, the Shard is 1 and the ShardTotal is the number of the split files,
+// use CompleteShardGGUFFilename to get the names of all shards.
+func (gf *GGUFFile) SuggestedFilename() GGUFFilename {
+	var (
+		gm = gf.Metadata()
+		gn GGUFFilename
+	)
+
+	switch {
+	case gm.Basename != "":
+		gn.BaseName = gm.Basename
+	case gm.Name != "":
+		gn.BaseName = gm.Name
+	default:
+		gn.BaseName = "ggml model"
+	}
+	// Keep the same form as ParseGGUFFilename, which separates the words of the BaseName with spaces.
+	gn.BaseName = strings.NewReplacer("/", " ", "-", " ").Replace(strings.TrimSpace(gn.BaseName))
+	gn.FineTune = strings.ReplaceAll(strings.TrimSpace(gm.Finetune), " ", "-")
+	if v := strings.ReplaceAll(strings.TrimSpace(gm.Version), " ", "-"); v != "" {
+		if v[0] >= '0' && v[0] <= '9' {
+			v = "v" + v
+		}
+		gn.Version = v
+	}
+
+	switch {
+	case gm.Type == "adapter":
+		if gf.Architecture().AdapterType == "lora" {
+			gn.Type = "LoRA"
+		}
+	case len(gf.TensorInfos) == 0:
+		if _, ok := gf.Header.MetadataKV.Get("tokenizer.ggml.model"); ok {
+			gn.Type = "vocab"
+		}
+	}
+
+	gn.SizeLabel = strings.ReplaceAll(strings.TrimSpace(gm.SizeLabel), " ", "-")
+	if gn.SizeLabel == "" && gm.Type == "model" && gf.ModelParameters != 0 {
+		gn.SizeLabel = gf.sizeLabel()
+	}
+
+	if gm.FileType < _GGUFFileTypeCount && len(gf.TensorInfos) != 0 {
+		// The GGUFFileType string is in the form of "<GGMLType>/<llama.cpp file type>",
+		// select the llama.cpp file type if declared by "general.file_type".
+		ft := gm.FileType.String()
+		if i := strings.Index(ft, "/"); i >= 0 {
+			if _, ok := gf.Header.MetadataKV.Get("general.file_type"); ok {
+				ft = ft[i+1:]
+			} else {
+				ft = ft[:i]
+			}
+		}
+		gn.Encoding = strings.ToUpper(ft)
+	}
+
+	if v, ok := gf.Header.MetadataKV.Get("split.count"); ok {
+		if n := ValueNumeric[int](v); n > 1 {
+			gn.Shard, gn.ShardTotal = ptr.To(1), ptr.To(n)
+		}
+	}
+
+	return gn
+}
+
+// sizeLabel returns the size label computed from the ModelParameters,
+// for MoE models, it is in the form of "<expert count>x<shared parameters + parameters per expert>".
+func (gf *GGUFFile) sizeLabel() string {
+	total := uint64(gf.ModelParameters)
+	if ec := uint64(gf.Architecture().ExpertCount); ec > 0 {
+		var exps uint64
+		for i := range gf.TensorInfos {
+			if strings.Contains(gf.TensorInfos[i].Name, "_exps.") {
+				exps += gf.TensorInfos[i].Elements()
+			}
+		}
+		if exps != 0 && exps < total {
+			return fmt.Sprintf("%dx%s", ec, roundedParametersNotation(total-exps+exps/ec))
+		}
+	}
+	return roundedParametersNotation(total)
+}
+
+// roundedParametersNotation returns the rounded notation of the given number of parameters,
+// keeping at least 2 significant digits, e.g. 7241732096 -> "7.2B", 70553706496 -> "71B".
+func roundedParametersNotation(n uint64) string {
+	v, suffix := float64(n), "K"
+	switch {
+	case v > 1e12:
+		v, suffix = v*1e-12, "T"
+	case v > 1e9:
+		v, suffix = v*1e-9, "B"
+	case v > 1e6:
+		v, suffix = v*1e-6, "M"
+	default:
+		v *= 1e-3
+	}
+	fix := max(2-len(strings.TrimLeft(strconv.FormatFloat(math.Round(v), 'f', 0, 64), "0")), 0)
+	return strconv.FormatFloat(v, 'f', fix, 64) + suffix
+}
+
 var ShardGGUFFilenameRegex = regexp.MustCompile(`^(?P<Prefix>.*)-(?:(?P<Shard>\d{5})-of-(?P<ShardTotal>\d{5}))\.gguf$`)
 
 // IsShardGGUFFilename returns true if the given filename is a shard GGUF filename.
@@ -253,3 +253,119 @@ func TestCompleteShardGGUFFilename(t *testing.T) {
 		})
 	}
 }
+
+func TestGGUFFile_SuggestedFilename(t *testing.T) {
+	str := func(k, v string) GGUFMetadataKV {
+		return GGUFMetadataKV{Key: k, ValueType: GGUFMetadataValueTypeString, Value: v}
+	}
+	u32 := func(k string, v uint32) GGUFMetadataKV {
+		return GGUFMetadataKV{Key: k, ValueType: GGUFMetadataValueTypeUint32, Value: v}
+	}
+	tensor := func(name string, typ GGMLType, dims ...uint64) GGUFTensorInfo {
+		return GGUFTensorInfo{Name: name, NDimensions: uint32(len(dims)), Dimensions: dims, Type: typ}
+	}
+
+	cases := []struct {
+		name     string
+		given    GGUFFile
+		expected string
+	}{
+		{
+			name: "metadata",
+			given: GGUFFile{
+				Header: GGUFHeader{MetadataKV: GGUFMetadataKVs{
+					str("general.architecture", "llama"),
+					str("general.name", "Meta Llama 3.1 8B Instruct"),
+					str("general.basename", "Meta-Llama-3.1"),
+					str("general.finetune", "Instruct"),
+					str("general.size_label", "8B"),
+					u32("general.file_type", 15),
+				}},
+				TensorInfos:     GGUFTensorInfos{tensor("blk.0.attn_q.weight", GGMLTypeQ4_K, 4096, 4096)},
+				ModelParameters: 8030261248,
+			},
+			expected: "Meta-Llama-3.1-8B-Instruct-Q4_K_M.gguf",
+		},
+		{
+			name: "computed size label",
+			given: GGUFFile{
+				Header: GGUFHeader{MetadataKV: GGUFMetadataKVs{
+					str("general.architecture", "qwen2"),
+					str("general.name", "Qwen2"),
+					str("general.version", "1.5"),
+				}},
+				TensorInfos: GGUFTensorInfos{
+					tensor("blk.0.attn_q.weight", GGMLTypeF16, 1024, 1024),
+					tensor("blk.1.attn_q.weight", GGMLTypeF16, 1024, 1024),
+				},
+				ModelParameters: 494032768,
+			},
+			expected: "Qwen2-494M-v1.5-F16.gguf",
+		},
+		{
+			name: "mixture of experts",
+			given: GGUFFile{
+				Header: GGUFHeader{MetadataKV: GGUFMetadataKVs{
+					str("general.architecture", "llama"),
+					str("general.basename", "Mixtral"),
+					u32("llama.expert_count", 8),
+					GGUFMetadataKV{Key: "split.count", ValueType: GGUFMetadataValueTypeUint16, Value: uint16(2)},
+				}},
+				TensorInfos: GGUFTensorInfos{
+					tensor("blk.0.attn_q.weight", GGMLTypeQ8_0, 1000, 1000),
+					tensor("blk.0.ffn_up_exps.weight", GGMLTypeQ8_0, 1000, 4000, 8),
+					tensor("blk.1.attn_q.weight", GGMLTypeQ8_0, 1000, 1000),
+				},
+				ModelParameters: 34000000,
+			},
+			expected: "Mixtral-8x6.0M-Q8_0-00001-of-00002.gguf",
+		},
+		{
+			name: "lora",
+			given: GGUFFile{
+				Header: GGUFHeader{MetadataKV: GGUFMetadataKVs{
+					str("general.type", "adapter"),
+					str("general.architecture", "llama"),
+					str("general.basename", "My Adapter"),
+					str("adapter.type", "lora"),
+				}},
+				TensorInfos:     GGUFTensorInfos{tensor("blk.0.attn_q.weight.lora_a", GGMLTypeF32, 16, 4096)},
+				ModelParameters: 65536,
+			},
+			expected: "My-Adapter-F32-LoRA.gguf",
+		},
+		{
+			name: "vocab",
+			given: GGUFFile{
+				Header: GGUFHeader{MetadataKV: GGUFMetadataKVs{
+					str("general.architecture", "llama"),
+					str("tokenizer.ggml.model", "gpt2"),
+				}},
+			},
+			expected: "ggml-model-vocab.gguf",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := tc.given.SuggestedFilename()
+			assert.Equal(t, tc.expected, actual.String())
+			if actual.SizeLabel != "" {
+				assert.Equal(t, &actual, ParseGGUFFilename(actual.String()), "round trip")
+			}
+		})
+	}
+}
+
+func TestRoundedParametersNotation(t *testing.T) {
+	cases := map[uint64]string{
+		7241732096:    "7.2B",
+		70553706496:   "71B",
+		494032768:     "494M",
+		1100048384:    "1.1B",
+		1500000000000: "1.5T",
+		135000:        "135K",
+	}
+	for given, expected := range cases {
+		assert.Equal(t, expected, roundedParametersNotation(given))
+	}
+}
@@ -173,6 +173,10 @@ const (
 	// GGMLObjectSize is the size of GGML object in bytes,
 	// see https://github.com/ggerganov/ggml/blob/0cbb7c0e053f5419cfbebb46fbf4d4ed60182cf5/include/ggml/ggml.h#L563.
 	GGMLObjectSize = 32
+
+	// GGMLMaxDims is the maximum number of dimensions of GGML tensor,
+	// see https://github.com/ggerganov/ggml/blob/0cbb7c0e053f5419cfbebb46fbf4d4ed60182cf5/include/ggml/ggml.h#L224.
+	GGMLMaxDims = 4
 )
 
 // GGMLTensorOverhead is the overhead of GGML tensor in bytes,
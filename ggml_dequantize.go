@@ -0,0 +1,644 @@
+package gguf_parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// _GGMLDequantizers is a table of dequantize functions for GGMLType,
+// each function dequantizes one block of the given GGMLType.
+//
+// The repacked GGMLTypes, e.g. GGMLTypeQ4_0_4_4, are not supported yet.
+var _GGMLDequantizers = map[GGMLType]func(b []byte, y []float32){
+	GGMLTypeF32:     dequantizeF32,
+	GGMLTypeF16:     dequantizeF16,
+	GGMLTypeBF16:    dequantizeBF16,
+	GGMLTypeF64:     dequantizeF64,
+	GGMLTypeI8:      dequantizeI8,
+	GGMLTypeI16:     dequantizeI16,
+	GGMLTypeI32:     dequantizeI32,
+	GGMLTypeI64:     dequantizeI64,
+	GGMLTypeQ4_0:    dequantizeQ4_0,
+	GGMLTypeQ4_1:    dequantizeQ4_1,
+	GGMLTypeQ5_0:    dequantizeQ5_0,
+	GGMLTypeQ5_1:    dequantizeQ5_1,
+	GGMLTypeQ8_0:    dequantizeQ8_0,
+	GGMLTypeQ8_1:    dequantizeQ8_1,
+	GGMLTypeQ2_K:    dequantizeQ2_K,
+	GGMLTypeQ3_K:    dequantizeQ3_K,
+	GGMLTypeQ4_K:    dequantizeQ4_K,
+	GGMLTypeQ5_K:    dequantizeQ5_K,
+	GGMLTypeQ6_K:    dequantizeQ6_K,
+	GGMLTypeQ8_K:    dequantizeQ8_K,
+	GGMLTypeIQ2_XXS: dequantizeIQ2_XXS,
+	GGMLTypeIQ2_XS:  dequantizeIQ2_XS,
+	GGMLTypeIQ2_S:   dequantizeIQ2_S,
+	GGMLTypeIQ3_XXS: dequantizeIQ3_XXS,
+	GGMLTypeIQ3_S:   dequantizeIQ3_S,
+	GGMLTypeIQ1_S:   dequantizeIQ1_S,
+	GGMLTypeIQ1_M:   dequantizeIQ1_M,
+	GGMLTypeIQ4_NL:  dequantizeIQ4_NL,
+	GGMLTypeIQ4_XS:  dequantizeIQ4_XS,
+	GGMLTypeTQ1_0:   dequantizeTQ1_0,
+	GGMLTypeTQ2_0:   dequantizeTQ2_0,
+}
+
+// IsDequantizable returns whether the GGMLType can be dequantized by Dequantize.
+func (t GGMLType) IsDequantizable() bool {
+	_, ok := _GGMLDequantizers[t]
+	return ok
+}
+
+// Dequantize dequantizes the given data of the given GGMLType to float32 values,
+// which is inspired by
+// https://github.com/ggerganov/llama.cpp/blob/b34e02348064c2f0cef1f89b44d9bee4eb15b9e7/ggml/src/ggml-quants.c.
+//
+// The given data must be in little-endian as GGML stores,
+// and the length of the given data must be a multiple of the GGMLType's block size in bytes.
+//
+// Dequantize returns an error if the GGMLType is not dequantizable or the data is malformed.
+func Dequantize(t GGMLType, data []byte) ([]float32, error) {
+	fn, ok := _GGMLDequantizers[t]
+	if !ok {
+		return nil, fmt.Errorf("unsupported type: %v", t)
+	}
+	tt, _ := t.Trait()
+	if uint64(len(data))%tt.TypeSize != 0 {
+		return nil, fmt.Errorf("invalid %v data size: %d", t, len(data))
+	}
+
+	nb := uint64(len(data)) / tt.TypeSize
+	y := make([]float32, nb*tt.BlockSize)
+	for i := uint64(0); i < nb; i++ {
+		fn(data[i*tt.TypeSize:(i+1)*tt.TypeSize], y[i*tt.BlockSize:(i+1)*tt.BlockSize])
+	}
+	return y, nil
+}
+
+// float16ToFloat32 converts the given IEEE 754 half precision bits to float32.
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+
+	switch exp {
+	case 0:
+		if mant == 0 {
+			return math.Float32frombits(sign)
+		}
+		// Subnormal, normalize it.
+		exp = 127 - 15 + 1
+		for mant&0x400 == 0 {
+			mant <<= 1
+			exp--
+		}
+		mant &= 0x3ff
+	case 0x1f:
+		// Inf or NaN.
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	default:
+		exp += 127 - 15
+	}
+	return math.Float32frombits(sign | exp<<23 | mant<<13)
+}
+
+func readFloat16(b []byte) float32 {
+	return float16ToFloat32(binary.LittleEndian.Uint16(b))
+}
+
+func dequantizeF32(b []byte, y []float32) {
+	y[0] = math.Float32frombits(binary.LittleEndian.Uint32(b))
+}
+
+func dequantizeF16(b []byte, y []float32) {
+	y[0] = readFloat16(b)
+}
+
+func dequantizeBF16(b []byte, y []float32) {
+	y[0] = math.Float32frombits(uint32(binary.LittleEndian.Uint16(b)) << 16)
+}
+
+func dequantizeF64(b []byte, y []float32) {
+	y[0] = float32(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+}
+
+func dequantizeI8(b []byte, y []float32) {
+	y[0] = float32(int8(b[0]))
+}
+
+func dequantizeI16(b []byte, y []float32) {
+	y[0] = float32(int16(binary.LittleEndian.Uint16(b)))
+}
+
+func dequantizeI32(b []byte, y []float32) {
+	y[0] = float32(int32(binary.LittleEndian.Uint32(b)))
+}
+
+func dequantizeI64(b []byte, y []float32) {
+	y[0] = float32(int64(binary.LittleEndian.Uint64(b)))
+}
+
+// dequantizeQ4_0 dequantizes a block_q4_0{d, qs[16]}.
+func dequantizeQ4_0(b []byte, y []float32) {
+	d := readFloat16(b)
+	qs := b[2:18]
+	for j := 0; j < 16; j++ {
+		y[j] = float32(int(qs[j]&0x0f)-8) * d
+		y[j+16] = float32(int(qs[j]>>4)-8) * d
+	}
+}
+
+// dequantizeQ4_1 dequantizes a block_q4_1{d, m, qs[16]}.
+func dequantizeQ4_1(b []byte, y []float32) {
+	d, m := readFloat16(b), readFloat16(b[2:])
+	qs := b[4:20]
+	for j := 0; j < 16; j++ {
+		y[j] = float32(qs[j]&0x0f)*d + m
+		y[j+16] = float32(qs[j]>>4)*d + m
+	}
+}
+
+// dequantizeQ5_0 dequantizes a block_q5_0{d, qh[4], qs[16]}.
+func dequantizeQ5_0(b []byte, y []float32) {
+	d := readFloat16(b)
+	qh := binary.LittleEndian.Uint32(b[2:])
+	qs := b[6:22]
+	for j := 0; j < 16; j++ {
+		xh0 := byte((qh>>j)<<4) & 0x10
+		xh1 := byte(qh>>(j+12)) & 0x10
+		y[j] = float32(int(qs[j]&0x0f|xh0)-16) * d
+		y[j+16] = float32(int(qs[j]>>4|xh1)-16) * d
+	}
+}
+
+// dequantizeQ5_1 dequantizes a block_q5_1{d, m, qh[4], qs[16]}.
+func dequantizeQ5_1(b []byte, y []float32) {
+	d, m := readFloat16(b), readFloat16(b[2:])
+	qh := binary.LittleEndian.Uint32(b[4:])
+	qs := b[8:24]
+	for j := 0; j < 16; j++ {
+		xh0 := byte((qh>>j)<<4) & 0x10
+		xh1 := byte(qh>>(j+12)) & 0x10
+		y[j] = float32(qs[j]&0x0f|xh0)*d + m
+		y[j+16] = float32(qs[j]>>4|xh1)*d + m
+	}
+}
+
+// dequantizeQ8_0 dequantizes a block_q8_0{d, qs[32]}.
+func dequantizeQ8_0(b []byte, y []float32) {
+	d := readFloat16(b)
+	qs := b[2:34]
+	for j := 0; j < 32; j++ {
+		y[j] = float32(int8(qs[j])) * d
+	}
+}
+
+// dequantizeQ8_1 dequantizes a block_q8_1{d, s, qs[32]}.
+func dequantizeQ8_1(b []byte, y []float32) {
+	d := readFloat16(b)
+	qs := b[4:36]
+	for j := 0; j < 32; j++ {
+		y[j] = float32(int8(qs[j])) * d
+	}
+}
+
+// dequantizeQ2_K dequantizes a block_q2_K{scales[16], qs[64], d, dmin}.
+func dequantizeQ2_K(b []byte, y []float32) {
+	scales, q := b[0:16], b[16:80]
+	d, dmin := readFloat16(b[80:]), readFloat16(b[82:])
+
+	var is, k int
+	for n := 0; n < 256; n += 128 {
+		var shift uint
+		for j := 0; j < 4; j++ {
+			sc := scales[is]
+			is++
+			dl, ml := d*float32(sc&0x0f), dmin*float32(sc>>4)
+			for l := 0; l < 16; l++ {
+				y[k] = dl*float32((q[l]>>shift)&3) - ml
+				k++
+			}
+
+			sc = scales[is]
+			is++
+			dl, ml = d*float32(sc&0x0f), dmin*float32(sc>>4)
+			for l := 0; l < 16; l++ {
+				y[k] = dl*float32((q[l+16]>>shift)&3) - ml
+				k++
+			}
+
+			shift += 2
+		}
+		q = q[32:]
+	}
+}
+
+// dequantizeQ3_K dequantizes a block_q3_K{hmask[32], qs[64], scales[12], d}.
+func dequantizeQ3_K(b []byte, y []float32) {
+	const (
+		kmask1 = 0x03030303
+		kmask2 = 0x0f0f0f0f
+	)
+
+	hm, q := b[0:32], b[32:96]
+	d := readFloat16(b[108:])
+
+	var scales [16]int8
+	{
+		var aux [4]uint32
+		aux[0] = binary.LittleEndian.Uint32(b[96:])
+		aux[1] = binary.LittleEndian.Uint32(b[100:])
+		tmp := binary.LittleEndian.Uint32(b[104:])
+		aux[2] = ((aux[0] >> 4) & kmask2) | (((tmp >> 4) & kmask1) << 4)
+		aux[3] = ((aux[1] >> 4) & kmask2) | (((tmp >> 6) & kmask1) << 4)
+		aux[0] = (aux[0] & kmask2) | (((tmp >> 0) & kmask1) << 4)
+		aux[1] = (aux[1] & kmask2) | (((tmp >> 2) & kmask1) << 4)
+		for i := range scales {
+			scales[i] = int8(aux[i/4] >> (8 * (i % 4)))
+		}
+	}
+
+	var (
+		is, k int
+		m     byte = 1
+	)
+	for n := 0; n < 256; n += 128 {
+		var shift uint
+		for j := 0; j < 4; j++ {
+			dl := d * float32(int(scales[is])-32)
+			is++
+			for l := 0; l < 16; l++ {
+				v := int((q[l] >> shift) & 3)
+				if hm[l]&m == 0 {
+					v -= 4
+				}
+				y[k] = dl * float32(v)
+				k++
+			}
+
+			dl = d * float32(int(scales[is])-32)
+			is++
+			for l := 0; l < 16; l++ {
+				v := int((q[l+16] >> shift) & 3)
+				if hm[l+16]&m == 0 {
+					v -= 4
+				}
+				y[k] = dl * float32(v)
+				k++
+			}
+
+			shift += 2
+			m <<= 1
+		}
+		q = q[32:]
+	}
+}
+
+// getScaleMinK4 returns the scale and min of the j-th sub-block of the K-quants,
+// see https://github.com/ggerganov/llama.cpp/blob/b34e02348064c2f0cef1f89b44d9bee4eb15b9e7/ggml/src/ggml-quants.c#L1802-L1810.
+func getScaleMinK4(j int, q []byte) (d, m byte) {
+	if j < 4 {
+		return q[j] & 63, q[j+4] & 63
+	}
+	return (q[j+4] & 0x0f) | ((q[j-4] >> 6) << 4), (q[j+4] >> 4) | ((q[j] >> 6) << 4)
+}
+
+// dequantizeQ4_K dequantizes a block_q4_K{d, dmin, scales[12], qs[128]}.
+func dequantizeQ4_K(b []byte, y []float32) {
+	d, dmin := readFloat16(b), readFloat16(b[2:])
+	scales, q := b[4:16], b[16:144]
+
+	var is, k int
+	for j := 0; j < 256; j += 64 {
+		sc, m := getScaleMinK4(is, scales)
+		d1, m1 := d*float32(sc), dmin*float32(m)
+		sc, m = getScaleMinK4(is+1, scales)
+		d2, m2 := d*float32(sc), dmin*float32(m)
+		for l := 0; l < 32; l++ {
+			y[k] = d1*float32(q[l]&0x0f) - m1
+			k++
+		}
+		for l := 0; l < 32; l++ {
+			y[k] = d2*float32(q[l]>>4) - m2
+			k++
+		}
+		q = q[32:]
+		is += 2
+	}
+}
+
+// dequantizeQ5_K dequantizes a block_q5_K{d, dmin, scales[12], qh[32], qs[128]}.
+func dequantizeQ5_K(b []byte, y []float32) {
+	d, dmin := readFloat16(b), readFloat16(b[2:])
+	scales, qh, ql := b[4:16], b[16:48], b[48:176]
+
+	var (
+		is, k  int
+		u1, u2 byte = 1, 2
+	)
+	for j := 0; j < 256; j += 64 {
+		sc, m := getScaleMinK4(is, scales)
+		d1, m1 := d*float32(sc), dmin*float32(m)
+		sc, m = getScaleMinK4(is+1, scales)
+		d2, m2 := d*float32(sc), dmin*float32(m)
+		for l := 0; l < 32; l++ {
+			v := ql[l] & 0x0f
+			if qh[l]&u1 != 0 {
+				v += 16
+			}
+			y[k] = d1*float32(v) - m1
+			k++
+		}
+		for l := 0; l < 32; l++ {
+			v := ql[l] >> 4
+			if qh[l]&u2 != 0 {
+				v += 16
+			}
+			y[k] = d2*float32(v) - m2
+			k++
+		}
+		ql = ql[32:]
+		is += 2
+		u1 <<= 2
+		u2 <<= 2
+	}
+}
+
+// dequantizeQ6_K dequantizes a block_q6_K{ql[128], qh[64], scales[16], d}.
+func dequantizeQ6_K(b []byte, y []float32) {
+	ql, qh, sc := b[0:128], b[128:192], b[192:208]
+	d := readFloat16(b[208:])
+
+	for n := 0; n < 256; n += 128 {
+		for l := 0; l < 32; l++ {
+			is := l / 16
+			q1 := int((ql[l]&0x0f)|((qh[l]>>0)&3)<<4) - 32
+			q2 := int((ql[l+32]&0x0f)|((qh[l]>>2)&3)<<4) - 32
+			q3 := int((ql[l]>>4)|((qh[l]>>4)&3)<<4) - 32
+			q4 := int((ql[l+32]>>4)|((qh[l]>>6)&3)<<4) - 32
+			y[n+l] = d * float32(int8(sc[is])) * float32(q1)
+			y[n+l+32] = d * float32(int8(sc[is+2])) * float32(q2)
+			y[n+l+64] = d * float32(int8(sc[is+4])) * float32(q3)
+			y[n+l+96] = d * float32(int8(sc[is+6])) * float32(q4)
+		}
+		ql, qh, sc = ql[64:], qh[32:], sc[8:]
+	}
+}
+
+// dequantizeQ8_K dequantizes a block_q8_K{d, qs[256], bsums[16]}.
+func dequantizeQ8_K(b []byte, y []float32) {
+	d := math.Float32frombits(binary.LittleEndian.Uint32(b))
+	qs := b[4:260]
+	for j := 0; j < 256; j++ {
+		y[j] = d * float32(int8(qs[j]))
+	}
+}
+
+// _GGMLIQ4NLValues is the non-linear values of IQ4_NL and IQ4_XS,
+// see https://github.com/ggerganov/llama.cpp/blob/b34e02348064c2f0cef1f89b44d9bee4eb15b9e7/ggml/src/ggml-common.h#L1061-L1063.
+var _GGMLIQ4NLValues = [16]int8{
+	-127, -104, -83, -65, -49, -35, -22, -10, 1, 13, 25, 38, 53, 69, 89, 113,
+}
+
+// dequantizeIQ4_NL dequantizes a block_iq4_nl{d, qs[16]}.
+func dequantizeIQ4_NL(b []byte, y []float32) {
+	d := readFloat16(b)
+	qs := b[2:18]
+	for j := 0; j < 16; j++ {
+		y[j] = d * float32(_GGMLIQ4NLValues[qs[j]&0x0f])
+		y[j+16] = d * float32(_GGMLIQ4NLValues[qs[j]>>4])
+	}
+}
+
+// dequantizeIQ4_XS dequantizes a block_iq4_xs{d, scales_h, scales_l[4], qs[128]}.
+func dequantizeIQ4_XS(b []byte, y []float32) {
+	d := readFloat16(b)
+	scalesH := binary.LittleEndian.Uint16(b[2:])
+	scalesL, qs := b[4:8], b[8:136]
+
+	for ib := 0; ib < 8; ib++ {
+		ls := int((scalesL[ib/2]>>(4*(ib%2)))&0x0f) | int((scalesH>>(2*ib))&3)<<4
+		dl := d * float32(ls-32)
+		for j := 0; j < 16; j++ {
+			y[ib*32+j] = dl * float32(_GGMLIQ4NLValues[qs[j]&0x0f])
+			y[ib*32+j+16] = dl * float32(_GGMLIQ4NLValues[qs[j]>>4])
+		}
+		qs = qs[16:]
+	}
+}
+
+// iqSign returns -1 if the j-th bit of the given signs is set, otherwise 1.
+func iqSign(signs byte, j int) float32 {
+	if signs&(1<<j) != 0 {
+		return -1
+	}
+	return 1
+}
+
+// dequantizeIQ2_XXS dequantizes a block_iq2_xxs{d, qs[32]}.
+func dequantizeIQ2_XXS(b []byte, y []float32) {
+	d := readFloat16(b)
+	qs := b[2:66]
+
+	for ib := 0; ib < 8; ib++ {
+		aux0 := qs[8*ib : 8*ib+4]
+		aux1 := binary.LittleEndian.Uint32(qs[8*ib+4:])
+		db := d * (0.5 + float32(aux1>>28)) * 0.25
+		for l := 0; l < 4; l++ {
+			grid := _GGMLIQ2XXSGrid[aux0[l]]
+			signs := _GGMLIQ2XSSigns[(aux1>>(7*l))&127]
+			for j := 0; j < 8; j++ {
+				y[ib*32+l*8+j] = db * float32(byte(grid>>(8*j))) * iqSign(signs, j)
+			}
+		}
+	}
+}
+
+// dequantizeIQ2_XS dequantizes a block_iq2_xs{d, qs[32], scales[8]}.
+func dequantizeIQ2_XS(b []byte, y []float32) {
+	d := readFloat16(b)
+	qs, scales := b[2:66], b[66:74]
+
+	for ib := 0; ib < 8; ib++ {
+		db := [2]float32{
+			d * (0.5 + float32(scales[ib]&0x0f)) * 0.25,
+			d * (0.5 + float32(scales[ib]>>4)) * 0.25,
+		}
+		for l := 0; l < 4; l++ {
+			q := binary.LittleEndian.Uint16(qs[2*(4*ib+l):])
+			grid := _GGMLIQ2XSGrid[q&511]
+			signs := _GGMLIQ2XSSigns[q>>9]
+			for j := 0; j < 8; j++ {
+				y[ib*32+l*8+j] = db[l/2] * float32(byte(grid>>(8*j))) * iqSign(signs, j)
+			}
+		}
+	}
+}
+
+// dequantizeIQ2_S dequantizes a block_iq2_s{d, qs[64], qh[8], scales[8]}.
+func dequantizeIQ2_S(b []byte, y []float32) {
+	d := readFloat16(b)
+	qs, signs := b[2:34], b[34:66]
+	qh, scales := b[66:74], b[74:82]
+
+	for ib := 0; ib < 8; ib++ {
+		db := [2]float32{
+			d * (0.5 + float32(scales[ib]&0x0f)) * 0.25,
+			d * (0.5 + float32(scales[ib]>>4)) * 0.25,
+		}
+		for l := 0; l < 4; l++ {
+			grid := _GGMLIQ2SGrid[uint16(qs[4*ib+l])|(uint16(qh[ib])<<(8-2*l))&0x300]
+			for j := 0; j < 8; j++ {
+				y[ib*32+l*8+j] = db[l/2] * float32(byte(grid>>(8*j))) * iqSign(signs[4*ib+l], j)
+			}
+		}
+	}
+}
+
+// dequantizeIQ3_XXS dequantizes a block_iq3_xxs{d, qs[96]},
+// the last 32 bytes of qs are the scales and signs.
+func dequantizeIQ3_XXS(b []byte, y []float32) {
+	d := readFloat16(b)
+	qs, scalesAndSigns := b[2:66], b[66:98]
+
+	for ib := 0; ib < 8; ib++ {
+		aux := binary.LittleEndian.Uint32(scalesAndSigns[4*ib:])
+		db := d * (0.5 + float32(aux>>28)) * 0.5
+		for l := 0; l < 4; l++ {
+			signs := _GGMLIQ2XSSigns[(aux>>(7*l))&127]
+			grid1 := _GGMLIQ3XXSGrid[qs[8*ib+2*l]]
+			grid2 := _GGMLIQ3XXSGrid[qs[8*ib+2*l+1]]
+			for j := 0; j < 4; j++ {
+				y[ib*32+l*8+j] = db * float32(byte(grid1>>(8*j))) * iqSign(signs, j)
+				y[ib*32+l*8+j+4] = db * float32(byte(grid2>>(8*j))) * iqSign(signs, j+4)
+			}
+		}
+	}
+}
+
+// dequantizeIQ3_S dequantizes a block_iq3_s{d, qs[64], qh[8], signs[32], scales[4]}.
+func dequantizeIQ3_S(b []byte, y []float32) {
+	d := readFloat16(b)
+	qs, qh := b[2:66], b[66:74]
+	signs, scales := b[74:106], b[106:110]
+
+	for ib := 0; ib < 8; ib++ {
+		db := d * float32(1+2*((scales[ib/2]>>(4*(ib%2)))&0x0f))
+		for l := 0; l < 4; l++ {
+			grid1 := _GGMLIQ3SGrid[uint16(qs[8*ib+2*l])|(uint16(qh[ib])<<(8-2*l))&256]
+			grid2 := _GGMLIQ3SGrid[uint16(qs[8*ib+2*l+1])|(uint16(qh[ib])<<(7-2*l))&256]
+			for j := 0; j < 4; j++ {
+				y[ib*32+l*8+j] = db * float32(byte(grid1>>(8*j))) * iqSign(signs[4*ib+l], j)
+				y[ib*32+l*8+j+4] = db * float32(byte(grid2>>(8*j))) * iqSign(signs[4*ib+l], j+4)
+			}
+		}
+	}
+}
+
+// _GGMLIQ1SDelta is the delta of IQ1_S and IQ1_M,
+// see https://github.com/ggml-org/llama.cpp/blob/master/ggml/src/ggml-common.h.
+const _GGMLIQ1SDelta = 0.125
+
+// dequantizeIQ1_S dequantizes a block_iq1_s{d, qs[32], qh[8]}.
+func dequantizeIQ1_S(b []byte, y []float32) {
+	d := readFloat16(b)
+	qs, qh := b[2:34], b[34:50]
+
+	for ib := 0; ib < 8; ib++ {
+		h := binary.LittleEndian.Uint16(qh[2*ib:])
+		dl := d * float32(2*((h>>12)&7)+1)
+		delta := float32(_GGMLIQ1SDelta)
+		if h&0x8000 != 0 {
+			delta = -delta
+		}
+		for l := 0; l < 4; l++ {
+			grid := _GGMLIQ1SGrid[uint16(qs[4*ib+l])|((h>>(3*l))&7)<<8]
+			for j := 0; j < 8; j++ {
+				y[ib*32+l*8+j] = dl * (float32(int8(grid>>(8*j))) + delta)
+			}
+		}
+	}
+}
+
+// dequantizeIQ1_M dequantizes a block_iq1_m{qs[32], qh[16], scales[8]},
+// the scale of the block is packed in the top 4 bits of each 16-bit scales.
+func dequantizeIQ1_M(b []byte, y []float32) {
+	qs, qh, scales := b[0:32], b[32:48], b[48:56]
+
+	var sc [4]uint16
+	for i := range sc {
+		sc[i] = binary.LittleEndian.Uint16(scales[2*i:])
+	}
+	d := float16ToFloat32((sc[0] >> 12) | ((sc[1] >> 8) & 0x00f0) | ((sc[2] >> 4) & 0x0f00) | (sc[3] & 0xf000))
+
+	for ib := 0; ib < 8; ib++ {
+		dl := [2]float32{
+			d * float32(2*((sc[ib/2]>>(6*(ib%2)+0))&7)+1),
+			d * float32(2*((sc[ib/2]>>(6*(ib%2)+3))&7)+1),
+		}
+		h0, h1 := uint16(qh[2*ib]), uint16(qh[2*ib+1])
+		idx := [4]uint16{
+			uint16(qs[4*ib+0]) | (h0<<8)&0x700,
+			uint16(qs[4*ib+1]) | (h0<<4)&0x700,
+			uint16(qs[4*ib+2]) | (h1<<8)&0x700,
+			uint16(qs[4*ib+3]) | (h1<<4)&0x700,
+		}
+		hs := [4]uint16{h0 & 0x08, h0 & 0x80, h1 & 0x08, h1 & 0x80}
+		for l := 0; l < 4; l++ {
+			delta := float32(_GGMLIQ1SDelta)
+			if hs[l] != 0 {
+				delta = -delta
+			}
+			grid := _GGMLIQ1SGrid[idx[l]]
+			for j := 0; j < 8; j++ {
+				y[ib*32+l*8+j] = dl[l/2] * (float32(int8(grid>>(8*j))) + delta)
+			}
+		}
+	}
+}
+
+// dequantizeTQ1_0 dequantizes a block_tq1_0{qs[48], qh[4], d}.
+func dequantizeTQ1_0(b []byte, y []float32) {
+	pow3 := [6]byte{1, 3, 9, 27, 81, 243}
+
+	qs, qh := b[0:48], b[48:52]
+	d := readFloat16(b[52:])
+
+	var k int
+	ternary := func(q byte) {
+		y[k] = float32(int((uint16(q)*3)>>8)-1) * d
+		k++
+	}
+	for n := 0; n < 5; n++ {
+		for m := 0; m < 32; m++ {
+			ternary(qs[m] * pow3[n])
+		}
+	}
+	for n := 0; n < 5; n++ {
+		for m := 0; m < 16; m++ {
+			ternary(qs[32+m] * pow3[n])
+		}
+	}
+	for n := 0; n < 4; n++ {
+		for j := 0; j < 4; j++ {
+			ternary(qh[j] * pow3[n])
+		}
+	}
+}
+
+// dequantizeTQ2_0 dequantizes a block_tq2_0{qs[64], d}.
+func dequantizeTQ2_0(b []byte, y []float32) {
+	qs := b[0:64]
+	d := readFloat16(b[64:])
+
+	var k int
+	for j := 0; j < 64; j += 32 {
+		for l := 0; l < 4; l++ {
+			for m := 0; m < 32; m++ {
+				y[k] = float32(int((qs[j+m]>>(l*2))&3)-1) * d
+				k++
+			}
+		}
+	}
+}
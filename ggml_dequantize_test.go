@@ -0,0 +1,388 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFloat16ToFloat32(t *testing.T) {
+	cases := []struct {
+		given    uint16
+		expected float32
+	}{
+		{0x0000, 0},
+		{0x3c00, 1},
+		{0xc000, -2},
+		{0x3800, 0.5},
+		{0x7bff, 65504},
+		{0x0001, float32(math.Pow(2, -24))},
+		{0x7c00, float32(math.Inf(1))},
+		{0xfc00, float32(math.Inf(-1))},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.expected, float16ToFloat32(tc.given), "0x%04x", tc.given)
+	}
+	assert.True(t, math.IsNaN(float64(float16ToFloat32(0x7e00))))
+}
+
+func TestDequantize(t *testing.T) {
+	f16 := func(v uint16) []byte {
+		return binary.LittleEndian.AppendUint16(nil, v)
+	}
+	rep := func(b byte, n int) []byte {
+		return bytes.Repeat([]byte{b}, n)
+	}
+	seq := func(n int, fn func(j int) byte) []byte {
+		r := make([]byte, n)
+		for j := range r {
+			r[j] = fn(j)
+		}
+		return r
+	}
+	join := func(bs ...[]byte) []byte {
+		return bytes.Join(bs, nil)
+	}
+
+	cases := []struct {
+		name     string
+		typ      GGMLType
+		given    []byte
+		expected func(k int) float32
+	}{
+		{
+			name:  "F32",
+			typ:   GGMLTypeF32,
+			given: binary.LittleEndian.AppendUint32(nil, math.Float32bits(-1.5)),
+			expected: func(k int) float32 {
+				return -1.5
+			},
+		},
+		{
+			name:  "F16",
+			typ:   GGMLTypeF16,
+			given: join(f16(0x3c00), f16(0xc000)),
+			expected: func(k int) float32 {
+				return []float32{1, -2}[k]
+			},
+		},
+		{
+			name:  "BF16",
+			typ:   GGMLTypeBF16,
+			given: join(f16(0x3f80), f16(0xc0a0)),
+			expected: func(k int) float32 {
+				return []float32{1, -5}[k]
+			},
+		},
+		{
+			name: "Q4_0",
+			typ:  GGMLTypeQ4_0,
+			given: join(f16(0x3800), seq(16, func(j int) byte {
+				return byte(j | (15-j)<<4)
+			})),
+			expected: func(k int) float32 {
+				if k < 16 {
+					return float32(k-8) * 0.5
+				}
+				return float32(7-(k-16)) * 0.5
+			},
+		},
+		{
+			name: "Q4_1",
+			typ:  GGMLTypeQ4_1,
+			given: join(f16(0x3c00), f16(0xc000), seq(16, func(j int) byte {
+				return byte(j | j<<4)
+			})),
+			expected: func(k int) float32 {
+				return float32(k%16) - 2
+			},
+		},
+		{
+			name: "Q5_0",
+			typ:  GGMLTypeQ5_0,
+			given: join(f16(0x3c00), binary.LittleEndian.AppendUint32(nil, 0x000fffff), seq(16, func(j int) byte {
+				return byte(j | j<<4)
+			})),
+			expected: func(k int) float32 {
+				if k < 20 {
+					return float32(k % 16)
+				}
+				return float32(k%16) - 16
+			},
+		},
+		{
+			name: "Q5_1",
+			typ:  GGMLTypeQ5_1,
+			given: join(f16(0x3c00), f16(0x3800), binary.LittleEndian.AppendUint32(nil, 0xffffffff), seq(16, func(j int) byte {
+				return byte(j | j<<4)
+			})),
+			expected: func(k int) float32 {
+				return float32(k%16+16) + 0.5
+			},
+		},
+		{
+			name: "Q8_0",
+			typ:  GGMLTypeQ8_0,
+			given: join(f16(0x4000), seq(32, func(j int) byte {
+				return byte(int8(j - 16))
+			})),
+			expected: func(k int) float32 {
+				return float32(k-16) * 2
+			},
+		},
+		{
+			name:  "Q2_K",
+			typ:   GGMLTypeQ2_K,
+			given: join(rep(0x21, 16), rep(0xe4, 64), f16(0x3c00), f16(0x3800)),
+			expected: func(k int) float32 {
+				return float32((k%128)/32) - 1
+			},
+		},
+		{
+			name:  "Q3_K",
+			typ:   GGMLTypeQ3_K,
+			given: join(rep(0xff, 32), rep(0xe4, 64), rep(0x11, 8), rep(0xaa, 4), f16(0x3c00)),
+			expected: func(k int) float32 {
+				return float32((k % 128) / 32)
+			},
+		},
+		{
+			name:  "Q4_K",
+			typ:   GGMLTypeQ4_K,
+			given: join(f16(0x3c00), f16(0x3c00), rep(0x02, 4), rep(0x01, 4), rep(0x12, 4), rep(0x53, 128)),
+			expected: func(k int) float32 {
+				if k%64 < 32 {
+					return 2*3 - 1
+				}
+				return 2*5 - 1
+			},
+		},
+		{
+			name:  "Q5_K",
+			typ:   GGMLTypeQ5_K,
+			given: join(f16(0x3c00), f16(0x3c00), rep(0x02, 4), rep(0x01, 4), rep(0x12, 4), rep(0xff, 32), rep(0x53, 128)),
+			expected: func(k int) float32 {
+				if k%64 < 32 {
+					return 2*(3+16) - 1
+				}
+				return 2*(5+16) - 1
+			},
+		},
+		{
+			name: "Q6_K",
+			typ:  GGMLTypeQ6_K,
+			given: join(rep(0x21, 128), rep(0xff, 64), seq(16, func(j int) byte {
+				return byte(j + 1)
+			}), f16(0x3c00)),
+			expected: func(k int) float32 {
+				quarter, l := (k%128)/32, k%32
+				sc := float32((k/128)*8 + l/16 + 2*quarter + 1)
+				if quarter < 2 {
+					return sc * 17
+				}
+				return sc * 18
+			},
+		},
+		{
+			name: "Q8_K",
+			typ:  GGMLTypeQ8_K,
+			given: join(binary.LittleEndian.AppendUint32(nil, math.Float32bits(0.25)), seq(256, func(j int) byte {
+				return byte(int8(j - 128))
+			}), rep(0, 32)),
+			expected: func(k int) float32 {
+				return float32(k-128) * 0.25
+			},
+		},
+		{
+			name: "IQ4_NL",
+			typ:  GGMLTypeIQ4_NL,
+			given: join(f16(0x3c00), seq(16, func(j int) byte {
+				return byte(j | (15-j)<<4)
+			})),
+			expected: func(k int) float32 {
+				if k < 16 {
+					return float32(_GGMLIQ4NLValues[k])
+				}
+				return float32(_GGMLIQ4NLValues[15-(k-16)])
+			},
+		},
+		{
+			name: "IQ4_XS",
+			typ:  GGMLTypeIQ4_XS,
+			given: join(f16(0x3c00), f16(0xaaaa), rep(0x11, 4), seq(128, func(j int) byte {
+				return byte(j%16 | (j%16)<<4)
+			})),
+			expected: func(k int) float32 {
+				return float32(_GGMLIQ4NLValues[k%16])
+			},
+		},
+		{
+			name:  "TQ1_0",
+			typ:   GGMLTypeTQ1_0,
+			given: join(rep(128, 48), rep(253, 4), f16(0x4000)),
+			expected: func(k int) float32 {
+				if k < 240 {
+					return 0
+				}
+				return 2
+			},
+		},
+		{
+			name:  "TQ2_0",
+			typ:   GGMLTypeTQ2_0,
+			given: join(rep(0x92, 64), f16(0x3c00)),
+			expected: func(k int) float32 {
+				return []float32{1, -1, 0, 1}[(k%128)/32]
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tt, ok := tc.typ.Trait()
+			assert.True(t, ok)
+			assert.True(t, tc.typ.IsDequantizable())
+			assert.Zero(t, uint64(len(tc.given))%tt.TypeSize, "invalid block size")
+
+			actual, err := Dequantize(tc.typ, tc.given)
+			require.NoError(t, err)
+			assert.Len(t, actual, len(tc.given)/int(tt.TypeSize)*int(tt.BlockSize))
+			for k := range actual {
+				if !assert.Equal(t, tc.expected(k), actual[k], "index %d", k) {
+					return
+				}
+			}
+		})
+	}
+}
+
+// TestDequantize_IQ checks the grid based GGMLTypes against the blocks dequantized by
+// https://github.com/ggml-org/llama.cpp/blob/master/ggml/src/ggml-quants.c,
+// each block is filled with byte(j*73+41) of the j-th byte,
+// and the scale is overwritten to 0.5.
+func TestDequantize_IQ(t *testing.T) {
+	block := func(n int) []byte {
+		b := make([]byte, n)
+		for j := range b {
+			b[j] = byte(j*73 + 41)
+		}
+		return b
+	}
+
+	cases := []struct {
+		typ   GGMLType
+		given func(b []byte)
+		first []float32
+		last  []float32
+		sum   float64
+	}{
+		{
+			typ: GGMLTypeIQ2_XXS,
+			first: []float32{
+				-61.8125, -61.8125, -11.5, -11.5, -35.9375, 35.9375, -35.9375, 35.9375,
+				-61.8125, 61.8125, 11.5, 11.5, -11.5, 11.5, -11.5, -11.5,
+			},
+			last: []float32{-35.9375, -11.5, 11.5, 61.8125, -11.5, 11.5, 11.5, -35.9375},
+			sum:  -149.125,
+		},
+		{
+			typ: GGMLTypeIQ2_XS,
+			first: []float32{
+				11.5, -35.9375, 11.5, 11.5, 35.9375, 35.9375, 35.9375, -11.5,
+				-61.8125, -11.5, 11.5, -35.9375, 11.5, 35.9375, -11.5, 11.5,
+			},
+			last: []float32{-15.5, 48.4375, 15.5, -83.3125, -83.3125, 48.4375, -15.5, 15.5},
+			sum:  332.875,
+		},
+		{
+			typ: GGMLTypeIQ2_S,
+			first: []float32{
+				-3.5, -10.9375, 10.9375, -3.5, -3.5, 10.9375, -10.9375, -18.8125,
+				10.9375, 18.8125, -3.5, 10.9375, 10.9375, -3.5, 3.5, 10.9375,
+			},
+			last: []float32{24.1875, -4.5, 24.1875, 4.5, -24.1875, -24.1875, 4.5, -24.1875},
+			sum:  -125.75,
+		},
+		{
+			typ: GGMLTypeIQ3_XXS,
+			first: []float32{
+				-148.5, -121.5, 94.5, -121.5, -94.5, -40.5, -13.5, 13.5,
+				-67.5, 40.5, 67.5, -40.5, 13.5, 67.5, 40.5, 94.5,
+			},
+			last: []float32{67.5, 121.5, -13.5, 67.5, -94.5, 148.5, 13.5, 121.5},
+			sum:  970.75,
+		},
+		{
+			typ: GGMLTypeIQ3_S,
+			first: []float32{
+				-17.5, -3.5, 52.5, 38.5, 17.5, 52.5, -31.5, 17.5,
+				31.5, 17.5, -31.5, -3.5, 3.5, 31.5, 3.5, -38.5,
+			},
+			last: []float32{17.5, -17.5, 10.5, -31.5, -31.5, 3.5, 31.5, 38.5},
+			sum:  81,
+		},
+		{
+			typ: GGMLTypeIQ1_S,
+			first: []float32{
+				0.3125, 0.3125, -2.1875, -2.1875, -2.1875, 0.3125, 0.3125, 0.3125,
+				0.3125, 0.3125, -2.1875, 0.3125, 2.8125, 0.3125, -2.1875, 0.3125,
+			},
+			last: []float32{-2.1875, 0.3125, -2.1875, 0.3125, 0.3125, 2.8125, 0.3125, -2.1875},
+			sum:  -36.5,
+		},
+		{
+			typ: GGMLTypeIQ1_M,
+			// The scale is packed in the top 4 bits of the 16-bit scales.
+			given: func(b []byte) {
+				b[49] &= 0x0f
+				b[51] &= 0x0f
+				b[53] = b[53]&0x0f | 0x80
+				b[55] = b[55]&0x0f | 0x30
+			},
+			first: []float32{
+				1.3125, -1.6875, -1.6875, -1.6875, -0.1875, -0.1875, -0.1875, -1.6875,
+				0.1875, 0.1875, 0.1875, 1.6875, -1.3125, 1.6875, 0.1875, 0.1875,
+			},
+			last: []float32{-5.0625, -0.5625, 3.9375, -0.5625, 3.9375, -5.0625, -0.5625, -5.0625},
+			sum:  -30.5,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.typ.String(), func(t *testing.T) {
+			tt, ok := tc.typ.Trait()
+			require.True(t, ok)
+			assert.True(t, tc.typ.IsDequantizable())
+
+			b := block(int(tt.TypeSize))
+			if tc.given != nil {
+				tc.given(b)
+			} else {
+				binary.LittleEndian.PutUint16(b, 0x3800)
+			}
+
+			actual, err := Dequantize(tc.typ, b)
+			require.NoError(t, err)
+			require.Len(t, actual, 256)
+			assert.Equal(t, tc.first, actual[:16])
+			assert.Equal(t, tc.last, actual[248:])
+			var sum float64
+			for _, v := range actual {
+				sum += float64(v)
+			}
+			assert.Equal(t, tc.sum, sum)
+		})
+	}
+}
+
+func TestDequantize_Error(t *testing.T) {
+	assert.False(t, GGMLTypeQ4_0_4_4.IsDequantizable())
+	_, err := Dequantize(GGMLTypeQ4_0_4_4, make([]byte, 18))
+	assert.Error(t, err)
+	_, err = Dequantize(GGMLTypeQ8_0, make([]byte, 33))
+	assert.Error(t, err)
+	_, err = Dequantize(GGMLTypeIQ2_XXS, make([]byte, 65))
+	assert.Error(t, err)
+}
@@ -15,6 +15,7 @@ require (
 	golang.org/x/exp v0.0.0-20241108190413-2d47ceb2692f
 	golang.org/x/sync v0.9.0
 	golang.org/x/sys v0.27.0
+	golang.org/x/text v0.20.0
 	golang.org/x/tools v0.27.0
 	gonum.org/v1/gonum v0.15.1
 )
@@ -0,0 +1,535 @@
+package gguf_parser
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SPDXExpression is a parsed SPDX license expression,
+// see https://spdx.github.io/spdx-spec/v2.3/SPDX-license-expressions/.
+//
+// It is either a license, which License is not empty,
+// or a compound of the Operands joined by the Operator.
+type SPDXExpression struct {
+	// License is the license identifier, e.g. "MIT", "LicenseRef-Llama-3".
+	License string `json:"license,omitempty"`
+	// OrLater is true if the license is suffixed with "+".
+	OrLater bool `json:"orLater,omitempty"`
+	// Exception is the exception identifier after "WITH", e.g. "LLVM-exception".
+	Exception string `json:"exception,omitempty"`
+
+	// Operator is the operator of the compound, either "AND" or "OR".
+	Operator string `json:"operator,omitempty"`
+	// Operands are the operands of the compound.
+	Operands []*SPDXExpression `json:"operands,omitempty"`
+}
+
+// SPDX special identifiers.
+const (
+	SPDXNone        = "NONE"
+	SPDXNoAssertion = "NOASSERTION"
+)
+
+// spdxLicenses are the well-known SPDX license identifiers,
+// indexed by the lowercase identifier.
+var spdxLicenses = func() map[string]string {
+	ids := []string{
+		"0BSD", "AFL-3.0", "AGPL-3.0", "AGPL-3.0-only", "AGPL-3.0-or-later",
+		"Apache-1.1", "Apache-2.0", "Artistic-2.0",
+		"BSD-2-Clause", "BSD-3-Clause", "BSD-3-Clause-Clear", "BSL-1.0",
+		"CC-BY-2.0", "CC-BY-3.0", "CC-BY-4.0", "CC-BY-NC-2.0", "CC-BY-NC-3.0", "CC-BY-NC-4.0",
+		"CC-BY-NC-ND-3.0", "CC-BY-NC-ND-4.0", "CC-BY-NC-SA-2.0", "CC-BY-NC-SA-3.0", "CC-BY-NC-SA-4.0",
+		"CC-BY-ND-4.0", "CC-BY-SA-3.0", "CC-BY-SA-4.0", "CC0-1.0",
+		"CDLA-Permissive-1.0", "CDLA-Permissive-2.0", "CDLA-Sharing-1.0",
+		"ECL-2.0", "EPL-1.0", "EPL-2.0", "EUPL-1.1", "EUPL-1.2", "GFDL-1.3-only",
+		"GPL-2.0", "GPL-2.0-only", "GPL-2.0-or-later", "GPL-3.0", "GPL-3.0-only", "GPL-3.0-or-later",
+		"ISC", "LGPL-2.1", "LGPL-2.1-only", "LGPL-2.1-or-later", "LGPL-3.0", "LGPL-3.0-only", "LGPL-3.0-or-later",
+		"LPPL-1.3c", "MIT", "MPL-2.0", "MS-PL", "NCSA", "ODbL-1.0", "OFL-1.1", "OSL-3.0", "PDDL-1.0",
+		"PostgreSQL", "Unlicense", "UPL-1.0", "WTFPL", "Zlib",
+		"Classpath-exception-2.0", "GCC-exception-3.1", "LLVM-exception",
+		SPDXNone, SPDXNoAssertion,
+	}
+	m := make(map[string]string, len(ids))
+	for _, id := range ids {
+		m[strings.ToLower(id)] = id
+	}
+	return m
+}()
+
+// licenseAliases maps the squashed free-text licenses to the SPDX expressions,
+// the keys are in lowercase without spaces, punctuations (except ".") and noise words,
+// see squashLicense.
+var licenseAliases = map[string]string{
+	"apache2":                  "Apache-2.0",
+	"apache2.0":                "Apache-2.0",
+	"mit":                      "MIT",
+	"bsd2clause":               "BSD-2-Clause",
+	"bsd3clause":               "BSD-3-Clause",
+	"gpl2":                     "GPL-2.0-only",
+	"gpl3":                     "GPL-3.0-only",
+	"lgpl3":                    "LGPL-3.0-only",
+	"agpl3":                    "AGPL-3.0-only",
+	"cc0":                      "CC0-1.0",
+	"other":                    "LicenseRef-Other",
+	"unknown":                  SPDXNoAssertion,
+	"llama2":                   "LicenseRef-Llama-2",
+	"llama2community":          "LicenseRef-Llama-2",
+	"llama3":                   "LicenseRef-Llama-3",
+	"llama3community":          "LicenseRef-Llama-3",
+	"metallama3community":      "LicenseRef-Llama-3",
+	"llama3.1":                 "LicenseRef-Llama-3.1",
+	"llama3.1community":        "LicenseRef-Llama-3.1",
+	"llama3.2":                 "LicenseRef-Llama-3.2",
+	"llama3.2community":        "LicenseRef-Llama-3.2",
+	"llama3.3":                 "LicenseRef-Llama-3.3",
+	"llama3.3community":        "LicenseRef-Llama-3.3",
+	"llama4":                   "LicenseRef-Llama-4",
+	"llama4community":          "LicenseRef-Llama-4",
+	"gemma":                    "LicenseRef-Gemma",
+	"gemmatermsofuse":          "LicenseRef-Gemma",
+	"deepseek":                 "LicenseRef-DeepSeek",
+	"qwen":                     "LicenseRef-Qwen",
+	"tongyiqianwen":            "LicenseRef-Qwen",
+	"openrail":                 "LicenseRef-OpenRAIL",
+	"openrail++":               "LicenseRef-OpenRAIL++",
+	"creativemlopenrailm":      "LicenseRef-CreativeML-OpenRAIL-M",
+	"bigscienceopenrailm":      "LicenseRef-BigScience-OpenRAIL-M",
+	"bigscienceopenrailm1.0":   "LicenseRef-BigScience-OpenRAIL-M",
+	"bigcodeopenrailm":         "LicenseRef-BigCode-OpenRAIL-M",
+	"bigcodeopenrailm1.0":      "LicenseRef-BigCode-OpenRAIL-M",
+	"falcon180btiitermsofuse":  "LicenseRef-Falcon-180B-TII",
+	"nvidiaopenmodel":          "LicenseRef-NVIDIA-Open-Model",
+	"nvidiaopenmodelagreement": "LicenseRef-NVIDIA-Open-Model",
+}
+
+var (
+	licenseNoiseRegex  = regexp.MustCompile(`\b(the|licen[sc]es?|agreements?|versions?|v)\b`)
+	licenseSquashRegex = regexp.MustCompile(`[^a-z0-9.+]+`)
+	licenseRefRegex    = regexp.MustCompile(`[^A-Za-z0-9.]+`)
+	licenseSuffixRegex = regexp.MustCompile(`\s*\([^()]*\)$`)
+	spdxIDRegex        = regexp.MustCompile(`^((DocumentRef-[A-Za-z0-9.\-]+:)?LicenseRef-[A-Za-z0-9.\-]+|[A-Za-z0-9.\-]+)$`)
+)
+
+// squashLicense squashes the given free-text license for matching,
+// e.g. "Apache License, Version 2.0" to "apache2.0".
+func squashLicense(s string) string {
+	s = strings.ToLower(s)
+	s = licenseNoiseRegex.ReplaceAllString(s, " ")
+	return strings.Trim(licenseSquashRegex.ReplaceAllString(s, ""), ".")
+}
+
+// ParseSPDXExpression parses the given SPDX license expression,
+// e.g. "MIT OR Apache-2.0", "(GPL-2.0-only WITH Classpath-exception-2.0) AND BSD-3-Clause".
+//
+// The operators are case-insensitive,
+// and the well-known license identifiers are canonicalized,
+// e.g. "apache-2.0 or mit" is parsed as "Apache-2.0 OR MIT".
+func ParseSPDXExpression(s string) (*SPDXExpression, error) {
+	p := &_SPDXParser{tokens: tokenizeSPDX(s)}
+	if len(p.tokens) == 0 {
+		return nil, errors.New("empty SPDX expression")
+	}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in SPDX expression", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+// String returns the SPDX expression in the canonical form,
+// the compound operands are parenthesized if needed.
+func (e *SPDXExpression) String() string {
+	if e.License != "" {
+		s := e.License
+		if e.OrLater {
+			s += "+"
+		}
+		if e.Exception != "" {
+			s += " WITH " + e.Exception
+		}
+		return s
+	}
+
+	ss := make([]string, len(e.Operands))
+	for i, o := range e.Operands {
+		ss[i] = o.String()
+		// AND binds tighter than OR.
+		if o.License == "" && o.Operator != e.Operator && e.Operator == "AND" {
+			ss[i] = "(" + ss[i] + ")"
+		}
+	}
+	return strings.Join(ss, " "+e.Operator+" ")
+}
+
+// Licenses returns the license identifiers in the SPDX expression,
+// without duplicates.
+func (e *SPDXExpression) Licenses() []string {
+	var (
+		r    []string
+		seen = map[string]struct{}{}
+		walk func(e *SPDXExpression)
+	)
+	walk = func(e *SPDXExpression) {
+		if e.License != "" {
+			if _, ok := seen[e.License]; !ok {
+				seen[e.License] = struct{}{}
+				r = append(r, e.License)
+			}
+			return
+		}
+		for _, o := range e.Operands {
+			walk(o)
+		}
+	}
+	walk(e)
+	return r
+}
+
+// tokenizeSPDX splits the given SPDX expression into tokens,
+// the parentheses are separated tokens.
+func tokenizeSPDX(s string) []string {
+	var (
+		r  []string
+		sb strings.Builder
+	)
+	flush := func() {
+		if sb.Len() != 0 {
+			r = append(r, sb.String())
+			sb.Reset()
+		}
+	}
+	for _, c := range s {
+		switch c {
+		case '(', ')':
+			flush()
+			r = append(r, string(c))
+		case ' ', '\t', '\n', '\r':
+			flush()
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	flush()
+	return r
+}
+
+// _SPDXParser is a recursive descent parser of the SPDX expression,
+// the precedence is WITH > AND > OR.
+type _SPDXParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *_SPDXParser) peekOperator(op string) bool {
+	if p.pos >= len(p.tokens) {
+		return false
+	}
+	t := p.tokens[p.pos]
+	return t == op || t == strings.ToLower(op)
+}
+
+func (p *_SPDXParser) parseOr() (*SPDXExpression, error) {
+	return p.parseCompound("OR", p.parseAnd)
+}
+
+func (p *_SPDXParser) parseAnd() (*SPDXExpression, error) {
+	return p.parseCompound("AND", p.parseWith)
+}
+
+func (p *_SPDXParser) parseCompound(op string, next func() (*SPDXExpression, error)) (*SPDXExpression, error) {
+	e, err := next()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekOperator(op) {
+		return e, nil
+	}
+	c := &SPDXExpression{Operator: op, Operands: []*SPDXExpression{e}}
+	for p.peekOperator(op) {
+		p.pos++
+		if e, err = next(); err != nil {
+			return nil, err
+		}
+		c.Operands = append(c.Operands, e)
+	}
+	return c, nil
+}
+
+func (p *_SPDXParser) parseWith() (*SPDXExpression, error) {
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekOperator("WITH") {
+		return e, nil
+	}
+	p.pos++
+	if e.License == "" {
+		return nil, errors.New("unexpected WITH after compound in SPDX expression")
+	}
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("missing exception after WITH in SPDX expression")
+	}
+	ex := p.tokens[p.pos]
+	if !spdxIDRegex.MatchString(ex) || isSPDXOperator(ex) {
+		return nil, fmt.Errorf("invalid exception %q in SPDX expression", ex)
+	}
+	p.pos++
+	e.Exception = canonicalSPDXID(ex)
+	return e, nil
+}
+
+func (p *_SPDXParser) parsePrimary() (*SPDXExpression, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("unexpected end of SPDX expression")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+
+	if t == "(" {
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos] != ")" {
+			return nil, errors.New("missing \")\" in SPDX expression")
+		}
+		p.pos++
+		return e, nil
+	}
+
+	e := &SPDXExpression{License: t}
+	if strings.HasSuffix(t, "+") {
+		e.License, e.OrLater = t[:len(t)-1], true
+	}
+	if !spdxIDRegex.MatchString(e.License) || isSPDXOperator(e.License) {
+		return nil, fmt.Errorf("invalid license %q in SPDX expression", t)
+	}
+	e.License = canonicalSPDXID(e.License)
+	return e, nil
+}
+
+func isSPDXOperator(s string) bool {
+	switch s {
+	case "AND", "and", "OR", "or", "WITH", "with":
+		return true
+	}
+	return false
+}
+
+// canonicalSPDXID returns the canonical form of the given well-known identifier,
+// or the given identifier if not well-known.
+func canonicalSPDXID(id string) string {
+	if c, ok := spdxLicenses[strings.ToLower(id)]; ok {
+		return c
+	}
+	if l := strings.ToLower(id); strings.HasPrefix(l, "licenseref-") {
+		return "LicenseRef-" + id[len("licenseref-"):]
+	}
+	return id
+}
+
+// NormalizeLicense normalizes the given license to a SPDX expression,
+// which accepts the SPDX expressions, the HuggingFace license identifiers (e.g. "llama3", "gemma", "other")
+// and the free-text license titles (e.g. "Apache License, Version 2.0", the full text of the license).
+//
+// The free-text license titles are matched exactly after squashing,
+// a trailing parenthesized abbreviation is ignored, e.g. "The MIT License (MIT)".
+// The unknown licenses are normalized to "LicenseRef-<license>",
+// and the empty license is normalized to "NOASSERTION".
+//
+// NormalizeLicense returns an error if the given license looks like a SPDX expression but is malformed,
+// e.g. "MIT AND", "(MIT".
+func NormalizeLicense(license string) (string, error) {
+	license = strings.TrimSpace(license)
+	// Select the title of the license text.
+	if i := strings.IndexAny(license, "\r\n"); i >= 0 {
+		license = strings.TrimSpace(license[:i])
+	}
+	if license == "" {
+		return SPDXNoAssertion, nil
+	}
+
+	e, err := ParseSPDXExpression(license)
+	if err != nil && looksLikeSPDXExpression(license) {
+		return "", fmt.Errorf("malformed license %q: %w", license, err)
+	}
+
+	if v, ok := licenseAliases[squashLicense(license)]; ok {
+		return v, nil
+	}
+
+	if err == nil {
+		var walk func(e *SPDXExpression)
+		walk = func(e *SPDXExpression) {
+			if e.License == "" {
+				for _, o := range e.Operands {
+					walk(o)
+				}
+				return
+			}
+			if _, ok := spdxLicenses[strings.ToLower(e.License)]; ok || strings.HasPrefix(e.License, "LicenseRef-") ||
+				strings.HasPrefix(e.License, "DocumentRef-") {
+				return
+			}
+			if v, ok := licenseAliases[squashLicense(e.License)]; ok && !strings.ContainsAny(v, " ") {
+				e.License = v
+				return
+			}
+			e.License = "LicenseRef-" + e.License
+		}
+		walk(e)
+		return e.String(), nil
+	}
+
+	if t := licenseSuffixRegex.ReplaceAllString(license, ""); t != license {
+		if v, ok := licenseAliases[squashLicense(t)]; ok {
+			return v, nil
+		}
+	}
+
+	if r := strings.Trim(licenseRefRegex.ReplaceAllString(license, "-"), "-"); r != "" {
+		return "LicenseRef-" + r, nil
+	}
+	return SPDXNoAssertion, nil
+}
+
+// looksLikeSPDXExpression returns true if the given license is intended to be a SPDX expression,
+// which contains an uppercase operator or unbalanced parentheses.
+func looksLikeSPDXExpression(license string) bool {
+	var depth int
+	for _, t := range tokenizeSPDX(license) {
+		switch t {
+		case "AND", "OR", "WITH":
+			return true
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth < 0 {
+				return true
+			}
+		}
+	}
+	return depth != 0
+}
+
+// LicensePolicy is a policy to check the licenses,
+// which can be loaded from JSON or YAML.
+//
+// A license is denied if it matches any of the Deny list,
+// or does not match any of the Allow list if the Allow list is not empty.
+//
+// The entries are matched case-insensitively against the normalized licenses,
+// and support the wildcard "*", e.g. "CC-BY-NC-*", "LicenseRef-Llama-*".
+type LicensePolicy struct {
+	// Allow is the list of the allowed licenses.
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+	// Deny is the list of the denied licenses.
+	Deny []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+}
+
+// LicensePolicyResult is the result of evaluating a license against a LicensePolicy.
+type LicensePolicyResult struct {
+	// License is the normalized license.
+	License string `json:"license"`
+	// Allowed is true if the license satisfies the policy.
+	Allowed bool `json:"allowed"`
+	// Violations are the reasons why the license does not satisfy the policy.
+	Violations []string `json:"violations,omitempty"`
+}
+
+// Evaluate evaluates the given license against the policy,
+// the license is normalized by NormalizeLicense.
+//
+// A compound of "AND" is allowed if all operands are allowed,
+// and a compound of "OR" is allowed if any operand is allowed.
+func (p LicensePolicy) Evaluate(license string) LicensePolicyResult {
+	var (
+		r   LicensePolicyResult
+		err error
+	)
+	r.License, err = NormalizeLicense(license)
+	if err != nil {
+		r.License = license
+		r.Violations = []string{err.Error()}
+		return r
+	}
+
+	e, err := ParseSPDXExpression(r.License)
+	if err != nil {
+		r.Violations = []string{err.Error()}
+		return r
+	}
+	allow, deny := p.patterns(p.Allow), p.patterns(p.Deny)
+	r.Allowed, r.Violations = evaluateLicense(e, allow, deny)
+	if r.Allowed {
+		r.Violations = nil
+	}
+	return r
+}
+
+// patterns normalizes the given entries into lowercase patterns.
+func (p LicensePolicy) patterns(entries []string) []string {
+	ps := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		if !strings.Contains(e, "*") {
+			if n, err := NormalizeLicense(e); err == nil {
+				e = n
+			}
+		}
+		ps = append(ps, strings.ToLower(e))
+	}
+	return ps
+}
+
+func evaluateLicense(e *SPDXExpression, allow, deny []string) (bool, []string) {
+	if e.License == "" {
+		var (
+			vs      []string
+			allowed = e.Operator == "AND"
+		)
+		for _, o := range e.Operands {
+			a, ovs := evaluateLicense(o, allow, deny)
+			vs = append(vs, ovs...)
+			if e.Operator == "AND" {
+				allowed = allowed && a
+			} else {
+				allowed = allowed || a
+			}
+		}
+		return allowed, vs
+	}
+
+	// Match the full form, the license with or without "+".
+	cs := []string{strings.ToLower(e.String()), strings.ToLower(e.License)}
+	if e.OrLater {
+		cs = append(cs, strings.ToLower(e.License+"+"))
+	}
+	match := func(ps []string) bool {
+		for _, p := range ps {
+			for _, c := range cs {
+				if ok, _ := path.Match(p, c); ok || p == c {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	switch {
+	case match(deny):
+		return false, []string{fmt.Sprintf("license %q is denied", e.String())}
+	case len(allow) != 0 && !match(allow):
+		return false, []string{fmt.Sprintf("license %q is not allowed", e.String())}
+	}
+	return true, nil
+}
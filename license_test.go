@@ -0,0 +1,191 @@
+package gguf_parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSPDXExpression(t *testing.T) {
+	testCases := []struct {
+		given    string
+		expected string
+		licenses []string
+	}{
+		{"MIT", "MIT", []string{"MIT"}},
+		{"mit or apache-2.0", "MIT OR Apache-2.0", []string{"MIT", "Apache-2.0"}},
+		{"GPL-2.0+ WITH Classpath-exception-2.0", "GPL-2.0+ WITH Classpath-exception-2.0", []string{"GPL-2.0"}},
+		{"MIT AND BSD-3-Clause OR Apache-2.0", "MIT AND BSD-3-Clause OR Apache-2.0", []string{"MIT", "BSD-3-Clause", "Apache-2.0"}},
+		{"MIT AND (BSD-3-Clause OR Apache-2.0)", "MIT AND (BSD-3-Clause OR Apache-2.0)", []string{"MIT", "BSD-3-Clause", "Apache-2.0"}},
+		{"(MIT OR MIT)", "MIT OR MIT", []string{"MIT"}},
+		{"licenseref-llama-3 AND DocumentRef-x:LicenseRef-y", "LicenseRef-llama-3 AND DocumentRef-x:LicenseRef-y", []string{"LicenseRef-llama-3", "DocumentRef-x:LicenseRef-y"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			e, err := ParseSPDXExpression(tc.given)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, e.String())
+			assert.Equal(t, tc.licenses, e.Licenses())
+		})
+	}
+
+	for _, given := range []string{
+		"",
+		"MIT OR",
+		"(MIT",
+		"MIT)",
+		"MIT Apache-2.0",
+		"(MIT OR BSD-3-Clause) WITH LLVM-exception",
+		"MIT WITH",
+		"Llama 3 Community License",
+	} {
+		_, err := ParseSPDXExpression(given)
+		assert.Error(t, err, given)
+	}
+}
+
+func TestNormalizeLicense(t *testing.T) {
+	testCases := []struct {
+		given    string
+		expected string
+	}{
+		{"", "NOASSERTION"},
+		{"apache-2.0", "Apache-2.0"},
+		{"Apache License, Version 2.0", "Apache-2.0"},
+		{"MIT License", "MIT"},
+		{"mit OR apache-2.0", "MIT OR Apache-2.0"},
+		{"cc-by-nc-4.0", "CC-BY-NC-4.0"},
+		{"llama3", "LicenseRef-Llama-3"},
+		{"llama3.1", "LicenseRef-Llama-3.1"},
+		{"Llama 3.2 Community License Agreement", "LicenseRef-Llama-3.2"},
+		{"LLAMA 2 COMMUNITY LICENSE AGREEMENT\nLlama 2 Version Release Date: July 18, 2023", "LicenseRef-Llama-2"},
+		{"META LLAMA 3 COMMUNITY LICENSE AGREEMENT\n\nMeta Llama 3 Version Release Date: April 18, 2024", "LicenseRef-Llama-3"},
+		{"gemma", "LicenseRef-Gemma"},
+		{"Gemma Terms of Use", "LicenseRef-Gemma"},
+		{"other", "LicenseRef-Other"},
+		{"unknown", "NOASSERTION"},
+		{"gemma AND mit", "LicenseRef-Gemma AND MIT"},
+		{"openrail", "LicenseRef-OpenRAIL"},
+		{"my-license", "LicenseRef-my-license"},
+		{"My Company License (internal)", "LicenseRef-My-Company-License-internal"},
+		{"The MIT License (MIT)", "MIT"},
+		{"Acme Limited Non-Commercial License", "LicenseRef-Acme-Limited-Non-Commercial-License"},
+		{"Use permitted for research only", "LicenseRef-Use-permitted-for-research-only"},
+		{"Submit requests to Acme", "LicenseRef-Submit-requests-to-Acme"},
+		{"Llama 3 Community License for Acme", "LicenseRef-Llama-3-Community-License-for-Acme"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			actual, err := NormalizeLicense(tc.given)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+
+	for _, given := range []string{
+		"MIT AND",
+		"(MIT",
+		"MIT)",
+		"MIT OR OR Apache-2.0",
+		"Apache-2.0 WITH",
+	} {
+		_, err := NormalizeLicense(given)
+		assert.Error(t, err, given)
+	}
+}
+
+func TestLicensePolicy_Evaluate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		given      LicensePolicy
+		license    string
+		expected   bool
+		violations []string
+	}{
+		{
+			name:     "empty policy",
+			license:  "llama3",
+			expected: true,
+		},
+		{
+			name:     "allowed",
+			given:    LicensePolicy{Allow: []string{"mit", "apache-2.0"}},
+			license:  "Apache License, Version 2.0",
+			expected: true,
+		},
+		{
+			name:       "not allowed",
+			given:      LicensePolicy{Allow: []string{"MIT", "Apache-2.0"}},
+			license:    "gemma",
+			violations: []string{`license "LicenseRef-Gemma" is not allowed`},
+		},
+		{
+			name:       "denied",
+			given:      LicensePolicy{Deny: []string{"CC-BY-NC-*"}},
+			license:    "cc-by-nc-4.0",
+			violations: []string{`license "CC-BY-NC-4.0" is denied`},
+		},
+		{
+			name:       "deny overrides allow",
+			given:      LicensePolicy{Allow: []string{"LicenseRef-Llama-*"}, Deny: []string{"llama3.1"}},
+			license:    "llama3.1",
+			violations: []string{`license "LicenseRef-Llama-3.1" is denied`},
+		},
+		{
+			name:     "allow by normalized alias",
+			given:    LicensePolicy{Allow: []string{"llama3"}},
+			license:  "META LLAMA 3 COMMUNITY LICENSE AGREEMENT\n...",
+			expected: true,
+		},
+		{
+			name:     "or with one allowed",
+			given:    LicensePolicy{Deny: []string{"GPL-*"}},
+			license:  "GPL-3.0-only OR MIT",
+			expected: true,
+		},
+		{
+			name:       "and with one denied",
+			given:      LicensePolicy{Deny: []string{"GPL-*"}},
+			license:    "GPL-3.0-only AND MIT",
+			violations: []string{`license "GPL-3.0-only" is denied`},
+		},
+		{
+			name:     "or later",
+			given:    LicensePolicy{Allow: []string{"GPL-2.0"}},
+			license:  "GPL-2.0+",
+			expected: true,
+		},
+		{
+			name:     "exception",
+			given:    LicensePolicy{Allow: []string{"Apache-2.0"}},
+			license:  "Apache-2.0 WITH LLVM-exception",
+			expected: true,
+		},
+		{
+			name:       "substring of allowed",
+			given:      LicensePolicy{Allow: []string{"MIT", "Apache-2.0"}},
+			license:    "Acme Limited Non-Commercial License",
+			violations: []string{`license "LicenseRef-Acme-Limited-Non-Commercial-License" is not allowed`},
+		},
+		{
+			name:       "malformed",
+			given:      LicensePolicy{Allow: []string{"MIT"}},
+			license:    "MIT AND",
+			violations: []string{`malformed license "MIT AND": unexpected end of SPDX expression`},
+		},
+		{
+			name:       "no assertion",
+			given:      LicensePolicy{Allow: []string{"MIT"}},
+			license:    "",
+			violations: []string{`license "NOASSERTION" is not allowed`},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := tc.given.Evaluate(tc.license)
+			assert.Equal(t, tc.expected, r.Allowed)
+			assert.Equal(t, tc.violations, r.Violations)
+		})
+	}
+}
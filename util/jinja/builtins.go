@@ -0,0 +1,1167 @@
+package jinja
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+type filterFunc func(v any, args []any, kwargs *Dict) (any, error)
+
+var filters map[string]filterFunc
+
+func init() {
+	filters = map[string]filterFunc{
+		"abs":        filterAbs,
+		"attr":       filterAttr,
+		"capitalize": stringFilter(capitalize),
+		"count":      filterLength,
+		"d":          filterDefault,
+		"default":    filterDefault,
+		"dictsort":   filterDictSort,
+		"e":          filterEscape,
+		"escape":     filterEscape,
+		"first":      filterFirst,
+		"float":      filterFloat,
+		"format":     filterFormat,
+		"indent":     filterIndent,
+		"int":        filterInt,
+		"items":      filterItems,
+		"join":       filterJoin,
+		"last":       filterLast,
+		"length":     filterLength,
+		"list":       filterList,
+		"lower":      stringFilter(strings.ToLower),
+		"map":        filterMap,
+		"max":        filterMinMax(1),
+		"min":        filterMinMax(-1),
+		"reject":     filterSelect(false, false),
+		"rejectattr": filterSelect(false, true),
+		"replace":    filterReplace,
+		"reverse":    filterReverse,
+		"round":      filterRound,
+		"safe":       filterSafe,
+		"select":     filterSelect(true, false),
+		"selectattr": filterSelect(true, true),
+		"sort":       filterSort,
+		"string":     filterString,
+		"sum":        filterSum,
+		"title":      stringFilter(title),
+		"tojson":     filterToJSON,
+		"trim":       filterTrim,
+		"unique":     filterUnique,
+		"upper":      stringFilter(strings.ToUpper),
+		"wordcount":  filterWordCount,
+	}
+}
+
+// arg returns the argument at the given position or of the given name,
+// or the given default value if not found.
+func arg(args []any, kwargs *Dict, i int, name string, def any) any {
+	if i < len(args) {
+		return args[i]
+	}
+	if v, ok := kwargs.Get(name); ok {
+		return v
+	}
+	return def
+}
+
+func stringFilter(f func(string) string) filterFunc {
+	return func(v any, _ []any, _ *Dict) (any, error) {
+		return f(toString(v)), nil
+	}
+}
+
+func capitalize(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	if n == 0 {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + strings.ToLower(s[n:])
+}
+
+func title(s string) string {
+	rs := []rune(s)
+	prev := false
+	for i, r := range rs {
+		if prev {
+			rs[i] = unicode.ToLower(r)
+		} else {
+			rs[i] = unicode.ToUpper(r)
+		}
+		prev = unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\''
+	}
+	return string(rs)
+}
+
+func filterAbs(v any, _ []any, _ *Dict) (any, error) {
+	switch t := v.(type) {
+	case int64:
+		if t < 0 {
+			return -t, nil
+		}
+		return t, nil
+	case float64:
+		return math.Abs(t), nil
+	}
+	return nil, fmt.Errorf("bad operand type for abs(): '%s'", typeName(v))
+}
+
+func filterAttr(v any, args []any, kwargs *Dict) (any, error) {
+	return getAttr(v, toString(arg(args, kwargs, 0, "name", ""))), nil
+}
+
+func filterDefault(v any, args []any, kwargs *Dict) (any, error) {
+	def := arg(args, kwargs, 0, "default_value", "")
+	_, undef := v.(Undefined)
+	if undef || truthy(arg(args, kwargs, 1, "boolean", false)) && !truthy(v) {
+		return def, nil
+	}
+	return v, nil
+}
+
+func filterDictSort(v any, args []any, kwargs *Dict) (any, error) {
+	d, ok := v.(*Dict)
+	if !ok {
+		return nil, fmt.Errorf("dictsort requires a dict, got '%s'", typeName(v))
+	}
+	var (
+		cs      = truthy(arg(args, kwargs, 0, "case_sensitive", false))
+		byValue = toString(arg(args, kwargs, 1, "by", "key")) == "value"
+		reverse = truthy(arg(args, kwargs, 2, "reverse", false))
+	)
+	items := dictItems(d)
+	err := sortValues(items, reverse, func(item any) any {
+		kv := item.(Tuple)
+		k := kv[0]
+		if byValue {
+			k = kv[1]
+		}
+		if s, ok := k.(string); ok && !cs {
+			return strings.ToLower(s)
+		}
+		return k
+	})
+	return items, err
+}
+
+func filterEscape(v any, _ []any, _ *Dict) (any, error) {
+	return html.EscapeString(toString(v)), nil
+}
+
+func filterFirst(v any, _ []any, _ *Dict) (any, error) {
+	l, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(l) == 0 {
+		return Undefined{Name: "first"}, nil
+	}
+	return l[0], nil
+}
+
+func filterLast(v any, _ []any, _ *Dict) (any, error) {
+	l, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(l) == 0 {
+		return Undefined{Name: "last"}, nil
+	}
+	return l[len(l)-1], nil
+}
+
+func filterFloat(v any, args []any, kwargs *Dict) (any, error) {
+	def := arg(args, kwargs, 0, "default", 0.0)
+	switch t := v.(type) {
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		if err != nil {
+			return def, nil
+		}
+		return f, nil
+	}
+	if f, ok := toFloat(v); ok {
+		return f, nil
+	}
+	return def, nil
+}
+
+func filterFormat(v any, args []any, kwargs *Dict) (any, error) {
+	switch {
+	case len(args) != 0 && kwargs.Len() != 0:
+		return nil, errors.New("can't handle positional and keyword arguments at the same time")
+	case kwargs.Len() != 0:
+		return formatPercent(toString(v), kwargs)
+	}
+	return formatPercent(toString(v), Tuple(args))
+}
+
+func filterInt(v any, args []any, kwargs *Dict) (any, error) {
+	def := arg(args, kwargs, 0, "default", int64(0))
+	switch t := v.(type) {
+	case string:
+		s := strings.ReplaceAll(strings.TrimSpace(t), "_", "")
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return int64(f), nil
+		}
+		return def, nil
+	case float64:
+		return int64(t), nil
+	}
+	if n, ok := toNumber(v); ok {
+		return n, nil
+	}
+	return def, nil
+}
+
+func filterIndent(v any, args []any, kwargs *Dict) (any, error) {
+	var (
+		s     = toString(v)
+		width = arg(args, kwargs, 0, "width", int64(4))
+		first = truthy(arg(args, kwargs, 1, "first", false))
+		blank = truthy(arg(args, kwargs, 2, "blank", false))
+	)
+	ind, ok := width.(string)
+	if !ok {
+		n, _ := toNumber(width)
+		w, _ := n.(int64)
+		ind = strings.Repeat(" ", int(max(w, 0)))
+	}
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		if i == 0 && !first || !blank && strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		lines[i] = ind + lines[i]
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func filterItems(v any, _ []any, _ *Dict) (any, error) {
+	switch t := v.(type) {
+	case *Dict:
+		return dictItems(t), nil
+	case Undefined:
+		return []any{}, nil
+	}
+	return nil, fmt.Errorf("can only get item pairs from a mapping, got '%s'", typeName(v))
+}
+
+func dictItems(d *Dict) []any {
+	l := make([]any, 0, d.Len())
+	for _, k := range d.Keys() {
+		l = append(l, Tuple{k, d.m[k]})
+	}
+	return l
+}
+
+func filterJoin(v any, args []any, kwargs *Dict) (any, error) {
+	l, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+	sep := toString(arg(args, kwargs, 0, "d", ""))
+	attr, hasAttr := arg(args, kwargs, 1, "attribute", nil).(string)
+	ss := make([]string, len(l))
+	for i := range l {
+		if hasAttr {
+			ss[i] = toString(getAttr(l[i], attr))
+		} else {
+			ss[i] = toString(l[i])
+		}
+	}
+	return strings.Join(ss, sep), nil
+}
+
+func filterLength(v any, _ []any, _ *Dict) (any, error) {
+	switch t := v.(type) {
+	case string:
+		return int64(utf8.RuneCountInString(t)), nil
+	case []any:
+		return int64(len(t)), nil
+	case Tuple:
+		return int64(len(t)), nil
+	case *Dict:
+		return int64(t.Len()), nil
+	case Undefined:
+		return int64(0), nil
+	}
+	return nil, fmt.Errorf("object of type '%s' has no len()", typeName(v))
+}
+
+func filterList(v any, _ []any, _ *Dict) (any, error) {
+	l, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(l), nil
+}
+
+func filterMap(v any, args []any, kwargs *Dict) (any, error) {
+	l, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+	r := make([]any, len(l))
+	if a, ok := kwargs.Get("attribute"); ok {
+		def, hasDef := kwargs.Get("default")
+		for i := range l {
+			r[i] = getAttr(l[i], toString(a))
+			if _, undef := r[i].(Undefined); undef && hasDef {
+				r[i] = def
+			}
+		}
+		return r, nil
+	}
+	if len(args) == 0 {
+		return nil, errors.New("map requires a filter name or an attribute")
+	}
+	f, ok := filters[toString(args[0])]
+	if !ok {
+		return nil, fmt.Errorf("no filter named '%s'", toString(args[0]))
+	}
+	for i := range l {
+		if r[i], err = f(l[i], args[1:], NewDict()); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func filterMinMax(sign int) filterFunc {
+	return func(v any, args []any, kwargs *Dict) (any, error) {
+		l, err := iterate(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(l) == 0 {
+			return Undefined{}, nil
+		}
+		cs := truthy(arg(args, kwargs, 0, "case_sensitive", false))
+		attr, hasAttr := arg(args, kwargs, 1, "attribute", nil).(string)
+		key := func(x any) any {
+			if hasAttr {
+				x = getAttr(x, attr)
+			}
+			if s, ok := x.(string); ok && !cs {
+				return strings.ToLower(s)
+			}
+			return x
+		}
+		r := l[0]
+		for _, x := range l[1:] {
+			c, err := compare(key(x), key(r))
+			if err != nil {
+				return nil, err
+			}
+			if c*sign > 0 {
+				r = x
+			}
+		}
+		return r, nil
+	}
+}
+
+func filterReplace(v any, args []any, kwargs *Dict) (any, error) {
+	var (
+		s     = toString(v)
+		old   = toString(arg(args, kwargs, 0, "old", ""))
+		nw    = toString(arg(args, kwargs, 1, "new", ""))
+		count = arg(args, kwargs, 2, "count", nil)
+	)
+	n := -1
+	if c, ok := count.(int64); ok {
+		n = int(c)
+	}
+	return strings.Replace(s, old, nw, n), nil
+}
+
+func filterReverse(v any, _ []any, _ *Dict) (any, error) {
+	if s, ok := v.(string); ok {
+		rs := []rune(s)
+		slices.Reverse(rs)
+		return string(rs), nil
+	}
+	l, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+	l = slices.Clone(l)
+	slices.Reverse(l)
+	return l, nil
+}
+
+func filterRound(v any, args []any, kwargs *Dict) (any, error) {
+	f, ok := toFloat(v)
+	if !ok {
+		return nil, fmt.Errorf("round requires a number, got '%s'", typeName(v))
+	}
+	var (
+		p, _   = arg(args, kwargs, 0, "precision", int64(0)).(int64)
+		method = toString(arg(args, kwargs, 1, "method", "common"))
+		e      = math.Pow10(int(p))
+	)
+	switch method {
+	case "common":
+		f = math.Round(f*e) / e
+	case "ceil":
+		f = math.Ceil(f*e) / e
+	case "floor":
+		f = math.Floor(f*e) / e
+	default:
+		return nil, errors.New("method must be common, ceil or floor")
+	}
+	return f, nil
+}
+
+func filterSafe(v any, _ []any, _ *Dict) (any, error) {
+	return v, nil
+}
+
+// filterSelect returns the select, reject, selectattr or rejectattr filter.
+func filterSelect(keep, byAttr bool) filterFunc {
+	return func(v any, args []any, kwargs *Dict) (any, error) {
+		l, err := iterate(v)
+		if err != nil {
+			return nil, err
+		}
+		var attr string
+		if byAttr {
+			if len(args) == 0 {
+				return nil, errors.New("missing attribute")
+			}
+			attr, args = toString(args[0]), args[1:]
+		}
+		r := []any{}
+		for _, x := range l {
+			t := x
+			if byAttr {
+				t = getAttr(x, attr)
+			}
+			var ok bool
+			if len(args) == 0 {
+				ok = truthy(t)
+			} else if ok, err = applyTest(toString(args[0]), t, args[1:]); err != nil {
+				return nil, err
+			}
+			if ok == keep {
+				r = append(r, x)
+			}
+		}
+		return r, nil
+	}
+}
+
+func filterSort(v any, args []any, kwargs *Dict) (any, error) {
+	l, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+	l = slices.Clone(l)
+	var (
+		reverse = truthy(arg(args, kwargs, 0, "reverse", false))
+		cs      = truthy(arg(args, kwargs, 1, "case_sensitive", false))
+	)
+	attr, hasAttr := arg(args, kwargs, 2, "attribute", nil).(string)
+	err = sortValues(l, reverse, func(x any) any {
+		if hasAttr {
+			x = getAttr(x, attr)
+		}
+		if s, ok := x.(string); ok && !cs {
+			return strings.ToLower(s)
+		}
+		return x
+	})
+	return l, err
+}
+
+// sortValues sorts the given values stably by the given key.
+func sortValues(l []any, reverse bool, key func(any) any) (err error) {
+	slices.SortStableFunc(l, func(a, b any) int {
+		c, cerr := compare(key(a), key(b))
+		if cerr != nil && err == nil {
+			err = cerr
+		}
+		if reverse {
+			return -c
+		}
+		return c
+	})
+	return err
+}
+
+func filterString(v any, _ []any, _ *Dict) (any, error) {
+	return toString(v), nil
+}
+
+func filterSum(v any, args []any, kwargs *Dict) (any, error) {
+	l, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+	attr, hasAttr := arg(args, kwargs, 0, "attribute", nil).(string)
+	r := arg(args, kwargs, 1, "start", int64(0))
+	for _, x := range l {
+		if hasAttr {
+			x = getAttr(x, attr)
+		}
+		if r, err = binaryOp("+", r, x); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func filterToJSON(v any, args []any, kwargs *Dict) (any, error) {
+	var (
+		indent   string
+		sortKeys = truthy(arg(args, kwargs, 1, "sort_keys", false))
+		itemSep  = ", "
+		keySep   = ": "
+	)
+	switch t := arg(args, kwargs, 0, "indent", nil).(type) {
+	case int64:
+		indent = strings.Repeat(" ", int(max(t, 0)))
+		itemSep = ","
+	case string:
+		indent = t
+		itemSep = ","
+	}
+	if seps, err := iterate(arg(args, kwargs, 2, "separators", nil)); err == nil && len(seps) == 2 {
+		itemSep, keySep = toString(seps[0]), toString(seps[1])
+	}
+	return toJSON(v, indent, sortKeys, itemSep, keySep)
+}
+
+func filterTrim(v any, args []any, kwargs *Dict) (any, error) {
+	if chars, ok := arg(args, kwargs, 0, "chars", nil).(string); ok {
+		return strings.Trim(toString(v), chars), nil
+	}
+	return strings.TrimSpace(toString(v)), nil
+}
+
+func filterUnique(v any, args []any, kwargs *Dict) (any, error) {
+	l, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+	cs := truthy(arg(args, kwargs, 0, "case_sensitive", false))
+	var (
+		r    []any
+		seen []any
+	)
+	for _, x := range l {
+		k := x
+		if s, ok := x.(string); ok && !cs {
+			k = strings.ToLower(s)
+		}
+		if !slices.ContainsFunc(seen, func(y any) bool { return equal(k, y) }) {
+			seen = append(seen, k)
+			r = append(r, x)
+		}
+	}
+	return r, nil
+}
+
+func filterWordCount(v any, _ []any, _ *Dict) (any, error) {
+	return int64(len(strings.Fields(toString(v)))), nil
+}
+
+// applyTest applies the test of the given name.
+func applyTest(name string, v any, args []any) (bool, error) {
+	a := func(i int) any {
+		if i < len(args) {
+			return args[i]
+		}
+		return Undefined{}
+	}
+	switch name {
+	case "defined":
+		_, ok := v.(Undefined)
+		return !ok, nil
+	case "undefined":
+		_, ok := v.(Undefined)
+		return ok, nil
+	case "none":
+		return v == nil, nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok, nil
+	case "true":
+		return v == true, nil
+	case "false":
+		return v == false, nil
+	case "integer":
+		_, ok := v.(int64)
+		return ok, nil
+	case "float":
+		_, ok := v.(float64)
+		return ok, nil
+	case "number":
+		_, ok := toNumber(v)
+		return ok, nil
+	case "string":
+		_, ok := v.(string)
+		return ok, nil
+	case "mapping":
+		_, ok := v.(*Dict)
+		return ok, nil
+	case "iterable", "sequence":
+		switch v.(type) {
+		case string, []any, Tuple, *Dict:
+			return true, nil
+		}
+		return false, nil
+	case "callable":
+		_, ok := v.(Func)
+		return ok, nil
+	case "odd", "even", "divisibleby":
+		i, ok := v.(int64)
+		if !ok {
+			return false, fmt.Errorf("test '%s' requires an integer", name)
+		}
+		switch name {
+		case "odd":
+			return i%2 != 0, nil
+		case "even":
+			return i%2 == 0, nil
+		}
+		d, ok := a(0).(int64)
+		if !ok || d == 0 {
+			return false, errors.New("test 'divisibleby' requires a non-zero integer")
+		}
+		return i%d == 0, nil
+	case "eq", "equalto", "==":
+		return equal(v, a(0)), nil
+	case "ne", "!=":
+		return !equal(v, a(0)), nil
+	case "lt", "lessthan", "<", "gt", "greaterthan", ">", "le", "<=", "ge", ">=":
+		op := map[string]string{"lt": "<", "lessthan": "<", "gt": ">", "greaterthan": ">", "le": "<=", "ge": ">="}[name]
+		if op == "" {
+			op = name
+		}
+		r, err := binaryOp(op, v, a(0))
+		if err != nil {
+			return false, err
+		}
+		return r.(bool), nil
+	case "in":
+		return contains(a(0), v)
+	case "lower":
+		s, ok := v.(string)
+		return ok && s == strings.ToLower(s), nil
+	case "upper":
+		s, ok := v.(string)
+		return ok && s == strings.ToUpper(s), nil
+	case "sameas":
+		switch v.(type) {
+		case nil, bool:
+			return v == a(0), nil
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("no test named '%s'", name)
+}
+
+// dictMethod returns the method of the given dict, or nil if not found.
+func dictMethod(d *Dict, name string) Func {
+	switch name {
+	case "items":
+		return func([]any, *Dict) (any, error) {
+			return dictItems(d), nil
+		}
+	case "keys":
+		return func([]any, *Dict) (any, error) {
+			return iterate(d)
+		}
+	case "values":
+		return func([]any, *Dict) (any, error) {
+			l := make([]any, 0, d.Len())
+			for _, k := range d.Keys() {
+				l = append(l, d.m[k])
+			}
+			return l, nil
+		}
+	case "get":
+		return func(args []any, kwargs *Dict) (any, error) {
+			if v, ok := d.Get(toString(arg(args, kwargs, 0, "key", ""))); ok {
+				return v, nil
+			}
+			return arg(args, kwargs, 1, "default", nil), nil
+		}
+	}
+	return nil
+}
+
+// listMethod returns the method of the given list, or nil if not found.
+//
+// The list is immutable as the sandbox of the Hugging Face transformers,
+// so the modifying methods raise an error.
+func listMethod(_ []any, name string) Func {
+	switch name {
+	case "append", "extend", "insert", "pop", "remove", "clear", "sort", "reverse":
+		return func([]any, *Dict) (any, error) {
+			return nil, fmt.Errorf("access to attribute '%s' of 'list' object is unsafe", name)
+		}
+	}
+	return nil
+}
+
+// stringMethod returns the method of the given string, or nil if not found.
+func stringMethod(s, name string) Func {
+	strip := func(f func(string, string) string, g func(string, func(rune) bool) string) Func {
+		return func(args []any, kwargs *Dict) (any, error) {
+			if chars, ok := arg(args, kwargs, 0, "chars", nil).(string); ok {
+				return f(s, chars), nil
+			}
+			return g(s, unicode.IsSpace), nil
+		}
+	}
+	affix := func(f func(string, string) bool) Func {
+		return func(args []any, kwargs *Dict) (any, error) {
+			switch t := arg(args, kwargs, 0, "prefix", "").(type) {
+			case string:
+				return f(s, t), nil
+			case []any, Tuple:
+				l, _ := iterate(t)
+				for i := range l {
+					if f(s, toString(l[i])) {
+						return true, nil
+					}
+				}
+				return false, nil
+			}
+			return false, errors.New("startswith/endswith requires a string or a tuple of strings")
+		}
+	}
+	conv := func(f func(string) string) Func {
+		return func([]any, *Dict) (any, error) {
+			return f(s), nil
+		}
+	}
+
+	switch name {
+	case "strip":
+		return strip(strings.Trim, strings.TrimFunc)
+	case "lstrip":
+		return strip(strings.TrimLeft, strings.TrimLeftFunc)
+	case "rstrip":
+		return strip(strings.TrimRight, strings.TrimRightFunc)
+	case "startswith":
+		return affix(strings.HasPrefix)
+	case "endswith":
+		return affix(strings.HasSuffix)
+	case "upper":
+		return conv(strings.ToUpper)
+	case "lower":
+		return conv(strings.ToLower)
+	case "title":
+		return conv(title)
+	case "capitalize":
+		return conv(capitalize)
+	case "split", "rsplit":
+		return func(args []any, kwargs *Dict) (any, error) {
+			sep, hasSep := arg(args, kwargs, 0, "sep", nil).(string)
+			n, _ := arg(args, kwargs, 1, "maxsplit", int64(-1)).(int64)
+			var ss []string
+			switch {
+			case !hasSep:
+				ss = strings.Fields(s)
+				if n >= 0 && int(n) < len(ss) {
+					// Keep the rest as the last part.
+					ss = splitFields(s, int(n), name == "rsplit")
+				}
+			case sep == "":
+				return nil, errors.New("empty separator")
+			case n < 0:
+				ss = strings.Split(s, sep)
+			case name == "split":
+				ss = strings.SplitN(s, sep, int(n)+1)
+			default:
+				ss = rsplitN(s, sep, int(n)+1)
+			}
+			l := make([]any, len(ss))
+			for i := range ss {
+				l[i] = ss[i]
+			}
+			return l, nil
+		}
+	case "splitlines":
+		return func([]any, *Dict) (any, error) {
+			ss := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+			if len(ss) > 0 && ss[len(ss)-1] == "" {
+				ss = ss[:len(ss)-1]
+			}
+			l := make([]any, len(ss))
+			for i := range ss {
+				l[i] = ss[i]
+			}
+			return l, nil
+		}
+	case "replace":
+		return func(args []any, kwargs *Dict) (any, error) {
+			return filterReplace(s, args, kwargs)
+		}
+	case "find":
+		return func(args []any, kwargs *Dict) (any, error) {
+			i := strings.Index(s, toString(arg(args, kwargs, 0, "sub", "")))
+			if i < 0 {
+				return int64(-1), nil
+			}
+			return int64(utf8.RuneCountInString(s[:i])), nil
+		}
+	case "count":
+		return func(args []any, kwargs *Dict) (any, error) {
+			return int64(strings.Count(s, toString(arg(args, kwargs, 0, "sub", "")))), nil
+		}
+	case "join":
+		return func(args []any, kwargs *Dict) (any, error) {
+			return filterJoin(arg(args, kwargs, 0, "iterable", []any{}), []any{s}, NewDict())
+		}
+	}
+	return nil
+}
+
+// splitFields splits the given string by whitespaces at most n times like Python.
+func splitFields(s string, n int, reverse bool) []string {
+	if reverse {
+		s = strings.TrimRightFunc(s, unicode.IsSpace)
+		var ss []string
+		for i := 0; i < n; i++ {
+			j := strings.LastIndexFunc(s, unicode.IsSpace)
+			if j < 0 {
+				break
+			}
+			ss = append([]string{s[j+1:]}, ss...)
+			s = strings.TrimRightFunc(s[:j], unicode.IsSpace)
+		}
+		return append([]string{s}, ss...)
+	}
+	s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	var ss []string
+	for i := 0; i < n; i++ {
+		j := strings.IndexFunc(s, unicode.IsSpace)
+		if j < 0 {
+			break
+		}
+		ss = append(ss, s[:j])
+		s = strings.TrimLeftFunc(s[j:], unicode.IsSpace)
+	}
+	return append(ss, s)
+}
+
+// rsplitN splits the given string by the given separator from the right into at most n parts.
+func rsplitN(s, sep string, n int) []string {
+	var ss []string
+	for len(ss) < n-1 {
+		i := strings.LastIndex(s, sep)
+		if i < 0 {
+			break
+		}
+		ss = append([]string{s[i+len(sep):]}, ss...)
+		s = s[:i]
+	}
+	return append([]string{s}, ss...)
+}
+
+// newGlobals returns the global functions.
+func newGlobals(now func() time.Time) map[string]any {
+	return map[string]any{
+		"raise_exception": Func(func(args []any, kwargs *Dict) (any, error) {
+			return nil, &Exception{Message: toString(arg(args, kwargs, 0, "message", ""))}
+		}),
+		"namespace": Func(func(args []any, kwargs *Dict) (any, error) {
+			ns := NewDict()
+			for _, a := range args {
+				if d, ok := a.(*Dict); ok {
+					for _, k := range d.Keys() {
+						ns.Set(k, d.m[k])
+					}
+				}
+			}
+			for _, k := range kwargs.Keys() {
+				ns.Set(k, kwargs.m[k])
+			}
+			return ns, nil
+		}),
+		"dict": Func(func(_ []any, kwargs *Dict) (any, error) {
+			return kwargs.Clone(), nil
+		}),
+		"range": Func(func(args []any, _ *Dict) (any, error) {
+			var (
+				start, stop, step = int64(0), int64(0), int64(1)
+				ok                = true
+			)
+			for i := range args {
+				if _, isInt := args[i].(int64); !isInt {
+					ok = false
+				}
+			}
+			switch {
+			case !ok:
+				return nil, errors.New("range requires integers")
+			case len(args) == 1:
+				stop = args[0].(int64)
+			case len(args) == 2:
+				start, stop = args[0].(int64), args[1].(int64)
+			case len(args) == 3:
+				start, stop, step = args[0].(int64), args[1].(int64), args[2].(int64)
+			default:
+				return nil, errors.New("range expected 1 to 3 arguments")
+			}
+			if step == 0 {
+				return nil, errors.New("range step must not be zero")
+			}
+			l := []any{}
+			for i := start; step > 0 && i < stop || step < 0 && i > stop; i += step {
+				l = append(l, i)
+			}
+			return l, nil
+		}),
+		"strftime_now": Func(func(args []any, kwargs *Dict) (any, error) {
+			return strftime(now(), toString(arg(args, kwargs, 0, "format", ""))), nil
+		}),
+	}
+}
+
+// strftime formats the given time like Python time.strftime.
+func strftime(t time.Time, f string) string {
+	var sb strings.Builder
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' || i+1 >= len(f) {
+			sb.WriteByte(f[i])
+			continue
+		}
+		i++
+		// "%-d" is the non-padded variant of glibc.
+		pad := true
+		if f[i] == '-' && i+1 < len(f) {
+			pad = false
+			i++
+		}
+		num := func(n, w int) {
+			if pad {
+				fmt.Fprintf(&sb, "%0*d", w, n)
+			} else {
+				sb.WriteString(strconv.Itoa(n))
+			}
+		}
+		switch f[i] {
+		case 'Y':
+			sb.WriteString(strconv.Itoa(t.Year()))
+		case 'y':
+			num(t.Year()%100, 2)
+		case 'm':
+			num(int(t.Month()), 2)
+		case 'd':
+			num(t.Day(), 2)
+		case 'H':
+			num(t.Hour(), 2)
+		case 'I':
+			num((t.Hour()+11)%12+1, 2)
+		case 'M':
+			num(t.Minute(), 2)
+		case 'S':
+			num(t.Second(), 2)
+		case 'j':
+			num(t.YearDay(), 3)
+		case 'p':
+			sb.WriteString(t.Format("PM"))
+		case 'B':
+			sb.WriteString(t.Month().String())
+		case 'b', 'h':
+			sb.WriteString(t.Month().String()[:3])
+		case 'A':
+			sb.WriteString(t.Weekday().String())
+		case 'a':
+			sb.WriteString(t.Weekday().String()[:3])
+		case 'Z':
+			sb.WriteString(t.Format("MST"))
+		case 'z':
+			sb.WriteString(t.Format("-0700"))
+		case '%':
+			sb.WriteByte('%')
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(f[i])
+		}
+	}
+	return sb.String()
+}
+
+// formatPercent formats the given arguments with the given format like Python "%" operator,
+// the arguments are a Tuple for multiple values, or a Dict for the "%(name)s" mapping keys.
+func formatPercent(f string, args any) (string, error) {
+	var (
+		vs []any
+		m  *Dict
+		n  int
+	)
+	switch t := args.(type) {
+	case Tuple:
+		vs = t
+	case *Dict:
+		m, vs = t, []any{t}
+	default:
+		vs = []any{t}
+	}
+	next := func() (any, error) {
+		if n >= len(vs) {
+			return nil, errors.New("not enough arguments for format string")
+		}
+		n++
+		return vs[n-1], nil
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' {
+			sb.WriteByte(f[i])
+			continue
+		}
+		i++
+		if i < len(f) && f[i] == '%' {
+			sb.WriteByte('%')
+			continue
+		}
+
+		// Mapping key.
+		var (
+			v      any
+			hasKey bool
+		)
+		if i < len(f) && f[i] == '(' {
+			j := strings.IndexByte(f[i:], ')')
+			if j < 0 {
+				return "", errors.New("incomplete format key")
+			}
+			if m == nil {
+				return "", errors.New("format requires a mapping")
+			}
+			k := f[i+1 : i+j]
+			var ok bool
+			if v, ok = m.Get(k); !ok {
+				return "", fmt.Errorf("key error: %s", repr(k))
+			}
+			hasKey, i = true, i+j+1
+		}
+
+		// Flags, width and precision.
+		s := i
+		for i < len(f) && strings.IndexByte("-+ 0#", f[i]) >= 0 {
+			i++
+		}
+		flags := f[s:i]
+		s = i
+		for i < len(f) && isDigit(f[i]) {
+			i++
+		}
+		width := f[s:i]
+		prec := ""
+		if i < len(f) && f[i] == '.' {
+			s = i
+			for i++; i < len(f) && isDigit(f[i]); i++ {
+			}
+			prec = f[s:i]
+			if prec == "." {
+				prec = ".0"
+			}
+		}
+		// Length modifiers are ignored like Python.
+		for i < len(f) && strings.IndexByte("hlL", f[i]) >= 0 {
+			i++
+		}
+		if i >= len(f) {
+			return "", errors.New("incomplete format")
+		}
+
+		if !hasKey {
+			var err error
+			if v, err = next(); err != nil {
+				return "", err
+			}
+		}
+		// The zero padding is for the numbers only.
+		spec, sspec := "%"+flags+width+prec, "%"+strings.ReplaceAll(flags, "0", "")+width+prec
+		switch c := f[i]; c {
+		case 's', 'r', 'a':
+			str := toString(v)
+			if c != 's' {
+				str = repr(v)
+			}
+			sb.WriteString(fmt.Sprintf(sspec+"s", str))
+		case 'd', 'i', 'u', 'o', 'x', 'X':
+			x, ok := toNumber(v)
+			if !ok {
+				return "", fmt.Errorf("%%%c format: a real number is required, not %s", c, typeName(v))
+			}
+			if xf, ok := x.(float64); ok {
+				if math.IsNaN(xf) || math.IsInf(xf, 0) {
+					return "", errors.New("cannot convert float to integer")
+				}
+				x = int64(xf)
+			}
+			switch c {
+			case 'd', 'i', 'u':
+				c = 'd'
+			case 'o':
+				if strings.Contains(flags, "#") {
+					// Python prefixes "0o" rather than "0".
+					spec, c = strings.ReplaceAll(spec, "#", ""), 'O'
+				}
+			}
+			sb.WriteString(fmt.Sprintf(spec+string(c), x))
+		case 'e', 'E', 'f', 'F', 'g', 'G':
+			x, ok := toFloat(v)
+			if !ok {
+				return "", fmt.Errorf("must be real number, not %s", typeName(v))
+			}
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				str := formatFloat(x)
+				if x > 0 && strings.Contains(flags, "+") {
+					str = "+" + str
+				}
+				if c == 'E' || c == 'F' || c == 'G' {
+					str = strings.ToUpper(str)
+				}
+				sb.WriteString(fmt.Sprintf("%"+strings.ReplaceAll(flags, "0", "")+width+"s", str))
+				continue
+			}
+			if prec == "" {
+				// Python defaults the precision to 6 for all, while Go uses the shortest for "g".
+				spec += ".6"
+			}
+			sb.WriteString(fmt.Sprintf(spec+string(c), x))
+		case 'c':
+			switch t := v.(type) {
+			case int64:
+				sb.WriteString(fmt.Sprintf(sspec+"c", rune(t)))
+			case string:
+				if utf8.RuneCountInString(t) != 1 {
+					return "", errors.New("%c requires int or char")
+				}
+				sb.WriteString(fmt.Sprintf(sspec+"s", t))
+			default:
+				return "", errors.New("%c requires int or char")
+			}
+		default:
+			return "", fmt.Errorf("unsupported format character '%c'", c)
+		}
+	}
+	if m == nil && n < len(vs) {
+		return "", errors.New("not all arguments converted during string formatting")
+	}
+	return sb.String(), nil
+}
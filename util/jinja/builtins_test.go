@@ -0,0 +1,116 @@
+package jinja
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilters(t *testing.T) {
+	cases := []struct {
+		given    string
+		expected string
+	}{
+		{`{{ -3 | abs }} {{ "hello world" | capitalize }} {{ "hello world" | title }}`, `3 Hello world Hello World`},
+		{`{{ u | default("x") }} {{ "" | default("x", true) }} {{ n | default("x") }}`, `x x None`},
+		{`{{ "<a href='x'>" | e }}`, `&lt;a href=&#39;x&#39;&gt;`},
+		{`{{ [1, 2, 3] | first }} {{ [1, 2, 3] | last }} {{ "abc" | length }}`, `1 3 3`},
+		{`{{ "3.5" | float }} {{ "42" | int }} {{ 3.9 | int }} {{ "x" | int(7) }}`, `3.5 42 3 7`},
+		{`{{ "a\nb" | indent(2) }}`, "a\n  b"},
+		{`{{ [1, 2] | join("-") }} {{ "ab" | list }}`, `1-2 ['a', 'b']`},
+		{`{{ ["a", "B"] | map("upper") | list }} {{ xs | map(attribute="n") | list }}`, `['A', 'B'] [2, 1]`},
+		{`{{ [3, 1, 2] | max }} {{ [3, 1, 2] | min }} {{ [1, 2, 3] | sum }} {{ [1, 2] | sum(start=10) }}`, `3 1 6 13`},
+		{`{{ [1, 2, 3, 4] | select("even") | list }} {{ [1, 2, 3, 4] | reject("odd") | list }}`, `[2, 4] [2, 4]`},
+		{`{{ xs | selectattr("n", "gt", 1) | list }} {{ xs | rejectattr("n", "gt", 1) | map(attribute="n") | list }}`, `[{'n': 2}] [1]`},
+		{`{{ "aaa" | replace("a", "b", 2) }} {{ [1, 2, 3] | reverse | list }} {{ "abc" | reverse }}`, `bba [3, 2, 1] cba`},
+		{`{{ 2.567 | round(2) }} {{ 2.5 | round(0, "floor") }}`, `2.57 2.0`},
+		{`{{ ["b", "A", "c"] | sort }} {{ xs | sort(attribute="n") | map(attribute="n") | join }}`, `['A', 'b', 'c'] 12`},
+		{`{{ [1, 2] | string }} {{ "  x " | trim }} {{ [1, 2, 1] | unique | list }}`, `[1, 2] x [1, 2]`},
+		{`{{ "a b  c" | wordcount }} {{ "Ab" | lower }}{{ "Ab" | upper }}`, `3 abAB`},
+		{`{{ {"a": 1} | tojson }} {{ {"a": [1]} | tojson(indent=2) }}`, "{\"a\": 1} {\n  \"a\": [\n    1\n  ]\n}"},
+		{`{{ {"b": 1, "a": 2} | dictsort(reverse=true) }}`, `[('b', 1), ('a', 2)]`},
+	}
+	for _, tc := range cases {
+		actual, err := testRender(t, tc.given, `{"n": null, "xs": [{"n": 2}, {"n": 1}]}`)
+		if assert.NoError(t, err, tc.given) {
+			assert.Equal(t, tc.expected, actual, tc.given)
+		}
+	}
+
+	_, err := testRender(t, `{{ 1 | unknown }}`, "")
+	assert.Error(t, err)
+}
+
+func TestTests(t *testing.T) {
+	cases := []struct {
+		given    string
+		expected string
+	}{
+		{`{{ x is defined }} {{ u is defined }} {{ u is undefined }} {{ n is none }}`, `True False True True`},
+		{`{{ true is boolean }} {{ true is true }} {{ false is false }} {{ 1 is boolean }}`, `True True True False`},
+		{`{{ 1 is integer }} {{ 1.0 is float }} {{ 1.5 is number }} {{ "1" is number }}`, `True True True False`},
+		{`{{ "a" is string }} {{ {} is mapping }} {{ [] is sequence }} {{ "a" is iterable }} {{ 1 is iterable }}`, `True True True True False`},
+		{`{{ 3 is odd }} {{ 4 is even }} {{ 6 is divisibleby 3 }} {{ 7 is divisibleby(3) }}`, `True True True False`},
+		{`{{ 1 is eq 1 }} {{ 1 is ne 1 }} {{ 1 is lt 2 }} {{ 1 is ge 2 }} {{ 1 is in [1] }}`, `True False True False True`},
+		{`{{ "ab" is lower }} {{ "AB" is upper }} {{ n is sameas none }} {{ range is callable }} {{ 1 is not string }}`, `True True True True True`},
+		{`{{ "abc".startswith(("x", "a")) }} {{ "abc".endswith(("b", "x")) }}`, `True False`},
+	}
+	for _, tc := range cases {
+		actual, err := testRender(t, tc.given, `{"x": 1, "n": null}`)
+		if assert.NoError(t, err, tc.given) {
+			assert.Equal(t, tc.expected, actual, tc.given)
+		}
+	}
+
+	_, err := testRender(t, `{{ 1 is unknown }}`, "")
+	assert.Error(t, err)
+}
+
+func TestFormatPercent(t *testing.T) {
+	cases := []struct {
+		format   string
+		args     any
+		expected string
+	}{
+		{"%s-%d", Tuple{"a", int64(3)}, "a-3"},
+		{"%5.2f|%-5s|%05d|%10s", Tuple{3.14159, "ab", int64(42), "x"}, " 3.14|ab   |00042|         x"},
+		{"%x %X %o %#o %#x", Tuple{int64(255), int64(255), int64(8), int64(8), int64(255)}, "ff FF 10 0o10 0xff"},
+		{"%r %s %s", Tuple{"a", []any{int64(1), "b"}, nil}, "'a' [1, 'b'] None"},
+		{"%(name)s is %(age)d", mustDict(t, `{"name": "x", "age": 3}`), "x is 3"},
+		{"%d%%", int64(50), "50%"},
+		{"%g %e %.1f %+d", Tuple{0.1234567, 12345.678, 2.25, int64(1)}, "0.123457 1.234568e+04 2.2 +1"},
+		{"%c%.2s", Tuple{int64(65), "abc"}, "Aab"},
+	}
+	for _, tc := range cases {
+		actual, err := formatPercent(tc.format, tc.args)
+		if assert.NoError(t, err, tc.format) {
+			assert.Equal(t, tc.expected, actual, tc.format)
+		}
+	}
+
+	errCases := []struct {
+		format string
+		args   any
+	}{
+		{"%s %s", Tuple{"a"}},
+		{"%s", Tuple{"a", "b"}},
+		{"%d", "x"},
+		{"%(a)s", Tuple{"x"}},
+		{"%z", "x"},
+		{"%", "x"},
+	}
+	for _, tc := range errCases {
+		_, err := formatPercent(tc.format, tc.args)
+		assert.Error(t, err, tc.format)
+	}
+}
+
+func mustDict(t *testing.T, s string) *Dict {
+	t.Helper()
+
+	v, err := FromJSON([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.(*Dict)
+}
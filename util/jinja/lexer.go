@@ -0,0 +1,346 @@
+package jinja
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type segmentKind int
+
+const (
+	segmentText segmentKind = iota
+	segmentVariable
+	segmentBlock
+)
+
+// segment is a piece of the template source,
+// which is either a text, a {{ variable }} or a {% block %}.
+type segment struct {
+	kind segmentKind
+	// text is the text, or the content inside the tag.
+	text string
+	// line is the line number where the segment starts.
+	line int
+}
+
+var endRawRegex = regexp.MustCompile(`\{%(-?)\s*endraw\s*(-?)%\}`)
+
+// lex splits the given source into segments,
+// the comments are dropped and the whitespace control is applied,
+// as the Jinja2 environment with trim_blocks and lstrip_blocks enabled.
+func lex(src string) ([]segment, error) {
+	var (
+		segs []segment
+		pos  int
+		// stripNext strips the leading whitespace of the next text, set by "-%}".
+		stripNext bool
+		// trimNext removes the first newline of the next text, set by trim_blocks.
+		trimNext bool
+	)
+	emitText := func(text string) {
+		switch {
+		case stripNext:
+			text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		case trimNext:
+			if strings.HasPrefix(text, "\r\n") {
+				text = text[2:]
+			} else if strings.HasPrefix(text, "\n") {
+				text = text[1:]
+			}
+		}
+		stripNext, trimNext = false, false
+		if text != "" {
+			segs = append(segs, segment{kind: segmentText, text: text})
+		}
+	}
+
+	for pos < len(src) {
+		i := indexTagStart(src, pos)
+		if i < 0 {
+			emitText(src[pos:])
+			break
+		}
+		line := strings.Count(src[:i], "\n") + 1
+
+		var (
+			kind    = segmentBlock
+			end     = "%}"
+			comment = false
+		)
+		switch src[i+1] {
+		case '{':
+			kind, end = segmentVariable, "}}"
+		case '#':
+			end, comment = "#}", true
+		}
+
+		// Whitespace control of the tag start.
+		text := src[pos:i]
+		inner := i + 2
+		switch {
+		case inner < len(src) && src[inner] == '-':
+			text = strings.TrimRightFunc(text, unicode.IsSpace)
+			inner++
+		case inner < len(src) && src[inner] == '+':
+			inner++
+		case kind == segmentBlock:
+			// lstrip_blocks.
+			j := strings.LastIndexByte(src[:i], '\n') + 1
+			if j >= pos && strings.TrimLeft(src[j:i], " \t") == "" {
+				text = text[:j-pos]
+			}
+		}
+		emitText(text)
+
+		// Tag end.
+		var j int
+		if comment {
+			j = strings.Index(src[inner:], end)
+			if j >= 0 {
+				j += inner
+			}
+		} else {
+			j = indexTagEnd(src, inner, end)
+		}
+		if j < 0 {
+			return nil, fmt.Errorf("line %d: unclosed tag", line)
+		}
+		content := src[inner:j]
+		pos = j + 2
+
+		// Whitespace control of the tag end.
+		switch {
+		case strings.HasSuffix(content, "-"):
+			content = content[:len(content)-1]
+			stripNext = true
+		case strings.HasSuffix(content, "+"):
+			content = content[:len(content)-1]
+		case kind == segmentBlock:
+			// trim_blocks.
+			trimNext = true
+		}
+		if comment {
+			continue
+		}
+
+		content = strings.TrimSpace(content)
+		if kind == segmentBlock && content == "raw" {
+			m := endRawRegex.FindStringSubmatchIndex(src[pos:])
+			if m == nil {
+				return nil, fmt.Errorf("line %d: unclosed raw block", line)
+			}
+			raw := src[pos : pos+m[0]]
+			if m[3] > m[2] {
+				raw = strings.TrimRightFunc(raw, unicode.IsSpace)
+			}
+			emitText(raw)
+			pos += m[1]
+			stripNext, trimNext = m[5] > m[4], m[5] == m[4]
+			continue
+		}
+		segs = append(segs, segment{kind: kind, text: content, line: line})
+	}
+	return segs, nil
+}
+
+// indexTagStart returns the index of the next tag start from the given position,
+// or -1 if not found.
+func indexTagStart(src string, pos int) int {
+	for i := pos; i+1 < len(src); i++ {
+		if src[i] == '{' && (src[i+1] == '{' || src[i+1] == '%' || src[i+1] == '#') {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexTagEnd returns the index of the given tag end from the given position,
+// the string literals are skipped,
+// or -1 if not found.
+func indexTagEnd(src string, pos int, end string) int {
+	var quote byte
+	for i := pos; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.HasPrefix(src[i:], end):
+			return i
+		}
+	}
+	return -1
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenString
+	tokenInt
+	tokenFloat
+	tokenOperator
+)
+
+// token is a token of the expression inside a tag.
+type token struct {
+	kind  tokenKind
+	value string
+	// num is the value of a tokenInt or tokenFloat.
+	num any
+}
+
+var operators = []string{
+	"==", "!=", "<=", ">=", "//", "**",
+	"<", ">", "+", "-", "*", "/", "%", "~", "|", ".", ",", ":", "(", ")", "[", "]", "{", "}", "=",
+}
+
+// tokenize splits the given content of a tag into tokens.
+func tokenize(s string) ([]token, error) {
+	var ts []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '_' || isLetter(c):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || isLetter(s[j]) || isDigit(s[j])) {
+				j++
+			}
+			ts = append(ts, token{kind: tokenName, value: s[i:j]})
+			i = j
+		case isDigit(c):
+			j := i
+			for j < len(s) && (isDigit(s[j]) || s[j] == '_') {
+				j++
+			}
+			float := false
+			if j+1 < len(s) && s[j] == '.' && isDigit(s[j+1]) {
+				float = true
+				j++
+				for j < len(s) && (isDigit(s[j]) || s[j] == '_') {
+					j++
+				}
+			}
+			if j < len(s) && (s[j] == 'e' || s[j] == 'E') {
+				k := j + 1
+				if k < len(s) && (s[k] == '+' || s[k] == '-') {
+					k++
+				}
+				if k < len(s) && isDigit(s[k]) {
+					float = true
+					for j = k; j < len(s) && isDigit(s[j]); j++ {
+					}
+				}
+			}
+			lit := strings.ReplaceAll(s[i:j], "_", "")
+			if float {
+				f, err := strconv.ParseFloat(lit, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid number %q", s[i:j])
+				}
+				ts = append(ts, token{kind: tokenFloat, value: s[i:j], num: f})
+			} else {
+				n, err := strconv.ParseInt(lit, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid number %q", s[i:j])
+				}
+				ts = append(ts, token{kind: tokenInt, value: s[i:j], num: n})
+			}
+			i = j
+		case c == '\'' || c == '"':
+			v, n, err := unquote(s[i:])
+			if err != nil {
+				return nil, err
+			}
+			ts = append(ts, token{kind: tokenString, value: v})
+			i += n
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					ts = append(ts, token{kind: tokenOperator, value: op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+		}
+	}
+	return append(ts, token{kind: tokenEOF}), nil
+}
+
+// unquote unquotes the string literal at the start of the given string,
+// and returns the value and the length of the literal.
+func unquote(s string) (string, int, error) {
+	q := s[0]
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case q:
+			return sb.String(), i + 1, nil
+		case '\\':
+			i++
+			if i >= len(s) {
+				break
+			}
+			switch e := s[i]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case '0':
+				sb.WriteByte(0)
+			case 'x', 'u', 'U':
+				n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+				if i+n >= len(s) {
+					return "", 0, fmt.Errorf("invalid escape in string literal")
+				}
+				r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid escape in string literal")
+				}
+				sb.WriteRune(rune(r))
+				i += n
+			case '\\', '\'', '"':
+				sb.WriteByte(e)
+			case '\n':
+				// Line continuation.
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(e)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string literal")
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,943 @@
+package jinja
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	errBreak    = errors.New("break")
+	errContinue = errors.New("continue")
+)
+
+// state is the rendering state.
+type state struct {
+	// frames are the variable scopes,
+	// the first is the globals and the second is the template variables.
+	frames []map[string]any
+	// filterInput is the input of the filter block.
+	filterInput any
+}
+
+func (s *state) lookup(name string) any {
+	for i := len(s.frames) - 1; i >= 0; i-- {
+		if v, ok := s.frames[i][name]; ok {
+			return v
+		}
+	}
+	return Undefined{Name: name}
+}
+
+func (s *state) set(name string, v any) {
+	s.frames[len(s.frames)-1][name] = v
+}
+
+// push returns a state with a new scope.
+func (s *state) push(vars map[string]any) *state {
+	fs := make([]map[string]any, len(s.frames), len(s.frames)+1)
+	copy(fs, s.frames)
+	return &state{frames: append(fs, vars)}
+}
+
+type (
+	node interface {
+		render(s *state, sb *strings.Builder) error
+	}
+
+	textNode struct {
+		text string
+	}
+
+	outputNode struct {
+		x expr
+	}
+
+	ifNode struct {
+		conds  []expr
+		bodies [][]node
+		orelse []node
+	}
+
+	forNode struct {
+		targets []string
+		iter    expr
+		cond    expr
+		// recursive is true if the body can call loop(...) to render the loop over the nested items.
+		recursive bool
+		body      []node
+		orelse    []node
+	}
+
+	setNode struct {
+		targets []string
+		// attr is the attribute name of setting a namespace attribute, e.g. "ns.attr".
+		attr string
+		x    expr
+		// body is the body of a block set.
+		body []node
+	}
+
+	macroNode struct {
+		name     string
+		params   []string
+		defaults []expr
+		body     []node
+	}
+
+	filterBlockNode struct {
+		filter expr
+		body   []node
+	}
+
+	blockNode struct {
+		body []node
+	}
+
+	breakNode struct{}
+
+	continueNode struct{}
+)
+
+func renderNodes(s *state, sb *strings.Builder, ns []node) error {
+	for _, n := range ns {
+		if err := n.render(s, sb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n textNode) render(_ *state, sb *strings.Builder) error {
+	sb.WriteString(n.text)
+	return nil
+}
+
+func (n outputNode) render(s *state, sb *strings.Builder) error {
+	v, err := n.x.eval(s)
+	if err != nil {
+		return err
+	}
+	sb.WriteString(toString(v))
+	return nil
+}
+
+func (n ifNode) render(s *state, sb *strings.Builder) error {
+	for i := range n.conds {
+		v, err := n.conds[i].eval(s)
+		if err != nil {
+			return err
+		}
+		if truthy(v) {
+			return renderNodes(s, sb, n.bodies[i])
+		}
+	}
+	return renderNodes(s, sb, n.orelse)
+}
+
+func (n forNode) render(s *state, sb *strings.Builder) error {
+	v, err := n.iter.eval(s)
+	if err != nil {
+		return err
+	}
+	return n.renderLoop(s, sb, v, 0)
+}
+
+// renderLoop renders the loop over the given iterable value at the given depth,
+// the depth increases when a recursive loop calls loop(...).
+func (n forNode) renderLoop(s *state, sb *strings.Builder, v any, depth int) error {
+	items, err := iterate(v)
+	if err != nil {
+		return err
+	}
+
+	bind := func(item any) (map[string]any, error) {
+		vars := map[string]any{}
+		if len(n.targets) == 1 {
+			vars[n.targets[0]] = item
+			return vars, nil
+		}
+		l, err := iterate(item)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unpack non-iterable %s object", typeName(item))
+		}
+		if len(l) != len(n.targets) {
+			return nil, fmt.Errorf("expected %d values to unpack, got %d", len(n.targets), len(l))
+		}
+		for i := range n.targets {
+			vars[n.targets[i]] = l[i]
+		}
+		return vars, nil
+	}
+
+	if n.cond != nil {
+		var filtered []any
+		for _, item := range items {
+			vars, err := bind(item)
+			if err != nil {
+				return err
+			}
+			c, err := n.cond.eval(s.push(vars))
+			if err != nil {
+				return err
+			}
+			if truthy(c) {
+				filtered = append(filtered, item)
+			}
+		}
+		items = filtered
+	}
+
+	if len(items) == 0 {
+		return renderNodes(s, sb, n.orelse)
+	}
+
+	for i, item := range items {
+		vars, err := bind(item)
+		if err != nil {
+			return err
+		}
+		loop := newLoop(items, i, depth)
+		if n.recursive {
+			loop.call = func(args []any, _ *Dict) (any, error) {
+				if len(args) != 1 {
+					return nil, errors.New("loop() takes exactly one argument")
+				}
+				var lsb strings.Builder
+				if err := n.renderLoop(s, &lsb, args[0], depth+1); err != nil {
+					return nil, err
+				}
+				return lsb.String(), nil
+			}
+		}
+		vars["loop"] = loop
+		err = renderNodes(s.push(vars), sb, n.body)
+		switch {
+		case errors.Is(err, errBreak):
+			return nil
+		case errors.Is(err, errContinue):
+		case err != nil:
+			return err
+		}
+	}
+	return nil
+}
+
+// newLoop returns the loop variable of the given index at the given depth.
+func newLoop(items []any, i, depth int) *Dict {
+	l := NewDict()
+	l.Set("index", int64(i+1))
+	l.Set("index0", int64(i))
+	l.Set("revindex", int64(len(items)-i))
+	l.Set("revindex0", int64(len(items)-i-1))
+	l.Set("first", i == 0)
+	l.Set("last", i == len(items)-1)
+	l.Set("length", int64(len(items)))
+	l.Set("depth", int64(depth+1))
+	l.Set("depth0", int64(depth))
+	if i > 0 {
+		l.Set("previtem", items[i-1])
+	} else {
+		l.Set("previtem", Undefined{Name: "previtem"})
+	}
+	if i < len(items)-1 {
+		l.Set("nextitem", items[i+1])
+	} else {
+		l.Set("nextitem", Undefined{Name: "nextitem"})
+	}
+	l.Set("cycle", Func(func(args []any, _ *Dict) (any, error) {
+		if len(args) == 0 {
+			return nil, errors.New("no items for cycling given")
+		}
+		return args[i%len(args)], nil
+	}))
+	return l
+}
+
+func (n setNode) render(s *state, sb *strings.Builder) error {
+	var (
+		v   any
+		err error
+	)
+	if n.x != nil {
+		v, err = n.x.eval(s)
+	} else {
+		var bsb strings.Builder
+		err = renderNodes(s, &bsb, n.body)
+		v = bsb.String()
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case n.attr != "":
+		ns, ok := s.lookup(n.targets[0]).(*Dict)
+		if !ok {
+			return errors.New("cannot assign attribute on non-namespace object")
+		}
+		ns.Set(n.attr, v)
+	case len(n.targets) == 1:
+		s.set(n.targets[0], v)
+	default:
+		l, err := iterate(v)
+		if err != nil {
+			return err
+		}
+		if len(l) != len(n.targets) {
+			return fmt.Errorf("expected %d values to unpack, got %d", len(n.targets), len(l))
+		}
+		for i := range n.targets {
+			s.set(n.targets[i], l[i])
+		}
+	}
+	return nil
+}
+
+func (n macroNode) render(s *state, _ *strings.Builder) error {
+	// Macros see the globals and the template variables.
+	root := &state{frames: s.frames[:min(len(s.frames), 2)]}
+	s.set(n.name, Func(func(args []any, kwargs *Dict) (any, error) {
+		if len(args) > len(n.params) {
+			return nil, fmt.Errorf("macro '%s' takes not more than %d argument(s)", n.name, len(n.params))
+		}
+		vars := map[string]any{}
+		for i, p := range n.params {
+			switch v, ok := kwargs.Get(p); {
+			case i < len(args):
+				vars[p] = args[i]
+			case ok:
+				vars[p] = v
+			case n.defaults[i] != nil:
+				d, err := n.defaults[i].eval(root.push(vars))
+				if err != nil {
+					return nil, err
+				}
+				vars[p] = d
+			default:
+				vars[p] = Undefined{Name: p}
+			}
+		}
+		var sb strings.Builder
+		if err := renderNodes(root.push(vars), &sb, n.body); err != nil {
+			return nil, err
+		}
+		return sb.String(), nil
+	}))
+	return nil
+}
+
+func (n filterBlockNode) render(s *state, sb *strings.Builder) error {
+	var bsb strings.Builder
+	if err := renderNodes(s, &bsb, n.body); err != nil {
+		return err
+	}
+	fs := *s
+	fs.filterInput = bsb.String()
+	v, err := n.filter.eval(&fs)
+	if err != nil {
+		return err
+	}
+	sb.WriteString(toString(v))
+	return nil
+}
+
+func (n blockNode) render(s *state, sb *strings.Builder) error {
+	return renderNodes(s, sb, n.body)
+}
+
+func (breakNode) render(*state, *strings.Builder) error {
+	return errBreak
+}
+
+func (continueNode) render(*state, *strings.Builder) error {
+	return errContinue
+}
+
+type (
+	expr interface {
+		eval(s *state) (any, error)
+	}
+
+	literal struct {
+		v any
+	}
+
+	listExpr struct {
+		items []expr
+	}
+
+	tupleExpr struct {
+		items []expr
+	}
+
+	dictExpr struct {
+		keys   []expr
+		values []expr
+	}
+
+	nameExpr struct {
+		name string
+	}
+
+	attrExpr struct {
+		x    expr
+		name string
+	}
+
+	itemExpr struct {
+		x   expr
+		key expr
+	}
+
+	sliceExpr struct {
+		x                 expr
+		start, stop, step expr
+	}
+
+	kwarg struct {
+		name string
+		x    expr
+	}
+
+	callExpr struct {
+		fn     expr
+		args   []expr
+		kwargs []kwarg
+	}
+
+	filterExpr struct {
+		// x is nil for the filter block.
+		x      expr
+		name   string
+		args   []expr
+		kwargs []kwarg
+	}
+
+	testExpr struct {
+		x      expr
+		name   string
+		args   []expr
+		negate bool
+	}
+
+	unaryExpr struct {
+		op string
+		x  expr
+	}
+
+	binaryExpr struct {
+		op   string
+		x, y expr
+	}
+
+	condExpr struct {
+		cond, then, orelse expr
+	}
+)
+
+func (x literal) eval(*state) (any, error) {
+	return x.v, nil
+}
+
+func (x listExpr) eval(s *state) (any, error) {
+	l := make([]any, len(x.items))
+	for i := range x.items {
+		v, err := x.items[i].eval(s)
+		if err != nil {
+			return nil, err
+		}
+		l[i] = v
+	}
+	return l, nil
+}
+
+func (x tupleExpr) eval(s *state) (any, error) {
+	l, err := listExpr(x).eval(s)
+	if err != nil {
+		return nil, err
+	}
+	return Tuple(l.([]any)), nil
+}
+
+func (x dictExpr) eval(s *state) (any, error) {
+	d := NewDict()
+	for i := range x.keys {
+		k, err := x.keys[i].eval(s)
+		if err != nil {
+			return nil, err
+		}
+		v, err := x.values[i].eval(s)
+		if err != nil {
+			return nil, err
+		}
+		d.Set(toString(k), v)
+	}
+	return d, nil
+}
+
+func (x nameExpr) eval(s *state) (any, error) {
+	return s.lookup(x.name), nil
+}
+
+func (x attrExpr) eval(s *state) (any, error) {
+	v, err := x.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	return getAttr(v, x.name), nil
+}
+
+func (x itemExpr) eval(s *state) (any, error) {
+	v, err := x.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	k, err := x.key.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	return getItem(v, k)
+}
+
+func (x sliceExpr) eval(s *state) (any, error) {
+	v, err := x.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	var idx [3]*int64
+	for i, e := range []expr{x.start, x.stop, x.step} {
+		if e == nil {
+			continue
+		}
+		iv, err := e.eval(s)
+		if err != nil {
+			return nil, err
+		}
+		switch t := iv.(type) {
+		case nil:
+		case int64:
+			idx[i] = &t
+		default:
+			return nil, errors.New("slice indices must be integers or None")
+		}
+	}
+	switch t := v.(type) {
+	case []any, Tuple:
+		items, _ := iterate(t)
+		is, err := sliceIndices(len(items), idx)
+		if err != nil {
+			return nil, err
+		}
+		l := make([]any, len(is))
+		for i := range is {
+			l[i] = items[is[i]]
+		}
+		if _, ok := t.(Tuple); ok {
+			return Tuple(l), nil
+		}
+		return l, nil
+	case string:
+		rs := []rune(t)
+		is, err := sliceIndices(len(rs), idx)
+		if err != nil {
+			return nil, err
+		}
+		r := make([]rune, len(is))
+		for i := range is {
+			r[i] = rs[is[i]]
+		}
+		return string(r), nil
+	case Undefined:
+		return t, nil
+	}
+	return nil, fmt.Errorf("'%s' object is not subscriptable", typeName(v))
+}
+
+// sliceIndices returns the indices selected by the given slice of the given length like Python.
+func sliceIndices(n int, idx [3]*int64) ([]int, error) {
+	step := 1
+	if idx[2] != nil {
+		step = int(*idx[2])
+		if step == 0 {
+			return nil, errors.New("slice step cannot be zero")
+		}
+	}
+	clamp := func(p *int64, def int) int {
+		if p == nil {
+			return def
+		}
+		i := int(*p)
+		if i < 0 {
+			i += n
+		}
+		if step > 0 {
+			return max(0, min(i, n))
+		}
+		return max(-1, min(i, n-1))
+	}
+	var is []int
+	if step > 0 {
+		for i := clamp(idx[0], 0); i < clamp(idx[1], n); i += step {
+			is = append(is, i)
+		}
+	} else {
+		for i := clamp(idx[0], n-1); i > clamp(idx[1], -1); i += step {
+			is = append(is, i)
+		}
+	}
+	return is, nil
+}
+
+func (x callExpr) eval(s *state) (any, error) {
+	fn, err := x.fn.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	args, kwargs, err := evalArgs(s, x.args, x.kwargs)
+	if err != nil {
+		return nil, err
+	}
+	switch f := fn.(type) {
+	case Func:
+		return f(args, kwargs)
+	case *Dict:
+		if f.call != nil {
+			return f.call(args, kwargs)
+		}
+	case Undefined:
+		return nil, fmt.Errorf("'%s' is undefined", f.Name)
+	}
+	return nil, fmt.Errorf("'%s' object is not callable", typeName(fn))
+}
+
+func evalArgs(s *state, xs []expr, kws []kwarg) ([]any, *Dict, error) {
+	args := make([]any, len(xs))
+	for i := range xs {
+		v, err := xs[i].eval(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		args[i] = v
+	}
+	kwargs := NewDict()
+	for _, kw := range kws {
+		v, err := kw.x.eval(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		kwargs.Set(kw.name, v)
+	}
+	return args, kwargs, nil
+}
+
+func (x filterExpr) eval(s *state) (any, error) {
+	var (
+		v   = s.filterInput
+		err error
+	)
+	if x.x != nil {
+		if v, err = x.x.eval(s); err != nil {
+			return nil, err
+		}
+	}
+	f, ok := filters[x.name]
+	if !ok {
+		return nil, fmt.Errorf("no filter named '%s'", x.name)
+	}
+	args, kwargs, err := evalArgs(s, x.args, x.kwargs)
+	if err != nil {
+		return nil, err
+	}
+	return f(v, args, kwargs)
+}
+
+func (x testExpr) eval(s *state) (any, error) {
+	v, err := x.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	args, _, err := evalArgs(s, x.args, nil)
+	if err != nil {
+		return nil, err
+	}
+	r, err := applyTest(x.name, v, args)
+	if err != nil {
+		return nil, err
+	}
+	return r != x.negate, nil
+}
+
+func (x unaryExpr) eval(s *state) (any, error) {
+	v, err := x.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "not":
+		return !truthy(v), nil
+	case "-":
+		switch t := v.(type) {
+		case int64:
+			return -t, nil
+		case float64:
+			return -t, nil
+		case bool:
+			if t {
+				return int64(-1), nil
+			}
+			return int64(0), nil
+		}
+	case "+":
+		if n, ok := toNumber(v); ok {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("bad operand type for unary %s: '%s'", x.op, typeName(v))
+}
+
+func (x binaryExpr) eval(s *state) (any, error) {
+	l, err := x.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "and":
+		if !truthy(l) {
+			return l, nil
+		}
+		return x.y.eval(s)
+	case "or":
+		if truthy(l) {
+			return l, nil
+		}
+		return x.y.eval(s)
+	}
+	r, err := x.y.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	return binaryOp(x.op, l, r)
+}
+
+func binaryOp(op string, l, r any) (any, error) {
+	switch op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "<", ">", "<=", ">=":
+		c, err := compare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "<":
+			return c < 0, nil
+		case ">":
+			return c > 0, nil
+		case "<=":
+			return c <= 0, nil
+		}
+		return c >= 0, nil
+	case "in":
+		return contains(r, l)
+	case "not in":
+		c, err := contains(r, l)
+		return !c, err
+	case "~":
+		return toString(l) + toString(r), nil
+	case "%":
+		if lt, ok := l.(string); ok {
+			return formatPercent(lt, r)
+		}
+	}
+
+	ln, lok := toNumber(l)
+	rn, rok := toNumber(r)
+	if lok && rok {
+		return arithmetic(op, ln, rn)
+	}
+
+	switch op {
+	case "+":
+		switch lt := l.(type) {
+		case string:
+			if rt, ok := r.(string); ok {
+				return lt + rt, nil
+			}
+		case []any:
+			if rt, ok := r.([]any); ok {
+				return append(append(make([]any, 0, len(lt)+len(rt)), lt...), rt...), nil
+			}
+		case Tuple:
+			if rt, ok := r.(Tuple); ok {
+				return append(append(make(Tuple, 0, len(lt)+len(rt)), lt...), rt...), nil
+			}
+		}
+	case "*":
+		n, ok := r.(int64)
+		if !ok {
+			n, ok = l.(int64)
+			l, r = r, l
+		}
+		if ok {
+			switch lt := l.(type) {
+			case string:
+				return strings.Repeat(lt, int(max(n, 0))), nil
+			case []any:
+				var ls []any
+				for i := int64(0); i < n; i++ {
+					ls = append(ls, lt...)
+				}
+				return ls, nil
+			case Tuple:
+				var ls Tuple
+				for i := int64(0); i < n; i++ {
+					ls = append(ls, lt...)
+				}
+				return ls, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unsupported operand type(s) for %s: '%s' and '%s'", op, typeName(l), typeName(r))
+}
+
+// arithmetic applies the given operator on the given numbers like Python.
+func arithmetic(op string, l, r any) (any, error) {
+	li, lok := l.(int64)
+	ri, rok := r.(int64)
+	if lok && rok {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "//", "%":
+			if ri == 0 {
+				return nil, errors.New("integer division or modulo by zero")
+			}
+			q, m := li/ri, li%ri
+			if m != 0 && (m < 0) != (ri < 0) {
+				q, m = q-1, m+ri
+			}
+			if op == "//" {
+				return q, nil
+			}
+			return m, nil
+		case "**":
+			if ri >= 0 {
+				p := int64(1)
+				for i := int64(0); i < ri; i++ {
+					p *= li
+				}
+				return p, nil
+			}
+		}
+	}
+
+	lf, _ := toFloat(l)
+	rf, _ := toFloat(r)
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return lf / rf, nil
+	case "//":
+		if rf == 0 {
+			return nil, errors.New("float floor division by zero")
+		}
+		return math.Floor(lf / rf), nil
+	case "%":
+		if rf == 0 {
+			return nil, errors.New("float modulo")
+		}
+		m := math.Mod(lf, rf)
+		if m != 0 && (m < 0) != (rf < 0) {
+			m += rf
+		}
+		return m, nil
+	case "**":
+		return math.Pow(lf, rf), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", op)
+}
+
+func (x condExpr) eval(s *state) (any, error) {
+	c, err := x.cond.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(c) {
+		return x.then.eval(s)
+	}
+	return x.orelse.eval(s)
+}
+
+// getAttr returns the attribute of the given value,
+// the item is preferred for a dict.
+func getAttr(v any, name string) any {
+	switch t := v.(type) {
+	case *Dict:
+		if a, ok := t.Get(name); ok {
+			return a
+		}
+		if m := dictMethod(t, name); m != nil {
+			return m
+		}
+	case []any:
+		if m := listMethod(t, name); m != nil {
+			return m
+		}
+	case string:
+		if m := stringMethod(t, name); m != nil {
+			return m
+		}
+	}
+	return Undefined{Name: name}
+}
+
+// getItem returns the item of the given value,
+// the attribute is tried if the item is not found.
+func getItem(v, k any) (any, error) {
+	switch t := v.(type) {
+	case *Dict:
+		if s, ok := k.(string); ok {
+			if a, ok := t.Get(s); ok {
+				return a, nil
+			}
+			return getAttr(v, s), nil
+		}
+		if a, ok := t.Get(toString(k)); ok {
+			return a, nil
+		}
+		return Undefined{Name: toString(k)}, nil
+	case []any, Tuple, string:
+		i, ok := k.(int64)
+		if !ok {
+			if s, ok := k.(string); ok {
+				return getAttr(v, s), nil
+			}
+			return nil, fmt.Errorf("%s indices must be integers, not %s", typeName(v), typeName(k))
+		}
+		l, _ := iterate(t)
+		if i < 0 {
+			i += int64(len(l))
+		}
+		if i < 0 || i >= int64(len(l)) {
+			return Undefined{Name: toString(k)}, nil
+		}
+		return l[i], nil
+	}
+	return Undefined{Name: toString(k)}, nil
+}
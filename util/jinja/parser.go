@@ -0,0 +1,777 @@
+package jinja
+
+import (
+	"fmt"
+	"slices"
+)
+
+// parser builds the nodes from the segments.
+type parser struct {
+	segs []segment
+	pos  int
+}
+
+// parseBody parses the nodes until one of the given end tags,
+// and returns the nodes, the end tag and the tokens of the end tag block.
+//
+// If no end tags are given, parses until the end of the segments.
+func (p *parser) parseBody(ends ...string) ([]node, string, *tokens, error) {
+	var ns []node
+	for p.pos < len(p.segs) {
+		seg := p.segs[p.pos]
+		p.pos++
+
+		switch seg.kind {
+		case segmentText:
+			ns = append(ns, textNode{text: seg.text})
+			continue
+		case segmentVariable:
+			ts, err := newTokens(seg)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			x, err := ts.parseExpression(true)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			if err = ts.expectEOF(); err != nil {
+				return nil, "", nil, err
+			}
+			ns = append(ns, outputNode{x: x})
+			continue
+		}
+
+		ts, err := newTokens(seg)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		tag := ts.peek()
+		if tag.kind != tokenName {
+			return nil, "", nil, ts.errorf("expected tag name")
+		}
+		if slices.Contains(ends, tag.value) {
+			ts.next()
+			return ns, tag.value, ts, nil
+		}
+		ts.next()
+
+		var n node
+		switch tag.value {
+		case "if":
+			n, err = p.parseIf(ts)
+		case "for":
+			n, err = p.parseFor(ts)
+		case "set":
+			n, err = p.parseSet(ts)
+		case "macro":
+			n, err = p.parseMacro(ts)
+		case "filter":
+			n, err = p.parseFilterBlock(ts)
+		case "generation":
+			var body []node
+			if body, _, _, err = p.parseBlockBody(ts, "endgeneration"); err == nil {
+				n = blockNode{body: body}
+			}
+		case "break":
+			n, err = breakNode{}, ts.expectEOF()
+		case "continue":
+			n, err = continueNode{}, ts.expectEOF()
+		default:
+			if len(ends) != 0 {
+				return nil, "", nil, ts.errorf("unexpected tag %q, expected %v", tag.value, ends)
+			}
+			return nil, "", nil, ts.errorf("unknown tag %q", tag.value)
+		}
+		if err != nil {
+			return nil, "", nil, err
+		}
+		ns = append(ns, n)
+	}
+	if len(ends) != 0 {
+		return nil, "", nil, fmt.Errorf("unexpected end of template, expected %v", ends)
+	}
+	return ns, "", nil, nil
+}
+
+// parseBlockBody expects the end of the given tag block tokens,
+// and parses the body until one of the given end tags.
+func (p *parser) parseBlockBody(ts *tokens, ends ...string) ([]node, string, *tokens, error) {
+	if err := ts.expectEOF(); err != nil {
+		return nil, "", nil, err
+	}
+	return p.parseBody(ends...)
+}
+
+func (p *parser) parseIf(ts *tokens) (node, error) {
+	var n ifNode
+	for {
+		cond, err := ts.parseExpression(true)
+		if err != nil {
+			return nil, err
+		}
+		body, end, ets, err := p.parseBlockBody(ts, "elif", "else", "endif")
+		if err != nil {
+			return nil, err
+		}
+		n.conds = append(n.conds, cond)
+		n.bodies = append(n.bodies, body)
+		switch end {
+		case "elif":
+			ts = ets
+			continue
+		case "else":
+			n.orelse, _, ets, err = p.parseBlockBody(ets, "endif")
+			if err != nil {
+				return nil, err
+			}
+		}
+		return n, ets.expectEOF()
+	}
+}
+
+func (p *parser) parseFor(ts *tokens) (node, error) {
+	var (
+		n   forNode
+		err error
+	)
+	n.targets, err = ts.parseTargets()
+	if err != nil {
+		return nil, err
+	}
+	if !ts.skipName("in") {
+		return nil, ts.errorf("expected 'in'")
+	}
+	n.iter, err = ts.parseExpression(false)
+	if err != nil {
+		return nil, err
+	}
+	if ts.skipName("if") {
+		if n.cond, err = ts.parseExpression(false); err != nil {
+			return nil, err
+		}
+	}
+	n.recursive = ts.skipName("recursive")
+	body, end, ets, err := p.parseBlockBody(ts, "else", "endfor")
+	if err != nil {
+		return nil, err
+	}
+	n.body = body
+	if end == "else" {
+		n.orelse, _, ets, err = p.parseBlockBody(ets, "endfor")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, ets.expectEOF()
+}
+
+func (p *parser) parseSet(ts *tokens) (node, error) {
+	var n setNode
+	t := ts.next()
+	if t.kind != tokenName {
+		return nil, ts.errorf("expected name")
+	}
+	n.targets = []string{t.value}
+	switch {
+	case ts.skipOperator("."):
+		a := ts.next()
+		if a.kind != tokenName {
+			return nil, ts.errorf("expected attribute name")
+		}
+		n.attr = a.value
+	case ts.peek().value == ",":
+		for ts.skipOperator(",") {
+			t := ts.next()
+			if t.kind != tokenName {
+				return nil, ts.errorf("expected name")
+			}
+			n.targets = append(n.targets, t.value)
+		}
+	}
+
+	if !ts.skipOperator("=") {
+		// Block set.
+		if len(n.targets) != 1 || n.attr != "" {
+			return nil, ts.errorf("expected '='")
+		}
+		body, _, ets, err := p.parseBlockBody(ts, "endset")
+		if err != nil {
+			return nil, err
+		}
+		n.body = body
+		return n, ets.expectEOF()
+	}
+
+	x, err := ts.parseTuple()
+	if err != nil {
+		return nil, err
+	}
+	n.x = x
+	return n, ts.expectEOF()
+}
+
+func (p *parser) parseMacro(ts *tokens) (node, error) {
+	var n macroNode
+	t := ts.next()
+	if t.kind != tokenName {
+		return nil, ts.errorf("expected macro name")
+	}
+	n.name = t.value
+	if !ts.skipOperator("(") {
+		return nil, ts.errorf("expected '('")
+	}
+	for !ts.skipOperator(")") {
+		if len(n.params) != 0 && !ts.skipOperator(",") {
+			return nil, ts.errorf("expected ','")
+		}
+		a := ts.next()
+		if a.kind != tokenName {
+			return nil, ts.errorf("expected parameter name")
+		}
+		var def expr
+		if ts.skipOperator("=") {
+			var err error
+			if def, err = ts.parseExpression(true); err != nil {
+				return nil, err
+			}
+		}
+		n.params = append(n.params, a.value)
+		n.defaults = append(n.defaults, def)
+	}
+	body, _, ets, err := p.parseBlockBody(ts, "endmacro")
+	if err != nil {
+		return nil, err
+	}
+	n.body = body
+	return n, ets.expectEOF()
+}
+
+func (p *parser) parseFilterBlock(ts *tokens) (node, error) {
+	var n filterBlockNode
+	// The first filter applies to the rendered body,
+	// which has no leading "|", e.g. "{% filter upper | trim %}".
+	t := ts.next()
+	if t.kind != tokenName {
+		return nil, ts.errorf("expected filter name")
+	}
+	f := filterExpr{name: t.value}
+	if ts.skipOperator("(") {
+		var err error
+		if f.args, f.kwargs, err = ts.parseArgs(); err != nil {
+			return nil, err
+		}
+	}
+	x, err := ts.parseFilters(f)
+	if err != nil {
+		return nil, err
+	}
+	n.filter = x
+	body, _, ets, err := p.parseBlockBody(ts, "endfilter")
+	if err != nil {
+		return nil, err
+	}
+	n.body = body
+	return n, ets.expectEOF()
+}
+
+// tokens is the cursor of the tokens of a tag.
+type tokens struct {
+	ts   []token
+	pos  int
+	line int
+}
+
+func newTokens(seg segment) (*tokens, error) {
+	ts, err := tokenize(seg.text)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", seg.line, err)
+	}
+	return &tokens{ts: ts, line: seg.line}, nil
+}
+
+func (ts *tokens) peek() token {
+	return ts.ts[ts.pos]
+}
+
+func (ts *tokens) peekAt(n int) token {
+	if ts.pos+n < len(ts.ts) {
+		return ts.ts[ts.pos+n]
+	}
+	return token{kind: tokenEOF}
+}
+
+func (ts *tokens) next() token {
+	t := ts.ts[ts.pos]
+	if t.kind != tokenEOF {
+		ts.pos++
+	}
+	return t
+}
+
+func (ts *tokens) skipOperator(op string) bool {
+	if t := ts.peek(); t.kind == tokenOperator && t.value == op {
+		ts.pos++
+		return true
+	}
+	return false
+}
+
+func (ts *tokens) skipName(name string) bool {
+	if t := ts.peek(); t.kind == tokenName && t.value == name {
+		ts.pos++
+		return true
+	}
+	return false
+}
+
+func (ts *tokens) expectOperator(op string) error {
+	if !ts.skipOperator(op) {
+		return ts.errorf("expected '%s'", op)
+	}
+	return nil
+}
+
+func (ts *tokens) expectEOF() error {
+	if ts.peek().kind != tokenEOF {
+		return ts.errorf("unexpected '%s'", ts.peek().value)
+	}
+	return nil
+}
+
+func (ts *tokens) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", ts.line, fmt.Sprintf(format, args...))
+}
+
+// parseTargets parses the assignment targets of a for loop, e.g. "k, v".
+func (ts *tokens) parseTargets() ([]string, error) {
+	var names []string
+	paren := ts.skipOperator("(")
+	for {
+		t := ts.next()
+		if t.kind != tokenName {
+			return nil, ts.errorf("expected name")
+		}
+		names = append(names, t.value)
+		if !ts.skipOperator(",") {
+			break
+		}
+	}
+	if paren {
+		if err := ts.expectOperator(")"); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// parseTuple parses an expression, or a tuple without parentheses, e.g. "1, 2".
+func (ts *tokens) parseTuple() (expr, error) {
+	x, err := ts.parseExpression(true)
+	if err != nil {
+		return nil, err
+	}
+	if ts.peek().value != "," || ts.peek().kind != tokenOperator {
+		return x, nil
+	}
+	l := tupleExpr{items: []expr{x}}
+	for ts.skipOperator(",") {
+		if ts.peek().kind == tokenEOF {
+			break
+		}
+		x, err = ts.parseExpression(true)
+		if err != nil {
+			return nil, err
+		}
+		l.items = append(l.items, x)
+	}
+	return l, nil
+}
+
+func (ts *tokens) parseExpression(withCond bool) (expr, error) {
+	x, err := ts.parseOr()
+	if err != nil || !withCond {
+		return x, err
+	}
+	for ts.skipName("if") {
+		c, err := ts.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		var e expr = literal{v: Undefined{}}
+		if ts.skipName("else") {
+			if e, err = ts.parseExpression(true); err != nil {
+				return nil, err
+			}
+		}
+		x = condExpr{cond: c, then: x, orelse: e}
+	}
+	return x, nil
+}
+
+func (ts *tokens) parseOr() (expr, error) {
+	x, err := ts.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for ts.skipName("or") {
+		y, err := ts.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op: "or", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (ts *tokens) parseAnd() (expr, error) {
+	x, err := ts.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for ts.skipName("and") {
+		y, err := ts.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op: "and", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (ts *tokens) parseNot() (expr, error) {
+	if ts.skipName("not") {
+		x, err := ts.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: "not", x: x}, nil
+	}
+	return ts.parseCompare()
+}
+
+func (ts *tokens) parseCompare() (expr, error) {
+	x, err := ts.parseMath1()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := ts.peek()
+		var op string
+		switch {
+		case t.kind == tokenOperator && slices.Contains([]string{"==", "!=", "<", ">", "<=", ">="}, t.value):
+			op = t.value
+			ts.next()
+		case t.kind == tokenName && t.value == "in":
+			op = "in"
+			ts.next()
+		case t.kind == tokenName && t.value == "not" && ts.peekAt(1).kind == tokenName && ts.peekAt(1).value == "in":
+			op = "not in"
+			ts.next()
+			ts.next()
+		default:
+			return x, nil
+		}
+		y, err := ts.parseMath1()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op: op, x: x, y: y}
+	}
+}
+
+func (ts *tokens) parseBinary(ops []string, next func() (expr, error)) (expr, error) {
+	x, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := ts.peek()
+		if t.kind != tokenOperator || !slices.Contains(ops, t.value) {
+			return x, nil
+		}
+		ts.next()
+		y, err := next()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op: t.value, x: x, y: y}
+	}
+}
+
+func (ts *tokens) parseMath1() (expr, error) {
+	return ts.parseBinary([]string{"+", "-"}, ts.parseConcat)
+}
+
+func (ts *tokens) parseConcat() (expr, error) {
+	return ts.parseBinary([]string{"~"}, ts.parseMath2)
+}
+
+func (ts *tokens) parseMath2() (expr, error) {
+	return ts.parseBinary([]string{"*", "/", "//", "%"}, ts.parsePow)
+}
+
+func (ts *tokens) parsePow() (expr, error) {
+	return ts.parseBinary([]string{"**"}, func() (expr, error) { return ts.parseUnary(true) })
+}
+
+func (ts *tokens) parseUnary(withFilter bool) (expr, error) {
+	var (
+		x   expr
+		err error
+	)
+	switch t := ts.peek(); {
+	case t.kind == tokenOperator && (t.value == "-" || t.value == "+"):
+		ts.next()
+		if x, err = ts.parseUnary(false); err != nil {
+			return nil, err
+		}
+		x = unaryExpr{op: t.value, x: x}
+	default:
+		if x, err = ts.parsePrimary(); err != nil {
+			return nil, err
+		}
+		if x, err = ts.parsePostfix(x); err != nil {
+			return nil, err
+		}
+	}
+	if !withFilter {
+		return x, nil
+	}
+	return ts.parseFilters(x)
+}
+
+func (ts *tokens) parsePrimary() (expr, error) {
+	t := ts.next()
+	switch t.kind {
+	case tokenName:
+		switch t.value {
+		case "true", "True":
+			return literal{v: true}, nil
+		case "false", "False":
+			return literal{v: false}, nil
+		case "none", "None":
+			return literal{v: nil}, nil
+		}
+		return nameExpr{name: t.value}, nil
+	case tokenString:
+		s := t.value
+		// Adjacent string literals are concatenated.
+		for ts.peek().kind == tokenString {
+			s += ts.next().value
+		}
+		return literal{v: s}, nil
+	case tokenInt, tokenFloat:
+		return literal{v: t.num}, nil
+	case tokenOperator:
+		switch t.value {
+		case "(":
+			// A parenthesized expression, or a tuple, e.g. "()", "(1,)" and "(1, 2)".
+			if ts.skipOperator(")") {
+				return tupleExpr{}, nil
+			}
+			x, err := ts.parseExpression(true)
+			if err != nil {
+				return nil, err
+			}
+			if ts.skipOperator(")") {
+				return x, nil
+			}
+			l := tupleExpr{items: []expr{x}}
+			for ts.skipOperator(",") {
+				if ts.skipOperator(")") {
+					return l, nil
+				}
+				if x, err = ts.parseExpression(true); err != nil {
+					return nil, err
+				}
+				l.items = append(l.items, x)
+			}
+			return l, ts.expectOperator(")")
+		case "[":
+			var l listExpr
+			for !ts.skipOperator("]") {
+				if len(l.items) != 0 {
+					if err := ts.expectOperator(","); err != nil {
+						return nil, err
+					}
+					if ts.skipOperator("]") {
+						break
+					}
+				}
+				x, err := ts.parseExpression(true)
+				if err != nil {
+					return nil, err
+				}
+				l.items = append(l.items, x)
+			}
+			return l, nil
+		case "{":
+			var d dictExpr
+			for !ts.skipOperator("}") {
+				if len(d.keys) != 0 {
+					if err := ts.expectOperator(","); err != nil {
+						return nil, err
+					}
+					if ts.skipOperator("}") {
+						break
+					}
+				}
+				k, err := ts.parseExpression(true)
+				if err != nil {
+					return nil, err
+				}
+				if err = ts.expectOperator(":"); err != nil {
+					return nil, err
+				}
+				v, err := ts.parseExpression(true)
+				if err != nil {
+					return nil, err
+				}
+				d.keys = append(d.keys, k)
+				d.values = append(d.values, v)
+			}
+			return d, nil
+		}
+	case tokenEOF:
+		return nil, ts.errorf("unexpected end of expression")
+	}
+	return nil, ts.errorf("unexpected '%s'", t.value)
+}
+
+func (ts *tokens) parsePostfix(x expr) (expr, error) {
+	for {
+		switch {
+		case ts.skipOperator("."):
+			t := ts.next()
+			switch t.kind {
+			case tokenName:
+				x = attrExpr{x: x, name: t.value}
+			case tokenInt:
+				x = itemExpr{x: x, key: literal{v: t.num}}
+			default:
+				return nil, ts.errorf("expected attribute name")
+			}
+		case ts.skipOperator("["):
+			var (
+				idx [3]expr
+				n   int
+				err error
+			)
+			for {
+				if t := ts.peek(); !(t.kind == tokenOperator && (t.value == ":" || t.value == "]")) {
+					if idx[n], err = ts.parseExpression(true); err != nil {
+						return nil, err
+					}
+				}
+				if n == 2 || !ts.skipOperator(":") {
+					break
+				}
+				n++
+			}
+			if err = ts.expectOperator("]"); err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				if idx[0] == nil {
+					return nil, ts.errorf("expected subscript")
+				}
+				x = itemExpr{x: x, key: idx[0]}
+			} else {
+				x = sliceExpr{x: x, start: idx[0], stop: idx[1], step: idx[2]}
+			}
+		case ts.skipOperator("("):
+			args, kwargs, err := ts.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			x = callExpr{fn: x, args: args, kwargs: kwargs}
+		default:
+			return x, nil
+		}
+	}
+}
+
+// parseArgs parses the call arguments after "(" until ")".
+func (ts *tokens) parseArgs() (args []expr, kwargs []kwarg, err error) {
+	for !ts.skipOperator(")") {
+		if len(args)+len(kwargs) != 0 {
+			if err = ts.expectOperator(","); err != nil {
+				return nil, nil, err
+			}
+			if ts.skipOperator(")") {
+				break
+			}
+		}
+		if t := ts.peek(); t.kind == tokenName && ts.peekAt(1).kind == tokenOperator && ts.peekAt(1).value == "=" {
+			ts.next()
+			ts.next()
+			v, err := ts.parseExpression(true)
+			if err != nil {
+				return nil, nil, err
+			}
+			kwargs = append(kwargs, kwarg{name: t.value, x: v})
+			continue
+		}
+		if len(kwargs) != 0 {
+			return nil, nil, ts.errorf("positional argument follows keyword argument")
+		}
+		v, err := ts.parseExpression(true)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, v)
+	}
+	return args, kwargs, nil
+}
+
+// parseFilters parses the filters and tests applied to the given expression.
+func (ts *tokens) parseFilters(x expr) (expr, error) {
+	for {
+		switch {
+		case ts.skipOperator("|"):
+			t := ts.next()
+			if t.kind != tokenName {
+				return nil, ts.errorf("expected filter name")
+			}
+			f := filterExpr{x: x, name: t.value}
+			if ts.skipOperator("(") {
+				var err error
+				if f.args, f.kwargs, err = ts.parseArgs(); err != nil {
+					return nil, err
+				}
+			}
+			x = f
+		case ts.skipName("is"):
+			te := testExpr{x: x, negate: ts.skipName("not")}
+			t := ts.next()
+			if t.kind != tokenName {
+				return nil, ts.errorf("expected test name")
+			}
+			te.name = t.value
+			switch n := ts.peek(); {
+			case n.kind == tokenOperator && n.value == "(":
+				ts.next()
+				args, _, err := ts.parseArgs()
+				if err != nil {
+					return nil, err
+				}
+				te.args = args
+			case n.kind == tokenString || n.kind == tokenInt || n.kind == tokenFloat ||
+				n.kind == tokenOperator && (n.value == "[" || n.value == "{") ||
+				n.kind == tokenName && !slices.Contains([]string{"and", "or", "else", "if", "in", "is", "not"}, n.value):
+				// A single argument without parentheses, e.g. "is divisibleby 3".
+				arg, err := ts.parsePrimary()
+				if err != nil {
+					return nil, err
+				}
+				if arg, err = ts.parsePostfix(arg); err != nil {
+					return nil, err
+				}
+				te.args = []expr{arg}
+			}
+			x = te
+		default:
+			return x, nil
+		}
+	}
+}
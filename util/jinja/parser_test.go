@@ -0,0 +1,152 @@
+package jinja
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRender parses and renders the given template with the given JSON variables.
+func testRender(t *testing.T, src, vars string) (string, error) {
+	t.Helper()
+
+	tmpl, err := Parse(src)
+	if err != nil {
+		return "", err
+	}
+	m := map[string]any{}
+	if vars != "" {
+		v, err := FromJSON([]byte(vars))
+		require.NoError(t, err)
+		d := v.(*Dict)
+		for _, k := range d.Keys() {
+			m[k], _ = d.Get(k)
+		}
+	}
+	return tmpl.Render(m)
+}
+
+func TestParse_Error(t *testing.T) {
+	cases := []string{
+		`{% for x in y %}x`,
+		`{% endfor %}`,
+		`{% if x %}x{% endfor %}`,
+		`{% foo %}`,
+		`{{ 1 + }}`,
+		`{{ (1, 2 }}`,
+		`{{ [1, 2 }}`,
+		`{{ {'a' 1} }}`,
+		`{{ x y }}`,
+		`{% for x y %}{% endfor %}`,
+		`{% set %}`,
+		`{% macro %}{% endmacro %}`,
+		`{{ f(a=1, 2) }}`,
+		`{{ x[] }}`,
+		`{% filter %}x{% endfilter %}`,
+		`{% filter | upper %}x{% endfilter %}`,
+	}
+	for _, given := range cases {
+		_, err := Parse(given)
+		assert.Error(t, err, given)
+	}
+}
+
+func TestTemplate_Render_Tuple(t *testing.T) {
+	cases := []struct {
+		given    string
+		expected string
+	}{
+		{`{{ "%s-%d" % ("a", 3) }}`, `a-3`},
+		{`{{ ((1, 2)) }}`, `(1, 2)`},
+		{`{{ (1,) }} {{ () }} {{ (1) }}`, `(1,) () 1`},
+		{`{{ (1, 2) == (1, 2) }} {{ (1, 2) == [1, 2] }} {{ (1, 2) < (1, 3) }}`, `True False True`},
+		{`{{ (1, 2) + (3,) }} {{ (1,) * 2 }}`, `(1, 2, 3) (1, 1)`},
+		{`{{ (1, 2, 3)[1:] }} {{ (1, 2, 3)[-1] }} {{ (1, 2) | length }}`, `(2, 3) 3 2`},
+		{`{% set a, b = (1, 2) %}{{ b }} {% set t = 1, 2 %}{{ t }}`, `2 (1, 2)`},
+		{`{{ 2 in (1, 2) }} {{ (1, 2) is sequence }} {{ (1, 2) | list }}`, `True True [1, 2]`},
+		{`{{ (1, "a") | tojson }} {{ "abc".startswith(("x", "a")) }}`, `[1, "a"] True`},
+		{`{% for a, b in [(1, 2), (3, 4)] %}{{ a + b }},{% endfor %}`, `3,7,`},
+		{`{{ {"a": 1} | items | list }} {{ {"b": 1, "a": 2} | dictsort }}`, `[('a', 1)] [('a', 2), ('b', 1)]`},
+		{`{{ x | tojson(separators=(",", ":")) }}`, `{"a":[1,2]}`},
+	}
+	for _, tc := range cases {
+		actual, err := testRender(t, tc.given, `{"x": {"a": [1, 2]}}`)
+		if assert.NoError(t, err, tc.given) {
+			assert.Equal(t, tc.expected, actual, tc.given)
+		}
+	}
+}
+
+func TestTemplate_Render_RecursiveLoop(t *testing.T) {
+	const tree = `{"tree": [
+		{"name": "a", "children": [{"name": "b"}, {"name": "c", "children": [{"name": "d"}]}]},
+		{"name": "e"}
+	]}`
+
+	cases := []struct {
+		given    string
+		expected string
+	}{
+		{
+			given:    `{% for item in tree recursive %}{{ item.name }}{% if item.children %}[{{ loop(item.children) }}]{% endif %}{% endfor %}`,
+			expected: `a[bc[d]]e`,
+		},
+		{
+			given:    `{% for item in tree recursive %}{{ loop.depth }}{{ loop.depth0 }}{% if item.children %}{{ loop(item.children) }}{% endif %}{% endfor %}`,
+			expected: `1021213210`,
+		},
+		{
+			given:    `{% for item in tree if item.name != "c" recursive %}{{ item.name }}{{ loop(item.children) }}{% else %}.{% endfor %}`,
+			expected: `ab.e.`,
+		},
+		{
+			given:    `{% for item in tree recursive %}{{ item.name }}{% if item.children %}{{ loop(item.children) }}{% endif %}{% if loop.first %}{% break %}{% endif %}{% endfor %}`,
+			expected: `ab`,
+		},
+	}
+	for _, tc := range cases {
+		actual, err := testRender(t, tc.given, tree)
+		if assert.NoError(t, err, tc.given) {
+			assert.Equal(t, tc.expected, actual, tc.given)
+		}
+	}
+
+	// The loop is not callable without recursive.
+	_, err := testRender(t, `{% for item in tree %}{{ loop(item.children) }}{% endfor %}`, tree)
+	assert.Error(t, err)
+}
+
+func TestTemplate_Render_Format(t *testing.T) {
+	cases := []struct {
+		given    string
+		expected string
+	}{
+		{`{{ "%s-%d" | format("a", 3) }}`, `a-3`},
+		{`{{ "%(name)s=%(value).2f" | format(name="pi", value=3.14159) }}`, `pi=3.14`},
+		{`{{ "[%5s]" | format(x.a) }}`, `[[1, 2]]`},
+		{`{% filter upper %}a{{ "b" }}c{% endfilter %}`, `ABC`},
+		{`{% filter replace("a", "b") | trim %} a{{ x.a | length }} {% endfilter %}`, `b2`},
+		{`{% set ns = namespace(l=[]) %}{% for i in x.a %}{% set ns.l = ns.l + [i * 2] %}{% endfor %}{{ ns.l }}`, `[2, 4]`},
+	}
+	for _, tc := range cases {
+		actual, err := testRender(t, tc.given, `{"x": {"a": [1, 2]}}`)
+		if assert.NoError(t, err, tc.given) {
+			assert.Equal(t, tc.expected, actual, tc.given)
+		}
+	}
+
+	errs := []struct {
+		given    string
+		expected string
+	}{
+		{`{{ "%s" | format("a", b=1) }}`, "positional and keyword arguments"},
+		{`{{ "%s %s" | format("a") }}`, "not enough arguments"},
+		{`{% set _ = x.a.append(3) %}`, "access to attribute 'append' of 'list' object is unsafe"},
+		{`{{ x.a.pop() }}`, "access to attribute 'pop' of 'list' object is unsafe"},
+	}
+	for _, tc := range errs {
+		_, err := testRender(t, tc.given, `{"x": {"a": [1, 2]}}`)
+		assert.ErrorContains(t, err, tc.expected, tc.given)
+	}
+}
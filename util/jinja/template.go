@@ -0,0 +1,112 @@
+// Package jinja implements the subset of Jinja2 used by the chat templates,
+// which renders as the Hugging Face transformers,
+// i.e. trim_blocks and lstrip_blocks are enabled,
+// the loop controls are supported and the tojson filter does not escape HTML.
+//
+// The supported tags are if, for (with recursive loops), set (with block set and namespace attributes),
+// macro, filter, generation, break and continue,
+// the other tags, e.g. include, extends, block and do, raise the "unknown tag" error.
+//
+// As the immutable sandbox of the Hugging Face transformers,
+// the methods modifying a list, e.g. list.append, raise the "unsafe" error,
+// use the namespace or the list concatenation instead.
+package jinja
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+)
+
+// Template is a parsed template.
+type Template struct {
+	nodes []node
+	now   func() time.Time
+}
+
+// Exception is the error raised by raise_exception in the template.
+type Exception struct {
+	Message string
+}
+
+func (e *Exception) Error() string {
+	return e.Message
+}
+
+// Parse parses the given template source.
+func Parse(src string) (*Template, error) {
+	segs, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{segs: segs}
+	ns, _, _, err := p.parseBody()
+	if err != nil {
+		return nil, err
+	}
+	return &Template{nodes: ns, now: time.Now}, nil
+}
+
+// WithNow returns a copy of the Template,
+// which uses the given function to get the current time for strftime_now.
+func (t *Template) WithNow(now func() time.Time) *Template {
+	c := *t
+	c.now = now
+	return &c
+}
+
+// Render renders the template with the given variables,
+// the Go values are converted into template values via JSON if needed.
+func (t *Template) Render(vars map[string]any) (string, error) {
+	vs := make(map[string]any, len(vars))
+	for k, v := range vars {
+		tv, err := ToValue(v)
+		if err != nil {
+			return "", fmt.Errorf("convert variable %q: %w", k, err)
+		}
+		vs[k] = tv
+	}
+	s := &state{frames: []map[string]any{newGlobals(t.now), maps.Clone(vs)}}
+
+	var sb strings.Builder
+	if err := renderNodes(s, &sb, t.nodes); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// ToValue converts the given Go value into a template value.
+func ToValue(v any) (any, error) {
+	switch t := v.(type) {
+	case nil, Undefined, bool, int64, float64, string, *Dict, Func:
+		return t, nil
+	case int:
+		return int64(t), nil
+	case int32:
+		return int64(t), nil
+	case uint32:
+		return int64(t), nil
+	case float32:
+		return float64(t), nil
+	case json.RawMessage:
+		return FromJSON(t)
+	case []any:
+		l := make([]any, len(t))
+		for i := range t {
+			var err error
+			if l[i], err = ToValue(t[i]); err != nil {
+				return nil, err
+			}
+		}
+		return l, nil
+	case Tuple:
+		l, err := ToValue([]any(t))
+		if err != nil {
+			return nil, err
+		}
+		return Tuple(l.([]any)), nil
+	}
+	return FromGo(v)
+}
@@ -0,0 +1,621 @@
+package jinja
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Values of the template are represented as below:
+//   - nil for None,
+//   - Undefined for the undefined variables,
+//   - bool, int64, float64 and string for the scalars,
+//   - []any for the lists,
+//   - Tuple for the tuples,
+//   - *Dict for the dicts and namespaces,
+//   - Func for the callables.
+
+// Undefined is the value of an undefined variable or attribute,
+// which renders as empty string and is falsy.
+type Undefined struct {
+	// Name is the name of the undefined variable or attribute.
+	Name string
+}
+
+// Func is a callable value.
+type Func func(args []any, kwargs *Dict) (any, error)
+
+// Tuple is an immutable sequence, which renders as "(1, 2)" like Python.
+type Tuple []any
+
+// Dict is an ordered dict, which keeps the insertion order of the keys like Python.
+type Dict struct {
+	keys []string
+	m    map[string]any
+	// call is the function of calling the Dict,
+	// e.g. the loop variable of a recursive loop.
+	call Func
+}
+
+// NewDict returns an empty Dict.
+func NewDict() *Dict {
+	return &Dict{m: map[string]any{}}
+}
+
+// Len returns the number of the items.
+func (d *Dict) Len() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.keys)
+}
+
+// Keys returns the keys in insertion order.
+func (d *Dict) Keys() []string {
+	if d == nil {
+		return nil
+	}
+	return d.keys
+}
+
+// Get returns the value of the given key.
+func (d *Dict) Get(k string) (any, bool) {
+	if d == nil {
+		return nil, false
+	}
+	v, ok := d.m[k]
+	return v, ok
+}
+
+// Set sets the value of the given key,
+// the key is appended if it is new.
+func (d *Dict) Set(k string, v any) {
+	if _, ok := d.m[k]; !ok {
+		d.keys = append(d.keys, k)
+	}
+	d.m[k] = v
+}
+
+// Clone returns a shallow copy of the Dict.
+func (d *Dict) Clone() *Dict {
+	c := &Dict{keys: slices.Clone(d.keys), m: make(map[string]any, len(d.m)), call: d.call}
+	for k, v := range d.m {
+		c.m[k] = v
+	}
+	return c
+}
+
+// FromJSON decodes the given JSON into a template value,
+// the key order of the objects is kept.
+func FromJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("invalid JSON: trailing data")
+	}
+	return v, nil
+}
+
+// FromGo converts the given Go value into a template value via JSON,
+// the struct fields keep their order, while the map keys are sorted.
+//
+// A json.RawMessage keeps the key order of the objects.
+func FromGo(v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return FromJSON(bs)
+}
+
+func decodeJSON(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			d := NewDict()
+			for dec.More() {
+				kt, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				d.Set(kt.(string), v)
+			}
+			_, err = dec.Token()
+			return d, err
+		case '[':
+			l := []any{}
+			for dec.More() {
+				v, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				l = append(l, v)
+			}
+			_, err = dec.Token()
+			return l, err
+		}
+		return nil, fmt.Errorf("invalid JSON: unexpected %v", t)
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		return t.Float64()
+	default:
+		// String, bool or nil.
+		return t, nil
+	}
+}
+
+// truthy returns the truth value of the given value like Python.
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case nil, Undefined:
+		return false
+	case bool:
+		return t
+	case int64:
+		return t != 0
+	case float64:
+		return t != 0
+	case string:
+		return t != ""
+	case []any:
+		return len(t) != 0
+	case Tuple:
+		return len(t) != 0
+	case *Dict:
+		return t.Len() != 0
+	}
+	return true
+}
+
+// toString returns the str() of the given value like Python.
+func toString(v any) string {
+	switch t := v.(type) {
+	case Undefined:
+		return ""
+	case string:
+		return t
+	}
+	return repr(v)
+}
+
+// repr returns the repr() of the given value like Python.
+func repr(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "None"
+	case Undefined:
+		return ""
+	case bool:
+		if t {
+			return "True"
+		}
+		return "False"
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float64:
+		return formatFloat(t)
+	case string:
+		q := "'"
+		if strings.Contains(t, "'") && !strings.Contains(t, `"`) {
+			q = `"`
+		}
+		var sb strings.Builder
+		sb.WriteString(q)
+		for _, r := range t {
+			switch {
+			case r == '\\':
+				sb.WriteString(`\\`)
+			case string(r) == q:
+				sb.WriteString(`\` + q)
+			case r == '\n':
+				sb.WriteString(`\n`)
+			case r == '\r':
+				sb.WriteString(`\r`)
+			case r == '\t':
+				sb.WriteString(`\t`)
+			case r < 0x20 || r == 0x7f:
+				fmt.Fprintf(&sb, `\x%02x`, r)
+			default:
+				sb.WriteRune(r)
+			}
+		}
+		sb.WriteString(q)
+		return sb.String()
+	case []any:
+		ss := make([]string, len(t))
+		for i := range t {
+			ss[i] = repr(t[i])
+		}
+		return "[" + strings.Join(ss, ", ") + "]"
+	case Tuple:
+		if len(t) == 1 {
+			return "(" + repr(t[0]) + ",)"
+		}
+		ss := make([]string, len(t))
+		for i := range t {
+			ss[i] = repr(t[i])
+		}
+		return "(" + strings.Join(ss, ", ") + ")"
+	case *Dict:
+		ss := make([]string, 0, t.Len())
+		for _, k := range t.keys {
+			ss = append(ss, repr(k)+": "+repr(t.m[k]))
+		}
+		return "{" + strings.Join(ss, ", ") + "}"
+	case Func:
+		return "<function>"
+	}
+	return fmt.Sprint(v)
+}
+
+// formatFloat formats the given float like Python repr.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	if a := math.Abs(f); a != 0 && (a >= 1e16 || a < 1e-4) {
+		s := strconv.FormatFloat(f, 'e', -1, 64)
+		// Python pads the exponent to 2 digits, the same as Go.
+		return s
+	}
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// toJSON returns the json.dumps() of the given value like Python,
+// with ensure_ascii=False.
+func toJSON(v any, indent string, sortKeys bool, itemSep, keySep string) (string, error) {
+	var sb strings.Builder
+	if err := writeJSON(&sb, v, indent, "", sortKeys, itemSep, keySep); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func writeJSON(sb *strings.Builder, v any, indent, prefix string, sortKeys bool, itemSep, keySep string) error {
+	nl := func(p string) {
+		if indent != "" {
+			sb.WriteString("\n")
+			sb.WriteString(p)
+		}
+	}
+	switch t := v.(type) {
+	case nil, Undefined:
+		sb.WriteString("null")
+	case bool:
+		sb.WriteString(strconv.FormatBool(t))
+	case int64:
+		sb.WriteString(strconv.FormatInt(t, 10))
+	case float64:
+		switch {
+		case math.IsNaN(t):
+			sb.WriteString("NaN")
+		case math.IsInf(t, 1):
+			sb.WriteString("Infinity")
+		case math.IsInf(t, -1):
+			sb.WriteString("-Infinity")
+		default:
+			sb.WriteString(formatFloat(t))
+		}
+	case string:
+		writeJSONString(sb, t)
+	case Tuple:
+		return writeJSON(sb, []any(t), indent, prefix, sortKeys, itemSep, keySep)
+	case []any:
+		if len(t) == 0 {
+			sb.WriteString("[]")
+			return nil
+		}
+		sb.WriteString("[")
+		for i := range t {
+			if i > 0 {
+				sb.WriteString(itemSep)
+			}
+			nl(prefix + indent)
+			if err := writeJSON(sb, t[i], indent, prefix+indent, sortKeys, itemSep, keySep); err != nil {
+				return err
+			}
+		}
+		nl(prefix)
+		sb.WriteString("]")
+	case *Dict:
+		if t.Len() == 0 {
+			sb.WriteString("{}")
+			return nil
+		}
+		keys := t.keys
+		if sortKeys {
+			keys = slices.Clone(keys)
+			sort.Strings(keys)
+		}
+		sb.WriteString("{")
+		for i, k := range keys {
+			if i > 0 {
+				sb.WriteString(itemSep)
+			}
+			nl(prefix + indent)
+			writeJSONString(sb, k)
+			sb.WriteString(keySep)
+			if err := writeJSON(sb, t.m[k], indent, prefix+indent, sortKeys, itemSep, keySep); err != nil {
+				return err
+			}
+		}
+		nl(prefix)
+		sb.WriteString("}")
+	default:
+		return fmt.Errorf("object of type %T is not JSON serializable", v)
+	}
+	return nil
+}
+
+func writeJSONString(sb *strings.Builder, s string) {
+	sb.WriteString(`"`)
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(sb, `\u%04x`, r)
+				continue
+			}
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteString(`"`)
+}
+
+// typeName returns the Python type name of the given value.
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "NoneType"
+	case Undefined:
+		return "Undefined"
+	case bool:
+		return "bool"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "str"
+	case []any:
+		return "list"
+	case Tuple:
+		return "tuple"
+	case *Dict:
+		return "dict"
+	case Func:
+		return "function"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// toNumber returns the given value as int64 or float64.
+func toNumber(v any) (any, bool) {
+	switch t := v.(type) {
+	case bool:
+		if t {
+			return int64(1), true
+		}
+		return int64(0), true
+	case int64, float64:
+		return t, true
+	}
+	return nil, false
+}
+
+func toFloat(v any) (float64, bool) {
+	n, ok := toNumber(v)
+	if !ok {
+		return 0, false
+	}
+	if i, ok := n.(int64); ok {
+		return float64(i), true
+	}
+	return n.(float64), true
+}
+
+// equal reports whether the given values are equal like Python.
+func equal(x, y any) bool {
+	if xn, ok := toNumber(x); ok {
+		if yn, ok := toNumber(y); ok {
+			xi, xok := xn.(int64)
+			yi, yok := yn.(int64)
+			if xok && yok {
+				return xi == yi
+			}
+			xf, _ := toFloat(xn)
+			yf, _ := toFloat(yn)
+			return xf == yf
+		}
+		return false
+	}
+	switch xt := x.(type) {
+	case nil:
+		return y == nil
+	case Undefined:
+		_, ok := y.(Undefined)
+		return ok
+	case string:
+		yt, ok := y.(string)
+		return ok && xt == yt
+	case []any:
+		yt, ok := y.([]any)
+		return ok && equalItems(xt, yt)
+	case Tuple:
+		yt, ok := y.(Tuple)
+		return ok && equalItems(xt, yt)
+	case *Dict:
+		yt, ok := y.(*Dict)
+		if !ok || xt.Len() != yt.Len() {
+			return false
+		}
+		for _, k := range xt.keys {
+			yv, ok := yt.m[k]
+			if !ok || !equal(xt.m[k], yv) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// equalItems reports whether the given items are equal one by one.
+func equalItems(x, y []any) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if !equal(x[i], y[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// compare returns the order of the given values,
+// only numbers, strings, lists and tuples are comparable.
+func compare(x, y any) (int, error) {
+	if xf, ok := toFloat(x); ok {
+		if yf, ok := toFloat(y); ok {
+			switch {
+			case xf < yf:
+				return -1, nil
+			case xf > yf:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	switch xt := x.(type) {
+	case string:
+		if yt, ok := y.(string); ok {
+			return strings.Compare(xt, yt), nil
+		}
+	case []any:
+		if yt, ok := y.([]any); ok {
+			return compareItems(xt, yt)
+		}
+	case Tuple:
+		if yt, ok := y.(Tuple); ok {
+			return compareItems(xt, yt)
+		}
+	}
+	return 0, fmt.Errorf("'<' not supported between instances of '%s' and '%s'", typeName(x), typeName(y))
+}
+
+// compareItems returns the lexicographical order of the given items.
+func compareItems(x, y []any) (int, error) {
+	for i := 0; i < len(x) && i < len(y); i++ {
+		c, err := compare(x[i], y[i])
+		if err != nil || c != 0 {
+			return c, err
+		}
+	}
+	return len(x) - len(y), nil
+}
+
+// iterate returns the items of the given iterable value,
+// the keys are returned for a dict.
+func iterate(v any) ([]any, error) {
+	switch t := v.(type) {
+	case Undefined:
+		return nil, nil
+	case []any:
+		return t, nil
+	case Tuple:
+		return t, nil
+	case *Dict:
+		l := make([]any, t.Len())
+		for i, k := range t.keys {
+			l[i] = k
+		}
+		return l, nil
+	case string:
+		rs := []rune(t)
+		l := make([]any, len(rs))
+		for i := range rs {
+			l[i] = string(rs[i])
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("'%s' object is not iterable", typeName(v))
+}
+
+// contains reports whether the given container contains the given item like Python "in".
+func contains(container, item any) (bool, error) {
+	switch t := container.(type) {
+	case string:
+		s, ok := item.(string)
+		if !ok {
+			return false, fmt.Errorf("'in <string>' requires string as left operand, not %s", typeName(item))
+		}
+		return strings.Contains(t, s), nil
+	case []any, Tuple:
+		l, _ := iterate(t)
+		for i := range l {
+			if equal(l[i], item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case *Dict:
+		s, ok := item.(string)
+		if !ok {
+			return false, nil
+		}
+		_, ok = t.m[s]
+		return ok, nil
+	case Undefined:
+		return false, nil
+	}
+	return false, fmt.Errorf("argument of type '%s' is not iterable", typeName(container))
+}